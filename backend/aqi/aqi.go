@@ -0,0 +1,189 @@
+// Package aqi computes air quality indices from pollutant concentrations.
+//
+// Each standard maps a pollutant's concentration onto a sub-index by linear
+// interpolation inside a breakpoint table:
+//
+//	I = (IHigh-ILow)/(CHigh-CLow) * (C-CLow) + ILow
+//
+// and the index is the highest sub-index, whose pollutant is the dominant
+// one. The Thai PCD and US EPA tables for PM2.5 and PM10 are built in; either
+// can be replaced at startup with Configure or LoadFile. Inputs are the
+// averages the standard is defined on (24 hours for PM in both standards).
+package aqi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Pollutant names a pollutant by the column it is read from.
+type Pollutant string
+
+const (
+	PM25 Pollutant = "pm25"
+	PM10 Pollutant = "pm10"
+)
+
+// Pollutants lists the pollutants a table may be defined for, in the order
+// ties for the dominant pollutant are broken.
+var Pollutants = []Pollutant{PM25, PM10}
+
+// Breakpoint maps the concentration band [CLow, CHigh] (µg/m³) onto the index
+// band [ILow, IHigh].
+type Breakpoint struct {
+	CLow  float64 `json:"c_low"`
+	CHigh float64 `json:"c_high"`
+	ILow  int     `json:"i_low"`
+	IHigh int     `json:"i_high"`
+}
+
+// Table is the breakpoint table of one pollutant. Concentrations are
+// truncated to Decimals places before the lookup, which is how the published
+// tables close the gaps between bands (35.4 / 35.5).
+type Table struct {
+	Decimals    int          `json:"decimals"`
+	Breakpoints []Breakpoint `json:"breakpoints"`
+}
+
+// Category is an index band with a stable name for clients to style;
+// an index belongs to the first category whose Max it does not exceed.
+type Category struct {
+	Max  int    `json:"max"`
+	Name string `json:"name"`
+}
+
+// Standard is a set of breakpoint tables and the categories of the index.
+type Standard struct {
+	Code       string              `json:"-"`
+	Name       string              `json:"name"`
+	Tables     map[Pollutant]Table `json:"tables"`
+	Categories []Category          `json:"categories"`
+}
+
+// Result is an index with the sub-index of every pollutant that had a value.
+// Dominant is empty (and AQI 0) when none had.
+type Result struct {
+	Standard   string            `json:"standard"`
+	AQI        int               `json:"aqi"`
+	Category   string            `json:"category,omitempty"`
+	Dominant   Pollutant         `json:"dominant_pollutant,omitempty"`
+	SubIndices map[Pollutant]int `json:"sub_indices"`
+}
+
+// DefaultStandard is used when a request does not name one.
+const DefaultStandard = "th"
+
+// ErrUnknownStandard is returned by Parse for a code without tables.
+var ErrUnknownStandard = errors.New("unknown AQI standard")
+
+var (
+	mu        sync.RWMutex
+	standards = map[string]Standard{"th": thai, "us": usEPA}
+)
+
+// Parse returns the standard named by code ("th", "us" or a configured one,
+// case-insensitive); empty selects DefaultStandard.
+func Parse(code string) (Standard, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		code = DefaultStandard
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := standards[code]
+	if !ok {
+		return Standard{}, fmt.Errorf("%w %q: use %s", ErrUnknownStandard, code, strings.Join(codes(), " or "))
+	}
+	return s, nil
+}
+
+func codes() []string {
+	out := make([]string, 0, len(standards))
+	for code := range standards {
+		out = append(out, code)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SubIndex returns the sub-index of concentration c of p. Values above the
+// table are reported at its top index. It is false when the standard has no
+// table for p or c is negative or NaN.
+func (s Standard) SubIndex(p Pollutant, c float64) (int, bool) {
+	t, ok := s.Tables[p]
+	if !ok || len(t.Breakpoints) == 0 || c < 0 || math.IsNaN(c) {
+		return 0, false
+	}
+	scale := math.Pow(10, float64(t.Decimals))
+	c = math.Floor(c*scale+1e-9) / scale
+
+	for _, b := range t.Breakpoints {
+		if c > b.CHigh {
+			continue
+		}
+		if c < b.CLow {
+			// Between two bands of a table with coarser steps than Decimals.
+			c = b.CLow
+		}
+		if b.CHigh == b.CLow {
+			return b.ILow, true
+		}
+		i := float64(b.IHigh-b.ILow)/(b.CHigh-b.CLow)*(c-b.CLow) + float64(b.ILow)
+		return int(math.Round(i)), true
+	}
+	return t.Breakpoints[len(t.Breakpoints)-1].IHigh, true
+}
+
+// Compute returns the index of the given concentrations. Pollutants that are
+// missing from c, or have no table in s, are left out.
+func (s Standard) Compute(c map[Pollutant]float64) Result {
+	r := Result{Standard: s.Code, SubIndices: map[Pollutant]int{}}
+	for _, p := range Pollutants {
+		v, ok := c[p]
+		if !ok {
+			continue
+		}
+		i, ok := s.SubIndex(p, v)
+		if !ok {
+			continue
+		}
+		r.SubIndices[p] = i
+		if r.Dominant == "" || i > r.AQI {
+			r.AQI, r.Dominant = i, p
+		}
+	}
+	if r.Dominant != "" {
+		r.Category = s.Category(r.AQI)
+	}
+	return r
+}
+
+// Category names the band of index i; above the last band it is the last.
+func (s Standard) Category(i int) string {
+	for _, c := range s.Categories {
+		if i <= c.Max {
+			return c.Name
+		}
+	}
+	if n := len(s.Categories); n > 0 {
+		return s.Categories[n-1].Name
+	}
+	return ""
+}
+
+// PM returns the concentrations map of PM2.5 and PM10 averages, leaving out
+// nil and non-positive values (sensors report 0 for "no reading").
+func PM(pm25, pm10 *float64) map[Pollutant]float64 {
+	c := make(map[Pollutant]float64, 2)
+	if pm25 != nil && *pm25 > 0 {
+		c[PM25] = *pm25
+	}
+	if pm10 != nil && *pm10 > 0 {
+		c[PM10] = *pm10
+	}
+	return c
+}
@@ -0,0 +1,156 @@
+package aqi
+
+import "testing"
+
+// edge is a concentration at a breakpoint and the sub-index it must give.
+type edge struct {
+	c    float64
+	want int
+}
+
+func TestSubIndexBreakpointEdges(t *testing.T) {
+	tests := []struct {
+		std   string
+		p     Pollutant
+		edges []edge
+	}{
+		{"th", PM25, []edge{
+			{0, 0}, {15, 25},
+			{15.1, 26}, {25, 50},
+			{25.1, 51}, {37.5, 100},
+			{37.6, 101}, {75, 200},
+			{75.1, 201}, {500, 500},
+		}},
+		{"th", PM10, []edge{
+			{0, 0}, {50, 25},
+			{51, 26}, {80, 50},
+			{81, 51}, {120, 100},
+			{121, 101}, {180, 200},
+			{181, 201}, {600, 500},
+		}},
+		{"us", PM25, []edge{
+			{0, 0}, {9.0, 50},
+			{9.1, 51}, {35.4, 100},
+			{35.5, 101}, {55.4, 150},
+			{55.5, 151}, {125.4, 200},
+			{125.5, 201}, {225.4, 300},
+			{225.5, 301}, {325.4, 500},
+		}},
+		{"us", PM10, []edge{
+			{0, 0}, {54, 50},
+			{55, 51}, {154, 100},
+			{155, 101}, {254, 150},
+			{255, 151}, {354, 200},
+			{355, 201}, {424, 300},
+			{425, 301}, {604, 500},
+		}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.std)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range tt.edges {
+			got, ok := s.SubIndex(tt.p, e.c)
+			if !ok || got != e.want {
+				t.Errorf("%s %s SubIndex(%v) = %d, %v; want %d", tt.std, tt.p, e.c, got, ok, e.want)
+			}
+		}
+	}
+}
+
+func TestSubIndexTruncation(t *testing.T) {
+	tests := []struct {
+		std  string
+		p    Pollutant
+		c    float64
+		want int
+	}{
+		// Truncated, not rounded: 35.49 is 35.4 and stays in the lower band.
+		{"us", PM25, 35.49, 100},
+		{"us", PM25, 9.09, 50},
+		{"th", PM25, 37.59, 100},
+		{"th", PM25, 15.05, 25},
+		// PM10 is truncated to whole µg/m³.
+		{"us", PM10, 54.9, 50},
+		{"th", PM10, 120.7, 100},
+		{"th", PM10, 50.99, 25},
+		// Inside a band: linear interpolation, rounded to the nearest index.
+		{"us", PM25, 12.0, 56},
+		{"th", PM25, 50.0, 134},
+		// Above the table: its top index.
+		{"us", PM25, 1000, 500},
+		{"th", PM10, 900, 500},
+	}
+	for _, tt := range tests {
+		s, _ := Parse(tt.std)
+		got, ok := s.SubIndex(tt.p, tt.c)
+		if !ok || got != tt.want {
+			t.Errorf("%s %s SubIndex(%v) = %d, %v; want %d", tt.std, tt.p, tt.c, got, ok, tt.want)
+		}
+	}
+}
+
+func TestSubIndexInvalid(t *testing.T) {
+	s, _ := Parse("th")
+	for _, c := range []float64{-0.1, -50} {
+		if _, ok := s.SubIndex(PM25, c); ok {
+			t.Errorf("SubIndex(%v) ok, want false", c)
+		}
+	}
+	if _, ok := s.SubIndex("o3", 10); ok {
+		t.Error("SubIndex of a pollutant without a table ok, want false")
+	}
+}
+
+func TestCompute(t *testing.T) {
+	us, _ := Parse("us")
+	r := us.Compute(PM(f(35.5), f(60)))
+	if r.AQI != 101 || r.Dominant != PM25 || r.Category != "unhealthy_for_sensitive_groups" ||
+		r.SubIndices[PM25] != 101 || r.SubIndices[PM10] != 53 {
+		t.Errorf("Compute = %+v", r)
+	}
+
+	th, _ := Parse("")
+	r = th.Compute(PM(nil, f(121)))
+	if r.Standard != "th" || r.AQI != 101 || r.Dominant != PM10 || r.Category != "starting_to_affect_health" {
+		t.Errorf("Compute = %+v", r)
+	}
+
+	// Zero and missing values are no data.
+	r = th.Compute(PM(f(0), nil))
+	if r.AQI != 0 || r.Dominant != "" || r.Category != "" || len(r.SubIndices) != 0 {
+		t.Errorf("Compute without data = %+v", r)
+	}
+}
+
+func TestCategory(t *testing.T) {
+	th, _ := Parse("th")
+	us, _ := Parse("us")
+	tests := []struct {
+		s    Standard
+		i    int
+		want string
+	}{
+		{th, 0, "very_good"}, {th, 25, "very_good"}, {th, 26, "good"},
+		{th, 100, "moderate"}, {th, 101, "starting_to_affect_health"}, {th, 201, "affects_health"},
+		{us, 50, "good"}, {us, 51, "moderate"}, {us, 150, "unhealthy_for_sensitive_groups"},
+		{us, 300, "very_unhealthy"}, {us, 301, "hazardous"}, {us, 999, "hazardous"},
+	}
+	for _, tt := range tests {
+		if got := tt.s.Category(tt.i); got != tt.want {
+			t.Errorf("%s Category(%d) = %q, want %q", tt.s.Code, tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, code := range []string{"", "th", "TH", " us "} {
+		if _, err := Parse(code); err != nil {
+			t.Errorf("Parse(%q): %v", code, err)
+		}
+	}
+	if _, err := Parse("eu"); err == nil {
+		t.Error("Parse(eu) succeeded, want ErrUnknownStandard")
+	}
+}
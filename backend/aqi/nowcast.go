@@ -0,0 +1,57 @@
+package aqi
+
+import "math"
+
+// NowCastHours is how many hourly averages the NowCast looks back over.
+const NowCastHours = 12
+
+// nowCastMinWeight is the lower bound of the weight factor for particulate
+// matter, and nowCastDecimals the precision the result is truncated to.
+const nowCastMinWeight = 0.5
+
+var nowCastDecimals = map[Pollutant]int{PM25: 1, PM10: 0}
+
+// NowCast returns the US EPA NowCast concentration of p from hourly averages,
+// newest first: hourly[0] is the current hour and nil marks an hour without
+// data. Only the first NowCastHours are used. The weight factor is the
+// minimum over the maximum concentration of those hours, at least 0.5, and
+// hour i counts with weight^i. It is false unless at least two of the three
+// most recent hours have data.
+func NowCast(p Pollutant, hourly []*float64) (float64, bool) {
+	if len(hourly) > NowCastHours {
+		hourly = hourly[:NowCastHours]
+	}
+	recent := 0
+	for i := 0; i < 3 && i < len(hourly); i++ {
+		if hourly[i] != nil {
+			recent++
+		}
+	}
+	if recent < 2 {
+		return 0, false
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, c := range hourly {
+		if c == nil {
+			continue
+		}
+		lo, hi = math.Min(lo, *c), math.Max(hi, *c)
+	}
+	weight := 1.0
+	if hi > 0 {
+		weight = math.Max(lo/hi, nowCastMinWeight)
+	}
+
+	var sum, weights float64
+	for i, c := range hourly {
+		if c == nil {
+			continue
+		}
+		w := math.Pow(weight, float64(i))
+		sum += w * *c
+		weights += w
+	}
+	scale := math.Pow(10, float64(nowCastDecimals[p]))
+	return math.Floor(sum/weights*scale+1e-9) / scale, true
+}
@@ -0,0 +1,105 @@
+package aqi
+
+import "testing"
+
+func f(v float64) *float64 { return &v }
+
+func hours(vals ...float64) []*float64 {
+	out := make([]*float64, len(vals))
+	for i, v := range vals {
+		out[i] = f(v)
+	}
+	return out
+}
+
+func TestNowCast(t *testing.T) {
+	tests := []struct {
+		name   string
+		p      Pollutant
+		hourly []*float64
+		want   float64
+		ok     bool
+	}{
+		{
+			// Weight 35/45 = 0.778; Σ wⁱcᵢ / Σ wⁱ = 40.42, truncated to 0.1.
+			name:   "EPA method, weight above the floor",
+			p:      PM25,
+			hourly: hours(40, 38, 42, 45, 44, 41, 39, 37, 36, 35, 38, 40),
+			want:   40.4,
+			ok:     true,
+		},
+		{
+			// Weight 64/100 = 0.64: (80 + 0.64·64 + 0.4096·100) / 2.0496 = 79.0.
+			name:   "EPA method, three hours of PM10",
+			p:      PM10,
+			hourly: hours(80, 64, 100),
+			want:   79,
+			ok:     true,
+		},
+		{
+			// 14.1/30.5 = 0.46 is raised to the 0.5 floor.
+			name:   "weight floor of 0.5",
+			p:      PM25,
+			hourly: hours(22.1, 18.4, 30.5, 25.0, 19.2, 15.8, 14.1, 16.9, 20.3, 24.7, 28.0, 26.2),
+			want:   22.1,
+			ok:     true,
+		},
+		{
+			// Weight 60/120 = 0.5; hours 0, 2, 4 and 11 weigh 1, 0.25, 0.0625, 0.5¹¹.
+			name:   "missing hours are skipped",
+			p:      PM10,
+			hourly: []*float64{f(120), nil, f(60), nil, f(90), nil, nil, nil, nil, nil, nil, f(75)},
+			want:   107,
+			ok:     true,
+		},
+		{
+			name:   "two of the three most recent hours suffice",
+			p:      PM25,
+			hourly: []*float64{nil, f(12.5), f(14.0)},
+			want:   13.2,
+			ok:     true,
+		},
+		{
+			name:   "only one of the three most recent hours",
+			p:      PM25,
+			hourly: []*float64{f(12.5), nil, nil, f(14.0), f(15.0), f(16.0)},
+			ok:     false,
+		},
+		{
+			name:   "no data",
+			p:      PM25,
+			hourly: make([]*float64, NowCastHours),
+			ok:     false,
+		},
+		{
+			name:   "constant input",
+			p:      PM25,
+			hourly: hours(27.3, 27.3, 27.3, 27.3, 27.3, 27.3, 27.3, 27.3, 27.3, 27.3, 27.3, 27.3),
+			want:   27.3,
+			ok:     true,
+		},
+		{
+			name:   "constant zero input",
+			p:      PM10,
+			hourly: hours(0, 0, 0),
+			want:   0,
+			ok:     true,
+		},
+		{
+			// The 13th hour (500) is beyond NowCastHours and ignored.
+			name:   "only twelve hours are used",
+			p:      PM25,
+			hourly: hours(5, 50, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 500),
+			want:   16.2,
+			ok:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := NowCast(tt.p, tt.hourly)
+			if ok != tt.ok || (ok && got != tt.want) {
+				t.Errorf("NowCast(%s) = %v, %v; want %v, %v", tt.p, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package aqi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// thai is the Pollution Control Department index (PM2.5 bands as revised in
+// June 2023). PCD leaves the top band open ("201 ขึ้นไป"); it is closed here
+// at AQI 500 for 500 µg/m³ PM2.5 and 600 µg/m³ PM10.
+var thai = Standard{
+	Code: "th",
+	Name: "Thailand PCD AQI",
+	Tables: map[Pollutant]Table{
+		PM25: {Decimals: 1, Breakpoints: []Breakpoint{
+			{0, 15, 0, 25},
+			{15.1, 25, 26, 50},
+			{25.1, 37.5, 51, 100},
+			{37.6, 75, 101, 200},
+			{75.1, 500, 201, 500},
+		}},
+		PM10: {Decimals: 0, Breakpoints: []Breakpoint{
+			{0, 50, 0, 25},
+			{51, 80, 26, 50},
+			{81, 120, 51, 100},
+			{121, 180, 101, 200},
+			{181, 600, 201, 500},
+		}},
+	},
+	Categories: []Category{
+		{25, "very_good"},
+		{50, "good"},
+		{100, "moderate"},
+		{200, "starting_to_affect_health"},
+		{500, "affects_health"},
+	},
+}
+
+// usEPA is the US EPA index with the PM2.5 bands of the 2024 revision.
+var usEPA = Standard{
+	Code: "us",
+	Name: "US EPA AQI",
+	Tables: map[Pollutant]Table{
+		PM25: {Decimals: 1, Breakpoints: []Breakpoint{
+			{0, 9.0, 0, 50},
+			{9.1, 35.4, 51, 100},
+			{35.5, 55.4, 101, 150},
+			{55.5, 125.4, 151, 200},
+			{125.5, 225.4, 201, 300},
+			{225.5, 325.4, 301, 500},
+		}},
+		PM10: {Decimals: 0, Breakpoints: []Breakpoint{
+			{0, 54, 0, 50},
+			{55, 154, 51, 100},
+			{155, 254, 101, 150},
+			{255, 354, 151, 200},
+			{355, 424, 201, 300},
+			{425, 604, 301, 500},
+		}},
+	},
+	Categories: []Category{
+		{50, "good"},
+		{100, "moderate"},
+		{150, "unhealthy_for_sensitive_groups"},
+		{200, "unhealthy"},
+		{300, "very_unhealthy"},
+		{500, "hazardous"},
+	},
+}
+
+// Configure overrides standards by code. For an existing standard only the
+// parts given are replaced (a pollutant's table, the categories, the name); a
+// new code must bring at least one table. Configure is meant for startup and
+// validates everything before changing anything.
+func Configure(overrides map[string]Standard) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	next := make(map[string]Standard, len(standards)+len(overrides))
+	for code, s := range standards {
+		next[code] = s
+	}
+	for code, o := range overrides {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if code == "" {
+			return fmt.Errorf("aqi: empty standard code")
+		}
+		s, ok := next[code]
+		if !ok {
+			s = Standard{Code: code, Name: code}
+		}
+		tables := make(map[Pollutant]Table, len(s.Tables)+len(o.Tables))
+		for p, t := range s.Tables {
+			tables[p] = t
+		}
+		for p, t := range o.Tables {
+			if !knownPollutant(p) {
+				return fmt.Errorf("aqi: %s: unknown pollutant %q", code, p)
+			}
+			if err := t.validate(); err != nil {
+				return fmt.Errorf("aqi: %s %s: %w", code, p, err)
+			}
+			tables[p] = t
+		}
+		if len(tables) == 0 {
+			return fmt.Errorf("aqi: %s: no breakpoint tables", code)
+		}
+		s.Tables = tables
+		if o.Name != "" {
+			s.Name = o.Name
+		}
+		if len(o.Categories) > 0 {
+			for i := 1; i < len(o.Categories); i++ {
+				if o.Categories[i].Max <= o.Categories[i-1].Max {
+					return fmt.Errorf("aqi: %s: categories must have increasing max", code)
+				}
+			}
+			s.Categories = o.Categories
+		}
+		next[code] = s
+	}
+	standards = next
+	return nil
+}
+
+// LoadFile applies the overrides in the JSON file at path, keyed by standard
+// code:
+//
+//	{"th": {"tables": {"pm25": {"decimals": 1, "breakpoints": [
+//	    {"c_low": 0, "c_high": 15, "i_low": 0, "i_high": 25}, ...]}}}}
+func LoadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var overrides map[string]Standard
+	if err := json.Unmarshal(b, &overrides); err != nil {
+		return fmt.Errorf("aqi: %s: %w", path, err)
+	}
+	return Configure(overrides)
+}
+
+func knownPollutant(p Pollutant) bool {
+	for _, k := range Pollutants {
+		if k == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Table) validate() error {
+	if t.Decimals < 0 || t.Decimals > 6 {
+		return fmt.Errorf("decimals must be between 0 and 6")
+	}
+	if len(t.Breakpoints) == 0 {
+		return fmt.Errorf("no breakpoints")
+	}
+	for i, b := range t.Breakpoints {
+		if b.CLow < 0 || b.CHigh < b.CLow || b.IHigh < b.ILow {
+			return fmt.Errorf("breakpoint %d: bands must be non-negative and ascending", i)
+		}
+		if i > 0 {
+			prev := t.Breakpoints[i-1]
+			if b.CLow <= prev.CHigh || b.ILow <= prev.IHigh {
+				return fmt.Errorf("breakpoint %d overlaps the one before", i)
+			}
+		}
+	}
+	return nil
+}
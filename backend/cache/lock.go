@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript takes the lock when it is free, or extends it when this
+// holder already owns it.
+var acquireScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if not v then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Lock is a lease-based lock held in Redis under a random per-holder token,
+// used to elect a single leader across replicas.
+type Lock struct {
+	key   string
+	token string
+	ttl   time.Duration
+}
+
+// NewLock creates a lock handle for key; nothing is acquired until Acquire.
+func NewLock(key string, ttl time.Duration) *Lock {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return &Lock{key: key, token: hex.EncodeToString(b), ttl: ttl}
+}
+
+// TTL returns the lease duration.
+func (l *Lock) TTL() time.Duration { return l.ttl }
+
+// Acquire takes or renews the lease. It reports false when another holder owns it.
+func (l *Lock) Acquire(ctx context.Context) (bool, error) {
+	if Rdb == nil {
+		return false, errors.New("redis client is not initialized")
+	}
+	n, err := acquireScript.Run(ctx, Rdb, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Release drops the lease if this holder still owns it.
+func (l *Lock) Release(ctx context.Context) error {
+	if Rdb == nil {
+		return errors.New("redis client is not initialized")
+	}
+	return releaseScript.Run(ctx, Rdb, []string{l.key}, l.token).Err()
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"yakkaw_dashboard/config"
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/repository"
+	"yakkaw_dashboard/services"
+	"yakkaw_dashboard/utils"
+)
+
+// commands are maintenance subcommands of the backend binary, run as
+// `main <command> [flags]` instead of starting the server.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"backfill":   runBackfill,
+	"reprocess":  runReprocess,
+	"partitions": runPartitions,
+	"rollups":    runRollups,
+	"addresses":  runAddresses,
+	"migrate":    runMigrate,
+	"explain":    runExplain,
+	"anomalies":  runAnomalies,
+	"drift":      runDrift,
+}
+
+// runCommand executes a subcommand and returns the process exit code.
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		return 2
+	}
+
+	utils.SetupLogger()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd(ctx, args); err != nil {
+		utils.GetLogger().Errorf("%s: %v", name, err)
+		return 1
+	}
+	return 0
+}
+
+func runBackfill(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	format := fs.String("format", "", "input format: csv, json or ndjson (default: from file extension)")
+	dryRun := fs.Bool("dry-run", false, "parse and validate only; write nothing")
+	resume := fs.Bool("resume", true, "continue after the last committed record of a previous run")
+	batch := fs.Int("batch", 1000, "records per transaction")
+	source := fs.String("source", "backfill", "source label for quarantined rows")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: main backfill [flags] FILE...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no input files")
+	}
+
+	database.Init()
+	logger := utils.GetLogger()
+
+	var total services.BackfillStats
+	for _, file := range fs.Args() {
+		stats, err := services.BackfillFile(ctx, file, services.BackfillOptions{
+			Format:    *format,
+			DryRun:    *dryRun,
+			Resume:    *resume,
+			BatchSize: *batch,
+			Source:    *source,
+			Progress: func(s services.BackfillStats) {
+				logger.Infof("backfill %s: %d records (inserted %d, updated %d, skipped %d, quarantined %d) in %s",
+					s.File, s.Records, s.Inserted, s.Updated, s.Skipped, s.Quarantined, s.Elapsed.Round(time.Millisecond))
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w (committed up to record %d; rerun to resume)", file, err, stats.Committed)
+		}
+
+		logger.Infof("backfill %s done: %d records, resumed from %d, inserted %d, updated %d, skipped %d, quarantined %d, dry-run=%t, %s",
+			stats.File, stats.Records, stats.ResumedFrom, stats.Inserted, stats.Updated, stats.Skipped, stats.Quarantined, stats.DryRun, stats.Elapsed.Round(time.Millisecond))
+		total.Records += stats.Records - stats.ResumedFrom
+		total.Inserted += stats.Inserted
+		total.Updated += stats.Updated
+		total.Skipped += stats.Skipped
+		total.Quarantined += stats.Quarantined
+	}
+
+	logger.Infof("backfill summary: %d files, %d new records read, inserted %d, updated %d, skipped %d, quarantined %d",
+		fs.NArg(), total.Records, total.Inserted, total.Updated, total.Skipped, total.Quarantined)
+	return refreshRollups(ctx)
+}
+
+func runReprocess(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reprocess", flag.ContinueOnError)
+	from := fs.String("from", "", "start of the fetch window, RFC3339 or YYYY-MM-DD (Asia/Bangkok); required")
+	to := fs.String("to", "", "end of the fetch window (exclusive); default now")
+	source := fs.String("source", "", "only reprocess payloads of this source")
+	dryRun := fs.Bool("dry-run", false, "decode and validate only; write nothing")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: main reprocess -from TIME [-to TIME] [-source NAME] [-dry-run]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	start, err := parseTimeFlag(*from)
+	if err != nil {
+		fs.Usage()
+		return fmt.Errorf("-from: %w", err)
+	}
+	end := time.Now()
+	if *to != "" {
+		if end, err = parseTimeFlag(*to); err != nil {
+			return fmt.Errorf("-to: %w", err)
+		}
+	}
+	if !end.After(start) {
+		return fmt.Errorf("-to must be after -from")
+	}
+
+	sources, err := services.SourcesFromConfig(config.Get())
+	if err != nil {
+		return err
+	}
+
+	database.Init()
+	logger := utils.GetLogger()
+	began := time.Now()
+
+	stats, err := services.ReprocessPayloads(ctx, services.PayloadDecoders(sources), services.ReprocessOptions{
+		From:   start,
+		To:     end,
+		Source: *source,
+		DryRun: *dryRun,
+		Progress: func(s services.ReprocessStats) {
+			logger.Infof("reprocess: %d payloads, %d rows (inserted %d, updated %d, skipped %d, quarantined %d)",
+				s.Payloads, s.Rows, s.Inserted, s.Updated, s.Skipped, s.Quarantined)
+		},
+	})
+	logger.Infof("reprocess summary: %d payloads (%d undecodable, %d unknown source), %d rows, inserted %d, updated %d, skipped %d, quarantined %d, dead-lettered %d, dry-run=%t, %s",
+		stats.Payloads, stats.Undecodable, stats.Unknown, stats.Rows, stats.Inserted, stats.Updated, stats.Skipped,
+		stats.Quarantined, stats.DeadLetters, *dryRun, time.Since(began).Round(time.Millisecond))
+	if err != nil || *dryRun {
+		return err
+	}
+	return refreshRollups(ctx)
+}
+
+func runPartitions(ctx context.Context, args []string) error {
+	cfg := config.Get()
+	fs := flag.NewFlagSet("partitions", flag.ContinueOnError)
+	keep := fs.Int("keep-months", cfg.RetentionRawMonths, "months of raw readings to keep before the current one; 0 skips retention")
+	mode := fs.String("mode", cfg.RetentionMode, "retention mode: detach or drop")
+	ahead := fs.Int("ahead", cfg.PartitionAheadMonths, "monthly partitions to create ahead of the current month")
+	dryRun := fs.Bool("dry-run", false, "list the partitions that would be retired; change nothing")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: main partitions [-keep-months N] [-mode detach|drop] [-ahead N] [-dry-run]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	database.Init()
+	logger := utils.GetLogger()
+	now := time.Now()
+
+	if !*dryRun {
+		if err := database.EnsureReadingsPartitions(database.DB.WithContext(ctx), now, *ahead); err != nil {
+			return err
+		}
+	}
+	parts, err := database.ReadingsPartitions(database.DB.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if len(parts) > 0 {
+		logger.Infof("partitions: %d monthly partitions, %s to %s", len(parts), parts[0].Name, parts[len(parts)-1].Name)
+	}
+	if *keep == 0 {
+		logger.Infof("partitions: retention disabled")
+		return nil
+	}
+
+	retired, err := services.ApplyRetention(ctx, now, services.RetentionOptions{
+		KeepMonths: *keep,
+		Mode:       *mode,
+		DryRun:     *dryRun,
+	})
+	for _, r := range retired {
+		logger.Infof("partitions: %s %s (%d readings, %d stations), dry-run=%t", r.Mode, r.Name, r.Readings, r.Stations, *dryRun)
+	}
+	if err == nil && len(retired) == 0 {
+		logger.Infof("partitions: nothing older than %d months", *keep)
+	}
+	return err
+}
+
+func runRollups(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rollups", flag.ContinueOnError)
+	from := fs.String("from", "", "rebuild rollups for readings from this time, RFC3339 or YYYY-MM-DD (Asia/Bangkok)")
+	to := fs.String("to", "", "end of the rebuild window (exclusive); default now")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: main rollups [-from TIME [-to TIME]]")
+		fmt.Fprintln(fs.Output(), "Without -from, only the hours queued by ingestion are refreshed.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	database.Init()
+	if *from == "" {
+		return refreshRollups(ctx)
+	}
+
+	start, err := parseTimeFlag(*from)
+	if err != nil {
+		return fmt.Errorf("-from: %w", err)
+	}
+	end := time.Now()
+	if *to != "" {
+		if end, err = parseTimeFlag(*to); err != nil {
+			return fmt.Errorf("-to: %w", err)
+		}
+	}
+	if !end.After(start) {
+		return fmt.Errorf("-to must be after -from")
+	}
+
+	began := time.Now()
+	hours, err := services.RebuildRollups(ctx, start, end)
+	utils.GetLogger().Infof("rollups: rebuilt %d hours in %s", hours, time.Since(began).Round(time.Millisecond))
+	return err
+}
+
+func runAnomalies(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("anomalies", flag.ContinueOnError)
+	since := fs.String("since", "", "check readings from this time, RFC3339 or YYYY-MM-DD (Asia/Bangkok); default ANOMALY_RECHECK ago")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: main anomalies [-since TIME]")
+		fmt.Fprintln(fs.Output(), "Flags PM2.5 spikes against each device's rolling median; re-running clears flags that no longer hold.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := services.AnomalyOptionsFromConfig(config.Get())
+	start := time.Now().Add(-opts.Recheck)
+	if *since != "" {
+		var err error
+		if start, err = parseTimeFlag(*since); err != nil {
+			return fmt.Errorf("-since: %w", err)
+		}
+	}
+
+	database.Init()
+	began := time.Now()
+	rep, err := services.DetectAnomalies(repository.NewAnomalyRepository(database.DB.WithContext(ctx)), opts, start)
+	utils.GetLogger().Infof("anomalies: checked %d readings, flagged %d, cleared %d in %s",
+		rep.Checked, rep.Flagged, rep.Cleared, time.Since(began).Round(time.Millisecond))
+	return err
+}
+
+func runDrift(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("drift", flag.ContinueOnError)
+	until := fs.String("until", "", "end of the comparison window (exclusive day), RFC3339 or YYYY-MM-DD (Asia/Bangkok); default today")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: main drift [-until DAY]")
+		fmt.Fprintln(fs.Output(), "Compares each station's daily PM2.5 means with its neighbours' and replaces station_drift.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	end := time.Now()
+	if *until != "" {
+		var err error
+		if end, err = parseTimeFlag(*until); err != nil {
+			return fmt.Errorf("-until: %w", err)
+		}
+	}
+
+	database.Init()
+	rep, err := services.DetectDrift(repository.NewStationRepository(database.DB.WithContext(ctx)),
+		services.DriftOptionsFromConfig(config.Get()), end)
+	utils.GetLogger().Infof("drift: scored %d of %d stations, %d flagged for recalibration", rep.Scored, rep.Stations, rep.Flagged)
+	return err
+}
+
+func runAddresses(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("addresses", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: main addresses")
+		fmt.Fprintln(fs.Output(), "Re-parses every station address into province, district and subdistrict (e.g. after the")
+		fmt.Fprintln(fs.Output(), "parser learned a new spelling) and lists the addresses without a recognisable province.")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	database.Init()
+	logger := utils.GetLogger()
+	res, err := database.BackfillStationAddresses(database.DB.WithContext(ctx), true)
+	if err != nil {
+		return err
+	}
+	logger.Infof("addresses: parsed %d station versions, %d changed", res.Parsed, res.Changed)
+	for _, a := range res.Unparsed {
+		logger.Warnf("addresses: no province in %q", a)
+	}
+	return refreshRollups(ctx)
+}
+
+func runMigrate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: main migrate status|up|down [N]|to VERSION")
+		fmt.Fprintln(fs.Output(), "  status      list migrations and whether they are applied")
+		fmt.Fprintln(fs.Output(), "  up          apply every pending migration")
+		fmt.Fprintln(fs.Output(), "  down [N]    revert the last N applied migrations (default 1)")
+		fmt.Fprintln(fs.Output(), "  to VERSION  apply or revert migrations until VERSION is the latest applied")
+		fmt.Fprintln(fs.Output(), "The baseline 0001 cannot be reverted: down and to refuse, before changing")
+		fmt.Fprintln(fs.Output(), "anything, to go below it (the lowest target is `to 1`).")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no migrate action")
+	}
+
+	database.Connect()
+	db := database.DB.WithContext(ctx)
+	logger := utils.GetLogger()
+
+	var ran []database.Migration
+	var err error
+	switch action := fs.Arg(0); action {
+	case "status":
+		states, err := database.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			if s.Unknown {
+				state += " (unknown to this binary)"
+			}
+			fmt.Printf("%04d  %-40s %s\n", s.Version, s.Name, state)
+		}
+		return nil
+	case "up":
+		latest, lerr := database.LatestMigration()
+		if lerr != nil {
+			return lerr
+		}
+		ran, err = database.MigrateTo(db, latest)
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			if steps, err = strconv.Atoi(fs.Arg(1)); err != nil || steps < 1 {
+				return fmt.Errorf("down: N must be a positive number")
+			}
+		}
+		ran, err = database.MigrateDown(db, steps)
+	case "to":
+		if fs.NArg() < 2 {
+			return fmt.Errorf("to: VERSION required")
+		}
+		version, perr := strconv.Atoi(fs.Arg(1))
+		if perr != nil || version < 0 {
+			return fmt.Errorf("to: VERSION must be a migration number")
+		}
+		ran, err = database.MigrateTo(db, version)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate action %q", action)
+	}
+
+	if err == nil && len(ran) == 0 {
+		logger.Infof("migrate: nothing to do")
+	} else {
+		logger.Infof("migrate: ran %d migrations", len(ran))
+	}
+	return err
+}
+
+// refreshRollups applies the rollup updates queued by a command's writes.
+func refreshRollups(ctx context.Context) error {
+	hours, err := services.RefreshRollups(ctx)
+	utils.GetLogger().Infof("rollups: refreshed %d hours", hours)
+	return err
+}
+
+// bangkok is used for date-only command flags; the fixed offset keeps it
+// working in images without tzdata.
+var bangkok = time.FixedZone("Asia/Bangkok", 7*60*60)
+
+func parseTimeFlag(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, fmt.Errorf("value required")
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, bangkok)
+}
+
+func runExplain(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	analyze := fs.Bool("analyze", false, "execute the queries (EXPLAIN ANALYZE, BUFFERS) instead of only planning them")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: main explain [-analyze]")
+		fmt.Fprintln(fs.Output(), "Prints the query plans of representative dashboard queries filtering on the reading time")
+		fmt.Fprintln(fs.Output(), "computed from timestamp (before) and on the indexed reading_at column (after), and of the")
+		fmt.Fprintln(fs.Output(), "after form with the reading_at indexes dropped in a rolled-back transaction.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	database.Init()
+	plans, err := services.ExplainQueryPlans(ctx, *analyze)
+	services.WriteQueryPlans(os.Stdout, plans)
+	return err
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"encoding/json"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -21,6 +24,126 @@ type Config struct {
 	RedisHost         string
 	RedisPort         string
 	RedisPassword     string
+	IngestSources     []IngestSourceConfig
+	PipelineInterval  time.Duration
+	PipelineJitter    time.Duration
+	ShutdownTimeout   time.Duration
+	// Upstream fetch resilience (see services.UpstreamClient).
+	UpstreamTimeout          time.Duration
+	UpstreamMaxRetries       int
+	UpstreamRetryBackoff     time.Duration
+	UpstreamMaxBackoff       time.Duration
+	UpstreamBreakerThreshold int
+	UpstreamBreakerCooldown  time.Duration
+	// RefreshAllowedURLs lists the api_url values an admin may pass to the
+	// on-demand refresh endpoint (PIPELINE_REFRESH_ALLOWED_URLS, comma separated).
+	RefreshAllowedURLs []string
+	// Partition maintenance and raw-data retention (see services.RunPartitionMaintenance).
+	PartitionAheadMonths         int
+	PartitionMaintenanceInterval time.Duration
+	// RetentionRawMonths keeps this many whole months of raw readings before
+	// the current one; 0 disables retention.
+	RetentionRawMonths int
+	// RetentionMode is "detach" (keep the table outside readings) or "drop".
+	RetentionMode string
+	// AQIBreakpointsFile is a JSON file of AQI breakpoint overrides (see
+	// aqi.LoadFile); empty keeps the built-in Thai PCD and US EPA tables.
+	AQIBreakpointsFile string
+	// ComplianceStandards are the limits compliance reports count
+	// exceedances of (see loadComplianceStandards).
+	ComplianceStandards []ComplianceStandard
+	// PM2.5 spike detection (see services.DetectAnomalies): a reading is
+	// flagged when it exceeds the median of the station's readings in the
+	// preceding AnomalyWindow by more than AnomalyThreshold scaled MADs and by
+	// at least AnomalyMinDelta µg/m³. Each pipeline run rechecks the last
+	// AnomalyRecheck of readings.
+	AnomalyWindow     time.Duration
+	AnomalyMinSamples int
+	AnomalyThreshold  float64
+	AnomalyMinDelta   float64
+	AnomalyRecheck    time.Duration
+	// Drift detection against neighbouring stations (see
+	// services.DetectDrift): every DriftInterval, each station's daily PM2.5
+	// means over the last DriftWindowDays are compared with the median of the
+	// stations within DriftRadiusKM. A station is flagged for recalibration
+	// when it reads more than DriftThreshold (a fraction, 0.3 = 30%) above or
+	// below its neighbours, now or after another 30 days of its trend.
+	DriftInterval      time.Duration
+	DriftRadiusKM      float64
+	DriftWindowDays    int
+	DriftMinNeighbours int
+	DriftMinDays       int
+	DriftThreshold     float64
+}
+
+// IngestSourceConfig describes an extra ingestion source on top of the
+// built-in Yakkaw devices API. Sources are read from INGEST_SOURCES (inline
+// JSON array) or INGEST_SOURCES_FILE (path to the same JSON).
+type IngestSourceConfig struct {
+	Name string `json:"name"`
+	// Type is one of "yakkaw", "http" or "file".
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// Path and Format are used by file sources; Format is "json" or "ndjson"
+	// and defaults from the file extension.
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	// Headers are sent with every request; values may reference environment
+	// variables as ${NAME} so secrets stay out of the JSON.
+	Headers map[string]string `json:"headers"`
+	Timeout time.Duration     `json:"-"`
+	// RecordsPath is the dotted path to the array of readings in the upstream
+	// payload (e.g. "data.items"); empty means the payload itself is the array.
+	RecordsPath string `json:"records_path"`
+	// FieldMap maps models.SensorData JSON field names to dotted paths inside
+	// each upstream record. Unmapped fields are looked up by their own name.
+	FieldMap map[string]string `json:"field_map"`
+}
+
+// UnmarshalJSON accepts Timeout as a Go duration string ("15s").
+func (s *IngestSourceConfig) UnmarshalJSON(data []byte) error {
+	type alias IngestSourceConfig
+	aux := struct {
+		*alias
+		Timeout string `json:"timeout"`
+	}{alias: (*alias)(s)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Timeout != "" {
+		d, err := time.ParseDuration(aux.Timeout)
+		if err != nil {
+			return err
+		}
+		s.Timeout = d
+	}
+	return nil
+}
+
+// ComplianceStandard is a concentration limit compliance reports are checked
+// against. Standards are read from COMPLIANCE_STANDARDS (inline JSON array)
+// or COMPLIANCE_STANDARDS_FILE and default to DefaultComplianceStandards.
+type ComplianceStandard struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	// Pollutant is "pm25" or "pm10".
+	Pollutant string `json:"pollutant"`
+	// Period is the averaging period of Limit: "1h", "24h" or "annual".
+	Period string  `json:"period"`
+	Limit  float64 `json:"limit"`
+}
+
+// DefaultComplianceStandards are the Thai national ambient standards (PM2.5
+// as revised in 2023) and the WHO 2021 air quality guidelines, in µg/m³.
+var DefaultComplianceStandards = []ComplianceStandard{
+	{Code: "th_pm25_24h", Name: "Thailand PM2.5 24-hour", Pollutant: "pm25", Period: "24h", Limit: 37.5},
+	{Code: "th_pm25_annual", Name: "Thailand PM2.5 annual", Pollutant: "pm25", Period: "annual", Limit: 15},
+	{Code: "th_pm10_24h", Name: "Thailand PM10 24-hour", Pollutant: "pm10", Period: "24h", Limit: 120},
+	{Code: "th_pm10_annual", Name: "Thailand PM10 annual", Pollutant: "pm10", Period: "annual", Limit: 50},
+	{Code: "who_pm25_24h", Name: "WHO PM2.5 24-hour", Pollutant: "pm25", Period: "24h", Limit: 15},
+	{Code: "who_pm25_annual", Name: "WHO PM2.5 annual", Pollutant: "pm25", Period: "annual", Limit: 5},
+	{Code: "who_pm10_24h", Name: "WHO PM10 24-hour", Pollutant: "pm10", Period: "24h", Limit: 45},
+	{Code: "who_pm10_annual", Name: "WHO PM10 annual", Pollutant: "pm10", Period: "annual", Limit: 15},
 }
 
 var (
@@ -49,6 +172,56 @@ func Get() *Config {
 			RedisHost:         getEnv("REDIS_HOST", "localhost"),
 			RedisPort:         getEnv("REDIS_PORT", "6379"),
 			RedisPassword:     getEnv("REDIS_PASS", ""),
+			IngestSources:     loadIngestSources(),
+			PipelineInterval:  getDurationEnv("PIPELINE_INTERVAL", 5*time.Minute),
+			PipelineJitter:    getDurationEnv("PIPELINE_JITTER", 30*time.Second),
+			ShutdownTimeout:   getDurationEnv("SHUTDOWN_TIMEOUT", 15*time.Second),
+
+			UpstreamTimeout:          getDurationEnv("UPSTREAM_TIMEOUT", 20*time.Second),
+			UpstreamMaxRetries:       getIntEnv("UPSTREAM_MAX_RETRIES", 3),
+			UpstreamRetryBackoff:     getDurationEnv("UPSTREAM_RETRY_BACKOFF", time.Second),
+			UpstreamMaxBackoff:       getDurationEnv("UPSTREAM_MAX_BACKOFF", 30*time.Second),
+			UpstreamBreakerThreshold: getIntEnv("UPSTREAM_BREAKER_THRESHOLD", 5),
+			UpstreamBreakerCooldown:  getDurationEnv("UPSTREAM_BREAKER_COOLDOWN", 5*time.Minute),
+
+			RefreshAllowedURLs: splitAndTrim(os.Getenv("PIPELINE_REFRESH_ALLOWED_URLS")),
+
+			PartitionAheadMonths:         getIntEnv("PARTITION_AHEAD_MONTHS", 3),
+			PartitionMaintenanceInterval: getDurationEnv("PARTITION_MAINTENANCE_INTERVAL", 6*time.Hour),
+			RetentionRawMonths:           getIntEnv("RETENTION_RAW_MONTHS", 0),
+			RetentionMode:                strings.ToLower(getEnv("RETENTION_MODE", "detach")),
+
+			AQIBreakpointsFile:  getEnv("AQI_BREAKPOINTS_FILE", ""),
+			ComplianceStandards: loadComplianceStandards(),
+
+			AnomalyWindow:     getDurationEnv("ANOMALY_WINDOW", 6*time.Hour),
+			AnomalyMinSamples: getIntEnv("ANOMALY_MIN_SAMPLES", 6),
+			AnomalyThreshold:  getFloatEnv("ANOMALY_THRESHOLD", 6),
+			AnomalyMinDelta:   getFloatEnv("ANOMALY_MIN_DELTA", 25),
+			AnomalyRecheck:    getDurationEnv("ANOMALY_RECHECK", 3*time.Hour),
+
+			DriftInterval:      getDurationEnv("DRIFT_INTERVAL", 24*time.Hour),
+			DriftRadiusKM:      getFloatEnv("DRIFT_RADIUS_KM", 15),
+			DriftWindowDays:    getIntEnv("DRIFT_WINDOW_DAYS", 60),
+			DriftMinNeighbours: getIntEnv("DRIFT_MIN_NEIGHBOURS", 2),
+			DriftMinDays:       getIntEnv("DRIFT_MIN_DAYS", 14),
+			DriftThreshold:     getFloatEnv("DRIFT_THRESHOLD", 0.3),
+		}
+		if cfg.PipelineInterval == 0 {
+			log.Fatalf("PIPELINE_INTERVAL must be greater than zero")
+		}
+		if cfg.PartitionMaintenanceInterval == 0 {
+			log.Fatalf("PARTITION_MAINTENANCE_INTERVAL must be greater than zero")
+		}
+		if cfg.AnomalyWindow == 0 || cfg.AnomalyMinSamples == 0 {
+			log.Fatalf("ANOMALY_WINDOW and ANOMALY_MIN_SAMPLES must be greater than zero")
+		}
+		if cfg.DriftInterval == 0 || cfg.DriftRadiusKM == 0 || cfg.DriftWindowDays == 0 ||
+			cfg.DriftMinNeighbours == 0 || cfg.DriftMinDays == 0 || cfg.DriftThreshold == 0 {
+			log.Fatalf("DRIFT_* settings must be greater than zero")
+		}
+		if cfg.RetentionMode != "detach" && cfg.RetentionMode != "drop" {
+			log.Fatalf("RETENTION_MODE must be detach or drop")
 		}
 	})
 
@@ -63,6 +236,42 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatalf("%s must be a non-negative duration such as 5m or 30s", key)
+	}
+	return d
+}
+
+func getIntEnv(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("%s must be a non-negative integer", key)
+	}
+	return n
+}
+
+func getFloatEnv(key string, fallback float64) float64 {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		log.Fatalf("%s must be a non-negative number", key)
+	}
+	return f
+}
+
 func getRequiredEnv(key string) string {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
@@ -71,6 +280,65 @@ func getRequiredEnv(key string) string {
 	return value
 }
 
+func loadIngestSources() []IngestSourceConfig {
+	raw := getEnv("INGEST_SOURCES", "")
+	if path := getEnv("INGEST_SOURCES_FILE", ""); path != "" && raw == "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("INGEST_SOURCES_FILE: %v", err)
+		}
+		raw = string(b)
+	}
+	if raw == "" {
+		return nil
+	}
+
+	var sources []IngestSourceConfig
+	if err := json.Unmarshal([]byte(raw), &sources); err != nil {
+		log.Fatalf("INGEST_SOURCES must be a JSON array of sources: %v", err)
+	}
+	for i := range sources {
+		for k, v := range sources[i].Headers {
+			sources[i].Headers[k] = os.ExpandEnv(v)
+		}
+	}
+	return sources
+}
+
+func loadComplianceStandards() []ComplianceStandard {
+	raw := getEnv("COMPLIANCE_STANDARDS", "")
+	if path := getEnv("COMPLIANCE_STANDARDS_FILE", ""); path != "" && raw == "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("COMPLIANCE_STANDARDS_FILE: %v", err)
+		}
+		raw = string(b)
+	}
+	if raw == "" {
+		return DefaultComplianceStandards
+	}
+
+	var standards []ComplianceStandard
+	if err := json.Unmarshal([]byte(raw), &standards); err != nil {
+		log.Fatalf("COMPLIANCE_STANDARDS must be a JSON array of standards: %v", err)
+	}
+	seen := make(map[string]bool, len(standards))
+	for _, s := range standards {
+		switch {
+		case s.Code == "" || seen[s.Code]:
+			log.Fatalf("COMPLIANCE_STANDARDS: every standard needs a unique code")
+		case s.Pollutant != "pm25" && s.Pollutant != "pm10":
+			log.Fatalf("COMPLIANCE_STANDARDS: %s: pollutant must be pm25 or pm10", s.Code)
+		case s.Period != "1h" && s.Period != "24h" && s.Period != "annual":
+			log.Fatalf("COMPLIANCE_STANDARDS: %s: period must be 1h, 24h or annual", s.Code)
+		case s.Limit <= 0:
+			log.Fatalf("COMPLIANCE_STANDARDS: %s: limit must be positive", s.Code)
+		}
+		seen[s.Code] = true
+	}
+	return standards
+}
+
 func buildOrigins(origins string) []string {
 	items := splitAndTrim(origins)
 	if len(items) == 0 {
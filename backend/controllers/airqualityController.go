@@ -1,23 +1,27 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"yakkaw_dashboard/aqi"
 	"yakkaw_dashboard/cache"
-	"yakkaw_dashboard/database"
 	"yakkaw_dashboard/models"
 	"yakkaw_dashboard/services"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
-type AirQualityController struct{}
+type AirQualityController struct {
+	Service *services.AirQualityService
+}
 
-func NewAirQualityController() *AirQualityController {
-	return &AirQualityController{}
+func NewAirQualityController(s *services.AirQualityService) *AirQualityController {
+	return &AirQualityController{Service: s}
 }
 
 // Handler สำหรับดึงค่าเฉลี่ย 24 ชั่วโมง
@@ -28,7 +32,7 @@ func (ctl *AirQualityController) GetOneDayDataHandler(c echo.Context) error {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	data, err := services.GetAirQuality24Hours()
+	data, err := ctl.Service.GetAirQuality24Hours()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -44,7 +48,7 @@ func (ctl *AirQualityController) GetOneWeekDataHandler(c echo.Context) error {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	data, err := services.GetAirQualityOneWeek()
+	data, err := ctl.Service.GetAirQualityOneWeek()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -60,7 +64,7 @@ func (ctl *AirQualityController) GetOneMonthDataHandler(c echo.Context) error {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	data, err := services.GetAirQualityOneMonth()
+	data, err := ctl.Service.GetAirQualityOneMonth()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -76,7 +80,7 @@ func (ctl *AirQualityController) GetThreeMonthsDataHandler(c echo.Context) error
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	data, err := services.GetAirQualityThreeMonths()
+	data, err := ctl.Service.GetAirQualityThreeMonths()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -92,7 +96,7 @@ func (ctl *AirQualityController) GetOneYearDataHandler(c echo.Context) error {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	data, err := services.GetAirQualityOneYear()
+	data, err := ctl.Service.GetAirQualityOneYear()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -101,45 +105,56 @@ func (ctl *AirQualityController) GetOneYearDataHandler(c echo.Context) error {
 }
 
 // GetLatestAirQuality ดึงค่า AQI และ timestamp ล่าสุดสำหรับจังหวัดที่ระบุ
-func GetLatestAirQuality(c echo.Context) error {
+// ถ้าส่ง aqi_standard=th|us จะคำนวณ AQI จากค่าเฉลี่ย PM 24 ชั่วโมงแทนค่าที่ upstream ส่งมา
+// และแนบ NowCast ของสถานีที่ส่ง reading ล่าสุดมาด้วยเสมอ
+func (ctl *AirQualityController) GetLatestAirQuality(c echo.Context) error {
 	province := c.QueryParam("province")
-	var result struct {
-		AQI       int   `json:"aqi"`
-		Timestamp int64 `json:"timestamp"`
-	}
-
-	cacheKey := fmt.Sprintf("air:latest:%s", province)
+	standard := strings.ToLower(strings.TrimSpace(c.QueryParam("aqi_standard")))
+	var std *aqi.Standard
+	if standard != "" {
+		s, err := aqi.Parse(standard)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		std = &s
+	}
+	var result services.LatestAirQuality
+
+	cacheKey := fmt.Sprintf("air:latest:%s:%s", province, standard)
 	if ok, err := cache.GetJSON(cacheKey, &result); err == nil && ok {
 		return c.JSON(http.StatusOK, result)
 	}
 
-	// สร้าง query สำหรับดึง record ล่าสุดจาก sensor_data โดยกรองด้วย address ที่มีชื่อจังหวัด
-	query := "SELECT aqi, timestamp FROM sensor_data WHERE 1=1"
-	args := []interface{}{}
-	if province != "" {
-		query += " AND address ILIKE ?"
-		args = append(args, "%"+province+"%")
-	}
-	query += " ORDER BY timestamp DESC LIMIT 1"
-
-	row := database.DB.Raw(query, args...).Row()
-	if err := row.Scan(&result.AQI, &result.Timestamp); err != nil {
+	// record ล่าสุดจาก sensor_data โดยกรองด้วยจังหวัดที่ parse จาก address
+	result, err := ctl.Service.GetLatestAirQuality(province, std)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return c.JSON(http.StatusNotFound, map[string]string{"message": "Not Found"})
 	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
 
 	_ = cache.SetJSON(cacheKey, result, 15*time.Second)
 	return c.JSON(http.StatusOK, result)
 }
 
 // GetProvinceAveragePM25Handler ดึงค่าเฉลี่ย PM2.5 ของแต่ละจังหวัด
+// (?exclude_anomalies=true ตัดค่าที่ถูกตั้งธงว่าเป็น spike ออก)
 func (ctl *AirQualityController) GetProvinceAveragePM25Handler(c echo.Context) error {
+	exclude, err := parseExcludeAnomalies(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 	cacheKey := "air:province-avg:24h"
+	if exclude {
+		cacheKey += ":clean"
+	}
 	var cached []map[string]interface{}
 	if ok, err := cache.GetJSON(cacheKey, &cached); err == nil && ok {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	data, err := services.GetProvinceAveragePM25()
+	data, err := ctl.Service.GetProvinceAveragePM25(exclude)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -155,7 +170,7 @@ func (ctl *AirQualityController) GetSensorData7DaysHandler(c echo.Context) error
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	data, err := services.GetSensorData7Days()
+	data, err := ctl.Service.GetSensorData7Days()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -163,7 +178,7 @@ func (ctl *AirQualityController) GetSensorData7DaysHandler(c echo.Context) error
 	return c.JSON(http.StatusOK, data)
 }
 
-func GetAirQualityOneYearSeriesByAddress(c echo.Context) error {
+func (ctl *AirQualityController) GetAirQualityOneYearSeriesByAddress(c echo.Context) error {
 	address := strings.TrimSpace(c.QueryParam("address"))
 	if address == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "address is required"})
@@ -175,7 +190,7 @@ func GetAirQualityOneYearSeriesByAddress(c echo.Context) error {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	data, err := services.GetAirQualityOneYearSeriesByAddress(address)
+	data, err := ctl.Service.GetAirQualityOneYearSeriesByAddress(address)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -185,7 +200,7 @@ func GetAirQualityOneYearSeriesByAddress(c echo.Context) error {
 }
 
 // GetAirQualityOneYearSeriesByProvince returns daily PM series (1 year) aggregated by province
-func GetAirQualityOneYearSeriesByProvince(c echo.Context) error {
+func (ctl *AirQualityController) GetAirQualityOneYearSeriesByProvince(c echo.Context) error {
 	province := c.QueryParam("province")
 	if province == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "province is required"})
@@ -197,7 +212,7 @@ func GetAirQualityOneYearSeriesByProvince(c echo.Context) error {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	data, err := services.GetAirQualityOneYearSeriesByProvince(province)
+	data, err := ctl.Service.GetAirQualityOneYearSeriesByProvince(province)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
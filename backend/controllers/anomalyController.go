@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"yakkaw_dashboard/services"
+)
+
+type AnomalyController struct {
+	Service *services.AnomalyService
+}
+
+// NewAnomalyController เป็น constructor สำหรับ AnomalyController
+func NewAnomalyController(s *services.AnomalyService) *AnomalyController {
+	return &AnomalyController{Service: s}
+}
+
+// ListAnomalies (ADMIN ONLY) lists readings flagged as PM2.5 spikes, newest
+// first, with a per-device summary. Optional filters: dvid, hours (look-back,
+// 1..720, default 24), limit (1..500, default 100), offset.
+func (ctl *AnomalyController) ListAnomalies(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	hours := 24
+	if v := c.QueryParam("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 720 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "hours must be between 1 and 720"})
+		}
+		hours = n
+	}
+
+	limit, offset := parsePagination(c, 100, 500)
+	rows, total, devices, err := ctl.Service.ListAnomalies(services.AnomalyFilter{
+		DVID:   c.QueryParam("dvid"),
+		Since:  time.Now().Add(-time.Duration(hours) * time.Hour),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":    rows,
+		"devices": devices,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// parseExcludeAnomalies reads the exclude_anomalies query param (absent is
+// false).
+func parseExcludeAnomalies(c echo.Context) (bool, error) {
+	v := c.QueryParam("exclude_anomalies")
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("exclude_anomalies must be true or false")
+	}
+	return b, nil
+}
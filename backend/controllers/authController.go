@@ -7,8 +7,8 @@ import (
 	"strings"
 	"time"
 	"yakkaw_dashboard/config"
-	"yakkaw_dashboard/database"
 	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
@@ -56,9 +56,17 @@ func shouldUseSecureCookie(c echo.Context) bool {
 	return strings.EqualFold(env, "production")
 }
 
+type AuthController struct {
+	Users repository.UserRepository
+}
+
+// NewAuthController เป็น constructor สำหรับ AuthController
+func NewAuthController(users repository.UserRepository) *AuthController {
+	return &AuthController{Users: users}
+}
+
 // Login - Handle user login by verifying password from the database
-// Login - Handle user login by verifying password from the database
-func Login(c echo.Context) error {
+func (ac *AuthController) Login(c echo.Context) error {
 	type loginRequest struct {
 		Username string `json:"username" form:"username"`
 		Password string `json:"password" form:"password"`
@@ -82,8 +90,8 @@ func Login(c echo.Context) error {
 	}
 
 	// Find user in the database
-	var user models.User
-	if err := database.DB.Where("username = ?", payload.Username).First(&user).Error; err != nil {
+	user, err := ac.Users.FindByUsername(payload.Username)
+	if err != nil {
 		return c.JSON(http.StatusUnauthorized, "Invalid username or password")
 	}
 
@@ -135,7 +143,7 @@ func Logout(c echo.Context) error {
 }
 
 // Register - Creates a new user
-func Register(c echo.Context) error {
+func (ac *AuthController) Register(c echo.Context) error {
 	var userRequest models.User
 
 	// Bind request body to struct
@@ -162,7 +170,7 @@ func Register(c echo.Context) error {
 	userRequest.Password = string(hashedPassword)
 
 	// Save user to database
-	if err := database.DB.Create(&userRequest).Error; err != nil {
+	if err := ac.Users.Create(&userRequest); err != nil {
 		return c.JSON(http.StatusInternalServerError, "Error registering user")
 	}
 
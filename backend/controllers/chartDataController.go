@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"yakkaw_dashboard/aqi"
 	"yakkaw_dashboard/cache"
 	"yakkaw_dashboard/models"
 	"yakkaw_dashboard/services"
@@ -13,10 +14,12 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-type ChartDataController struct{}
+type ChartDataController struct {
+	Service *services.ChartDataService
+}
 
-func NewChartDataController() *ChartDataController {
-	return &ChartDataController{}
+func NewChartDataController(s *services.ChartDataService) *ChartDataController {
+	return &ChartDataController{Service: s}
 }
 
 var ()
@@ -33,13 +36,18 @@ func (ctl *ChartDataController) GetChartDataHandler(c echo.Context) error {
 		metric = "pm25"
 	}
 
-	cacheKey := fmt.Sprintf("chart:data:%s:%s:%s", rangeType, province, metric)
+	std, err := aqi.Parse(c.QueryParam("aqi_standard"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	cacheKey := fmt.Sprintf("chart:data:%s:%s:%s:%s", rangeType, province, metric, std.Code)
 	var cached models.ChartData
 	if ok, err := cache.GetJSON(cacheKey, &cached); err == nil && ok {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	chartData, err := services.GetChartData(rangeType, province, metric)
+	chartData, err := ctl.chartDataFor(rangeType, province, metric, std)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -55,13 +63,17 @@ func (ctl *ChartDataController) GetTodayChartDataHandler(c echo.Context) error {
 	if metric == "" {
 		metric = "pm25"
 	}
-	cacheKey := fmt.Sprintf("chart:data:Today:%s:%s", province, metric)
+	std, err := aqi.Parse(c.QueryParam("aqi_standard"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	cacheKey := fmt.Sprintf("chart:data:Today:%s:%s:%s", province, metric, std.Code)
 	var cached models.ChartData
 	if ok, err := cache.GetJSON(cacheKey, &cached); err == nil && ok {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	chartData, err := services.GetChartData("Today", province, metric)
+	chartData, err := ctl.chartDataFor("Today", province, metric, std)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -85,7 +97,7 @@ func (ctl *ChartDataController) GetHeatmapOneYearHandler(c echo.Context) error {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	chartData, err := services.GetHeatmapOneYearDaily(province, metric)
+	chartData, err := ctl.Service.GetHeatmapOneYearDaily(province, metric)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -127,14 +139,29 @@ func (ctl *ChartDataController) GetDailyRankingHandler(c echo.Context) error {
 		}
 	}
 
-	cacheKey := fmt.Sprintf("chart:rank:%s:%s:%s:%d", dateStr, metric, group, limit)
+	std, err := aqi.Parse(c.QueryParam("aqi_standard"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	exclude, err := parseExcludeAnomalies(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	cacheKey := fmt.Sprintf("chart:rank:%s:%s:%s:%d:%s:%t", dateStr, metric, group, limit, std.Code, exclude)
 	var cached []services.DailyRankRow
 	if ok, err := cache.GetJSON(cacheKey, &cached); err == nil && ok {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	// เรียก service แบบ group-able
-	ranking, err := services.GetDailyRankingGrouped(dateStr, metric, group, limit)
+	// เรียก service แบบ group-able; metric=aqi จัดอันดับด้วย AQI ที่คำนวณตาม aqi_standard
+	var ranking []services.DailyRankRow
+	if metric == "aqi" {
+		ranking, err = ctl.Service.GetDailyAQIRanking(dateStr, group, limit, std, exclude)
+	} else {
+		ranking, err = ctl.Service.GetDailyRankingGrouped(dateStr, metric, group, limit, exclude)
+	}
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -143,6 +170,15 @@ func (ctl *ChartDataController) GetDailyRankingHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, ranking)
 }
 
+// chartDataFor computes metric=aqi under the requested standard instead of
+// GetChartData's default one.
+func (ctl *ChartDataController) chartDataFor(rangeType, province, metric string, std aqi.Standard) (models.ChartData, error) {
+	if metric == "aqi" {
+		return ctl.Service.GetChartAQI(rangeType, province, std)
+	}
+	return ctl.Service.GetChartData(rangeType, province, metric)
+}
+
 func chartDataTTL(rangeType string) time.Duration {
 	switch rangeType {
 	case "Today", "24 Hour":
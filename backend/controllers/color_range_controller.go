@@ -2,13 +2,27 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 	"yakkaw_dashboard/models"
 	"yakkaw_dashboard/services"
 
 	"github.com/labstack/echo/v4"
 )
 
-type ColorRangeController struct{}
+type ColorRangeController struct {
+	Service *services.ColorRangeService
+}
+
+// NewColorRangeController เป็น constructor สำหรับ ColorRangeController
+func NewColorRangeController(s *services.ColorRangeService) *ColorRangeController {
+	return &ColorRangeController{Service: s}
+}
+
+// colorRangeID parses the :id path parameter.
+func colorRangeID(c echo.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	return uint(id), err == nil
+}
 
 func (ctrl *ColorRangeController) Create(c echo.Context) error {
 	var input models.ColorRange
@@ -16,7 +30,7 @@ func (ctrl *ColorRangeController) Create(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
 	}
 
-	data, err := services.CreateColorRange(input)
+	data, err := ctrl.Service.CreateColorRange(input)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create"})
 	}
@@ -25,7 +39,7 @@ func (ctrl *ColorRangeController) Create(c echo.Context) error {
 }
 
 func (ctrl *ColorRangeController) GetAll(c echo.Context) error {
-	data, err := services.GetAllColorRanges()
+	data, err := ctrl.Service.GetAllColorRanges()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch data"})
 	}
@@ -33,8 +47,11 @@ func (ctrl *ColorRangeController) GetAll(c echo.Context) error {
 }
 
 func (ctrl *ColorRangeController) GetByID(c echo.Context) error {
-	id := c.Param("id")
-	data, err := services.GetColorRange(id)
+	id, ok := colorRangeID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ID"})
+	}
+	data, err := ctrl.Service.GetColorRange(id)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "Not found"})
 	}
@@ -42,13 +59,16 @@ func (ctrl *ColorRangeController) GetByID(c echo.Context) error {
 }
 
 func (ctrl *ColorRangeController) Update(c echo.Context) error {
-	id := c.Param("id")
+	id, ok := colorRangeID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ID"})
+	}
 	var input models.ColorRange
 	if err := c.Bind(&input); err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid input"})
 	}
 
-	data, err := services.UpdateColorRange(id, input)
+	data, err := ctrl.Service.UpdateColorRange(id, input)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Update failed"})
 	}
@@ -56,8 +76,11 @@ func (ctrl *ColorRangeController) Update(c echo.Context) error {
 }
 
 func (ctrl *ColorRangeController) Delete(c echo.Context) error {
-	id := c.Param("id")
-	if err := services.DeleteColorRange(id); err != nil {
+	id, ok := colorRangeID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid ID"})
+	}
+	if err := ctrl.Service.DeleteColorRange(id); err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Delete failed"})
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "Deleted successfully"})
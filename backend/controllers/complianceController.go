@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/cache"
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ComplianceController struct {
+	Service *services.ComplianceService
+}
+
+// NewComplianceController เป็น constructor สำหรับ ComplianceController
+func NewComplianceController(s *services.ComplianceService) *ComplianceController {
+	return &ComplianceController{Service: s}
+}
+
+// GetCompliance (PUBLIC) นับจำนวนวัน/ชั่วโมงที่เกินมาตรฐาน:
+//
+//	GET /api/compliance?year=2025&group_by=province&province=เชียงราย&standard=th_pm25_24h
+//
+// year (default ปีปัจจุบัน) หรือ from/to เป็น YYYY-MM-DD (to ไม่รวม); group_by คือ station, province
+// (default; station เมื่อส่ง dvid) หรือ month; standard ส่งซ้ำหรือคั่นด้วย comma ได้ (default ทุกมาตรฐาน); format=csv ดาวน์โหลดเป็นไฟล์ CSV
+func (ctl *ComplianceController) GetCompliance(c echo.Context) error {
+	q := services.ComplianceQuery{
+		Location:  strings.TrimSpace(c.QueryParam("province")),
+		DVID:      strings.TrimSpace(c.QueryParam("dvid")),
+		Standards: queryList(c, "standard"),
+	}
+	defaultGroup := services.ComplianceGroupProvince
+	if q.DVID != "" {
+		defaultGroup = services.ComplianceGroupStation
+	}
+	q.GroupBy = queryDefault(c, "group_by", defaultGroup)
+
+	year := time.Now().In(database.Bangkok).Year()
+	if v := c.QueryParam("year"); v != "" {
+		y, err := strconv.Atoi(v)
+		if err != nil || y < 2000 || y > 9999 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid year"})
+		}
+		year = y
+	}
+	q.From = time.Date(year, time.January, 1, 0, 0, 0, 0, database.Bangkok)
+	q.To = q.From.AddDate(1, 0, 0)
+	var err error
+	if v := c.QueryParam("from"); v != "" {
+		if q.From, err = time.ParseInLocation("2006-01-02", v, database.Bangkok); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid from: use YYYY-MM-DD"})
+		}
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if q.To, err = time.ParseInLocation("2006-01-02", v, database.Bangkok); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid to: use YYYY-MM-DD"})
+		}
+	}
+
+	format := queryDefault(c, "format", "json")
+	if format != "json" && format != "csv" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be json or csv"})
+	}
+
+	// ช่วงที่จบไปแล้วเปลี่ยนเฉพาะเมื่อมี reading มาช้า; ช่วงที่ยังไม่จบ cache สั้นกว่า
+	ttl := 6 * time.Hour
+	if q.To.After(time.Now()) {
+		ttl = 10 * time.Minute
+	}
+	cacheKey := fmt.Sprintf("compliance:%d:%d:%s:%s:%s:%s", q.From.Unix(), q.To.Unix(), q.GroupBy,
+		q.Location, q.DVID, strings.Join(q.Standards, ","))
+	var report services.ComplianceReport
+	if ok, err := cache.GetJSON(cacheKey, &report); err != nil || !ok {
+		report, err = ctl.Service.GetComplianceReport(q)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidComplianceQuery) {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		_ = cache.SetJSON(cacheKey, report, ttl)
+	}
+
+	if format == "json" {
+		return c.JSON(http.StatusOK, report)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	filename := fmt.Sprintf("compliance_%s_%s_%s.csv", report.GroupBy, report.From, report.To)
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Blob(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/services"
+)
+
+// ListDeadLetters (ADMIN ONLY) lists readings whose upsert failed.
+// Optional filters: dvid, source, limit (1..500, default 100), offset.
+func ListDeadLetters(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	limit, offset := parsePagination(c, 100, 500)
+	rows, total, err := services.ListDeadLetters(services.DeadLetterFilter{
+		DVID:   c.QueryParam("dvid"),
+		Source: c.QueryParam("source"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   rows,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetDeadLetter (ADMIN ONLY) returns one dead letter with its full payload.
+func GetDeadLetter(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	row, err := services.GetDeadLetter(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Dead letter not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, row)
+}
+
+// UpdateDeadLetter (ADMIN ONLY) replaces a dead letter's payload with the
+// reading in the request body (models.SensorData JSON shape).
+func UpdateDeadLetter(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var payload models.SensorData
+	if err := c.Bind(&payload); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
+	}
+
+	row, err := services.UpdateDeadLetter(uint(id), payload)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Dead letter not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, row)
+}
+
+// ReplayDeadLetter (ADMIN ONLY) re-submits a dead letter through the normal
+// ingest path; it is removed once the upsert succeeds.
+func ReplayDeadLetter(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	result, err := services.ReplayDeadLetter(c.Request().Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Dead letter not found"})
+		}
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "Dead letter replayed",
+		"result":  result,
+	})
+}
+
+// DeleteDeadLetter (ADMIN ONLY) discards a dead letter.
+func DeleteDeadLetter(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	if err := services.DeleteDeadLetter(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Dead letter not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Dead letter deleted"})
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"yakkaw_dashboard/services"
+)
+
+// CreateDeviceKey (ADMIN ONLY) issues a push-ingest API key for a device.
+// The plaintext key is only shown in this response.
+func CreateDeviceKey(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	var req struct {
+		Label string `json:"label"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
+	}
+
+	plain, key, err := services.CreateDeviceAPIKey(c.Param("dvid"), req.Label)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Device not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"key":  plain,
+		"data": key,
+	})
+}
+
+// ListDeviceKeys (ADMIN ONLY) lists the API keys issued for a device.
+func ListDeviceKeys(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	keys, err := services.ListDeviceAPIKeys(c.Param("dvid"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// RevokeDeviceKey (ADMIN ONLY) revokes a device API key.
+func RevokeDeviceKey(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	if err := services.RevokeDeviceAPIKey(c.Param("dvid"), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Key not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Key revoked"})
+}
@@ -1,15 +1,26 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"yakkaw_dashboard/models"
 	"yakkaw_dashboard/services"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
-func CreateDevice(c echo.Context) error {
+type DeviceController struct {
+	Service *services.DeviceService
+}
+
+// NewDeviceController เป็น constructor สำหรับ DeviceController
+func NewDeviceController(s *services.DeviceService) *DeviceController {
+	return &DeviceController{Service: s}
+}
+
+func (dc *DeviceController) CreateDevice(c echo.Context) error {
     // Enforce admin role for device creation
     if role, _ := c.Get("userRole").(string); role != "admin" {
         return c.JSON(http.StatusForbidden, map[string]string{"error": "admin role required"})
@@ -19,7 +30,7 @@ func CreateDevice(c echo.Context) error {
         return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
     }
 
-	createdDevice, err := services.CreateDevice(device)
+	createdDevice, err := dc.Service.CreateDevice(device)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -27,33 +38,36 @@ func CreateDevice(c echo.Context) error {
 	return c.JSON(http.StatusOK, createdDevice)
 }
 
-func GetDevice(c echo.Context) error {
+func (dc *DeviceController) GetDevice(c echo.Context) error {
 	dvid := c.Param("dvid")
-	device, err := services.GetDeviceByDVID(dvid)
+	device, err := dc.Service.GetDeviceByDVID(dvid)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Device not found"})
 	}
+	devices := []models.Device{device}
+	dc.Service.AttachDrift(devices)
 
-	return c.JSON(http.StatusOK, device)
+	return c.JSON(http.StatusOK, devices[0])
 }
 
-func GetAllDevices(c echo.Context) error {
-	devices, err := services.GetAllDevices()
+func (dc *DeviceController) GetAllDevices(c echo.Context) error {
+	devices, err := dc.Service.GetAllDevices()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	dc.Service.AttachDrift(devices)
 
 	return c.JSON(http.StatusOK, devices)
 }
 
-func UpdateDevice(c echo.Context) error {
+func (dc *DeviceController) UpdateDevice(c echo.Context) error {
 	dvid := c.Param("dvid")
 	var device models.Device
 	if err := c.Bind(&device); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	updatedDevice, err := services.UpdateDevice(dvid, device)
+	updatedDevice, err := dc.Service.UpdateDevice(dvid, device)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -61,7 +75,7 @@ func UpdateDevice(c echo.Context) error {
 	return c.JSON(http.StatusOK, updatedDevice)
 }
 
-func DeleteDevice(c echo.Context) error {
+func (dc *DeviceController) DeleteDevice(c echo.Context) error {
 	// ดึง id จาก URL parameter
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -69,7 +83,10 @@ func DeleteDevice(c echo.Context) error {
 	}
 
 	// เรียกใช้ service เพื่อลบข้อมูล
-	if err := services.DeleteDevice(uint(id)); err != nil {
+	if err := dc.Service.DeleteDevice(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Device not found"})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
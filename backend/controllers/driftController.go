@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"yakkaw_dashboard/services"
+)
+
+// ListDrift (ADMIN ONLY) reports the latest comparison of every station with
+// its neighbours, flagged stations first. Optional: flagged=true to list only
+// stations needing recalibration, limit (1..500, default 100), offset.
+func (ctl *StationController) ListDrift(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	flagged := false
+	if v := c.QueryParam("flagged"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "flagged must be true or false"})
+		}
+		flagged = b
+	}
+
+	limit, offset := parsePagination(c, 100, 500)
+	rows, total, err := ctl.Service.ListDrift(services.DriftFilter{
+		FlaggedOnly: flagged,
+		Limit:       limit,
+		Offset:      offset,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":   rows,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
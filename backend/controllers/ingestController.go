@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/services"
+	"yakkaw_dashboard/utils"
+)
+
+const (
+	maxPushBodyBytes = 5 << 20
+	maxPushReadings  = 1000
+)
+
+type IngestController struct {
+	Devices *services.DeviceService
+}
+
+// NewIngestController เป็น constructor สำหรับ IngestController
+func NewIngestController(devices *services.DeviceService) *IngestController {
+	return &IngestController{Devices: devices}
+}
+
+// IngestReadings (DEVICE KEY) accepts one reading or an array of readings in
+// the models.SensorData JSON shape and runs them through the same validate +
+// upsert path as the poller. Every reading must belong to the key's device;
+// a missing dvid defaults to it.
+func (ic *IngestController) IngestReadings(c echo.Context) error {
+	dvid, _ := c.Get("deviceDVID").(string)
+	if dvid == "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "device api key required"})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxPushBodyBytes+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "failed to read body"})
+	}
+	if len(body) > maxPushBodyBytes {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "request body too large"})
+	}
+
+	var rows []models.SensorData
+	body = bytes.TrimSpace(body)
+	switch {
+	case len(body) == 0:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "empty body"})
+	case body[0] == '[':
+		err = json.Unmarshal(body, &rows)
+	default:
+		var row models.SensorData
+		err = json.Unmarshal(body, &row)
+		rows = []models.SensorData{row}
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid JSON: " + err.Error()})
+	}
+	if len(rows) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "no readings"})
+	}
+	if len(rows) > maxPushReadings {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "too many readings in one request"})
+	}
+
+	for i := range rows {
+		if rows[i].DVID == "" {
+			rows[i].DVID = dvid
+		}
+		if rows[i].DVID != dvid {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "api key is not allowed to publish for dvid " + rows[i].DVID})
+		}
+	}
+
+	device, err := ic.Devices.GetDeviceByDVID(dvid)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "device is not registered"})
+	}
+	services.FillFromDevice(rows, device)
+
+	result, err := services.IngestRows(c.Request().Context(), "push:"+dvid, rows)
+	if err != nil {
+		utils.GetLogger().WithError(err).WithField("dvid", dvid).Error("push ingest failed")
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to store readings"})
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -3,15 +3,25 @@ package controllers
 import (
 	"net/http"
 	"strconv"
-	"yakkaw_dashboard/database"
 	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+	"yakkaw_dashboard/services"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 	"fmt"
 	"time"
 )
 
-func CreateNotification(c echo.Context) error {
+type NotificationController struct {
+	Notifications repository.NotificationRepository
+}
+
+// NewNotificationController เป็น constructor สำหรับ NotificationController
+func NewNotificationController(notifications repository.NotificationRepository) *NotificationController {
+	return &NotificationController{Notifications: notifications}
+}
+
+func (nc *NotificationController) CreateNotification(c echo.Context) error {
 	userRole := c.Get("userRole")
 	if userRole != "admin" {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
@@ -26,7 +36,7 @@ func CreateNotification(c echo.Context) error {
 		notification.Icon = "default-icon-url" 
 	}
 
-	if err := database.DB.Create(&notification).Error; err != nil {
+	if err := nc.Notifications.Create(&notification); err != nil {
 		c.Logger().Error(err) 
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save notification"})
 	}
@@ -34,10 +44,27 @@ func CreateNotification(c echo.Context) error {
 	return c.JSON(http.StatusCreated, notification)
 }
 
-func GetNotifications(c echo.Context) error {
-	var notifications []models.Notification
+// GetNotifications lists public notifications; system notifications raised
+// by the backend itself (e.g. schema drift) are only listed for admins.
+func (nc *NotificationController) GetNotifications(c echo.Context) error {
+	return nc.listNotifications(c, false)
+}
+
+// GetAdminNotifications (ADMIN ONLY) lists all notifications, including system ones.
+func (nc *NotificationController) GetAdminNotifications(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+	return nc.listNotifications(c, true)
+}
 
-	if err := database.DB.Find(&notifications).Error; err != nil {
+func (nc *NotificationController) listNotifications(c echo.Context, includeSystem bool) error {
+	var exclude []string
+	if !includeSystem {
+		exclude = append(exclude, services.NotificationCategorySystem)
+	}
+	notifications, err := nc.Notifications.List(exclude...)
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch notifications"})
 	}
 
@@ -58,7 +85,7 @@ func GetNotifications(c echo.Context) error {
 	return c.JSON(http.StatusOK, response)
 }
 
-func DeleteNotification(c echo.Context) error {
+func (nc *NotificationController) DeleteNotification(c echo.Context) error {
 	userRole := c.Get("userRole")
 	if userRole != "admin" {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
@@ -70,8 +97,7 @@ func DeleteNotification(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
 	}
 
-	var notification models.Notification
-	if err := database.DB.Where("id = ?", uint(uintID)).First(&notification).Error; err != nil {
+	if _, err := nc.Notifications.FindByID(uint(uintID)); err != nil {
 
 		if err == gorm.ErrRecordNotFound {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "Notification not found"})
@@ -80,7 +106,7 @@ func DeleteNotification(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to find notification"})
 	}
 
-	if err := database.DB.Unscoped().Delete(&models.Notification{}, uint(uintID)).Error; err != nil {
+	if err := nc.Notifications.Delete(uint(uintID)); err != nil {
 		c.Logger().Error(err) // Log error for debugging
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete notification"})
 	}
@@ -88,7 +114,7 @@ func DeleteNotification(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"message": "Notification deleted successfully"})
 }
 
-func UpdateNotification(c echo.Context) error {
+func (nc *NotificationController) UpdateNotification(c echo.Context) error {
 
 	userRole := c.Get("userRole")
 	if userRole != "admin" {
@@ -108,8 +134,8 @@ func UpdateNotification(c echo.Context) error {
 	}
 
 
-	var notification models.Notification
-	if err := database.DB.First(&notification, uint(uintID)).Error; err != nil {
+	notification, err := nc.Notifications.FindByID(uint(uintID))
+	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Notification not found"})
 	}
 
@@ -118,7 +144,7 @@ func UpdateNotification(c echo.Context) error {
 	notification.Icon = updatedNotification.Icon
 	notification.Category = updatedNotification.Category
 
-	if err := database.DB.Save(&notification).Error; err != nil {
+	if err := nc.Notifications.Save(&notification); err != nil {
 		c.Logger().Error(err) 
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update notification"})
 	}
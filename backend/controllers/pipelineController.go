@@ -1,32 +1,199 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 
 	"yakkaw_dashboard/config"
 	"yakkaw_dashboard/services"
 )
 
-// PipelineRefresh triggers an on-demand fetch from the devices API and upserts into sensor_data
-func PipelineRefresh(c echo.Context) error {
-	apiURL := c.QueryParam("api_url")
-	if apiURL == "" {
-		apiURL = config.Get().DevicesAPIURL
+// RefreshPipeline (ADMIN ONLY) queues an on-demand ingest and answers 202
+// with a job ID to poll via GetRefreshJob. The source is chosen by "source"
+// (a configured ingest source) or "api_url" (must be in
+// PIPELINE_REFRESH_ALLOWED_URLS), from the JSON body or query string; with
+// neither, the default devices API is refreshed.
+func RefreshPipeline(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
 	}
 
-	processed, err := services.FetchAndStoreDevices(apiURL)
+	var req struct {
+		Source string `json:"source"`
+		APIURL string `json:"api_url"`
+	}
+	if c.Request().ContentLength > 0 {
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
+		}
+	}
+	if req.Source == "" {
+		req.Source = c.QueryParam("source")
+	}
+	if req.APIURL == "" {
+		req.APIURL = c.QueryParam("api_url")
+	}
+
+	src, err := services.ResolveRefreshSource(config.Get(), req.Source, req.APIURL)
+	switch {
+	case errors.Is(err, services.ErrUnknownSource):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, services.ErrURLNotAllowed):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	run, existing, err := services.EnqueueRefresh(src)
+	if err != nil {
+		if errors.Is(err, services.ErrRefreshQueueFull) {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	message := "refresh queued"
+	if existing {
+		message = "refresh already in progress"
+	}
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message":    message,
+		"job_id":     run.ID,
+		"status":     run.Status,
+		"source":     run.Source,
+		"status_url": fmt.Sprintf("/admin/pipeline/refresh/%d", run.ID),
+	})
+}
+
+// GetRefreshJob (ADMIN ONLY) reports the progress of a refresh job: its
+// status (queued, running, succeeded, failed, skipped), the current stage
+// while running and the processed counts once finished.
+func GetRefreshJob(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	run, err := services.GetPipelineRun(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Refresh job not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	done := run.FinishedAt != nil
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"job_id":    run.ID,
+		"status":    run.Status,
+		"stage":     run.Stage,
+		"done":      done,
+		"processed": run.RowsInserted + run.RowsUpdated + run.RowsSkipped,
+		"run":       run,
+	})
+}
+
+// ListPipelineRuns (ADMIN ONLY) returns pipeline run history, newest first.
+// Optional filters: source, status, limit (1..200, default 50), offset.
+func ListPipelineRuns(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	limit, offset := parsePagination(c, 50, 200)
+	runs, total, err := services.ListPipelineRuns(services.PipelineRunFilter{
+		Source: c.QueryParam("source"),
+		Status: c.QueryParam("status"),
+		Limit:  limit,
+		Offset: offset,
+	})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error":     err.Error(),
-			"api_url":   apiURL,
-			"processed": processed,
-		})
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message":   "refresh complete",
-		"api_url":   apiURL,
-		"processed": processed,
+		"data":   runs,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
 	})
 }
+
+// GetPipelineRun (ADMIN ONLY) returns a single pipeline run.
+func GetPipelineRun(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	run, err := services.GetPipelineRun(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Pipeline run not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, run)
+}
+
+// GetPipelineStatus (ADMIN ONLY) returns the latest run per source together
+// with outstanding dead-letter and quarantine counts.
+func GetPipelineStatus(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	status, err := services.GetPipelineStatus()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// GetSchemaDrift (ADMIN ONLY) returns the last detected upstream schema diff
+// per source (or for ?source= only); resolved_at is set once payloads match
+// the expected schema again.
+func GetSchemaDrift(c echo.Context) error {
+	if role, _ := c.Get("userRole").(string); role != "admin" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	}
+
+	drifts, err := services.LatestSchemaDrifts(c.QueryParam("source"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, drifts)
+}
+
+// parsePagination reads limit/offset query params, clamping limit to 1..max.
+func parsePagination(c echo.Context, def, max int) (int, int) {
+	limit := def
+	if v, err := strconv.Atoi(c.QueryParam("limit")); err == nil {
+		limit = v
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > max {
+		limit = max
+	}
+
+	offset := 0
+	if v, err := strconv.Atoi(c.QueryParam("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	return limit, offset
+}
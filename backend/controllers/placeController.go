@@ -6,21 +6,23 @@ import (
 	"time"
 
 	"yakkaw_dashboard/cache"
-	"yakkaw_dashboard/services"
+	"yakkaw_dashboard/repository"
 
 	"github.com/labstack/echo/v4"
 )
 
-func GetPlaces(c echo.Context) error {
+// GetPlaces (PUBLIC) lists the places of the current stations, optionally
+// filtered by province (or part of a place name).
+func (ctl *StationController) GetPlaces(c echo.Context) error {
 	province := c.QueryParam("province")
 	cacheKey := fmt.Sprintf("places:%s", province)
 
-	var cached []services.PlaceItem
+	var cached []repository.PlaceItem
 	if ok, err := cache.GetJSON(cacheKey, &cached); err == nil && ok {
 		return c.JSON(http.StatusOK, cached)
 	}
 
-	places, err := services.GetDistinctPlaces(province)
+	places, err := ctl.Service.GetDistinctPlaces(province)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
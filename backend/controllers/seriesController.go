@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/cache"
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SeriesController struct {
+	Service *services.SeriesService
+}
+
+// NewSeriesController เป็น constructor สำหรับ SeriesController
+func NewSeriesController(s *services.SeriesService) *SeriesController {
+	return &SeriesController{Service: s}
+}
+
+// GetSeries (PUBLIC) is the generic time-series endpoint:
+//
+//	GET /api/v2/series?from=2025-01-01&to=2025-02-01&interval=1d&metric=pm25
+//	    &group_by=province&agg=avg&province=เชียงใหม่&province=TH-57
+//
+// from/to are RFC3339 times or YYYY-MM-DD dates (Asia/Bangkok midnight); to is
+// exclusive and defaults to now, from to 24 hours before to. interval is 5m,
+// 1h (default), 1d, 1w or 1M; group_by is province, place, dvid or none
+// (default); agg is avg (default), min, max, median, p90 or count. The
+// province, place and dvid filters may be repeated or comma-separated.
+// exclude_anomalies=true leaves out readings flagged as spikes.
+func (ctl *SeriesController) GetSeries(c echo.Context) error {
+	q := services.SeriesQuery{
+		Interval:   queryDefault(c, "interval", "1h"),
+		Metric:     queryDefault(c, "metric", "pm25"),
+		GroupBy:    queryDefault(c, "group_by", services.SeriesGroupNone),
+		Aggregator: queryDefault(c, "agg", "avg"),
+		Provinces:  queryList(c, "province"),
+		Places:     queryList(c, "place"),
+		DVIDs:      queryList(c, "dvid"),
+	}
+
+	var err error
+	if q.ExcludeAnomalies, err = parseExcludeAnomalies(c); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	q.To = time.Now()
+	if v := c.QueryParam("to"); v != "" {
+		if q.To, err = parseSeriesTime(v); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid to: use RFC3339 or YYYY-MM-DD"})
+		}
+	}
+	q.From = q.To.Add(-24 * time.Hour)
+	if v := c.QueryParam("from"); v != "" {
+		if q.From, err = parseSeriesTime(v); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid from: use RFC3339 or YYYY-MM-DD"})
+		}
+	}
+
+	// Windows ending in the past are immutable apart from late readings; an
+	// open window is cached per minute.
+	ttl := time.Hour
+	if time.Since(q.To) < time.Hour {
+		ttl = time.Minute
+		q.To = q.To.Truncate(time.Minute)
+	}
+	cacheKey := fmt.Sprintf("series:%d:%d:%s:%s:%s:%s:%s:%s:%s:%t", q.From.Unix(), q.To.Unix(), q.Interval,
+		q.Metric, q.GroupBy, q.Aggregator, strings.Join(q.Provinces, ","), strings.Join(q.Places, ","), strings.Join(q.DVIDs, ","),
+		q.ExcludeAnomalies)
+	var cached services.SeriesResult
+	if ok, err := cache.GetJSON(cacheKey, &cached); err == nil && ok {
+		return c.JSON(http.StatusOK, cached)
+	}
+
+	result, err := ctl.Service.GetSeries(q)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSeriesQuery) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	_ = cache.SetJSON(cacheKey, result, ttl)
+	return c.JSON(http.StatusOK, result)
+}
+
+func parseSeriesTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, database.Bangkok)
+}
+
+func queryDefault(c echo.Context, name, def string) string {
+	if v := strings.TrimSpace(c.QueryParam(name)); v != "" {
+		return v
+	}
+	return def
+}
+
+// queryList collects a repeatable, comma-separated query parameter.
+func queryList(c echo.Context, name string) []string {
+	var out []string
+	for _, v := range c.QueryParams()[name] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
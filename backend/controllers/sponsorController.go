@@ -3,15 +3,24 @@ package controllers
 import (
 	"net/http"
 	"strconv"
-	"yakkaw_dashboard/database"
 	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
+type SponsorController struct {
+	Sponsors repository.SponsorRepository
+}
+
+// NewSponsorController เป็น constructor สำหรับ SponsorController
+func NewSponsorController(sponsors repository.SponsorRepository) *SponsorController {
+	return &SponsorController{Sponsors: sponsors}
+}
+
 // CreateSponsor - สร้าง sponsor ใหม่ (เฉพาะ admin)
-func CreateSponsor(c echo.Context) error {
+func (sc *SponsorController) CreateSponsor(c echo.Context) error {
 	userRole := c.Get("userRole")
 	if userRole != "admin" {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
@@ -23,7 +32,7 @@ func CreateSponsor(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
 	}
 
-	if err := database.DB.Create(&sponsor).Error; err != nil {
+	if err := sc.Sponsors.Create(&sponsor); err != nil {
 		c.Logger().Error("Error creating sponsor in DB: ", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create sponsor"})
 	}
@@ -32,10 +41,9 @@ func CreateSponsor(c echo.Context) error {
 }
 
 // GetSponsors - ดึงรายการ sponsor ทั้งหมด (เปิดให้ทุกคน)
-func GetSponsors(c echo.Context) error {
-	var sponsors []models.Sponsor
-
-	if err := database.DB.Find(&sponsors).Error; err != nil {
+func (sc *SponsorController) GetSponsors(c echo.Context) error {
+	sponsors, err := sc.Sponsors.List()
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch sponsors"})
 	}
 
@@ -43,7 +51,7 @@ func GetSponsors(c echo.Context) error {
 }
 
 // UpdateSponsor - อัปเดตข้อมูล sponsor (เฉพาะ admin)
-func UpdateSponsor(c echo.Context) error {
+func (sc *SponsorController) UpdateSponsor(c echo.Context) error {
 	userRole := c.Get("userRole")
 	if userRole != "admin" {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
@@ -55,8 +63,8 @@ func UpdateSponsor(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
 	}
 
-	var sponsor models.Sponsor
-	if err := database.DB.First(&sponsor, uint(uintID)).Error; err != nil {
+	sponsor, err := sc.Sponsors.FindByID(uint(uintID))
+	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "Sponsor not found"})
 		}
@@ -67,7 +75,7 @@ func UpdateSponsor(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input"})
 	}
 
-	if err := database.DB.Save(&sponsor).Error; err != nil {
+	if err := sc.Sponsors.Save(&sponsor); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update sponsor"})
 	}
 
@@ -75,7 +83,7 @@ func UpdateSponsor(c echo.Context) error {
 }
 
 // DeleteSponsor - ลบ sponsor (เฉพาะ admin)
-func DeleteSponsor(c echo.Context) error {
+func (sc *SponsorController) DeleteSponsor(c echo.Context) error {
 	userRole := c.Get("userRole")
 	if userRole != "admin" {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "Permission denied"})
@@ -87,7 +95,10 @@ func DeleteSponsor(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
 	}
 
-	if err := database.DB.Delete(&models.Sponsor{}, uint(uintID)).Error; err != nil {
+	if err := sc.Sponsors.Delete(uint(uintID)); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Sponsor not found"})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete sponsor"})
 	}
 
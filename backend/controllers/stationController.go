@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"yakkaw_dashboard/aqi"
+	"yakkaw_dashboard/cache"
+	"yakkaw_dashboard/services"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type StationController struct {
+	Service *services.StationService
+}
+
+// NewStationController เป็น constructor สำหรับ StationController
+func NewStationController(s *services.StationService) *StationController {
+	return &StationController{Service: s}
+}
+
+// GetStationProfile (PUBLIC) ข้อมูลสถานีปัจจุบัน + reading ล่าสุด + NowCast
+// ค่า AQI ของ NowCast คำนวณตาม aqi_standard=th|us (ค่าเริ่มต้น th)
+func (ctl *StationController) GetStationProfile(c echo.Context) error {
+	dvid := c.Param("dvid")
+	std, err := aqi.Parse(c.QueryParam("aqi_standard"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	cacheKey := fmt.Sprintf("station:profile:%s:%s", dvid, std.Code)
+	var cached services.StationProfile
+	if ok, err := cache.GetJSON(cacheKey, &cached); err == nil && ok {
+		return c.JSON(http.StatusOK, cached)
+	}
+
+	profile, err := ctl.Service.GetStationProfile(dvid, std)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Station not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	_ = cache.SetJSON(cacheKey, profile, time.Minute)
+	return c.JSON(http.StatusOK, profile)
+}
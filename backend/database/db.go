@@ -6,8 +6,6 @@ import (
 	"os"
 	"time"
 
-	"yakkaw_dashboard/models"
-
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -19,10 +17,31 @@ var err error
 const (
 	maxDBRetries = 10
 	retryDelay   = 3 * time.Second
+
+	// initialPartitionsAhead monthly partitions are created at startup and by
+	// the baseline migration so writes never depend on the maintenance job
+	// having run.
+	initialPartitionsAhead = 2
 )
 
-// Init initializes the database connection using environment variables
+// Init connects to the database and makes sure its schema is fully migrated;
+// the process exits otherwise. Run `main migrate up` to migrate.
 func Init() {
+	Connect()
+
+	if err := RequireMigrated(DB); err != nil {
+		log.Fatalf("%v", err)
+	}
+	// the maintenance job keeps partitions ahead of time; this covers a fresh start
+	if err := EnsureReadingsPartitions(DB, time.Now(), initialPartitionsAhead); err != nil {
+		log.Fatalf("failed to create readings partitions: %v", err)
+	}
+	fmt.Println("Database connection successfully established")
+}
+
+// Connect opens the database connection using environment variables, without
+// checking the schema (the migrate command uses it directly).
+func Connect() {
 	// Load .env file
 	// Load .env if present; do not fail if missing
 	_ = godotenv.Load()
@@ -50,7 +69,4 @@ func Init() {
 	if err != nil {
 		log.Fatalf("failed to connect to database after %d attempts: %v", maxDBRetries, err)
 	}
-
-	DB.AutoMigrate(&models.Notification{}, &models.User{}, &models.Sponsor{}, &models.SensorData{}, &models.APIResponse{}, &models.ChartData{}, models.DatasetChart{}, &models.Category{}, &models.News{}, &models.Device{}, &models.ColorRange{})
-	fmt.Println("Database connection successfully established and migrations applied")
 }
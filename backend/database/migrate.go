@@ -0,0 +1,358 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schema changes are versioned SQL scripts in migrations/, named
+// NNNN_name.up.sql with an optional NNNN_name.down.sql. Each migration runs in
+// its own transaction and is recorded in schema_migrations; the server refuses
+// to start until every migration is applied (`main migrate up`). The
+// baseline (0001) has no down script: it converts whatever schema the database
+// had before, so there is nothing to go back to, and MigrateTo refuses any
+// target below it.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// migrateLockKey serialises migration runs across replicas
+// (pg_advisory_xact_lock).
+const migrateLockKey = 7146002
+
+// migrationHooks run in Go after a migration's up script, for steps SQL alone
+// cannot express.
+var migrationHooks = map[int]func(tx *gorm.DB) error{
+	1: baselineHook,
+}
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // empty: the migration cannot be reverted
+}
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string { return "schema_migrations" }
+
+// MigrationState is a migration and whether it is applied. Unknown marks a
+// version recorded in the database that this binary does not have (the
+// database was migrated by a newer release).
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := migrationFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must be NNNN_name.up.sql or NNNN_name.down.sql", e.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := migrationFiles.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// LatestMigration returns the highest embedded migration version.
+func LatestMigration() (int, error) {
+	migs, err := Migrations()
+	if err != nil || len(migs) == 0 {
+		return 0, err
+	}
+	return migs[len(migs)-1].Version, nil
+}
+
+// MigrationStatus lists every embedded migration with its applied time, plus
+// applied versions this binary does not know.
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	migs, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []MigrationState
+	for _, m := range migs {
+		s := MigrationState{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			s.AppliedAt = &a.AppliedAt
+			delete(applied, m.Version)
+		}
+		out = append(out, s)
+	}
+	for _, a := range applied {
+		at := a.AppliedAt
+		out = append(out, MigrationState{Migration: Migration{Version: a.Version, Name: a.Name}, AppliedAt: &at, Unknown: true})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// MigrateTo applies or reverts migrations until exactly those up to target
+// are applied, and returns the migrations it ran. MigrateTo(db, latest)
+// applies everything pending.
+func MigrateTo(db *gorm.DB, target int) ([]Migration, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	migs, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRevertible(migs, applied, target); err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range migs {
+		if m.Version > target {
+			break
+		}
+		done, err := runMigration(db, m, true)
+		if err != nil {
+			return ran, err
+		}
+		if done {
+			ran = append(ran, m)
+		}
+	}
+	for i := len(migs) - 1; i >= 0; i-- {
+		m := migs[i]
+		if m.Version <= target {
+			break
+		}
+		done, err := runMigration(db, m, false)
+		if err != nil {
+			return ran, err
+		}
+		if done {
+			ran = append(ran, m)
+		}
+	}
+	return ran, nil
+}
+
+// checkRevertible fails, before anything is run, when reaching target would
+// revert an applied migration that has no down script.
+func checkRevertible(migs []Migration, applied map[int]SchemaMigration, target int) error {
+	for i := len(migs) - 1; i >= 0; i-- {
+		m := migs[i]
+		if m.Version <= target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok && m.Down == "" {
+			return fmt.Errorf("cannot migrate below %04d_%s: it has no down script (the baseline is irreversible; restore a backup or recreate the database instead)", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts the last steps applied migrations.
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	var applied []MigrationState
+	for _, s := range states {
+		if s.AppliedAt != nil {
+			if s.Unknown {
+				return nil, fmt.Errorf("migration %d is applied but unknown to this binary; revert it with the release that added it", s.Version)
+			}
+			applied = append(applied, s)
+		}
+	}
+	if steps > len(applied) {
+		steps = len(applied)
+	}
+	target := 0
+	if i := len(applied) - steps - 1; i >= 0 {
+		target = applied[i].Version
+	}
+	return MigrateTo(db, target)
+}
+
+// RequireMigrated returns an error unless every embedded migration has been
+// applied. Migrations applied by a newer release are only logged.
+func RequireMigrated(db *gorm.DB) error {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, s := range states {
+		switch {
+		case s.Unknown:
+			log.Printf("database has migration %d_%s, which this binary does not know", s.Version, s.Name)
+		case s.AppliedAt == nil:
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is not up to date (pending: %v); run `main migrate up`", pending)
+	}
+	return nil
+}
+
+// runMigration applies (up) or reverts one migration in a transaction unless
+// another run already did, and reports whether it changed anything.
+func runMigration(db *gorm.DB, m Migration, up bool) (bool, error) {
+	if !up && m.Down == "" {
+		var n int64
+		if err := db.Model(&SchemaMigration{}).Where("version = ?", m.Version).Count(&n).Error; err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return false, fmt.Errorf("migration %04d_%s cannot be reverted", m.Version, m.Name)
+		}
+		return false, nil
+	}
+
+	done := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`SELECT pg_advisory_xact_lock(?)`, migrateLockKey).Error; err != nil {
+			return err
+		}
+		var n int64
+		if err := tx.Model(&SchemaMigration{}).Where("version = ?", m.Version).Count(&n).Error; err != nil {
+			return err
+		}
+		if (n > 0) == up {
+			return nil
+		}
+
+		began := time.Now()
+		if !up {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return err
+			}
+			done = true
+			log.Printf("reverted migration %04d_%s in %s", m.Version, m.Name, time.Since(began).Round(time.Millisecond))
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		}
+
+		if err := tx.Exec(m.Up).Error; err != nil {
+			return err
+		}
+		if hook := migrationHooks[m.Version]; hook != nil {
+			if err := hook(tx); err != nil {
+				return err
+			}
+		}
+		done = true
+		log.Printf("applied migration %04d_%s in %s", m.Version, m.Name, time.Since(began).Round(time.Millisecond))
+		return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+	})
+	if err != nil {
+		dir := "up"
+		if !up {
+			dir = "down"
+		}
+		return false, fmt.Errorf("migration %04d_%s %s: %w", m.Version, m.Name, dir, err)
+	}
+	return done, nil
+}
+
+func ensureMigrationsTable(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name varchar(255) NOT NULL,
+		applied_at timestamptz NOT NULL
+	)`).Error
+}
+
+func appliedMigrations(db *gorm.DB) (map[int]SchemaMigration, error) {
+	var exists bool
+	if err := db.Raw(`SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists).Error; err != nil {
+		return nil, err
+	}
+	applied := map[int]SchemaMigration{}
+	if !exists {
+		return applied, nil
+	}
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// baselineHook brings any earlier database, down to one with the original
+// wide sensor_data table, to the baseline: legacy rows are split into
+// readings and stations, readings is partitioned by month, the sensor_data
+// view is created and station addresses are parsed. Each step is a no-op when
+// already done.
+func baselineHook(tx *gorm.DB) error {
+	if err := migrateSensorDataSplit(tx); err != nil {
+		return fmt.Errorf("split sensor_data: %w", err)
+	}
+	if err := migrateReadingsPartitioning(tx, initialPartitionsAhead); err != nil {
+		return fmt.Errorf("partition readings: %w", err)
+	}
+	if err := migrateStationAddresses(tx); err != nil {
+		return fmt.Errorf("parse station addresses: %w", err)
+	}
+	return nil
+}
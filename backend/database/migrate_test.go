@@ -0,0 +1,50 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	migs, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migs) == 0 || migs[0].Version != 1 || migs[0].Name != "baseline" {
+		t.Fatalf("first migration = %+v, want 0001_baseline", migs[0])
+	}
+	if migs[0].Down != "" {
+		t.Error("the baseline has a down script")
+	}
+	for i, m := range migs {
+		if i > 0 && m.Version != migs[i-1].Version+1 {
+			t.Errorf("migration %d follows %d; versions must be consecutive", m.Version, migs[i-1].Version)
+		}
+		if i > 0 && m.Down == "" {
+			t.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
+
+func TestCheckRevertible(t *testing.T) {
+	migs := []Migration{
+		{Version: 1, Name: "baseline", Up: "up"},
+		{Version: 2, Name: "two", Up: "up", Down: "down"},
+		{Version: 3, Name: "three", Up: "up", Down: "down"},
+	}
+	applied := map[int]SchemaMigration{1: {Version: 1}, 2: {Version: 2}, 3: {Version: 3}}
+
+	for _, target := range []int{3, 2, 1} {
+		if err := checkRevertible(migs, applied, target); err != nil {
+			t.Errorf("target %d: %v", target, err)
+		}
+	}
+	err := checkRevertible(migs, applied, 0)
+	if err == nil || !strings.Contains(err.Error(), "0001_baseline") {
+		t.Errorf("target 0: err = %v, want the baseline refused", err)
+	}
+	// Nothing applied: nothing to revert.
+	if err := checkRevertible(migs, map[int]SchemaMigration{}, 0); err != nil {
+		t.Errorf("empty database, target 0: %v", err)
+	}
+}
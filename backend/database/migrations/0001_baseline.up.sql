@@ -0,0 +1,76 @@
+-- Baseline: the schema AutoMigrate maintained before versioned migrations.
+-- Every statement is idempotent so databases created by AutoMigrate adopt it
+-- unchanged. readings starts unpartitioned here; the baseline hook in
+-- migrate.go converts legacy data, partitions readings, creates the
+-- sensor_data view and parses station addresses.
+
+CREATE TABLE IF NOT EXISTS "notifications" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"title" text,"message" text,"category" text,"icon" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_notifications_deleted_at" ON "notifications" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "users" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"username" text,"password" text,"role" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "sponsors" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text,"logo" text,"description" text,"category" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_sponsors_deleted_at" ON "sponsors" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "readings" ("id" bigserial,"dvid" varchar(10) NOT NULL,"timestamp" bigint NOT NULL,"status" varchar(20),"ddate" varchar(50),"dtime" varchar(50),"av24h" bigint,"av12h" bigint,"av6h" bigint,"av3h" bigint,"av1h" bigint,"pm25" bigint,"pm10" bigint,"pm100" bigint,"aqi" bigint,"temperature" bigint,"humidity" bigint,"pres" bigint,"color" varchar(5),"trend" varchar(5),PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_readings_dvid_timestamp" ON "readings" ("dvid","timestamp");
+
+CREATE TABLE IF NOT EXISTS "stations" ("id" bigserial,"dvid" varchar(10) NOT NULL,"version" bigint NOT NULL,"valid_from" bigint NOT NULL,"valid_to" bigint,"deviceid" varchar(20),"latitude" decimal,"longitude" decimal,"place" text,"address" text,"model" varchar(50),"deploydate" varchar(50),"contactname" varchar(50),"contactphone" varchar(20),"note" text,"province" varchar(50),"province_code" varchar(5),"district" varchar(100),"subdistrict" varchar(100),"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_stations_province_code" ON "stations" ("province_code");
+CREATE INDEX IF NOT EXISTS "idx_stations_province" ON "stations" ("province");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_stations_current" ON "stations" ("dvid") WHERE valid_to IS NULL;
+CREATE INDEX IF NOT EXISTS "idx_stations_dvid_valid_from" ON "stations" ("dvid","valid_from");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_stations_dvid_version" ON "stations" ("dvid","version");
+
+CREATE TABLE IF NOT EXISTS "categories" ("id" bigserial,"name" varchar(100),PRIMARY KEY ("id"));
+
+CREATE TABLE IF NOT EXISTS "news" ("id" bigserial,"title" varchar(200),"description" text,"image" varchar(255),"url" varchar(255),"date" timestamptz,"category_id" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_categories_news" FOREIGN KEY ("category_id") REFERENCES "categories"("id"));
+
+CREATE TABLE IF NOT EXISTS "devices" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"dv_id" varchar(255) NOT NULL,"address" varchar(255) NOT NULL,"longitude" decimal NOT NULL,"latitude" decimal NOT NULL,"place" varchar(255) NOT NULL,"models" varchar(255) NOT NULL,"contact_name" varchar(255) NOT NULL,"contact_phone" varchar(255) NOT NULL,"deploy_date" timestamp NOT NULL,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_devices_deleted_at" ON "devices" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "color_ranges" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"min" bigint,"max" bigint,"color" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_color_ranges_deleted_at" ON "color_ranges" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "pipeline_runs" ("id" bigserial,"source" varchar(100),"trigger" varchar(20),"status" varchar(20),"stage" varchar(20),"started_at" timestamptz,"finished_at" timestamptz,"http_status" bigint,"attempts" bigint,"rows_received" bigint,"rows_inserted" bigint,"rows_updated" bigint,"rows_skipped" bigint,"rows_failed" bigint,"rows_quarantined" bigint,"rows_dead_lettered" bigint,"error" text,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_pipeline_runs_started_at" ON "pipeline_runs" ("started_at");
+CREATE INDEX IF NOT EXISTS "idx_pipeline_runs_status" ON "pipeline_runs" ("status");
+CREATE INDEX IF NOT EXISTS "idx_pipeline_runs_source" ON "pipeline_runs" ("source");
+
+CREATE TABLE IF NOT EXISTS "sensor_data_quarantine" ("id" bigserial,"source" varchar(100),"dvid" varchar(10),"timestamp" bigint,"rule" varchar(50),"reason" text,"payload" jsonb,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_sensor_data_quarantine_rule" ON "sensor_data_quarantine" ("rule");
+CREATE INDEX IF NOT EXISTS "idx_sensor_data_quarantine_dv_id" ON "sensor_data_quarantine" ("dvid");
+CREATE INDEX IF NOT EXISTS "idx_sensor_data_quarantine_source" ON "sensor_data_quarantine" ("source");
+
+CREATE TABLE IF NOT EXISTS "backfill_checkpoints" ("file" text,"size" bigint,"mod_time" timestamptz,"records" bigint,"done" boolean,"updated_at" timestamptz,PRIMARY KEY ("file"));
+
+CREATE TABLE IF NOT EXISTS "device_api_keys" ("id" bigserial,"dvid" varchar(255) NOT NULL,"label" varchar(100),"prefix" varchar(16),"key_hash" char(64) NOT NULL,"last_used_at" timestamptz,"revoked_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_device_api_keys_key_hash" ON "device_api_keys" ("key_hash");
+CREATE INDEX IF NOT EXISTS "idx_device_api_keys_dv_id" ON "device_api_keys" ("dvid");
+
+CREATE TABLE IF NOT EXISTS "dead_letters" ("id" bigserial,"source" varchar(100),"dvid" text,"timestamp" bigint,"error" text,"payload" jsonb,"attempts" bigint DEFAULT 1,"last_attempt_at" timestamptz,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_dead_letters_dv_id" ON "dead_letters" ("dvid");
+CREATE INDEX IF NOT EXISTS "idx_dead_letters_source" ON "dead_letters" ("source");
+
+CREATE TABLE IF NOT EXISTS "raw_payloads" ("id" bigserial,"source" varchar(100),"run_id" bigint,"url" text,"status_code" bigint,"content_type" varchar(100),"fetched_at" timestamptz,"size" bigint,"sha256" char(64),"body" bytea,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_raw_payloads_sha256" ON "raw_payloads" ("sha256");
+CREATE INDEX IF NOT EXISTS "idx_raw_payloads_fetched_at" ON "raw_payloads" ("fetched_at");
+CREATE INDEX IF NOT EXISTS "idx_raw_payloads_run_id" ON "raw_payloads" ("run_id");
+CREATE INDEX IF NOT EXISTS "idx_raw_payloads_source_fetched" ON "raw_payloads" ("source","fetched_at");
+
+CREATE TABLE IF NOT EXISTS "schema_drifts" ("id" bigserial,"source" varchar(100),"fingerprint" char(64),"added" jsonb,"removed" jsonb,"type_changed" jsonb,"records" bigint,"occurrences" bigint,"first_seen_at" timestamptz,"last_seen_at" timestamptz,"resolved_at" timestamptz,"notification_id" bigint,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_schema_drifts_fingerprint" ON "schema_drifts" ("fingerprint");
+CREATE INDEX IF NOT EXISTS "idx_schema_drifts_source" ON "schema_drifts" ("source");
+CREATE INDEX IF NOT EXISTS "idx_schema_drifts_last_seen_at" ON "schema_drifts" ("last_seen_at");
+
+CREATE TABLE IF NOT EXISTS "readings_monthly" ("dvid" varchar(10),"month" date,"readings" bigint,"pm25_avg" decimal,"pm25_min" bigint,"pm25_max" bigint,"pm10_avg" decimal,"pm10_min" bigint,"pm10_max" bigint,"aqi_avg" decimal,"aqi_max" bigint,"temperature_avg" decimal,"humidity_avg" decimal,"rolled_up_at" timestamptz,PRIMARY KEY ("dvid","month"));
+
+CREATE TABLE IF NOT EXISTS "rollup_hourly" ("scope" varchar(10),"key" varchar(255),"bucket" timestamp,"readings" bigint,"pm25_avg" decimal,"pm25_min" bigint,"pm25_max" bigint,"pm25_count" bigint,"pm10_avg" decimal,"pm10_min" bigint,"pm10_max" bigint,"pm10_count" bigint,"aqi_avg" decimal,"aqi_min" bigint,"aqi_max" bigint,"aqi_count" bigint,"temperature_avg" decimal,"temperature_min" bigint,"temperature_max" bigint,"temperature_count" bigint,"humidity_avg" decimal,"humidity_min" bigint,"humidity_max" bigint,"humidity_count" bigint,"updated_at" timestamptz,PRIMARY KEY ("scope","key","bucket"));
+CREATE INDEX IF NOT EXISTS "idx_rollup_hourly_scope_bucket" ON "rollup_hourly" ("scope","bucket");
+
+CREATE TABLE IF NOT EXISTS "rollup_daily" ("scope" varchar(10),"key" varchar(255),"bucket" timestamp,"readings" bigint,"pm25_avg" decimal,"pm25_min" bigint,"pm25_max" bigint,"pm25_count" bigint,"pm10_avg" decimal,"pm10_min" bigint,"pm10_max" bigint,"pm10_count" bigint,"aqi_avg" decimal,"aqi_min" bigint,"aqi_max" bigint,"aqi_count" bigint,"temperature_avg" decimal,"temperature_min" bigint,"temperature_max" bigint,"temperature_count" bigint,"humidity_avg" decimal,"humidity_min" bigint,"humidity_max" bigint,"humidity_count" bigint,"updated_at" timestamptz,PRIMARY KEY ("scope","key","bucket"));
+CREATE INDEX IF NOT EXISTS "idx_rollup_daily_scope_bucket" ON "rollup_daily" ("scope","bucket");
+
+CREATE TABLE IF NOT EXISTS "rollup_dirty_hours" ("hour" bigint,"marked_at" timestamptz,PRIMARY KEY ("hour"));
+CREATE INDEX IF NOT EXISTS "idx_rollup_dirty_hours_marked_at" ON "rollup_dirty_hours" ("marked_at");
@@ -0,0 +1,3 @@
+CREATE TABLE IF NOT EXISTS "api_responses" ();
+CREATE TABLE IF NOT EXISTS "chart_data" ("labels" json,"datasets" json);
+CREATE TABLE IF NOT EXISTS "dataset_charts" ("label" json,"data" json);
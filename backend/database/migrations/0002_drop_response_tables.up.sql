@@ -0,0 +1,5 @@
+-- AutoMigrate was also handed the API response structs and created empty
+-- tables for them; nothing reads or writes these.
+DROP TABLE IF EXISTS "api_responses";
+DROP TABLE IF EXISTS "chart_data";
+DROP TABLE IF EXISTS "dataset_charts";
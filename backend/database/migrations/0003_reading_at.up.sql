@@ -0,0 +1,46 @@
+-- reading_at is the reading time as timestamptz, derived from the epoch-ms
+-- timestamp so it can never disagree with it. Filters on reading_at can use
+-- the indexes below; timestamp stays the partition key.
+ALTER TABLE readings ADD COLUMN reading_at timestamptz
+	GENERATED ALWAYS AS (to_timestamp(timestamp::double precision / 1000)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_readings_reading_at ON readings (reading_at);
+CREATE INDEX IF NOT EXISTS idx_readings_dvid_reading_at ON readings (dvid, reading_at);
+
+-- Province filters resolve to station versions first, then to their
+-- readings through (dvid, reading_at).
+DROP INDEX IF EXISTS idx_stations_province;
+CREATE INDEX IF NOT EXISTS idx_stations_province_dvid ON stations (province, dvid, valid_from);
+
+CREATE OR REPLACE VIEW sensor_data AS
+SELECT
+	r.id,
+	r.dvid,
+	COALESCE(s.deviceid, '') AS deviceid,
+	r.status,
+	COALESCE(s.latitude, 0) AS latitude,
+	COALESCE(s.longitude, 0) AS longitude,
+	COALESCE(s.place, '') AS place,
+	COALESCE(s.address, '') AS address,
+	COALESCE(s.model, '') AS model,
+	COALESCE(s.deploydate, '') AS deploydate,
+	COALESCE(s.contactname, '') AS contactname,
+	COALESCE(s.contactphone, '') AS contactphone,
+	COALESCE(s.note, '') AS note,
+	r.ddate,
+	r.dtime,
+	r.timestamp,
+	r.av24h, r.av12h, r.av6h, r.av3h, r.av1h,
+	r.pm25, r.pm10, r.pm100, r.aqi,
+	r.temperature, r.humidity, r.pres,
+	r.color, r.trend,
+	COALESCE(s.province, '') AS province,
+	COALESCE(s.province_code, '') AS province_code,
+	COALESCE(s.district, '') AS district,
+	COALESCE(s.subdistrict, '') AS subdistrict,
+	r.reading_at
+FROM readings r
+LEFT JOIN stations s
+	ON s.dvid = r.dvid
+	AND s.valid_from <= r.timestamp
+	AND (s.valid_to IS NULL OR r.timestamp < s.valid_to);
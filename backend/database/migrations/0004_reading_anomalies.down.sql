@@ -0,0 +1,37 @@
+-- A view cannot lose a column in place, so it is rebuilt without anomaly.
+DROP VIEW sensor_data;
+CREATE VIEW sensor_data AS
+SELECT
+	r.id,
+	r.dvid,
+	COALESCE(s.deviceid, '') AS deviceid,
+	r.status,
+	COALESCE(s.latitude, 0) AS latitude,
+	COALESCE(s.longitude, 0) AS longitude,
+	COALESCE(s.place, '') AS place,
+	COALESCE(s.address, '') AS address,
+	COALESCE(s.model, '') AS model,
+	COALESCE(s.deploydate, '') AS deploydate,
+	COALESCE(s.contactname, '') AS contactname,
+	COALESCE(s.contactphone, '') AS contactphone,
+	COALESCE(s.note, '') AS note,
+	r.ddate,
+	r.dtime,
+	r.timestamp,
+	r.av24h, r.av12h, r.av6h, r.av3h, r.av1h,
+	r.pm25, r.pm10, r.pm100, r.aqi,
+	r.temperature, r.humidity, r.pres,
+	r.color, r.trend,
+	COALESCE(s.province, '') AS province,
+	COALESCE(s.province_code, '') AS province_code,
+	COALESCE(s.district, '') AS district,
+	COALESCE(s.subdistrict, '') AS subdistrict,
+	r.reading_at
+FROM readings r
+LEFT JOIN stations s
+	ON s.dvid = r.dvid
+	AND s.valid_from <= r.timestamp
+	AND (s.valid_to IS NULL OR r.timestamp < s.valid_to);
+
+DROP TABLE IF EXISTS reading_anomalies;
+ALTER TABLE readings DROP COLUMN IF EXISTS anomaly;
@@ -0,0 +1,51 @@
+-- anomaly flags PM2.5 spikes found by the rolling median/MAD detector
+-- (services.DetectAnomalies); aggregations can leave flagged readings out.
+ALTER TABLE readings ADD COLUMN IF NOT EXISTS anomaly boolean NOT NULL DEFAULT false;
+
+-- The baseline each flag was raised against, for the admin report.
+CREATE TABLE IF NOT EXISTS reading_anomalies (
+	dvid varchar(10) NOT NULL,
+	timestamp bigint NOT NULL,
+	pm25 bigint NOT NULL,
+	median double precision NOT NULL,
+	mad double precision NOT NULL,
+	score double precision NOT NULL,
+	samples integer NOT NULL,
+	detected_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (dvid, timestamp)
+);
+CREATE INDEX IF NOT EXISTS idx_reading_anomalies_timestamp ON reading_anomalies (timestamp);
+
+CREATE OR REPLACE VIEW sensor_data AS
+SELECT
+	r.id,
+	r.dvid,
+	COALESCE(s.deviceid, '') AS deviceid,
+	r.status,
+	COALESCE(s.latitude, 0) AS latitude,
+	COALESCE(s.longitude, 0) AS longitude,
+	COALESCE(s.place, '') AS place,
+	COALESCE(s.address, '') AS address,
+	COALESCE(s.model, '') AS model,
+	COALESCE(s.deploydate, '') AS deploydate,
+	COALESCE(s.contactname, '') AS contactname,
+	COALESCE(s.contactphone, '') AS contactphone,
+	COALESCE(s.note, '') AS note,
+	r.ddate,
+	r.dtime,
+	r.timestamp,
+	r.av24h, r.av12h, r.av6h, r.av3h, r.av1h,
+	r.pm25, r.pm10, r.pm100, r.aqi,
+	r.temperature, r.humidity, r.pres,
+	r.color, r.trend,
+	COALESCE(s.province, '') AS province,
+	COALESCE(s.province_code, '') AS province_code,
+	COALESCE(s.district, '') AS district,
+	COALESCE(s.subdistrict, '') AS subdistrict,
+	r.reading_at,
+	r.anomaly
+FROM readings r
+LEFT JOIN stations s
+	ON s.dvid = r.dvid
+	AND s.valid_from <= r.timestamp
+	AND (s.valid_to IS NULL OR r.timestamp < s.valid_to);
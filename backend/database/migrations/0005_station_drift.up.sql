@@ -0,0 +1,18 @@
+-- The latest drift check of each station against its neighbours
+-- (services.DetectDrift): how far its daily PM2.5 means sit from the median of
+-- the stations around it, and how fast that is changing.
+CREATE TABLE IF NOT EXISTS station_drift (
+	dvid varchar(10) NOT NULL,
+	window_from date NOT NULL,
+	window_to date NOT NULL,
+	days integer NOT NULL,
+	neighbours integer NOT NULL,
+	ratio double precision NOT NULL,
+	score double precision NOT NULL,
+	mean_diff double precision NOT NULL,
+	trend double precision NOT NULL,
+	flagged boolean NOT NULL DEFAULT false,
+	reason text NOT NULL DEFAULT '',
+	computed_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (dvid)
+);
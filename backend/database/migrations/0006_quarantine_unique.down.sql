@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_sensor_data_quarantine_reading;
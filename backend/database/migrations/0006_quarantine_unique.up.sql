@@ -0,0 +1,12 @@
+-- A reading rejected on every poll is quarantined once per rule: keep the
+-- newest copy of each and make the key unique so quarantineRows can upsert.
+DELETE FROM sensor_data_quarantine q
+USING sensor_data_quarantine n
+WHERE n.source = q.source
+	AND n.dvid = q.dvid
+	AND n.timestamp = q.timestamp
+	AND n.rule = q.rule
+	AND n.id > q.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sensor_data_quarantine_reading
+	ON sensor_data_quarantine (source, dvid, timestamp, rule);
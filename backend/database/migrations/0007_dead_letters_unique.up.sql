@@ -0,0 +1,22 @@
+-- A reading the database keeps refusing is one dead letter whose attempts
+-- count up: fold existing copies into the newest and make the key unique so
+-- deadLetterRows can upsert.
+UPDATE dead_letters d
+SET attempts = g.attempts, created_at = g.created_at
+FROM (
+	SELECT max(id) AS id, sum(attempts) AS attempts, min(created_at) AS created_at
+	FROM dead_letters
+	GROUP BY source, dvid, timestamp
+	HAVING count(*) > 1
+) g
+WHERE d.id = g.id;
+
+DELETE FROM dead_letters d
+USING dead_letters n
+WHERE n.source = d.source
+	AND n.dvid = d.dvid
+	AND n.timestamp = d.timestamp
+	AND n.id > d.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dead_letters_reading
+	ON dead_letters (source, dvid, timestamp);
@@ -0,0 +1,19 @@
+package database
+
+import "fmt"
+
+// ReadingWindowSQL restricts sensor_data rows to reading times in [from, to),
+// both SQL timestamptz expressions. reading_at is what the time indexes cover;
+// the same bounds on timestamp, the partition key, let the planner skip the
+// monthly partitions outside the window.
+func ReadingWindowSQL(from, to string) string {
+	return fmt.Sprintf("reading_at >= %[1]s AND reading_at < %[2]s AND timestamp >= epoch_ms(%[1]s) AND timestamp < epoch_ms(%[2]s)", from, to)
+}
+
+// ReadingsSinceSQL restricts rows to the last interval (e.g. "24 hours").
+func ReadingsSinceSQL(interval string) string {
+	return ReadingWindowSQL("now() - interval '"+interval+"'", "now()")
+}
+
+// BangkokTodaySQL is the start of the current day in Asia/Bangkok.
+const BangkokTodaySQL = `(date_trunc('day', now() AT TIME ZONE 'Asia/Bangkok') AT TIME ZONE 'Asia/Bangkok')`
@@ -0,0 +1,236 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// readings is range-partitioned by month on timestamp (epoch ms). Months are
+// calendar months in Asia/Bangkok, so a partition holds exactly the readings
+// the dashboards show for that month. Rows outside every monthly partition
+// (far past, far future, or a month whose partition was retired) land in
+// readings_default.
+const readingsDefaultPartition = "readings_default"
+
+// oldestPartitionMonth bounds the monthly partitions created when converting
+// an existing table; older (bogus) timestamps stay in the default partition.
+var oldestPartitionMonth = time.Date(2015, time.January, 1, 0, 0, 0, 0, Bangkok)
+
+// Bangkok is the zone partition months are cut in. A fixed offset keeps it
+// working in images without tzdata; Thailand has no DST.
+var Bangkok = time.FixedZone("Asia/Bangkok", 7*60*60)
+
+var partitionNameRe = regexp.MustCompile(`^readings_p(\d{4})_(\d{2})$`)
+
+// epochMsFuncSQL lets queries compare the raw timestamp column with a time
+// expression (timestamp >= epoch_ms(now() - interval '1 year')) so the
+// planner can prune partitions; wrapping the column in to_timestamp() cannot.
+const epochMsFuncSQL = `
+CREATE OR REPLACE FUNCTION epoch_ms(t timestamptz) RETURNS bigint
+LANGUAGE sql IMMUTABLE PARALLEL SAFE
+AS $$ SELECT (EXTRACT(EPOCH FROM t) * 1000)::bigint $$`
+
+// ReadingsPartition is one monthly partition of readings.
+type ReadingsPartition struct {
+	Name  string
+	Month time.Time // first instant of the month in Bangkok
+}
+
+// Bounds returns the partition's [from, to) range in epoch milliseconds.
+func (p ReadingsPartition) Bounds() (int64, int64) {
+	return p.Month.UnixMilli(), p.Month.AddDate(0, 1, 0).UnixMilli()
+}
+
+// MonthStart truncates t to the first instant of its month in Bangkok.
+func MonthStart(t time.Time) time.Time {
+	t = t.In(Bangkok)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, Bangkok)
+}
+
+// PartitionName returns the name of the partition holding month.
+func PartitionName(month time.Time) string {
+	month = month.In(Bangkok)
+	return fmt.Sprintf("readings_p%04d_%02d", month.Year(), int(month.Month()))
+}
+
+// migrateReadingsPartitioning converts an unpartitioned readings table into
+// a monthly partitioned one, copying its rows, and re-points the sensor_data
+// view at it. It is a no-op once readings is partitioned, apart from making
+// sure the partitions up to aheadMonths from now exist.
+func migrateReadingsPartitioning(db *gorm.DB, aheadMonths int) error {
+	if err := db.Exec(epochMsFuncSQL).Error; err != nil {
+		return err
+	}
+
+	var relkind string
+	if err := db.Raw(`SELECT relkind::text FROM pg_class WHERE oid = to_regclass('readings')`).
+		Scan(&relkind).Error; err != nil {
+		return err
+	}
+	if relkind == "p" {
+		return EnsureReadingsPartitions(db, time.Now(), aheadMonths)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		log.Println("partitioning readings by month (this may take a while)")
+
+		for _, stmt := range []string{
+			`ALTER TABLE readings RENAME TO readings_unpartitioned`,
+			`ALTER TABLE readings_unpartitioned RENAME CONSTRAINT readings_pkey TO readings_unpartitioned_pkey`,
+			`ALTER INDEX idx_readings_dvid_timestamp RENAME TO idx_readings_unpartitioned_dvid_timestamp`,
+			`CREATE TABLE readings (LIKE readings_unpartitioned INCLUDING DEFAULTS INCLUDING STORAGE)
+				PARTITION BY RANGE (timestamp)`,
+			// The id sequence would otherwise be dropped with the old table.
+			`ALTER SEQUENCE readings_id_seq OWNED BY readings.id`,
+			// Unique constraints on a partitioned table must include the
+			// partition key; (dvid, timestamp) already does.
+			`ALTER TABLE readings ADD PRIMARY KEY (id, timestamp)`,
+			`CREATE UNIQUE INDEX idx_readings_dvid_timestamp ON readings (dvid, timestamp)`,
+			`CREATE TABLE ` + readingsDefaultPartition + ` PARTITION OF readings DEFAULT`,
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+
+		var oldest *int64
+		if err := tx.Raw(`SELECT MIN(timestamp) FROM readings_unpartitioned WHERE timestamp >= ?`,
+			oldestPartitionMonth.UnixMilli()).Scan(&oldest).Error; err != nil {
+			return err
+		}
+		from := time.Now()
+		if oldest != nil {
+			from = time.UnixMilli(*oldest)
+		}
+		for m := MonthStart(from); !m.After(MonthStart(time.Now()).AddDate(0, aheadMonths, 0)); m = m.AddDate(0, 1, 0) {
+			if err := createReadingsPartition(tx, m); err != nil {
+				return err
+			}
+		}
+
+		res := tx.Exec(`INSERT INTO readings SELECT * FROM readings_unpartitioned`)
+		if res.Error != nil {
+			return res.Error
+		}
+		log.Printf("copied %d readings into monthly partitions", res.RowsAffected)
+
+		// The view still references the renamed table by OID.
+		if err := tx.Exec(sensorDataViewSQL).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`DROP TABLE readings_unpartitioned`).Error
+	})
+}
+
+// EnsureReadingsPartitions creates any missing monthly partition from the
+// month of now up to aheadMonths later. Creating partitions ahead of time
+// keeps new readings out of the default partition.
+func EnsureReadingsPartitions(db *gorm.DB, now time.Time, aheadMonths int) error {
+	existing, err := ReadingsPartitions(db)
+	if err != nil {
+		return err
+	}
+	have := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		have[p.Name] = true
+	}
+
+	start := MonthStart(now)
+	for i := 0; i <= aheadMonths; i++ {
+		m := start.AddDate(0, i, 0)
+		if have[PartitionName(m)] {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return createReadingsPartition(tx, m)
+		})
+		if err != nil {
+			return fmt.Errorf("create %s: %w", PartitionName(m), err)
+		}
+		log.Printf("created partition %s", PartitionName(m))
+	}
+	return nil
+}
+
+// createReadingsPartition attaches the partition for month. Postgres refuses
+// to create a partition while the default partition holds rows in its range,
+// so such rows are moved out first and re-inserted afterwards. Must run in a
+// transaction.
+func createReadingsPartition(tx *gorm.DB, month time.Time) error {
+	name := PartitionName(month)
+	from, to := ReadingsPartition{Name: name, Month: month}.Bounds()
+
+	var stray int64
+	if err := tx.Raw(`SELECT COUNT(*) FROM `+readingsDefaultPartition+` WHERE timestamp >= ? AND timestamp < ?`,
+		from, to).Scan(&stray).Error; err != nil {
+		return err
+	}
+	if stray > 0 {
+		if err := tx.Exec(`CREATE TEMP TABLE readings_move (LIKE readings) ON COMMIT DROP`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`WITH moved AS (
+				DELETE FROM `+readingsDefaultPartition+` WHERE timestamp >= ? AND timestamp < ? RETURNING *
+			) INSERT INTO readings_move SELECT * FROM moved`, from, to).Error; err != nil {
+			return err
+		}
+	}
+
+	// name and bounds are generated, never user input.
+	if err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s PARTITION OF readings FOR VALUES FROM (%d) TO (%d)`,
+		name, from, to)).Error; err != nil {
+		return err
+	}
+
+	if stray > 0 {
+		// Generated columns (reading_at) cannot be inserted into.
+		var cols string
+		if err := tx.Raw(`SELECT string_agg(quote_ident(column_name), ', ' ORDER BY ordinal_position)
+			FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'readings' AND is_generated = 'NEVER'`).
+			Scan(&cols).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`INSERT INTO readings (` + cols + `) SELECT ` + cols + ` FROM readings_move`).Error; err != nil {
+			return err
+		}
+		log.Printf("moved %d readings from %s into %s", stray, readingsDefaultPartition, name)
+	}
+	return nil
+}
+
+// ReadingsPartitions lists the monthly partitions attached to readings,
+// oldest first. The default partition is not included.
+func ReadingsPartitions(db *gorm.DB) ([]ReadingsPartition, error) {
+	var names []string
+	err := db.Raw(`
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'readings'::regclass`).Scan(&names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []ReadingsPartition
+	for _, name := range names {
+		m := partitionNameRe.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		var year, month int
+		fmt.Sscan(m[1], &year)
+		fmt.Sscan(m[2], &month)
+		parts = append(parts, ReadingsPartition{
+			Name:  name,
+			Month: time.Date(year, time.Month(month), 1, 0, 0, 0, 0, Bangkok),
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Month.Before(parts[j].Month) })
+	return parts, nil
+}
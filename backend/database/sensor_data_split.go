@@ -0,0 +1,119 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// sensorDataViewSQL rebuilds the old wide sensor_data row from readings and
+// the station version that was valid at each reading's timestamp, so read
+// queries written against sensor_data keep working unchanged. This is the view
+// of the baseline migration; later migrations in migrations/ replace it.
+const sensorDataViewSQL = `
+CREATE OR REPLACE VIEW sensor_data AS
+SELECT
+	r.id,
+	r.dvid,
+	COALESCE(s.deviceid, '') AS deviceid,
+	r.status,
+	COALESCE(s.latitude, 0) AS latitude,
+	COALESCE(s.longitude, 0) AS longitude,
+	COALESCE(s.place, '') AS place,
+	COALESCE(s.address, '') AS address,
+	COALESCE(s.model, '') AS model,
+	COALESCE(s.deploydate, '') AS deploydate,
+	COALESCE(s.contactname, '') AS contactname,
+	COALESCE(s.contactphone, '') AS contactphone,
+	COALESCE(s.note, '') AS note,
+	r.ddate,
+	r.dtime,
+	r.timestamp,
+	r.av24h, r.av12h, r.av6h, r.av3h, r.av1h,
+	r.pm25, r.pm10, r.pm100, r.aqi,
+	r.temperature, r.humidity, r.pres,
+	r.color, r.trend,
+	COALESCE(s.province, '') AS province,
+	COALESCE(s.province_code, '') AS province_code,
+	COALESCE(s.district, '') AS district,
+	COALESCE(s.subdistrict, '') AS subdistrict
+FROM readings r
+LEFT JOIN stations s
+	ON s.dvid = r.dvid
+	AND s.valid_from <= r.timestamp
+	AND (s.valid_to IS NULL OR r.timestamp < s.valid_to)`
+
+// copyReadingsSQL moves the measurement columns of the legacy table.
+const copyReadingsSQL = `
+INSERT INTO readings (dvid, timestamp, status, ddate, dtime, av24h, av12h, av6h, av3h, av1h,
+	pm25, pm10, pm100, aqi, temperature, humidity, pres, color, trend)
+SELECT dvid, timestamp, status, ddate, dtime, av24h, av12h, av6h, av3h, av1h,
+	pm25, pm10, pm100, aqi, temperature, humidity, pres, color, trend
+FROM sensor_data
+ON CONFLICT (dvid, timestamp) DO NOTHING`
+
+// copyStationsSQL derives station versions from the legacy table: a new
+// version starts whenever a device's metadata differs from its previous
+// reading. The first version is back-dated to 0.
+const copyStationsSQL = `
+WITH meta AS (
+	SELECT dvid, timestamp, deviceid, latitude, longitude, place, address, model,
+		deploydate, contactname, contactphone, note,
+		md5(ROW(deviceid, latitude, longitude, place, address, model,
+			deploydate, contactname, contactphone, note)::text) AS hash
+	FROM sensor_data
+), marked AS (
+	SELECT *, LAG(hash) OVER (PARTITION BY dvid ORDER BY timestamp) AS prev_hash
+	FROM meta
+), changes AS (
+	SELECT * FROM marked WHERE prev_hash IS DISTINCT FROM hash
+), versions AS (
+	SELECT *,
+		ROW_NUMBER() OVER (PARTITION BY dvid ORDER BY timestamp) AS version,
+		LEAD(timestamp) OVER (PARTITION BY dvid ORDER BY timestamp) AS next_from
+	FROM changes
+)
+INSERT INTO stations (dvid, version, valid_from, valid_to, deviceid, latitude, longitude,
+	place, address, model, deploydate, contactname, contactphone, note, created_at)
+SELECT dvid, version, CASE WHEN version = 1 THEN 0 ELSE timestamp END, next_from,
+	deviceid, latitude, longitude, place, address, model,
+	deploydate, contactname, contactphone, note, NOW()
+FROM versions`
+
+// migrateSensorDataSplit moves a legacy wide sensor_data table into readings
+// and stations, keeps the original as sensor_data_legacy and replaces it with
+// the compatibility view. It is a no-op once sensor_data is already a view.
+func migrateSensorDataSplit(db *gorm.DB) error {
+	var tableType string
+	err := db.Raw(`SELECT table_type FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name = 'sensor_data'`).Scan(&tableType).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if tableType == "BASE TABLE" {
+			log.Println("migrating sensor_data into readings/stations (this may take a while)")
+
+			res := tx.Exec(copyReadingsSQL)
+			if res.Error != nil {
+				return res.Error
+			}
+			log.Printf("copied %d readings", res.RowsAffected)
+
+			if err := tx.Exec("DELETE FROM stations").Error; err != nil {
+				return err
+			}
+			res = tx.Exec(copyStationsSQL)
+			if res.Error != nil {
+				return res.Error
+			}
+			log.Printf("created %d station versions", res.RowsAffected)
+
+			if err := tx.Exec("ALTER TABLE sensor_data RENAME TO sensor_data_legacy").Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec(sensorDataViewSQL).Error
+	})
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"log"
+	"time"
+
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/thaiaddress"
+
+	"gorm.io/gorm"
+)
+
+// AddressBackfill reports a BackfillStationAddresses run.
+type AddressBackfill struct {
+	Parsed  int // station versions parsed
+	Changed int // versions whose parsed columns changed
+	// Unparsed are the distinct addresses no province could be found in.
+	Unparsed []string
+}
+
+// BackfillStationAddresses parses the address of every station version that
+// has not been parsed yet (all: every version, e.g. after the parser learned
+// a new spelling) into the province, district and subdistrict columns. The
+// hours of readings whose province changed are queued for a rollup refresh,
+// since the province rollups are keyed by it.
+func BackfillStationAddresses(db *gorm.DB, all bool) (AddressBackfill, error) {
+	var res AddressBackfill
+	var rows []struct {
+		ID           uint
+		DVID         string
+		Address      string
+		Province     *string
+		ProvinceCode *string
+		District     *string
+		Subdistrict  *string
+	}
+	q := db.Model(&models.Station{}).
+		Select("id", "dvid", "address", "province", "province_code", "district", "subdistrict").
+		Order("id")
+	if !all {
+		q = q.Where("province_code IS NULL")
+	}
+	if err := q.Find(&rows).Error; err != nil {
+		return res, err
+	}
+
+	unparsed := map[string]bool{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		changed := map[string]bool{}
+		for _, r := range rows {
+			a := thaiaddress.Parse(r.Address)
+			res.Parsed++
+			if a.ProvinceCode == "" && r.Address != "" && !unparsed[r.Address] {
+				unparsed[r.Address] = true
+				res.Unparsed = append(res.Unparsed, r.Address)
+			}
+			if r.ProvinceCode != nil && *r.ProvinceCode == a.ProvinceCode && str(r.Province) == a.Province &&
+				str(r.District) == a.District && str(r.Subdistrict) == a.Subdistrict {
+				continue
+			}
+			err := tx.Model(&models.Station{}).Where("id = ?", r.ID).Updates(map[string]interface{}{
+				"province":      a.Province,
+				"province_code": a.ProvinceCode,
+				"district":      a.District,
+				"subdistrict":   a.Subdistrict,
+			}).Error
+			if err != nil {
+				return err
+			}
+			res.Changed++
+			if r.Province == nil || *r.Province != a.Province {
+				changed[r.DVID] = true
+			}
+		}
+		if len(changed) == 0 {
+			return nil
+		}
+
+		dvids := make([]string, 0, len(changed))
+		for dvid := range changed {
+			dvids = append(dvids, dvid)
+		}
+		return tx.Exec(`
+			INSERT INTO rollup_dirty_hours (hour, marked_at)
+			SELECT DISTINCT timestamp - timestamp % ?, NOW()
+			FROM readings
+			WHERE dvid IN ?
+			ON CONFLICT (hour) DO NOTHING`, time.Hour.Milliseconds(), dvids).Error
+	})
+	return res, err
+}
+
+// migrateStationAddresses parses the addresses of station versions written
+// before the columns existed.
+func migrateStationAddresses(db *gorm.DB) error {
+	res, err := BackfillStationAddresses(db, false)
+	if err != nil {
+		return err
+	}
+	if res.Parsed > 0 {
+		log.Printf("parsed %d station addresses (%d without a recognisable province)", res.Parsed, len(res.Unparsed))
+	}
+	return nil
+}
+
+func str(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
-	"time"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
+	"yakkaw_dashboard/aqi"
 	"yakkaw_dashboard/cache"
 	"yakkaw_dashboard/config"
 	"yakkaw_dashboard/database"
@@ -17,14 +23,28 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
 	cfg := config.Get()
 
+	// Cancelled on SIGINT/SIGTERM so the scheduler and HTTP server can drain.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize the Echo framework
 	e := echo.New()
 
 	// Set up logging
 	utils.SetupLogger()
 
+	if cfg.AQIBreakpointsFile != "" {
+		if err := aqi.LoadFile(cfg.AQIBreakpointsFile); err != nil {
+			e.Logger.Fatalf("AQI_BREAKPOINTS_FILE: %v", err)
+		}
+	}
+
 	// Initialize the database
 	database.Init()
 
@@ -37,6 +57,10 @@ func main() {
 		e.Logger.Fatalf("database seeding failed: %v", err)
 	}
 
+	if err := services.QueueInitialRollups(); err != nil {
+		e.Logger.Errorf("queueing initial rollups: %v", err)
+	}
+
 	// Enable CORS middleware (ของ Echo ต้องเรียกผ่าน echomw)
 	e.Use(echomw.CORSWithConfig(echomw.CORSConfig{
 		AllowOrigins:     cfg.AllowedOrigins,
@@ -52,14 +76,53 @@ func main() {
 	// Set up routes
 	routes.Init(e)
 
-	// Start a goroutine for the data pipeline to fetch and store API data periodically.
-	go func(apiURL string) {
-		for {
-			services.FetchAndStoreData(apiURL)
-			time.Sleep(5 * time.Minute)
-		}
-	}(cfg.DevicesAPIURL)
+	sources, err := services.SourcesFromConfig(cfg)
+	if err != nil {
+		e.Logger.Fatalf("ingest source configuration invalid: %v", err)
+	}
+
+	// Run the data pipeline periodically; only the replica holding the Redis
+	// leader lock fetches, so scaled-out instances don't duplicate ingestion.
+	scheduler := services.NewPipelineScheduler(cfg.PipelineInterval, cfg.PipelineJitter, sources)
+	var wg sync.WaitGroup
+	// Monthly partitions of readings are created ahead of time and, with
+	// RETENTION_RAW_MONTHS set, old ones rolled up and retired.
+	partitions := services.NewPartitionScheduler(cfg)
+	// Stations are compared with their neighbours once per DRIFT_INTERVAL.
+	drift := services.NewDriftScheduler(cfg)
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		scheduler.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		partitions.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		drift.Run(ctx)
+	}()
+	// Admin-triggered refreshes run here, outside the request.
+	go func() {
+		defer wg.Done()
+		services.RunRefreshWorker(ctx)
+	}()
 
 	// Start the server
-	e.Logger.Fatal(e.Start(":" + cfg.ServerPort))
+	go func() {
+		if err := e.Start(":" + cfg.ServerPort); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	e.Logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Errorf("server shutdown: %v", err)
+	}
+	wg.Wait()
 }
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"yakkaw_dashboard/services"
+)
+
+// DeviceKeyMiddleware authenticates push ingestion with a per-device API key
+// sent as "X-API-Key: <key>" or "Authorization: Bearer <key>".
+func DeviceKeyMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		plain := strings.TrimSpace(c.Request().Header.Get("X-API-Key"))
+		if plain == "" {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			if strings.HasPrefix(auth, "Bearer ") {
+				plain = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+			}
+		}
+		if plain == "" {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "device api key required"})
+		}
+
+		key, err := services.AuthenticateDeviceKey(plain)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidDeviceKey) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid device api key"})
+			}
+			c.Logger().Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to verify api key"})
+		}
+
+		c.Set("deviceDVID", key.DVID)
+		return next(c)
+	}
+}
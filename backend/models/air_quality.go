@@ -1,5 +1,8 @@
 package models
 
+// SensorData is the wide reading + station row exposed by the sensor_data
+// view (see database/sensor_data_split.go) and the JSON shape used by
+// upstreams. It is not auto-migrated; writes go to Reading and Station.
 type SensorData struct {
     ID           uint   `gorm:"primaryKey"`
     DVID         string `gorm:"column:dvid;size:10;index:idx_dvid_timestamp,unique" json:"dvid"`
@@ -31,6 +34,9 @@ type SensorData struct {
     Pres         int     `gorm:"column:pres" json:"pres"`
     Color        string  `gorm:"column:color;size:5" json:"color"`
     Trend        string  `gorm:"column:trend;size:5" json:"trend"`
+    // Anomaly marks a PM2.5 spike flagged by the detector (read-only). It is
+    // not part of the upstream JSON shape, so ingest mapping ignores it.
+    Anomaly      bool    `gorm:"column:anomaly;->" json:"-"`
 }
 
 
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ReadingAnomaly records why a reading was flagged as a PM2.5 spike: its
+// value against the median and MAD of the station's preceding readings.
+type ReadingAnomaly struct {
+	DVID       string    `gorm:"column:dvid;primaryKey" json:"dvid"`
+	Timestamp  int64     `gorm:"column:timestamp;primaryKey" json:"timestamp"`
+	PM25       int       `gorm:"column:pm25" json:"pm25"`
+	Median     float64   `gorm:"column:median" json:"median"`
+	MAD        float64   `gorm:"column:mad" json:"mad"`
+	Score      float64   `gorm:"column:score" json:"score"`
+	Samples    int       `gorm:"column:samples" json:"samples"`
+	DetectedAt time.Time `gorm:"column:detected_at" json:"detected_at"`
+}
+
+func (ReadingAnomaly) TableName() string {
+	return "reading_anomalies"
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// BackfillCheckpoint tracks how far a backfill got through an archive file so
+// an interrupted run can resume. Size and ModTime detect a changed file.
+type BackfillCheckpoint struct {
+	File      string    `gorm:"primaryKey;type:text" json:"file"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	Records   int64     `json:"records"`
+	Done      bool      `json:"done"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -3,9 +3,14 @@ package models
 type ChartData struct {
     Labels   []string        `json:"labels" gorm:"type:json"`  // หรือ gorm:"serializer:json"
     Datasets []DatasetChart  `json:"datasets" gorm:"type:json"`
+    // AQIStandard is set on AQI charts, whose datasets carry Dominant and SubIndices
+    AQIStandard string       `json:"aqi_standard,omitempty"`
 }
 
 type DatasetChart struct {
 	Label string	`json:"label" gorm:"type:json"`
     Data []float64 `json:"data" gorm:"type:json"`
+    // Dominant and SubIndices (keyed by pollutant) are aligned with Data
+    Dominant   []string             `json:"dominant_pollutant,omitempty"`
+    SubIndices map[string][]float64 `json:"sub_indices,omitempty"`
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// DeadLetter holds a reading whose upsert failed at the database, with the
+// error, so it can be fixed and replayed instead of being lost. Each failed
+// write of the same reading counts another attempt.
+type DeadLetter struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Source        string     `gorm:"size:100;index;uniqueIndex:idx_dead_letters_reading,priority:1" json:"source"`
+	DVID          string     `gorm:"column:dvid;type:text;index;uniqueIndex:idx_dead_letters_reading,priority:2" json:"dvid"`
+	Timestamp     int64      `gorm:"column:timestamp;uniqueIndex:idx_dead_letters_reading,priority:3" json:"timestamp"`
+	Error         string     `gorm:"type:text" json:"error"`
+	Payload       SensorData `gorm:"serializer:json;type:jsonb" json:"payload"`
+	Attempts      int        `gorm:"default:1" json:"attempts"`
+	LastAttemptAt time.Time  `json:"last_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -17,4 +17,6 @@ type Device struct {
 	ContactName  string    `gorm:"type:varchar(255);not null" json:"contact_name"`
 	ContactPhone string    `gorm:"type:varchar(255);not null" json:"contact_phone"`
 	DeployDate   time.Time `gorm:"type:timestamp;not null" json:"deploy_date"`
+	// Drift is the station's latest neighbour comparison, when it has one.
+	Drift *StationDrift `gorm:"-" json:"drift,omitempty"`
 }
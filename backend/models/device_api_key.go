@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// DeviceAPIKey authenticates a device or gateway pushing readings for one
+// DVID. Only the SHA-256 of the key is stored; Prefix helps admins tell keys apart.
+type DeviceAPIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	DVID       string     `gorm:"column:dvid;type:varchar(255);index;not null" json:"dvid"`
+	Label      string     `gorm:"type:varchar(100)" json:"label"`
+	Prefix     string     `gorm:"type:varchar(16)" json:"prefix"`
+	KeyHash    string     `gorm:"type:char(64);uniqueIndex;not null" json:"-"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
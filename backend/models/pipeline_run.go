@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// PipelineRun records one ingestion run of a single source.
+type PipelineRun struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Source       string     `gorm:"size:100;index" json:"source"`
+	Trigger      string     `gorm:"size:20" json:"trigger"`
+	Status       string     `gorm:"size:20;index" json:"status"`
+	Stage        string     `gorm:"size:20" json:"stage,omitempty"` // fetching | writing while running
+	StartedAt    time.Time  `gorm:"index" json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	HTTPStatus   int        `json:"http_status"`
+	Attempts     int        `json:"attempts"`
+	RowsReceived int        `json:"rows_received"`
+	RowsInserted int        `json:"rows_inserted"`
+	RowsUpdated  int        `json:"rows_updated"`
+	RowsSkipped  int        `json:"rows_skipped"`
+	RowsFailed   int        `json:"rows_failed"`
+	// RowsQuarantined counts rows rejected by ingest validation.
+	RowsQuarantined int `json:"rows_quarantined"`
+	// RowsDeadLettered counts rows the database refused; see dead_letters.
+	RowsDeadLettered int    `json:"rows_dead_lettered"`
+	Error            string `gorm:"type:text" json:"error,omitempty"`
+}
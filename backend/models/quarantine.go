@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// SensorDataQuarantine holds an ingested reading that failed validation,
+// together with the rule that rejected it. A reading rejected again by the
+// same rule updates its row instead of adding one.
+type SensorDataQuarantine struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Source    string     `gorm:"size:100;index;uniqueIndex:idx_sensor_data_quarantine_reading,priority:1" json:"source"`
+	DVID      string     `gorm:"column:dvid;size:10;index;uniqueIndex:idx_sensor_data_quarantine_reading,priority:2" json:"dvid"`
+	Timestamp int64      `gorm:"column:timestamp;uniqueIndex:idx_sensor_data_quarantine_reading,priority:3" json:"timestamp"`
+	Rule      string     `gorm:"size:50;index;uniqueIndex:idx_sensor_data_quarantine_reading,priority:4" json:"rule"`
+	Reason    string     `gorm:"type:text" json:"reason"`
+	Payload   SensorData `gorm:"serializer:json;type:jsonb" json:"payload"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (SensorDataQuarantine) TableName() string {
+	return "sensor_data_quarantine"
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// RawPayload is an upstream response body archived exactly as fetched
+// (gzip-compressed) with its fetch metadata, for audits and reprocessing.
+type RawPayload struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Source      string    `gorm:"size:100;index:idx_raw_payloads_source_fetched,priority:1" json:"source"`
+	RunID       *uint     `gorm:"index" json:"run_id,omitempty"`
+	URL         string    `gorm:"type:text" json:"url"`
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `gorm:"size:100" json:"content_type"`
+	FetchedAt   time.Time `gorm:"index:idx_raw_payloads_source_fetched,priority:2;index" json:"fetched_at"`
+	Size        int       `json:"size"`
+	SHA256      string    `gorm:"column:sha256;type:char(64);index" json:"sha256"`
+	Body        []byte    `gorm:"type:bytea" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Reading is one measurement from a station. Station metadata (place,
+// address, contacts, ...) lives in Station; the sensor_data view joins the two
+// back into the SensorData shape for read queries.
+type Reading struct {
+	ID          uint   `gorm:"primaryKey"`
+	DVID        string `gorm:"column:dvid;size:10;not null;uniqueIndex:idx_readings_dvid_timestamp"`
+	Timestamp   int64  `gorm:"column:timestamp;not null;uniqueIndex:idx_readings_dvid_timestamp"`
+	Status      string `gorm:"column:status;size:20"`
+	DDate       string `gorm:"column:ddate;size:50"`
+	DTime       string `gorm:"column:dtime;size:50"`
+	Av24h       int    `gorm:"column:av24h"`
+	Av12h       int    `gorm:"column:av12h"`
+	Av6h        int    `gorm:"column:av6h"`
+	Av3h        int    `gorm:"column:av3h"`
+	Av1h        int    `gorm:"column:av1h"`
+	PM25        int    `gorm:"column:pm25"`
+	PM10        int    `gorm:"column:pm10"`
+	PM100       int    `gorm:"column:pm100"`
+	AQI         int    `gorm:"column:aqi"`
+	Temperature int    `gorm:"column:temperature"`
+	Humidity    int    `gorm:"column:humidity"`
+	Pres        int    `gorm:"column:pres"`
+	Color       string `gorm:"column:color;size:5"`
+	Trend       string `gorm:"column:trend;size:5"`
+	// ReadingAt is generated by the database from Timestamp.
+	ReadingAt time.Time `gorm:"column:reading_at;->"`
+	// Anomaly is set by the spike detector, never by ingest.
+	Anomaly bool `gorm:"column:anomaly;->"`
+}
+
+// Station is one version of a station's metadata. A version applies to
+// readings with ValidFrom <= timestamp < ValidTo; the current version has a
+// nil ValidTo. The first version starts at 0 so every reading has a match.
+// Province, ProvinceCode (ISO 3166-2:TH), District and Subdistrict are parsed
+// from Address at ingest (see thaiaddress); they are NULL on versions written
+// before the parser existed until the startup backfill has run.
+type Station struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	DVID         string    `gorm:"column:dvid;size:10;not null;uniqueIndex:idx_stations_dvid_version;index:idx_stations_dvid_valid_from,priority:1;index:idx_stations_province_dvid,priority:2;uniqueIndex:idx_stations_current,where:valid_to IS NULL" json:"dvid"`
+	Version      int       `gorm:"column:version;not null;uniqueIndex:idx_stations_dvid_version" json:"version"`
+	ValidFrom    int64     `gorm:"column:valid_from;not null;index:idx_stations_dvid_valid_from,priority:2;index:idx_stations_province_dvid,priority:3" json:"valid_from"`
+	ValidTo      *int64    `gorm:"column:valid_to" json:"valid_to"`
+	DeviceID     string    `gorm:"column:deviceid;size:20" json:"deviceid"`
+	Latitude     float64   `gorm:"column:latitude" json:"latitude"`
+	Longitude    float64   `gorm:"column:longitude" json:"longitude"`
+	Place        string    `gorm:"column:place;type:text" json:"place"`
+	Address      string    `gorm:"column:address;type:text" json:"address"`
+	Model        string    `gorm:"column:model;size:50" json:"model"`
+	DeployDate   string    `gorm:"column:deploydate;size:50" json:"deploydate"`
+	ContactName  string    `gorm:"column:contactname;size:50" json:"contactname"`
+	ContactPhone string    `gorm:"column:contactphone;size:20" json:"contactphone"`
+	Note         string    `gorm:"column:note;type:text" json:"note"`
+	Province     string    `gorm:"column:province;size:50;index:idx_stations_province_dvid,priority:1" json:"province"`
+	ProvinceCode string    `gorm:"column:province_code;size:5;index" json:"province_code"`
+	District     string    `gorm:"column:district;size:100" json:"district"`
+	Subdistrict  string    `gorm:"column:subdistrict;size:100" json:"subdistrict"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// ReadingMonthly summarises one station's readings for one calendar month
+// (Asia/Bangkok). It is written from a raw partition before the retention
+// job detaches or drops it, so long-range history survives the raw data.
+// Zero PM/AQI values are treated as missing, as in the chart queries.
+type ReadingMonthly struct {
+	DVID           string    `gorm:"column:dvid;size:10;primaryKey" json:"dvid"`
+	Month          time.Time `gorm:"type:date;primaryKey" json:"month"`
+	Readings       int64     `json:"readings"`
+	PM25Avg        *float64  `gorm:"column:pm25_avg" json:"pm25_avg"`
+	PM25Min        *int      `gorm:"column:pm25_min" json:"pm25_min"`
+	PM25Max        *int      `gorm:"column:pm25_max" json:"pm25_max"`
+	PM10Avg        *float64  `gorm:"column:pm10_avg" json:"pm10_avg"`
+	PM10Min        *int      `gorm:"column:pm10_min" json:"pm10_min"`
+	PM10Max        *int      `gorm:"column:pm10_max" json:"pm10_max"`
+	AQIAvg         *float64  `gorm:"column:aqi_avg" json:"aqi_avg"`
+	AQIMax         *int      `gorm:"column:aqi_max" json:"aqi_max"`
+	TemperatureAvg *float64  `json:"temperature_avg"`
+	HumidityAvg    *float64  `json:"humidity_avg"`
+	RolledUpAt     time.Time `json:"rolled_up_at"`
+}
+
+func (ReadingMonthly) TableName() string { return "readings_monthly" }
@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// Rollup scopes: a rollup row summarises one station, one province or one
+// place over one bucket.
+const (
+	RollupScopeDVID     = "dvid"
+	RollupScopeProvince = "province"
+	RollupScopePlace    = "place"
+)
+
+// RollupBucket is the shared shape of the hourly and daily rollups. Bucket is
+// the Asia/Bangkok wall-clock start of the hour or day (timestamp without
+// time zone), matching what the chart queries group by. Each metric carries
+// its average, minimum, maximum and the number of readings that had it; zero
+// PM and AQI values are treated as missing.
+type RollupBucket struct {
+	Scope    string    `gorm:"size:10;primaryKey;index:,composite:scope_bucket,priority:1" json:"scope"`
+	Key      string    `gorm:"size:255;primaryKey" json:"key"`
+	Bucket   time.Time `gorm:"type:timestamp;primaryKey;index:,composite:scope_bucket,priority:2" json:"bucket"`
+	Readings int64     `json:"readings"`
+
+	PM25Avg   *float64 `gorm:"column:pm25_avg" json:"pm25_avg"`
+	PM25Min   *int     `gorm:"column:pm25_min" json:"pm25_min"`
+	PM25Max   *int     `gorm:"column:pm25_max" json:"pm25_max"`
+	PM25Count int64    `gorm:"column:pm25_count" json:"pm25_count"`
+
+	PM10Avg   *float64 `gorm:"column:pm10_avg" json:"pm10_avg"`
+	PM10Min   *int     `gorm:"column:pm10_min" json:"pm10_min"`
+	PM10Max   *int     `gorm:"column:pm10_max" json:"pm10_max"`
+	PM10Count int64    `gorm:"column:pm10_count" json:"pm10_count"`
+
+	AQIAvg   *float64 `gorm:"column:aqi_avg" json:"aqi_avg"`
+	AQIMin   *int     `gorm:"column:aqi_min" json:"aqi_min"`
+	AQIMax   *int     `gorm:"column:aqi_max" json:"aqi_max"`
+	AQICount int64    `gorm:"column:aqi_count" json:"aqi_count"`
+
+	TemperatureAvg   *float64 `json:"temperature_avg"`
+	TemperatureMin   *int     `json:"temperature_min"`
+	TemperatureMax   *int     `json:"temperature_max"`
+	TemperatureCount int64    `json:"temperature_count"`
+
+	HumidityAvg   *float64 `json:"humidity_avg"`
+	HumidityMin   *int     `json:"humidity_min"`
+	HumidityMax   *int     `json:"humidity_max"`
+	HumidityCount int64    `json:"humidity_count"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Metric returns the average, minimum, maximum and count of metric in b; ok
+// is false for a metric that is not rolled up.
+func (b RollupBucket) Metric(metric string) (avg *float64, min, max *int, count int64, ok bool) {
+	switch metric {
+	case "pm25":
+		return b.PM25Avg, b.PM25Min, b.PM25Max, b.PM25Count, true
+	case "pm10":
+		return b.PM10Avg, b.PM10Min, b.PM10Max, b.PM10Count, true
+	case "aqi":
+		return b.AQIAvg, b.AQIMin, b.AQIMax, b.AQICount, true
+	case "temperature":
+		return b.TemperatureAvg, b.TemperatureMin, b.TemperatureMax, b.TemperatureCount, true
+	case "humidity":
+		return b.HumidityAvg, b.HumidityMin, b.HumidityMax, b.HumidityCount, true
+	}
+	return nil, nil, nil, 0, false
+}
+
+// RollupHourly is the hourly rollup, rebuilt from raw readings.
+type RollupHourly struct {
+	RollupBucket `gorm:"embedded"`
+}
+
+func (RollupHourly) TableName() string { return "rollup_hourly" }
+
+// RollupDaily is the daily rollup, derived from the hourly one.
+type RollupDaily struct {
+	RollupBucket `gorm:"embedded"`
+}
+
+func (RollupDaily) TableName() string { return "rollup_daily" }
+
+// RollupDirtyHour queues an hour (epoch ms of its start) whose readings
+// changed and whose rollups must be recomputed. Rows are written in the
+// ingest transaction, so a crash between ingest and refresh loses nothing.
+type RollupDirtyHour struct {
+	Hour     int64     `gorm:"primaryKey;autoIncrement:false"`
+	MarkedAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// FieldTypeChange is a field whose JSON type differs from the expected one.
+type FieldTypeChange struct {
+	Field    string   `json:"field"`
+	Expected string   `json:"expected"`
+	Observed []string `json:"observed"`
+}
+
+// SchemaDrift records one distinct difference between an upstream payload
+// and the schema the ingest path expects. Identical diffs are folded into the
+// same row by Fingerprint; ResolvedAt is set once a clean payload arrives.
+type SchemaDrift struct {
+	ID             uint              `gorm:"primaryKey" json:"id"`
+	Source         string            `gorm:"size:100;index" json:"source"`
+	Fingerprint    string            `gorm:"type:char(64);index" json:"fingerprint"`
+	Added          []string          `gorm:"serializer:json;type:jsonb" json:"added"`
+	Removed        []string          `gorm:"serializer:json;type:jsonb" json:"removed"`
+	TypeChanged    []FieldTypeChange `gorm:"serializer:json;type:jsonb" json:"type_changed"`
+	Records        int               `json:"records"`
+	Occurrences    int               `json:"occurrences"`
+	FirstSeenAt    time.Time         `json:"first_seen_at"`
+	LastSeenAt     time.Time         `gorm:"index" json:"last_seen_at"`
+	ResolvedAt     *time.Time        `json:"resolved_at"`
+	NotificationID *uint             `json:"notification_id,omitempty"`
+}
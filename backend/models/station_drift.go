@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// StationDrift is the latest comparison of a station's daily PM2.5 means with
+// the median of its neighbours over [WindowFrom, WindowTo). Ratio is the
+// median of station/neighbours over the Days compared, Score its deviation
+// from 1 (+0.3 reads 30% high) and Trend the change of the daily ratio per 30
+// days. Reason says why a Flagged station needs recalibration: "bias" or
+// "trend". Place is only filled by the admin report.
+type StationDrift struct {
+	DVID       string    `gorm:"column:dvid;primaryKey" json:"dvid"`
+	Place      string    `gorm:"column:place;->" json:"place,omitempty"`
+	WindowFrom time.Time `gorm:"column:window_from;type:date" json:"window_from"`
+	WindowTo   time.Time `gorm:"column:window_to;type:date" json:"window_to"`
+	Days       int       `gorm:"column:days" json:"days"`
+	Neighbours int       `gorm:"column:neighbours" json:"neighbours"`
+	Ratio      float64   `gorm:"column:ratio" json:"ratio"`
+	Score      float64   `gorm:"column:score" json:"score"`
+	MeanDiff   float64   `gorm:"column:mean_diff" json:"mean_diff"`
+	Trend      float64   `gorm:"column:trend" json:"trend"`
+	Flagged    bool      `gorm:"column:flagged" json:"flagged"`
+	Reason     string    `gorm:"column:reason" json:"reason,omitempty"`
+	ComputedAt time.Time `gorm:"column:computed_at" json:"computed_at"`
+}
+
+func (StationDrift) TableName() string {
+	return "station_drift"
+}
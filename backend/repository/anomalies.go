@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AnomalyRepository stores the PM2.5 spike flags on readings and the reason
+// each flag was raised.
+type AnomalyRepository interface {
+	// Readings returns the PM2.5 and current flag of every reading in
+	// [from, to), ordered by dvid and timestamp.
+	Readings(from, to time.Time) ([]AnomalyReading, error)
+	// Apply flags the readings of flagged and stores why, and unflags cleared
+	// and drops their reasons. It returns how many readings were newly
+	// flagged and how many were unflagged; readings that already had the
+	// requested flag are not counted.
+	Apply(flagged []models.ReadingAnomaly, cleared []AnomalyReading) (int, int, error)
+	// List returns a page of the flags raised on readings since since, of
+	// station dvid when it is set, newest first, with their total.
+	List(dvid string, since time.Time, limit, offset int) ([]models.ReadingAnomaly, int64, error)
+	// Devices summarises the same flags per station, most flags first.
+	Devices(dvid string, since time.Time) ([]AnomalyDevice, error)
+}
+
+// AnomalyReading is the PM2.5 of one reading and whether it is flagged.
+type AnomalyReading struct {
+	DVID      string
+	Timestamp int64
+	PM25      int
+	Anomaly   bool
+}
+
+// AnomalyDevice summarises one station's flags in the report window.
+type AnomalyDevice struct {
+	DVID          string  `json:"dvid"`
+	Place         string  `json:"place"`
+	Anomalies     int     `json:"anomalies"`
+	LastTimestamp int64   `json:"last_timestamp"`
+	MaxPM25       int     `json:"max_pm25"`
+	MaxScore      float64 `json:"max_score"`
+}
+
+// anomalyBatch bounds the rows of one flag update (three parameters each).
+const anomalyBatch = 1000
+
+type gormAnomalyRepository struct{ db *gorm.DB }
+
+// NewAnomalyRepository returns the AnomalyRepository backed by db.
+func NewAnomalyRepository(db *gorm.DB) AnomalyRepository {
+	return &gormAnomalyRepository{db: db}
+}
+
+func (r *gormAnomalyRepository) Readings(from, to time.Time) ([]AnomalyReading, error) {
+	var rows []AnomalyReading
+	err := r.db.Raw(`
+		SELECT dvid, timestamp, pm25, anomaly
+		FROM readings
+		WHERE `+database.ReadingWindowSQL("CAST(@from AS timestamptz)", "CAST(@to AS timestamptz)")+`
+		ORDER BY dvid, timestamp`, windowArgs(from, to)).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// setAnomalyFlags updates the flags of a batch of readings in one statement
+// and counts the rows whose flag actually changed, by new value.
+func setAnomalyFlags(n int) string {
+	values := make([]string, n)
+	values[0] = "(CAST(? AS varchar), CAST(? AS bigint), CAST(? AS boolean))"
+	for i := 1; i < n; i++ {
+		values[i] = "(?, ?, ?)"
+	}
+	return `
+		WITH changed AS (
+			UPDATE readings r SET anomaly = v.flag
+			FROM (VALUES ` + strings.Join(values, ", ") + `) AS v(dvid, timestamp, flag)
+			WHERE r.dvid = v.dvid AND r.timestamp = v.timestamp
+			  AND r.anomaly IS DISTINCT FROM v.flag
+			RETURNING v.flag
+		)
+		SELECT COUNT(*) FILTER (WHERE flag) AS flagged,
+		       COUNT(*) FILTER (WHERE NOT flag) AS cleared
+		FROM changed`
+}
+
+func (r *gormAnomalyRepository) Apply(flagged []models.ReadingAnomaly, cleared []AnomalyReading) (int, int, error) {
+	args := make([]interface{}, 0, 3*(len(flagged)+len(cleared)))
+	for _, a := range flagged {
+		args = append(args, a.DVID, a.Timestamp, true)
+	}
+	for _, c := range cleared {
+		args = append(args, c.DVID, c.Timestamp, false)
+	}
+
+	var nFlagged, nCleared int
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(args); start += 3 * anomalyBatch {
+			end := min(start+3*anomalyBatch, len(args))
+			var changed struct {
+				Flagged int
+				Cleared int
+			}
+			if err := tx.Raw(setAnomalyFlags((end-start)/3), args[start:end]...).Scan(&changed).Error; err != nil {
+				return err
+			}
+			nFlagged += changed.Flagged
+			nCleared += changed.Cleared
+		}
+
+		if len(flagged) > 0 {
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(&flagged, 500).Error; err != nil {
+				return err
+			}
+		}
+		for start := 0; start < len(cleared); start += anomalyBatch {
+			end := min(start+anomalyBatch, len(cleared))
+			keys := make([][]interface{}, 0, end-start)
+			for _, c := range cleared[start:end] {
+				keys = append(keys, []interface{}{c.DVID, c.Timestamp})
+			}
+			if err := tx.Where("(dvid, timestamp) IN ?", keys).Delete(&models.ReadingAnomaly{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return nFlagged, nCleared, nil
+}
+
+func (r *gormAnomalyRepository) List(dvid string, since time.Time, limit, offset int) ([]models.ReadingAnomaly, int64, error) {
+	q := r.db.Model(&models.ReadingAnomaly{}).Where("timestamp >= ?", since.UnixMilli())
+	if dvid != "" {
+		q = q.Where("dvid = ?", dvid)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var rows []models.ReadingAnomaly
+	if err := q.Order("timestamp DESC").Limit(limit).Offset(offset).Find(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+func (r *gormAnomalyRepository) Devices(dvid string, since time.Time) ([]AnomalyDevice, error) {
+	args := []interface{}{since.UnixMilli()}
+	cond := ""
+	if dvid != "" {
+		cond = " AND a.dvid = ?"
+		args = append(args, dvid)
+	}
+	var devices []AnomalyDevice
+	err := r.db.Raw(`
+		SELECT a.dvid, COALESCE(MAX(s.place), '') AS place, COUNT(*) AS anomalies,
+		       MAX(a.timestamp) AS last_timestamp, MAX(a.pm25) AS max_pm25, MAX(a.score) AS max_score
+		FROM reading_anomalies a
+		LEFT JOIN stations s ON s.dvid = a.dvid AND s.valid_to IS NULL
+		WHERE a.timestamp >= ?`+cond+`
+		GROUP BY a.dvid
+		ORDER BY anomalies DESC, a.dvid`, args...).Scan(&devices).Error
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+)
+
+type gormDeviceRepository struct{ db *gorm.DB }
+
+// NewDeviceRepository returns the DeviceRepository backed by db.
+func NewDeviceRepository(db *gorm.DB) DeviceRepository {
+	return &gormDeviceRepository{db: db}
+}
+
+func (r *gormDeviceRepository) Create(device *models.Device) error {
+	return r.db.Create(device).Error
+}
+
+func (r *gormDeviceRepository) FindByDVID(dvid string) (models.Device, error) {
+	var device models.Device
+	err := r.db.Where("dv_id = ?", dvid).First(&device).Error
+	return device, err
+}
+
+func (r *gormDeviceRepository) List() ([]models.Device, error) {
+	var devices []models.Device
+	if err := r.db.Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (r *gormDeviceRepository) Save(device *models.Device) error {
+	return r.db.Save(device).Error
+}
+
+func (r *gormDeviceRepository) Delete(id uint) error {
+	return deleteByID(r.db, &models.Device{}, id)
+}
+
+type gormNewsRepository struct{ db *gorm.DB }
+
+// NewNewsRepository returns the NewsRepository backed by db.
+func NewNewsRepository(db *gorm.DB) NewsRepository {
+	return &gormNewsRepository{db: db}
+}
+
+func (r *gormNewsRepository) Create(news *models.News) error {
+	return r.db.Create(news).Error
+}
+
+func (r *gormNewsRepository) FindByID(id uint) (models.News, error) {
+	var news models.News
+	err := r.db.First(&news, id).Error
+	return news, err
+}
+
+func (r *gormNewsRepository) LoadCategory(news *models.News) error {
+	return r.db.Preload("Category").First(news, news.ID).Error
+}
+
+func (r *gormNewsRepository) List() ([]models.News, error) {
+	var news []models.News
+	// โหลด News พร้อม Category (แต่ไม่ให้ preload news อีก)
+	if err := r.db.Preload("Category").Find(&news).Error; err != nil {
+		return nil, err
+	}
+	return news, nil
+}
+
+func (r *gormNewsRepository) Save(news *models.News) error {
+	return r.db.Save(news).Error
+}
+
+func (r *gormNewsRepository) Delete(id uint) error {
+	return deleteByID(r.db, &models.News{}, id)
+}
+
+type gormCategoryRepository struct{ db *gorm.DB }
+
+// NewCategoryRepository returns the CategoryRepository backed by db.
+func NewCategoryRepository(db *gorm.DB) CategoryRepository {
+	return &gormCategoryRepository{db: db}
+}
+
+func (r *gormCategoryRepository) Create(category *models.Category) error {
+	return r.db.Create(category).Error
+}
+
+func (r *gormCategoryRepository) FindByID(id uint) (models.Category, error) {
+	var category models.Category
+	err := r.db.First(&category, id).Error
+	return category, err
+}
+
+func (r *gormCategoryRepository) List() ([]models.Category, error) {
+	var categories []models.Category
+	// โหลด Category พร้อม News แต่ไม่ preload category ของ news
+	if err := r.db.Preload("News").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *gormCategoryRepository) Save(category *models.Category) error {
+	return r.db.Save(category).Error
+}
+
+func (r *gormCategoryRepository) Delete(id uint) error {
+	return deleteByID(r.db, &models.Category{}, id)
+}
+
+type gormNotificationRepository struct{ db *gorm.DB }
+
+// NewNotificationRepository returns the NotificationRepository backed by db.
+func NewNotificationRepository(db *gorm.DB) NotificationRepository {
+	return &gormNotificationRepository{db: db}
+}
+
+func (r *gormNotificationRepository) Create(notification *models.Notification) error {
+	return r.db.Create(notification).Error
+}
+
+func (r *gormNotificationRepository) FindByID(id uint) (models.Notification, error) {
+	var notification models.Notification
+	err := r.db.Where("id = ?", id).First(&notification).Error
+	return notification, err
+}
+
+func (r *gormNotificationRepository) List(excludeCategories ...string) ([]models.Notification, error) {
+	var notifications []models.Notification
+	q := r.db
+	for _, category := range excludeCategories {
+		q = q.Where("category IS DISTINCT FROM ?", category)
+	}
+	if err := q.Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (r *gormNotificationRepository) Save(notification *models.Notification) error {
+	return r.db.Save(notification).Error
+}
+
+func (r *gormNotificationRepository) Delete(id uint) error {
+	return deleteByID(r.db.Unscoped(), &models.Notification{}, id)
+}
+
+type gormSponsorRepository struct{ db *gorm.DB }
+
+// NewSponsorRepository returns the SponsorRepository backed by db.
+func NewSponsorRepository(db *gorm.DB) SponsorRepository {
+	return &gormSponsorRepository{db: db}
+}
+
+func (r *gormSponsorRepository) Create(sponsor *models.Sponsor) error {
+	return r.db.Create(sponsor).Error
+}
+
+func (r *gormSponsorRepository) FindByID(id uint) (models.Sponsor, error) {
+	var sponsor models.Sponsor
+	err := r.db.First(&sponsor, id).Error
+	return sponsor, err
+}
+
+func (r *gormSponsorRepository) List() ([]models.Sponsor, error) {
+	var sponsors []models.Sponsor
+	if err := r.db.Find(&sponsors).Error; err != nil {
+		return nil, err
+	}
+	return sponsors, nil
+}
+
+func (r *gormSponsorRepository) Save(sponsor *models.Sponsor) error {
+	return r.db.Save(sponsor).Error
+}
+
+func (r *gormSponsorRepository) Delete(id uint) error {
+	return deleteByID(r.db, &models.Sponsor{}, id)
+}
+
+type gormColorRangeRepository struct{ db *gorm.DB }
+
+// NewColorRangeRepository returns the ColorRangeRepository backed by db.
+func NewColorRangeRepository(db *gorm.DB) ColorRangeRepository {
+	return &gormColorRangeRepository{db: db}
+}
+
+func (r *gormColorRangeRepository) Create(colorRange *models.ColorRange) error {
+	return r.db.Create(colorRange).Error
+}
+
+func (r *gormColorRangeRepository) FindByID(id uint) (models.ColorRange, error) {
+	var colorRange models.ColorRange
+	err := r.db.First(&colorRange, id).Error
+	return colorRange, err
+}
+
+func (r *gormColorRangeRepository) List() ([]models.ColorRange, error) {
+	var colorRanges []models.ColorRange
+	if err := r.db.Find(&colorRanges).Error; err != nil {
+		return nil, err
+	}
+	return colorRanges, nil
+}
+
+func (r *gormColorRangeRepository) Save(colorRange *models.ColorRange) error {
+	return r.db.Save(colorRange).Error
+}
+
+func (r *gormColorRangeRepository) Delete(id uint) error {
+	return deleteByID(r.db, &models.ColorRange{}, id)
+}
+
+type gormUserRepository struct{ db *gorm.DB }
+
+// NewUserRepository returns the UserRepository backed by db.
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &gormUserRepository{db: db}
+}
+
+func (r *gormUserRepository) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUserRepository) FindByUsername(username string) (models.User, error) {
+	var user models.User
+	err := r.db.Where("username = ?", username).First(&user).Error
+	return user, err
+}
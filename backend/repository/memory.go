@@ -0,0 +1,1500 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/thaiaddress"
+
+	"gorm.io/gorm"
+)
+
+// memTable is an in-memory table keyed by an auto-assigned uint ID. Rows are
+// copied in and out, so callers cannot change stored rows by accident.
+type memTable[T any] struct {
+	mu   sync.Mutex
+	rows map[uint]T
+	next uint
+	id   func(*T) *uint
+	// model is nil for rows without gorm.Model timestamps.
+	model func(*T) *gorm.Model
+}
+
+func newMemTable[T any](id func(*T) *uint, model func(*T) *gorm.Model) *memTable[T] {
+	return &memTable[T]{rows: map[uint]T{}, id: id, model: model}
+}
+
+func (t *memTable[T]) create(row *T) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.id(row)
+	if *id == 0 {
+		t.next++
+		*id = t.next
+	} else if *id > t.next {
+		t.next = *id
+	}
+	if t.model != nil {
+		now := time.Now()
+		m := t.model(row)
+		m.CreatedAt, m.UpdatedAt = now, now
+	}
+	t.rows[*id] = *row
+	return nil
+}
+
+func (t *memTable[T]) find(id uint) (T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row, ok := t.rows[id]
+	if !ok {
+		return row, gorm.ErrRecordNotFound
+	}
+	return row, nil
+}
+
+// first returns the row with the lowest ID for which match is true.
+func (t *memTable[T]) first(match func(T) bool) (T, error) {
+	for _, row := range t.list() {
+		if match(row) {
+			return row, nil
+		}
+	}
+	var zero T
+	return zero, gorm.ErrRecordNotFound
+}
+
+// list returns every row ordered by ID.
+func (t *memTable[T]) list() []T {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]uint, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	out := make([]T, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, t.rows[id])
+	}
+	return out
+}
+
+// save updates a row, or creates it when it has no ID, like gorm's Save.
+func (t *memTable[T]) save(row *T) error {
+	if *t.id(row) == 0 {
+		return t.create(row)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.model != nil {
+		t.model(row).UpdatedAt = time.Now()
+	}
+	t.rows[*t.id(row)] = *row
+	return nil
+}
+
+func (t *memTable[T]) delete(id uint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.rows[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(t.rows, id)
+	return nil
+}
+
+// MemoryDeviceRepository is an in-memory DeviceRepository.
+type MemoryDeviceRepository struct{ t *memTable[models.Device] }
+
+func NewMemoryDeviceRepository() *MemoryDeviceRepository {
+	return &MemoryDeviceRepository{newMemTable(
+		func(d *models.Device) *uint { return &d.ID },
+		func(d *models.Device) *gorm.Model { return &d.Model },
+	)}
+}
+
+func (r *MemoryDeviceRepository) Create(device *models.Device) error { return r.t.create(device) }
+
+func (r *MemoryDeviceRepository) FindByDVID(dvid string) (models.Device, error) {
+	return r.t.first(func(d models.Device) bool { return d.DVID == dvid })
+}
+
+func (r *MemoryDeviceRepository) List() ([]models.Device, error)   { return r.t.list(), nil }
+func (r *MemoryDeviceRepository) Save(device *models.Device) error { return r.t.save(device) }
+func (r *MemoryDeviceRepository) Delete(id uint) error             { return r.t.delete(id) }
+
+// MemoryCategoryRepository is an in-memory CategoryRepository. List fills in
+// each category's news from the news repository it is linked to, if any.
+type MemoryCategoryRepository struct {
+	t    *memTable[models.Category]
+	news *MemoryNewsRepository
+}
+
+func NewMemoryCategoryRepository() *MemoryCategoryRepository {
+	return &MemoryCategoryRepository{t: newMemTable[models.Category](
+		func(c *models.Category) *uint { return &c.ID }, nil,
+	)}
+}
+
+func (r *MemoryCategoryRepository) Create(category *models.Category) error {
+	return r.t.create(category)
+}
+
+func (r *MemoryCategoryRepository) FindByID(id uint) (models.Category, error) { return r.t.find(id) }
+
+func (r *MemoryCategoryRepository) List() ([]models.Category, error) {
+	categories := r.t.list()
+	if r.news == nil {
+		return categories, nil
+	}
+	all := r.news.t.list()
+	for i := range categories {
+		for _, n := range all {
+			if n.CategoryID == categories[i].ID {
+				categories[i].News = append(categories[i].News, n)
+			}
+		}
+	}
+	return categories, nil
+}
+
+func (r *MemoryCategoryRepository) Save(category *models.Category) error {
+	return r.t.save(category)
+}
+
+func (r *MemoryCategoryRepository) Delete(id uint) error { return r.t.delete(id) }
+
+// MemoryNewsRepository is an in-memory NewsRepository. Categories are resolved
+// from the category repository given to NewMemoryNewsRepository (nil: none).
+type MemoryNewsRepository struct {
+	t          *memTable[models.News]
+	categories *MemoryCategoryRepository
+}
+
+// NewMemoryNewsRepository returns an empty news repository linked to
+// categories, which may be nil.
+func NewMemoryNewsRepository(categories *MemoryCategoryRepository) *MemoryNewsRepository {
+	r := &MemoryNewsRepository{
+		t:          newMemTable[models.News](func(n *models.News) *uint { return &n.ID }, nil),
+		categories: categories,
+	}
+	if categories != nil {
+		categories.news = r
+	}
+	return r
+}
+
+func (r *MemoryNewsRepository) Create(news *models.News) error {
+	news.Category = nil
+	return r.t.create(news)
+}
+
+func (r *MemoryNewsRepository) FindByID(id uint) (models.News, error) { return r.t.find(id) }
+
+func (r *MemoryNewsRepository) LoadCategory(news *models.News) error {
+	stored, err := r.t.find(news.ID)
+	if err != nil {
+		return err
+	}
+	*news = stored
+	if r.categories != nil {
+		if c, err := r.categories.t.find(news.CategoryID); err == nil {
+			news.Category = &c
+		}
+	}
+	return nil
+}
+
+func (r *MemoryNewsRepository) List() ([]models.News, error) {
+	news := r.t.list()
+	for i := range news {
+		if err := r.LoadCategory(&news[i]); err != nil {
+			return nil, err
+		}
+	}
+	return news, nil
+}
+
+func (r *MemoryNewsRepository) Save(news *models.News) error {
+	news.Category = nil
+	return r.t.save(news)
+}
+
+func (r *MemoryNewsRepository) Delete(id uint) error { return r.t.delete(id) }
+
+// MemoryNotificationRepository is an in-memory NotificationRepository.
+type MemoryNotificationRepository struct {
+	t *memTable[models.Notification]
+}
+
+func NewMemoryNotificationRepository() *MemoryNotificationRepository {
+	return &MemoryNotificationRepository{newMemTable(
+		func(n *models.Notification) *uint { return &n.ID },
+		func(n *models.Notification) *gorm.Model { return &n.Model },
+	)}
+}
+
+func (r *MemoryNotificationRepository) Create(notification *models.Notification) error {
+	return r.t.create(notification)
+}
+
+func (r *MemoryNotificationRepository) FindByID(id uint) (models.Notification, error) {
+	return r.t.find(id)
+}
+
+func (r *MemoryNotificationRepository) List(excludeCategories ...string) ([]models.Notification, error) {
+	var out []models.Notification
+next:
+	for _, n := range r.t.list() {
+		for _, c := range excludeCategories {
+			if n.Category == c {
+				continue next
+			}
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func (r *MemoryNotificationRepository) Save(notification *models.Notification) error {
+	return r.t.save(notification)
+}
+
+func (r *MemoryNotificationRepository) Delete(id uint) error { return r.t.delete(id) }
+
+// MemorySponsorRepository is an in-memory SponsorRepository.
+type MemorySponsorRepository struct{ t *memTable[models.Sponsor] }
+
+func NewMemorySponsorRepository() *MemorySponsorRepository {
+	return &MemorySponsorRepository{newMemTable(
+		func(s *models.Sponsor) *uint { return &s.ID },
+		func(s *models.Sponsor) *gorm.Model { return &s.Model },
+	)}
+}
+
+func (r *MemorySponsorRepository) Create(sponsor *models.Sponsor) error     { return r.t.create(sponsor) }
+func (r *MemorySponsorRepository) FindByID(id uint) (models.Sponsor, error) { return r.t.find(id) }
+func (r *MemorySponsorRepository) List() ([]models.Sponsor, error)          { return r.t.list(), nil }
+func (r *MemorySponsorRepository) Save(sponsor *models.Sponsor) error       { return r.t.save(sponsor) }
+func (r *MemorySponsorRepository) Delete(id uint) error                     { return r.t.delete(id) }
+
+// MemoryColorRangeRepository is an in-memory ColorRangeRepository.
+type MemoryColorRangeRepository struct{ t *memTable[models.ColorRange] }
+
+func NewMemoryColorRangeRepository() *MemoryColorRangeRepository {
+	return &MemoryColorRangeRepository{newMemTable(
+		func(c *models.ColorRange) *uint { return &c.ID },
+		func(c *models.ColorRange) *gorm.Model { return &c.Model },
+	)}
+}
+
+func (r *MemoryColorRangeRepository) Create(colorRange *models.ColorRange) error {
+	return r.t.create(colorRange)
+}
+
+func (r *MemoryColorRangeRepository) FindByID(id uint) (models.ColorRange, error) {
+	return r.t.find(id)
+}
+
+func (r *MemoryColorRangeRepository) List() ([]models.ColorRange, error) { return r.t.list(), nil }
+
+func (r *MemoryColorRangeRepository) Save(colorRange *models.ColorRange) error {
+	return r.t.save(colorRange)
+}
+
+func (r *MemoryColorRangeRepository) Delete(id uint) error { return r.t.delete(id) }
+
+// MemoryUserRepository is an in-memory UserRepository.
+type MemoryUserRepository struct{ t *memTable[models.User] }
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{newMemTable(
+		func(u *models.User) *uint { return &u.ID },
+		func(u *models.User) *gorm.Model { return &u.Model },
+	)}
+}
+
+func (r *MemoryUserRepository) Create(user *models.User) error { return r.t.create(user) }
+
+func (r *MemoryUserRepository) FindByUsername(username string) (models.User, error) {
+	return r.t.first(func(u models.User) bool { return u.Username == username })
+}
+
+// MemoryReadingRepository is an in-memory ReadingRepository over sensor_data
+// rows. The province of a row is parsed from its address, as ingest does.
+type MemoryReadingRepository struct {
+	mu   sync.Mutex
+	rows []models.SensorData
+}
+
+// NewMemoryReadingRepository returns a repository holding rows.
+func NewMemoryReadingRepository(rows ...models.SensorData) *MemoryReadingRepository {
+	r := &MemoryReadingRepository{}
+	r.Add(rows...)
+	return r
+}
+
+// Add stores more readings.
+func (r *MemoryReadingRepository) Add(rows ...models.SensorData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows = append(r.rows, rows...)
+}
+
+func (r *MemoryReadingRepository) window(from, to time.Time) []models.SensorData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []models.SensorData
+	for _, row := range r.rows {
+		if row.Timestamp >= from.UnixMilli() && row.Timestamp < to.UnixMilli() {
+			out = append(out, row)
+		}
+	}
+	return out
+}
+
+func (r *MemoryReadingRepository) AddressAverages(from, to time.Time) ([]AddressAverage, error) {
+	type sum struct{ pm25, pm10, n float64 }
+	sums := map[string]*sum{}
+	var order []string
+	for _, row := range r.window(from, to) {
+		s, ok := sums[row.Address]
+		if !ok {
+			s = &sum{}
+			sums[row.Address] = s
+			order = append(order, row.Address)
+		}
+		s.pm25 += float64(row.PM25)
+		s.pm10 += float64(row.PM10)
+		s.n++
+	}
+	out := make([]AddressAverage, 0, len(order))
+	for _, a := range order {
+		s := sums[a]
+		out = append(out, AddressAverage{Address: a, AvgPM25: s.pm25 / s.n, AvgPM10: s.pm10 / s.n})
+	}
+	return out, nil
+}
+
+func (r *MemoryReadingRepository) ProvinceAveragesPM25(from, to time.Time, excludeAnomalies bool) ([]ProvinceAverage, error) {
+	sums := map[string]*ProvinceAverage{}
+	for _, row := range r.window(from, to) {
+		province := thaiaddress.Parse(row.Address).Province
+		if province == "" || (excludeAnomalies && row.Anomaly) {
+			continue
+		}
+		p, ok := sums[province]
+		if !ok {
+			p = &ProvinceAverage{Province: province}
+			sums[province] = p
+		}
+		p.AvgPM25 += float64(row.PM25)
+		p.Readings++
+	}
+	out := make([]ProvinceAverage, 0, len(sums))
+	for _, p := range sums {
+		p.AvgPM25 = math.Round(p.AvgPM25/float64(p.Readings)*100) / 100
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AvgPM25 > out[j].AvgPM25 })
+	return out, nil
+}
+
+func (r *MemoryReadingRepository) Between(from, to time.Time) ([]models.SensorData, error) {
+	out := r.window(from, to)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Timestamp > out[j].Timestamp })
+	return out, nil
+}
+
+func (r *MemoryReadingRepository) Latest(f ReadingFilter) (models.SensorData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest models.SensorData
+	found := false
+	for _, row := range r.rows {
+		if !f.matches(row) {
+			continue
+		}
+		if !found || row.Timestamp > latest.Timestamp {
+			latest, found = row, true
+		}
+	}
+	if !found {
+		return latest, gorm.ErrRecordNotFound
+	}
+	return latest, nil
+}
+
+func (r *MemoryReadingRepository) PMAverages(f ReadingFilter, from, to time.Time) (PMAverage, error) {
+	var avg PMAverage
+	var pm25, pm10 struct{ sum, n float64 }
+	for _, row := range r.window(from, to) {
+		if !f.matches(row) {
+			continue
+		}
+		avg.Readings++
+		if row.PM25 != 0 {
+			pm25.sum += float64(row.PM25)
+			pm25.n++
+		}
+		if row.PM10 != 0 {
+			pm10.sum += float64(row.PM10)
+			pm10.n++
+		}
+	}
+	if pm25.n > 0 {
+		v := pm25.sum / pm25.n
+		avg.PM25 = &v
+	}
+	if pm10.n > 0 {
+		v := pm10.sum / pm10.n
+		avg.PM10 = &v
+	}
+	return avg, nil
+}
+
+func (r *MemoryReadingRepository) HourlyPM(dvid string, from, to time.Time) ([]HourlyPM, error) {
+	type sum struct{ pm25, n25, pm10, n10 float64 }
+	sums := map[int64]*sum{}
+	for _, row := range r.window(from, to) {
+		if row.DVID != dvid {
+			continue
+		}
+		hour := row.Timestamp - row.Timestamp%time.Hour.Milliseconds()
+		s, ok := sums[hour]
+		if !ok {
+			s = &sum{}
+			sums[hour] = s
+		}
+		if row.PM25 != 0 {
+			s.pm25 += float64(row.PM25)
+			s.n25++
+		}
+		if row.PM10 != 0 {
+			s.pm10 += float64(row.PM10)
+			s.n10++
+		}
+	}
+	out := make([]HourlyPM, 0, len(sums))
+	for hour, s := range sums {
+		h := HourlyPM{Hour: time.UnixMilli(hour)}
+		if s.n25 > 0 {
+			v := s.pm25 / s.n25
+			h.PM25 = &v
+		}
+		if s.n10 > 0 {
+			v := s.pm10 / s.n10
+			h.PM10 = &v
+		}
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Hour.After(out[j].Hour) })
+	return out, nil
+}
+
+// provinceHours returns the readings of the window matching f, as
+// HourlyLatest and HourlyAverages select them, keyed by province and Bangkok
+// wall-clock hour.
+func (r *MemoryReadingRepository) provinceHours(f ReadingFilter, metric string, from, to time.Time) (map[seriesGroup][]models.SensorData, error) {
+	if err := readingMetric(metric); err != nil {
+		return nil, err
+	}
+	out := map[seriesGroup][]models.SensorData{}
+	for _, row := range r.window(from, to) {
+		province := thaiaddress.Parse(row.Address).Province
+		if !f.matches(row) || (f == (ReadingFilter{}) && province == "") {
+			continue
+		}
+		wall := time.UnixMilli(row.Timestamp).In(database.Bangkok)
+		g := seriesGroup{province, seriesBucket("1h", wall)}
+		out[g] = append(out[g], row)
+	}
+	return out, nil
+}
+
+// provinceHourRows sorts values by hour and province.
+func provinceHourRows(values map[seriesGroup]float64) []ProvinceHour {
+	out := make([]ProvinceHour, 0, len(values))
+	for g, v := range values {
+		out = append(out, ProvinceHour{Province: g.key, Hour: g.bucket, Value: v})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Hour.Equal(out[j].Hour) {
+			return out[i].Hour.Before(out[j].Hour)
+		}
+		return out[i].Province < out[j].Province
+	})
+	return out
+}
+
+func (r *MemoryReadingRepository) HourlyLatest(f ReadingFilter, metric string, from, to time.Time) ([]ProvinceHour, error) {
+	hours, err := r.provinceHours(f, metric, from, to)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[seriesGroup]float64, len(hours))
+	for g, rows := range hours {
+		latest := rows[0]
+		for _, row := range rows[1:] {
+			if row.Timestamp > latest.Timestamp {
+				latest = row
+			}
+		}
+		values[g], _ = seriesValue(latest, metric)
+	}
+	return provinceHourRows(values), nil
+}
+
+func (r *MemoryReadingRepository) HourlyAverages(f ReadingFilter, metric string, from, to time.Time) ([]ProvinceHour, error) {
+	hours, err := r.provinceHours(f, metric, from, to)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[seriesGroup]float64, len(hours))
+	for g, rows := range hours {
+		var sum float64
+		for _, row := range rows {
+			v, _ := seriesValue(row, metric)
+			sum += v
+		}
+		values[g] = sum / float64(len(rows))
+	}
+	return provinceHourRows(values), nil
+}
+
+func (r *MemoryReadingRepository) GroupAverages(group, metric string, from, to time.Time, excludeAnomalies bool) ([]GroupAverage, error) {
+	if err := readingMetric(metric); err != nil {
+		return nil, err
+	}
+	if !readingGroups[group] {
+		return nil, fmt.Errorf("unknown group %q", group)
+	}
+	type sum struct {
+		avg   GroupAverage
+		total float64
+		n     int
+	}
+	sums := map[string]*sum{}
+	var order []string
+	for _, row := range r.window(from, to) {
+		key := row.Address
+		switch group {
+		case "place":
+			key = row.Place
+		case "province":
+			key = thaiaddress.Parse(row.Address).Province
+		}
+		if key == "" || (excludeAnomalies && row.Anomaly) {
+			continue
+		}
+		s, ok := sums[key]
+		if !ok {
+			s = &sum{avg: GroupAverage{Key: key}}
+			sums[key] = s
+			order = append(order, key)
+		}
+		s.avg.Readings++
+		if v, _ := seriesValue(row, metric); v != 0 {
+			s.total += v
+			s.n++
+		}
+	}
+	out := make([]GroupAverage, 0, len(order))
+	for _, key := range order {
+		s := sums[key]
+		if s.n > 0 {
+			v := s.total / float64(s.n)
+			s.avg.Avg = &v
+		}
+		out = append(out, s.avg)
+	}
+	return out, nil
+}
+
+// matches applies f the way the SQL filter does, with the province parsed
+// from the address.
+func (f ReadingFilter) matches(row models.SensorData) bool {
+	switch {
+	case f.DVID != "":
+		return row.DVID == f.DVID
+	case f.ProvinceCode != "":
+		return thaiaddress.Parse(row.Address).ProvinceCode == f.ProvinceCode
+	case f.Place != "":
+		return strings.Contains(strings.ToLower(row.Place), strings.ToLower(f.Place))
+	}
+	return true
+}
+
+// matchesStation applies f to a station version like the SQL filter does.
+func (f ReadingFilter) matchesStation(s models.Station) bool {
+	switch {
+	case f.DVID != "":
+		return s.DVID == f.DVID
+	case f.ProvinceCode != "":
+		return s.ProvinceCode == f.ProvinceCode
+	case f.Place != "":
+		return strings.Contains(strings.ToLower(s.Place), strings.ToLower(f.Place))
+	}
+	return true
+}
+
+// MemoryStationRepository is an in-memory StationRepository over station
+// versions.
+type MemoryStationRepository struct {
+	mu       sync.Mutex
+	stations []models.Station
+	daily    []DailyMean
+	drift    map[string]models.StationDrift
+}
+
+// NewMemoryStationRepository returns a repository holding stations.
+func NewMemoryStationRepository(stations ...models.Station) *MemoryStationRepository {
+	r := &MemoryStationRepository{}
+	r.Add(stations...)
+	return r
+}
+
+// Add stores more station versions.
+func (r *MemoryStationRepository) Add(stations ...models.Station) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stations = append(r.stations, stations...)
+}
+
+func (r *MemoryStationRepository) Current(dvid string) (models.Station, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.stations {
+		if s.DVID == dvid && s.ValidTo == nil {
+			return s, nil
+		}
+	}
+	return models.Station{}, gorm.ErrRecordNotFound
+}
+
+func (r *MemoryStationRepository) Places(dvids ...string) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]string, len(dvids))
+	for _, dvid := range dvids {
+		for _, s := range r.stations {
+			if s.DVID == dvid && s.ValidTo == nil && strings.TrimSpace(s.Place) != "" {
+				out[dvid] = strings.TrimSpace(s.Place)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (r *MemoryStationRepository) PlaceIndex(f ReadingFilter) ([]PlaceItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	items := map[[2]string]*PlaceItem{}
+	for _, s := range r.stations {
+		if s.ValidTo != nil || !f.matchesStation(s) {
+			continue
+		}
+		label := strings.TrimSpace(s.Place)
+		if label == "" {
+			label = s.Address
+		}
+		key := [2]string{label, s.Address}
+		item, ok := items[key]
+		if !ok {
+			item = &PlaceItem{Label: label, Address: s.Address, Latitude: s.Latitude, Longitude: s.Longitude}
+			items[key] = item
+		}
+		item.Latitude = math.Max(item.Latitude, s.Latitude)
+		item.Longitude = math.Max(item.Longitude, s.Longitude)
+		item.Count++
+	}
+	out := make([]PlaceItem, 0, len(items))
+	for _, item := range items {
+		out = append(out, *item)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Label < out[j].Label
+	})
+	if len(out) > 1000 {
+		out = out[:1000]
+	}
+	return out, nil
+}
+
+func (r *MemoryStationRepository) Located() ([]models.Station, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []models.Station
+	for _, s := range r.stations {
+		if s.ValidTo == nil && !(s.Latitude == 0 && s.Longitude == 0) {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DVID < out[j].DVID })
+	return out, nil
+}
+
+// AddDaily stores daily rollup means for DailyPM25.
+func (r *MemoryStationRepository) AddDaily(days ...DailyMean) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.daily = append(r.daily, days...)
+}
+
+func (r *MemoryStationRepository) DailyPM25(from, to time.Time, minReadings int) ([]DailyMean, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []DailyMean
+	for _, d := range r.daily {
+		if !d.Day.Before(from) && d.Day.Before(to) && d.Readings >= minReadings {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// SetDrift stores drift results, replacing earlier ones of the same dvid.
+func (r *MemoryStationRepository) SetDrift(drifts ...models.StationDrift) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.drift == nil {
+		r.drift = make(map[string]models.StationDrift)
+	}
+	for _, d := range drifts {
+		r.drift[d.DVID] = d
+	}
+}
+
+func (r *MemoryStationRepository) Drift(dvids ...string) (map[string]models.StationDrift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string]models.StationDrift, len(dvids))
+	for _, dvid := range dvids {
+		if d, ok := r.drift[dvid]; ok {
+			out[dvid] = d
+		}
+	}
+	return out, nil
+}
+
+func (r *MemoryStationRepository) ReplaceDrift(results []models.StationDrift) error {
+	r.mu.Lock()
+	r.drift = nil
+	r.mu.Unlock()
+	r.SetDrift(results...)
+	return nil
+}
+
+func (r *MemoryStationRepository) ListDrift(flaggedOnly bool, limit, offset int) ([]models.StationDrift, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []models.StationDrift
+	for _, d := range r.drift {
+		if flaggedOnly && !d.Flagged {
+			continue
+		}
+		for _, s := range r.stations {
+			if s.DVID == d.DVID && s.ValidTo == nil {
+				d.Place = s.Place
+			}
+		}
+		rows = append(rows, d)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Flagged != b.Flagged {
+			return a.Flagged
+		}
+		if math.Abs(a.Score) != math.Abs(b.Score) {
+			return math.Abs(a.Score) > math.Abs(b.Score)
+		}
+		return a.DVID < b.DVID
+	})
+	total := int64(len(rows))
+	return page(rows, limit, offset), total, nil
+}
+
+// MemoryAnomalyRepository is an in-memory AnomalyRepository. Its device
+// summaries carry no place, as it holds no stations.
+type MemoryAnomalyRepository struct {
+	mu       sync.Mutex
+	readings []AnomalyReading
+	reasons  map[readingKey]models.ReadingAnomaly
+}
+
+type readingKey struct {
+	dvid      string
+	timestamp int64
+}
+
+// NewMemoryAnomalyRepository returns a repository holding readings.
+func NewMemoryAnomalyRepository(readings ...AnomalyReading) *MemoryAnomalyRepository {
+	return &MemoryAnomalyRepository{readings: readings, reasons: make(map[readingKey]models.ReadingAnomaly)}
+}
+
+func (r *MemoryAnomalyRepository) Readings(from, to time.Time) ([]AnomalyReading, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []AnomalyReading
+	for _, row := range r.readings {
+		if row.Timestamp >= from.UnixMilli() && row.Timestamp < to.UnixMilli() {
+			out = append(out, row)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].DVID != out[j].DVID {
+			return out[i].DVID < out[j].DVID
+		}
+		return out[i].Timestamp < out[j].Timestamp
+	})
+	return out, nil
+}
+
+// setFlag sets the flag of a stored reading and reports whether it changed.
+func (r *MemoryAnomalyRepository) setFlag(dvid string, timestamp int64, flag bool) bool {
+	for i := range r.readings {
+		if row := &r.readings[i]; row.DVID == dvid && row.Timestamp == timestamp && row.Anomaly != flag {
+			row.Anomaly = flag
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryAnomalyRepository) Apply(flagged []models.ReadingAnomaly, cleared []AnomalyReading) (int, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	nFlagged, nCleared := 0, 0
+	for _, a := range flagged {
+		if r.setFlag(a.DVID, a.Timestamp, true) {
+			nFlagged++
+		}
+		r.reasons[readingKey{a.DVID, a.Timestamp}] = a
+	}
+	for _, c := range cleared {
+		if r.setFlag(c.DVID, c.Timestamp, false) {
+			nCleared++
+		}
+		delete(r.reasons, readingKey{c.DVID, c.Timestamp})
+	}
+	return nFlagged, nCleared, nil
+}
+
+func (r *MemoryAnomalyRepository) matching(dvid string, since time.Time) []models.ReadingAnomaly {
+	var out []models.ReadingAnomaly
+	for _, a := range r.reasons {
+		if a.Timestamp >= since.UnixMilli() && (dvid == "" || a.DVID == dvid) {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Timestamp != out[j].Timestamp {
+			return out[i].Timestamp > out[j].Timestamp
+		}
+		return out[i].DVID < out[j].DVID
+	})
+	return out
+}
+
+func (r *MemoryAnomalyRepository) List(dvid string, since time.Time, limit, offset int) ([]models.ReadingAnomaly, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows := r.matching(dvid, since)
+	total := int64(len(rows))
+	return page(rows, limit, offset), total, nil
+}
+
+func (r *MemoryAnomalyRepository) Devices(dvid string, since time.Time) ([]AnomalyDevice, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byDVID := make(map[string]*AnomalyDevice)
+	var devices []*AnomalyDevice
+	for _, a := range r.matching(dvid, since) {
+		d := byDVID[a.DVID]
+		if d == nil {
+			d = &AnomalyDevice{DVID: a.DVID}
+			byDVID[a.DVID] = d
+			devices = append(devices, d)
+		}
+		d.Anomalies++
+		d.LastTimestamp = max(d.LastTimestamp, a.Timestamp)
+		d.MaxPM25 = max(d.MaxPM25, a.PM25)
+		d.MaxScore = max(d.MaxScore, a.Score)
+	}
+	out := make([]AnomalyDevice, len(devices))
+	for i, d := range devices {
+		out[i] = *d
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Anomalies != out[j].Anomalies {
+			return out[i].Anomalies > out[j].Anomalies
+		}
+		return out[i].DVID < out[j].DVID
+	})
+	return out, nil
+}
+
+// page returns the rows of a limit/offset page; a negative limit means no
+// limit, as in GORM.
+func page[T any](rows []T, limit, offset int) []T {
+	if offset > len(rows) {
+		offset = len(rows)
+	}
+	rows = rows[offset:]
+	if limit >= 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+// MemoryRollupRepository is an in-memory RollupRepository over hourly and
+// daily rollup rows; the station filters of RollupFilter read the stations
+// added with AddStations.
+type MemoryRollupRepository struct {
+	mu       sync.Mutex
+	hourly   []models.RollupBucket
+	daily    []models.RollupBucket
+	stations []models.Station
+}
+
+// NewMemoryRollupRepository returns a repository holding hourly rollup rows.
+func NewMemoryRollupRepository(hourly ...models.RollupBucket) *MemoryRollupRepository {
+	return &MemoryRollupRepository{hourly: hourly}
+}
+
+// AddHourly stores more hourly rollup rows.
+func (r *MemoryRollupRepository) AddHourly(rows ...models.RollupBucket) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hourly = append(r.hourly, rows...)
+}
+
+// AddDaily stores more daily rollup rows.
+func (r *MemoryRollupRepository) AddDaily(rows ...models.RollupBucket) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.daily = append(r.daily, rows...)
+}
+
+// AddStations stores station versions for the station filters.
+func (r *MemoryRollupRepository) AddStations(stations ...models.Station) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stations = append(r.stations, stations...)
+}
+
+// matches applies f the way the SQL filter does.
+func (r *MemoryRollupRepository) matches(f RollupFilter, b models.RollupBucket) bool {
+	if b.Scope != f.Scope {
+		return false
+	}
+	switch {
+	case len(f.Keys) > 0:
+		for _, k := range f.Keys {
+			if b.Key == k {
+				return true
+			}
+		}
+		return false
+	case len(f.KeyLike) > 0:
+		for _, s := range f.KeyLike {
+			if strings.Contains(strings.ToLower(b.Key), strings.ToLower(s)) {
+				return true
+			}
+		}
+		return false
+	case f.ProvinceCode != "" || f.Place != "" || f.Address != "":
+		s, ok := r.current(b.Key)
+		switch {
+		case !ok:
+			return false
+		case f.ProvinceCode != "":
+			return s.ProvinceCode == f.ProvinceCode
+		case f.Place != "":
+			return strings.Contains(strings.ToLower(s.Place), strings.ToLower(f.Place))
+		}
+		return strings.Contains(strings.ToLower(s.Address), strings.ToLower(f.Address))
+	}
+	return true
+}
+
+// current returns the current version of station dvid.
+func (r *MemoryRollupRepository) current(dvid string) (models.Station, bool) {
+	for _, s := range r.stations {
+		if s.DVID == dvid && s.ValidTo == nil {
+			return s, true
+		}
+	}
+	return models.Station{}, false
+}
+
+// pmSum accumulates reading-weighted PM2.5 and PM10 means of rollup rows.
+type pmSum struct {
+	pm25, n25, pm10, n10 float64
+	readings             int
+}
+
+func (s *pmSum) add(b models.RollupBucket) {
+	if b.PM25Avg != nil {
+		s.pm25 += *b.PM25Avg * float64(b.PM25Count)
+		s.n25 += float64(b.PM25Count)
+	}
+	if b.PM10Avg != nil {
+		s.pm10 += *b.PM10Avg * float64(b.PM10Count)
+		s.n10 += float64(b.PM10Count)
+	}
+	s.readings += int(b.Readings)
+}
+
+// means returns the weighted means, nil without data.
+func (s *pmSum) means() (pm25, pm10 *float64) {
+	if s.n25 > 0 {
+		v := s.pm25 / s.n25
+		pm25 = &v
+	}
+	if s.n10 > 0 {
+		v := s.pm10 / s.n10
+		pm10 = &v
+	}
+	return pm25, pm10
+}
+
+// dailyIn returns the daily rows of the window, compared as Bangkok
+// wall-clock buckets.
+func (r *MemoryRollupRepository) dailyIn(from, to time.Time) []models.RollupBucket {
+	lo, hi := bucketArg(from), bucketArg(to)
+	var out []models.RollupBucket
+	for _, b := range r.daily {
+		if at := b.Bucket.Format("2006-01-02 15:04:05"); at >= lo && at < hi {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func (r *MemoryRollupRepository) AddressAverages(from, to time.Time) ([]AddressAverage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sums := map[string]*pmSum{}
+	var order []string
+	for _, b := range r.dailyIn(from, to) {
+		s, ok := r.current(b.Key)
+		if b.Scope != models.RollupScopeDVID || !ok {
+			continue
+		}
+		sum, ok := sums[s.Address]
+		if !ok {
+			sum = &pmSum{}
+			sums[s.Address] = sum
+			order = append(order, s.Address)
+		}
+		sum.add(b)
+	}
+	out := make([]AddressAverage, 0, len(order))
+	for _, address := range order {
+		a := AddressAverage{Address: address}
+		pm25, pm10 := sums[address].means()
+		if pm25 != nil {
+			a.AvgPM25 = *pm25
+		}
+		if pm10 != nil {
+			a.AvgPM10 = *pm10
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func (r *MemoryRollupRepository) DailyPM(f RollupFilter, from, to time.Time) ([]DailyPM, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sums := map[time.Time]*pmSum{}
+	for _, b := range r.dailyIn(from, to) {
+		if !r.matches(f, b) {
+			continue
+		}
+		sum, ok := sums[b.Bucket]
+		if !ok {
+			sum = &pmSum{}
+			sums[b.Bucket] = sum
+		}
+		sum.add(b)
+	}
+	round := func(v *float64) *float64 {
+		if v != nil {
+			*v = math.Round(*v*100) / 100
+		}
+		return v
+	}
+	out := make([]DailyPM, 0, len(sums))
+	for day, sum := range sums {
+		pm25, pm10 := sum.means()
+		out = append(out, DailyPM{Day: day, PM25: round(pm25), PM10: round(pm10), Readings: sum.readings})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Day.Before(out[j].Day) })
+	return out, nil
+}
+
+func (r *MemoryRollupRepository) Day(scope string, day time.Time) ([]models.RollupBucket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	want := day.In(database.Bangkok).Format("2006-01-02") + " 00:00:00"
+	var out []models.RollupBucket
+	for _, b := range r.daily {
+		if b.Scope == scope && b.Bucket.Format("2006-01-02 15:04:05") == want {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+func (r *MemoryRollupRepository) DailyFromHourly(f RollupFilter, pollutant string, limits []float64, from, to time.Time) ([]RollupDay, error) {
+	if !rollupPollutants[pollutant] {
+		return nil, fmt.Errorf("pollutant %q is not rolled up", pollutant)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lo, hi := bucketArg(from), bucketArg(to)
+
+	type dayKey struct {
+		key string
+		day time.Time
+	}
+	sums := map[dayKey]float64{}
+	days := map[dayKey]*RollupDay{}
+	var order []dayKey
+	for _, b := range r.hourly {
+		avg, _, _, count, _ := b.Metric(pollutant)
+		at := b.Bucket.Format("2006-01-02 15:04:05")
+		if !r.matches(f, b) || at < lo || at >= hi || count == 0 || avg == nil {
+			continue
+		}
+		k := dayKey{b.Key, time.Date(b.Bucket.Year(), b.Bucket.Month(), b.Bucket.Day(), 0, 0, 0, 0, time.UTC)}
+		d := days[k]
+		if d == nil {
+			d = &RollupDay{Key: k.key, Day: k.day, Above: make([]int, len(limits))}
+			days[k] = d
+			order = append(order, k)
+		}
+		d.Hours++
+		sums[k] += *avg
+		if d.Max == nil || *avg > *d.Max {
+			v := *avg
+			d.Max = &v
+		}
+		for i, limit := range limits {
+			if *avg > limit {
+				d.Above[i]++
+			}
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].key != order[j].key {
+			return order[i].key < order[j].key
+		}
+		return order[i].day.Before(order[j].day)
+	})
+	out := make([]RollupDay, 0, len(order))
+	for _, k := range order {
+		d := days[k]
+		mean := sums[k] / float64(d.Hours)
+		d.Mean = &mean
+		out = append(out, *d)
+	}
+	return out, nil
+}
+
+// MemorySeriesRepository is an in-memory SeriesRepository over raw readings
+// and the rollup rows of Rollups. The province of a reading is parsed from its
+// address, as ingest does.
+type MemorySeriesRepository struct {
+	Rollups *MemoryRollupRepository
+
+	mu       sync.Mutex
+	readings []models.SensorData
+}
+
+// NewMemorySeriesRepository returns a repository holding readings, with
+// empty rollups.
+func NewMemorySeriesRepository(readings ...models.SensorData) *MemorySeriesRepository {
+	return &MemorySeriesRepository{Rollups: NewMemoryRollupRepository(), readings: readings}
+}
+
+// seriesBucket truncates a Bangkok wall-clock time to its interval bucket.
+func seriesBucket(interval string, t time.Time) time.Time {
+	switch interval {
+	case "5m":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()/5*5, 0, 0, time.UTC)
+	case "1h":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.UTC)
+	case "1w":
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+	case "1M":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// seriesValue reads metric from row like seriesMetricSQL; ok is false for a
+// missing value.
+func seriesValue(row models.SensorData, metric string) (float64, bool) {
+	var v int
+	zeroMissing := true
+	switch metric {
+	case "pm25":
+		v = row.PM25
+	case "pm10":
+		v = row.PM10
+	case "pm100":
+		v = row.PM100
+	case "aqi":
+		v = row.AQI
+	case "av1h":
+		v = row.Av1h
+	case "av3h":
+		v = row.Av3h
+	case "av6h":
+		v = row.Av6h
+	case "av12h":
+		v = row.Av12h
+	case "av24h":
+		v = row.Av24h
+	case "pres":
+		v = row.Pres
+	case "temperature":
+		v, zeroMissing = row.Temperature, false
+	case "humidity":
+		v, zeroMissing = row.Humidity, false
+	}
+	return float64(v), !(zeroMissing && v == 0)
+}
+
+// percentile interpolates like percentile_cont; values is sorted.
+func percentile(values []float64, p float64) float64 {
+	pos := p * float64(len(values)-1)
+	lo := int(math.Floor(pos))
+	if lo+1 >= len(values) {
+		return values[lo]
+	}
+	return values[lo] + (pos-float64(lo))*(values[lo+1]-values[lo])
+}
+
+type seriesGroup struct {
+	key    string
+	bucket time.Time
+}
+
+// seriesRows sorts groups by key and bucket into rows.
+func seriesRows(groups map[seriesGroup]SeriesRow) []SeriesRow {
+	rows := make([]SeriesRow, 0, len(groups))
+	for _, row := range groups {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Key != rows[j].Key {
+			return rows[i].Key < rows[j].Key
+		}
+		return rows[i].Bucket.Before(rows[j].Bucket)
+	})
+	return rows
+}
+
+func (r *MemorySeriesRepository) Readings(q SeriesSpec) ([]SeriesRow, error) {
+	if _, ok := seriesMetricSQL[q.Metric]; !ok {
+		return nil, fmt.Errorf("cannot aggregate %s of %s at %s", q.Aggregator, q.Metric, q.Interval)
+	}
+	if _, ok := seriesAggregatorSQL[q.Aggregator]; !ok {
+		return nil, fmt.Errorf("cannot aggregate %s of %s at %s", q.Aggregator, q.Metric, q.Interval)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	in := func(v string, list []string) bool {
+		for _, s := range list {
+			if v == s {
+				return true
+			}
+		}
+		return false
+	}
+	values := map[seriesGroup][]float64{}
+	groups := map[seriesGroup]SeriesRow{}
+	for _, row := range r.readings {
+		if row.Timestamp < q.From.UnixMilli() || row.Timestamp >= q.To.UnixMilli() || (q.ExcludeAnomalies && row.Anomaly) {
+			continue
+		}
+		province := thaiaddress.Parse(row.Address).ProvinceCode
+		place := strings.TrimSpace(row.Place)
+		if len(q.ProvinceCodes) > 0 && !in(province, q.ProvinceCodes) ||
+			len(q.DVIDs) > 0 && !in(row.DVID, q.DVIDs) ||
+			len(q.Places) > 0 && !matchesAnyPlace(row.Place, q.Places) {
+			continue
+		}
+		key := "all"
+		switch q.GroupBy {
+		case "province":
+			key = province
+		case "place":
+			key = place
+		case "dvid":
+			key = row.DVID
+		}
+		if key == "" {
+			continue
+		}
+		wall := time.UnixMilli(row.Timestamp).In(database.Bangkok)
+		g := seriesGroup{key, seriesBucket(q.Interval, wall)}
+		groups[g] = SeriesRow{Key: g.key, Bucket: g.bucket}
+		if v, ok := seriesValue(row, q.Metric); ok {
+			values[g] = append(values[g], v)
+		}
+	}
+
+	for g, row := range groups {
+		vs := values[g]
+		sort.Float64s(vs)
+		row.N = int64(len(vs))
+		var v float64
+		switch {
+		case q.Aggregator == "count":
+			v = float64(len(vs))
+		case len(vs) == 0:
+			continue
+		case q.Aggregator == "avg":
+			for _, x := range vs {
+				v += x
+			}
+			v /= float64(len(vs))
+		case q.Aggregator == "min":
+			v = vs[0]
+		case q.Aggregator == "max":
+			v = vs[len(vs)-1]
+		case q.Aggregator == "median":
+			v = percentile(vs, 0.5)
+		case q.Aggregator == "p90":
+			v = percentile(vs, 0.9)
+		}
+		row.Value = &v
+		groups[g] = row
+	}
+	return seriesRows(groups), nil
+}
+
+func matchesAnyPlace(place string, places []string) bool {
+	for _, p := range places {
+		if strings.Contains(strings.ToLower(place), strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemorySeriesRepository) Rollup(q SeriesSpec, f RollupFilter) ([]SeriesRow, error) {
+	table := seriesRollupTable(q.Interval)
+	if !rolledUpMetrics[q.Metric] || table == "" {
+		return nil, fmt.Errorf("%s at %s is not rolled up", q.Metric, q.Interval)
+	}
+	switch q.Aggregator {
+	case "avg", "min", "max", "count":
+	default:
+		return nil, fmt.Errorf("rollups cannot answer %s", q.Aggregator)
+	}
+	rr := r.Rollups
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	buckets := rr.daily
+	if table == "rollup_hourly" {
+		buckets = rr.hourly
+	}
+
+	lo, hi := bucketArg(q.From), bucketArg(q.To)
+	type acc struct {
+		sum      float64
+		count    int64
+		min, max *int
+	}
+	accs := map[seriesGroup]*acc{}
+	for _, b := range buckets {
+		at := b.Bucket.Format("2006-01-02 15:04:05")
+		if !rr.matches(f, b) || at < lo || at >= hi {
+			continue
+		}
+		key := b.Key
+		if q.GroupBy == "none" {
+			key = "all"
+		}
+		g := seriesGroup{key, seriesBucket(q.Interval, b.Bucket)}
+		a := accs[g]
+		if a == nil {
+			a = &acc{}
+			accs[g] = a
+		}
+		avg, min, max, count, _ := b.Metric(q.Metric)
+		if avg != nil {
+			a.sum += *avg * float64(count)
+		}
+		a.count += count
+		if min != nil && (a.min == nil || *min < *a.min) {
+			a.min = min
+		}
+		if max != nil && (a.max == nil || *max > *a.max) {
+			a.max = max
+		}
+	}
+
+	groups := map[seriesGroup]SeriesRow{}
+	for g, a := range accs {
+		row := SeriesRow{Key: g.key, Bucket: g.bucket, N: a.count}
+		var v *float64
+		switch q.Aggregator {
+		case "avg":
+			if a.count > 0 {
+				x := a.sum / float64(a.count)
+				v = &x
+			}
+		case "min":
+			if a.min != nil {
+				x := float64(*a.min)
+				v = &x
+			}
+		case "max":
+			if a.max != nil {
+				x := float64(*a.max)
+				v = &x
+			}
+		case "count":
+			x := float64(a.count)
+			v = &x
+		}
+		row.Value = v
+		groups[g] = row
+	}
+	return seriesRows(groups), nil
+}
+
+var (
+	_ DeviceRepository       = (*MemoryDeviceRepository)(nil)
+	_ NewsRepository         = (*MemoryNewsRepository)(nil)
+	_ CategoryRepository     = (*MemoryCategoryRepository)(nil)
+	_ NotificationRepository = (*MemoryNotificationRepository)(nil)
+	_ SponsorRepository      = (*MemorySponsorRepository)(nil)
+	_ ColorRangeRepository   = (*MemoryColorRangeRepository)(nil)
+	_ UserRepository         = (*MemoryUserRepository)(nil)
+	_ ReadingRepository      = (*MemoryReadingRepository)(nil)
+	_ StationRepository      = (*MemoryStationRepository)(nil)
+	_ AnomalyRepository      = (*MemoryAnomalyRepository)(nil)
+	_ RollupRepository       = (*MemoryRollupRepository)(nil)
+	_ SeriesRepository       = (*MemorySeriesRepository)(nil)
+)
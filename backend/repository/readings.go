@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+)
+
+// ReadingRepository answers the air quality queries over raw readings (the
+// sensor_data view). Windows are [from, to).
+type ReadingRepository interface {
+	// AddressAverages averages PM2.5 and PM10 per station address.
+	AddressAverages(from, to time.Time) ([]AddressAverage, error)
+	// ProvinceAveragesPM25 averages PM2.5 per parsed province, highest first;
+	// readings of stations without a province are left out, and so are
+	// readings flagged as anomalies when excludeAnomalies is set.
+	ProvinceAveragesPM25(from, to time.Time, excludeAnomalies bool) ([]ProvinceAverage, error)
+	// Between returns the readings in the window, newest first.
+	Between(from, to time.Time) ([]models.SensorData, error)
+	// Latest returns the newest reading matching f.
+	Latest(f ReadingFilter) (models.SensorData, error)
+	// PMAverages averages PM2.5 and PM10 over the readings matching f,
+	// ignoring zero values.
+	PMAverages(f ReadingFilter, from, to time.Time) (PMAverage, error)
+	// HourlyPM averages PM2.5 and PM10 of station dvid per clock hour,
+	// newest first, ignoring zero values. Hours without readings are left out.
+	HourlyPM(dvid string, from, to time.Time) ([]HourlyPM, error)
+	// HourlyLatest returns, per parsed province and Bangkok hour, the value
+	// of metric in the newest reading matching f, by hour. The zero filter
+	// leaves out readings without a province.
+	HourlyLatest(f ReadingFilter, metric string, from, to time.Time) ([]ProvinceHour, error)
+	// HourlyAverages averages metric per parsed province and Bangkok hour
+	// over the readings matching f, by hour. The zero filter leaves out
+	// readings without a province.
+	HourlyAverages(f ReadingFilter, metric string, from, to time.Time) ([]ProvinceHour, error)
+	// GroupAverages averages metric, ignoring zero values, per address,
+	// place or parsed province (group); readings without the group are left
+	// out, and so are readings flagged as anomalies when excludeAnomalies is
+	// set.
+	GroupAverages(group, metric string, from, to time.Time, excludeAnomalies bool) ([]GroupAverage, error)
+}
+
+// AddressAverage is the mean PM2.5 and PM10 of one station address.
+type AddressAverage struct {
+	Address string
+	AvgPM25 float64 `gorm:"column:avg_pm25"`
+	AvgPM10 float64 `gorm:"column:avg_pm10"`
+}
+
+// ProvinceAverage is the mean PM2.5 of one province, rounded to two decimals,
+// over Readings readings.
+type ProvinceAverage struct {
+	Province string
+	AvgPM25  float64 `gorm:"column:avg_pm25"`
+	Readings int
+}
+
+// PMAverage is the mean PM2.5 and PM10 of Readings readings; a mean is nil
+// when no reading carried the pollutant.
+type PMAverage struct {
+	PM25     *float64 `gorm:"column:avg_pm25"`
+	PM10     *float64 `gorm:"column:avg_pm10"`
+	Readings int
+}
+
+// HourlyPM is the mean PM2.5 and PM10 of the hour starting at Hour; a mean is
+// nil when no reading of the hour carried the pollutant.
+type HourlyPM struct {
+	Hour time.Time
+	PM25 *float64 `gorm:"column:avg_pm25"`
+	PM10 *float64 `gorm:"column:avg_pm10"`
+}
+
+// ProvinceHour is one value of a province in the hour starting at Hour, a
+// Bangkok wall-clock time.
+type ProvinceHour struct {
+	Province string
+	Hour     time.Time
+	Value    float64
+}
+
+// GroupAverage is the mean of one group over Readings readings; Avg is nil
+// when none of them had the metric.
+type GroupAverage struct {
+	Key      string
+	Avg      *float64
+	Readings int
+}
+
+// ReadingFilter selects readings of one station by DVID, else by the
+// station's parsed province code or, when that is empty too, by a
+// case-insensitive substring of its place name. The zero filter matches every
+// reading.
+type ReadingFilter struct {
+	DVID         string
+	ProvinceCode string
+	Place        string
+}
+
+type gormReadingRepository struct{ db *gorm.DB }
+
+// NewReadingRepository returns the ReadingRepository backed by db.
+func NewReadingRepository(db *gorm.DB) ReadingRepository {
+	return &gormReadingRepository{db: db}
+}
+
+var readingWindow = database.ReadingWindowSQL("CAST(@from AS timestamptz)", "CAST(@to AS timestamptz)")
+
+func windowArgs(from, to time.Time) map[string]interface{} {
+	return map[string]interface{}{"from": from, "to": to}
+}
+
+func (r *gormReadingRepository) AddressAverages(from, to time.Time) ([]AddressAverage, error) {
+	var rows []AddressAverage
+	err := r.db.Raw(`
+        SELECT address, AVG(pm25) AS avg_pm25, AVG(pm10) AS avg_pm10
+        FROM sensor_data
+        WHERE `+readingWindow+`
+        GROUP BY address`, windowArgs(from, to)).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormReadingRepository) ProvinceAveragesPM25(from, to time.Time, excludeAnomalies bool) ([]ProvinceAverage, error) {
+	anomalies := ""
+	if excludeAnomalies {
+		anomalies = "AND NOT anomaly"
+	}
+	var rows []ProvinceAverage
+	err := r.db.Raw(`
+        SELECT
+            province,
+            ROUND(AVG(pm25)::numeric, 2) AS avg_pm25,
+            COUNT(*) AS readings
+        FROM sensor_data
+        WHERE `+readingWindow+`
+          AND province <> ''
+          `+anomalies+`
+        GROUP BY province
+        ORDER BY avg_pm25 DESC`, windowArgs(from, to)).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormReadingRepository) Between(from, to time.Time) ([]models.SensorData, error) {
+	var rows []models.SensorData
+	err := r.db.Raw(`
+		SELECT *
+		FROM sensor_data
+		WHERE `+readingWindow+`
+		ORDER BY reading_at DESC`, windowArgs(from, to)).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormReadingRepository) Latest(f ReadingFilter) (models.SensorData, error) {
+	var row models.SensorData
+	err := filterReadings(r.db.Table("sensor_data"), f).Order("timestamp DESC").Take(&row).Error
+	return row, err
+}
+
+func (r *gormReadingRepository) PMAverages(f ReadingFilter, from, to time.Time) (PMAverage, error) {
+	var avg PMAverage
+	err := filterReadings(r.db.Table("sensor_data"), f).
+		Select("AVG(NULLIF(pm25, 0)) AS avg_pm25, AVG(NULLIF(pm10, 0)) AS avg_pm10, COUNT(*) AS readings").
+		Where(readingWindow, windowArgs(from, to)).
+		Scan(&avg).Error
+	return avg, err
+}
+
+func (r *gormReadingRepository) HourlyPM(dvid string, from, to time.Time) ([]HourlyPM, error) {
+	var rows []HourlyPM
+	args := windowArgs(from, to)
+	args["dvid"] = dvid
+	err := r.db.Raw(`
+		SELECT date_trunc('hour', reading_at) AS hour,
+		       AVG(NULLIF(pm25, 0)) AS avg_pm25,
+		       AVG(NULLIF(pm10, 0)) AS avg_pm10
+		FROM sensor_data
+		WHERE dvid = @dvid AND `+readingWindow+`
+		GROUP BY hour
+		ORDER BY hour DESC`, args).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readingGroups are the sensor_data columns GroupAverages groups by.
+var readingGroups = map[string]bool{"address": true, "place": true, "province": true}
+
+// readingMetric checks that metric is a sensor_data metric column before it
+// is interpolated into SQL.
+func readingMetric(metric string) error {
+	if _, ok := seriesMetricSQL[metric]; !ok {
+		return fmt.Errorf("unknown metric %q", metric)
+	}
+	return nil
+}
+
+func (r *gormReadingRepository) HourlyLatest(f ReadingFilter, metric string, from, to time.Time) ([]ProvinceHour, error) {
+	if err := readingMetric(metric); err != nil {
+		return nil, err
+	}
+	args := windowArgs(from, to)
+	var rows []ProvinceHour
+	err := r.db.Raw(`
+		WITH hourly AS (
+			SELECT province,
+			       date_trunc('hour', reading_at AT TIME ZONE 'Asia/Bangkok') AS hour,
+			       `+metric+` AS value,
+			       ROW_NUMBER() OVER (
+			           PARTITION BY province, date_trunc('hour', reading_at)
+			           ORDER BY timestamp DESC
+			       ) AS rn
+			FROM sensor_data
+			WHERE `+readingWindow+` AND `+f.provinceWhere(args)+`
+		)
+		SELECT province, hour, value
+		FROM hourly
+		WHERE rn = 1
+		ORDER BY hour, province`, args).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormReadingRepository) HourlyAverages(f ReadingFilter, metric string, from, to time.Time) ([]ProvinceHour, error) {
+	if err := readingMetric(metric); err != nil {
+		return nil, err
+	}
+	args := windowArgs(from, to)
+	var rows []ProvinceHour
+	err := r.db.Raw(`
+		SELECT province,
+		       date_trunc('hour', reading_at AT TIME ZONE 'Asia/Bangkok') AS hour,
+		       AVG(`+metric+`) AS value
+		FROM sensor_data
+		WHERE `+readingWindow+` AND `+f.provinceWhere(args)+`
+		GROUP BY 1, 2
+		ORDER BY hour, province`, args).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormReadingRepository) GroupAverages(group, metric string, from, to time.Time, excludeAnomalies bool) ([]GroupAverage, error) {
+	if err := readingMetric(metric); err != nil {
+		return nil, err
+	}
+	if !readingGroups[group] {
+		return nil, fmt.Errorf("unknown group %q", group)
+	}
+	anomalies := ""
+	if excludeAnomalies {
+		anomalies = "AND NOT anomaly"
+	}
+	var rows []GroupAverage
+	err := r.db.Raw(`
+		SELECT `+group+` AS key,
+		       AVG(NULLIF(`+metric+`, 0)) AS avg,
+		       COUNT(*) AS readings
+		FROM sensor_data
+		WHERE `+readingWindow+`
+		  AND `+group+` IS NOT NULL
+		  AND `+group+` <> ''
+		  `+anomalies+`
+		GROUP BY 1`, windowArgs(from, to)).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// where returns the SQL condition of f on a sensor_data or stations row and
+// adds its named arguments to args.
+func (f ReadingFilter) where(args map[string]interface{}) string {
+	switch {
+	case f.DVID != "":
+		args["dvid"] = f.DVID
+		return "dvid = @dvid"
+	case f.ProvinceCode != "":
+		args["province_code"] = f.ProvinceCode
+		return "province_code = @province_code"
+	case f.Place != "":
+		args["place"] = "%" + f.Place + "%"
+		return "place ILIKE @place"
+	}
+	return "TRUE"
+}
+
+// provinceWhere is f.where, except that the zero filter keeps only readings
+// with a province.
+func (f ReadingFilter) provinceWhere(args map[string]interface{}) string {
+	if f == (ReadingFilter{}) {
+		return "province <> ''"
+	}
+	return f.where(args)
+}
+
+func filterReadings(q *gorm.DB, f ReadingFilter) *gorm.DB {
+	switch {
+	case f.DVID != "":
+		q = q.Where("dvid = ?", f.DVID)
+	case f.ProvinceCode != "":
+		q = q.Where("province_code = ?", f.ProvinceCode)
+	case f.Place != "":
+		q = q.Where("place ILIKE ?", "%"+f.Place+"%")
+	}
+	return q
+}
@@ -0,0 +1,92 @@
+// Package repository is the storage layer behind the services and
+// controllers: one interface per domain, a GORM implementation used by the
+// server and an in-memory fake (memory.go) for tests and local tools.
+//
+// Both implementations report a missing record as gorm.ErrRecordNotFound, so
+// callers can keep checking errors.Is(err, gorm.ErrRecordNotFound).
+package repository
+
+import (
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+)
+
+// DeviceRepository stores registered devices, looked up by their DVID.
+type DeviceRepository interface {
+	Create(device *models.Device) error
+	FindByDVID(dvid string) (models.Device, error)
+	List() ([]models.Device, error)
+	Save(device *models.Device) error
+	Delete(id uint) error
+}
+
+// NewsRepository stores news items. List includes each item's category;
+// FindByID does not until LoadCategory is called.
+type NewsRepository interface {
+	Create(news *models.News) error
+	FindByID(id uint) (models.News, error)
+	LoadCategory(news *models.News) error
+	List() ([]models.News, error)
+	Save(news *models.News) error
+	Delete(id uint) error
+}
+
+// CategoryRepository stores news categories. List includes each category's
+// news.
+type CategoryRepository interface {
+	Create(category *models.Category) error
+	FindByID(id uint) (models.Category, error)
+	List() ([]models.Category, error)
+	Save(category *models.Category) error
+	Delete(id uint) error
+}
+
+// NotificationRepository stores notifications. Delete removes the row for
+// good rather than soft-deleting it.
+type NotificationRepository interface {
+	Create(notification *models.Notification) error
+	FindByID(id uint) (models.Notification, error)
+	// List returns the notifications whose category is none of
+	// excludeCategories.
+	List(excludeCategories ...string) ([]models.Notification, error)
+	Save(notification *models.Notification) error
+	Delete(id uint) error
+}
+
+// SponsorRepository stores sponsors.
+type SponsorRepository interface {
+	Create(sponsor *models.Sponsor) error
+	FindByID(id uint) (models.Sponsor, error)
+	List() ([]models.Sponsor, error)
+	Save(sponsor *models.Sponsor) error
+	Delete(id uint) error
+}
+
+// ColorRangeRepository stores the AQI color scale.
+type ColorRangeRepository interface {
+	Create(colorRange *models.ColorRange) error
+	FindByID(id uint) (models.ColorRange, error)
+	List() ([]models.ColorRange, error)
+	Save(colorRange *models.ColorRange) error
+	Delete(id uint) error
+}
+
+// UserRepository stores dashboard users.
+type UserRepository interface {
+	Create(user *models.User) error
+	FindByUsername(username string) (models.User, error)
+}
+
+// deleteByID deletes the row with the given primary key and reports
+// gorm.ErrRecordNotFound when there was none.
+func deleteByID(db *gorm.DB, model interface{}, id uint) error {
+	res := db.Delete(model, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+)
+
+// RollupRepository answers aggregate queries over the hourly and daily
+// rollups (see services.RefreshRollups). Windows are [from, to) and are
+// compared with the Asia/Bangkok wall-clock buckets.
+type RollupRepository interface {
+	// DailyFromHourly summarises the hourly means of pollutant (pm25 or
+	// pm10) per key and Bangkok day: the hours with data, the mean and the
+	// maximum of their means, and for each of limits how many were above it.
+	// Days without any hour of data are left out.
+	DailyFromHourly(f RollupFilter, pollutant string, limits []float64, from, to time.Time) ([]RollupDay, error)
+	// AddressAverages averages PM2.5 and PM10 of the daily station rollups
+	// per current station address; an average without data is 0.
+	AddressAverages(from, to time.Time) ([]AddressAverage, error)
+	// DailyPM averages PM2.5 and PM10 of the daily rollups of f per day,
+	// rounded to two decimals, by day.
+	DailyPM(f RollupFilter, from, to time.Time) ([]DailyPM, error)
+	// Day returns the daily rollup rows of scope for the Bangkok day of day.
+	Day(scope string, day time.Time) ([]models.RollupBucket, error)
+}
+
+// RollupFilter selects the rollup rows of Scope by key: any of Keys, else keys
+// containing any of KeyLike (any case), else, in the dvid scope, the stations
+// currently in ProvinceCode or whose place or address contains Place or
+// Address. A filter with only a Scope matches every key of it.
+type RollupFilter struct {
+	Scope        string
+	Keys         []string
+	KeyLike      []string
+	ProvinceCode string
+	Place        string
+	Address      string
+}
+
+// RollupDay is one key's Bangkok day of hourly means of a pollutant. Mean and
+// Max are nil when no hour had data; Above counts the hourly means above each
+// requested limit.
+type RollupDay struct {
+	Key   string
+	Day   time.Time
+	Hours int
+	Mean  *float64
+	Max   *float64
+	Above []int
+}
+
+// DailyPM is the mean PM2.5 and PM10 of the day starting at Day, a Bangkok
+// wall-clock time, over Readings readings; a mean is nil without data.
+type DailyPM struct {
+	Day      time.Time
+	PM25     *float64
+	PM10     *float64
+	Readings int
+}
+
+type gormRollupRepository struct{ db *gorm.DB }
+
+// NewRollupRepository returns the RollupRepository backed by db.
+func NewRollupRepository(db *gorm.DB) RollupRepository {
+	return &gormRollupRepository{db: db}
+}
+
+// rolledUpMetrics are the metrics the rollups carry, and rollupPollutants
+// those DailyFromHourly accepts; names are interpolated into SQL.
+var (
+	rolledUpMetrics  = map[string]bool{"pm25": true, "pm10": true, "aqi": true, "temperature": true, "humidity": true}
+	rollupPollutants = map[string]bool{"pm25": true, "pm10": true}
+)
+
+// where returns the SQL condition of f on a rollup table and adds its named
+// arguments to args.
+func (f RollupFilter) where(args map[string]interface{}) string {
+	conds := []string{"scope = @scope"}
+	args["scope"] = f.Scope
+	switch {
+	case len(f.Keys) > 0:
+		conds = append(conds, "key IN @keys")
+		args["keys"] = f.Keys
+	case len(f.KeyLike) > 0:
+		like := make([]string, len(f.KeyLike))
+		for i, s := range f.KeyLike {
+			name := fmt.Sprintf("like%d", i)
+			args[name] = "%" + s + "%"
+			like[i] = "key ILIKE @" + name
+		}
+		conds = append(conds, "("+strings.Join(like, " OR ")+")")
+	case f.ProvinceCode != "":
+		conds = append(conds, "key IN (SELECT dvid FROM stations WHERE valid_to IS NULL AND province_code = @province_code)")
+		args["province_code"] = f.ProvinceCode
+	case f.Place != "":
+		conds = append(conds, "key IN (SELECT dvid FROM stations WHERE valid_to IS NULL AND place ILIKE @place)")
+		args["place"] = "%" + f.Place + "%"
+	case f.Address != "":
+		conds = append(conds, "key IN (SELECT dvid FROM stations WHERE valid_to IS NULL AND address ILIKE @address)")
+		args["address"] = "%" + f.Address + "%"
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (r *gormRollupRepository) DailyFromHourly(f RollupFilter, pollutant string, limits []float64, from, to time.Time) ([]RollupDay, error) {
+	if !rollupPollutants[pollutant] {
+		return nil, fmt.Errorf("pollutant %q is not rolled up", pollutant)
+	}
+	args := map[string]interface{}{"from": bucketArg(from), "to": bucketArg(to)}
+	has := pollutant + "_count > 0"
+	cols := []string{
+		"COUNT(*) FILTER (WHERE " + has + ")",
+		"CAST(AVG(" + pollutant + "_avg) FILTER (WHERE " + has + ") AS float8)",
+		"CAST(MAX(" + pollutant + "_avg) FILTER (WHERE " + has + ") AS float8)",
+	}
+	for i, limit := range limits {
+		name := fmt.Sprintf("limit%d", i)
+		args[name] = limit
+		cols = append(cols, fmt.Sprintf("COUNT(*) FILTER (WHERE %s AND %s_avg > CAST(@%s AS float8))", has, pollutant, name))
+	}
+
+	rows, err := r.db.Raw(`
+		SELECT key, date_trunc('day', bucket) AS day,
+		       `+strings.Join(cols, ",\n\t\t       ")+`
+		FROM rollup_hourly
+		WHERE `+f.where(args)+`
+		  AND bucket >= CAST(@from AS timestamp) AND bucket < CAST(@to AS timestamp)
+		GROUP BY 1, 2
+		HAVING COUNT(*) FILTER (WHERE `+has+`) > 0
+		ORDER BY 1, 2`, args).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []RollupDay
+	for rows.Next() {
+		d := RollupDay{Above: make([]int, len(limits))}
+		var mean, max sql.NullFloat64
+		dest := []interface{}{&d.Key, &d.Day, &d.Hours, &mean, &max}
+		for i := range d.Above {
+			dest = append(dest, &d.Above[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if mean.Valid {
+			d.Mean = &mean.Float64
+		}
+		if max.Valid {
+			d.Max = &max.Float64
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// rollupAvgSQL combines the per-bucket averages of metric into one average
+// weighted by reading count.
+func rollupAvgSQL(metric string) string {
+	return fmt.Sprintf("SUM(%[1]s_avg * %[1]s_count) / NULLIF(SUM(%[1]s_count), 0)", metric)
+}
+
+func (r *gormRollupRepository) AddressAverages(from, to time.Time) ([]AddressAverage, error) {
+	var rows []AddressAverage
+	err := r.db.Raw(`
+		SELECT s.address,
+		       COALESCE(`+rollupAvgSQL("pm25")+`, 0) AS avg_pm25,
+		       COALESCE(`+rollupAvgSQL("pm10")+`, 0) AS avg_pm10
+		FROM rollup_daily r
+		JOIN stations s ON s.dvid = r.key AND s.valid_to IS NULL
+		WHERE r.scope = 'dvid'
+		  AND r.bucket >= CAST(@from AS timestamp) AND r.bucket < CAST(@to AS timestamp)
+		GROUP BY s.address`, map[string]interface{}{"from": bucketArg(from), "to": bucketArg(to)}).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormRollupRepository) DailyPM(f RollupFilter, from, to time.Time) ([]DailyPM, error) {
+	args := map[string]interface{}{"from": bucketArg(from), "to": bucketArg(to)}
+	var rows []DailyPM
+	err := r.db.Raw(`
+		SELECT bucket AS day,
+		       ROUND(CAST(`+rollupAvgSQL("pm25")+` AS numeric), 2) AS pm25,
+		       ROUND(CAST(`+rollupAvgSQL("pm10")+` AS numeric), 2) AS pm10,
+		       SUM(readings) AS readings
+		FROM rollup_daily
+		WHERE `+f.where(args)+`
+		  AND bucket >= CAST(@from AS timestamp) AND bucket < CAST(@to AS timestamp)
+		GROUP BY bucket
+		ORDER BY bucket`, args).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormRollupRepository) Day(scope string, day time.Time) ([]models.RollupBucket, error) {
+	var rows []models.RollupBucket
+	err := r.db.Model(&models.RollupDaily{}).
+		Where("scope = ? AND bucket = CAST(? AS timestamp)", scope, day.In(database.Bangkok).Format("2006-01-02")).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
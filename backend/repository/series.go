@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/database"
+
+	"gorm.io/gorm"
+)
+
+// SeriesRepository aggregates one metric per key and bucket for the series
+// endpoint (see services.GetSeries). Buckets are Asia/Bangkok wall-clock
+// periods returned as timestamps without a zone: 5m, 1h, 1d, 1w (weeks start
+// on Monday) or 1M.
+type SeriesRepository interface {
+	// Readings aggregates the raw readings in [q.From, q.To) matching q's
+	// filters. Keys are ISO province codes, trimmed place names, dvids or
+	// "all", as q.GroupBy says; readings without the key are left out.
+	Readings(q SeriesSpec) ([]SeriesRow, error)
+	// Rollup aggregates the rollup rows of f in [q.From, q.To): the hourly
+	// rollup for 1h buckets, the daily one for longer buckets. Only avg, min,
+	// max and count can be aggregated. Keys are the rollup keys, or "all" when
+	// q.GroupBy is none; q's own filters are ignored.
+	Rollup(q SeriesSpec, f RollupFilter) ([]SeriesRow, error)
+}
+
+// SeriesSpec is a validated series query. Filters of the same kind are ORed,
+// different kinds ANDed; Places match case-insensitive substrings of the place
+// name.
+type SeriesSpec struct {
+	From          time.Time
+	To            time.Time
+	Interval      string
+	Metric        string
+	Aggregator    string
+	GroupBy       string
+	ProvinceCodes []string
+	Places        []string
+	DVIDs         []string
+	// ExcludeAnomalies leaves out readings flagged as spikes.
+	ExcludeAnomalies bool
+}
+
+// SeriesRow is the aggregate of one key and bucket over N readings that had
+// the metric; Value is nil when there were none.
+type SeriesRow struct {
+	Key    string
+	Bucket time.Time
+	Value  *float64
+	N      int64
+}
+
+// seriesMetricSQL is how a raw value is read: zero PM, AQI and pressure
+// values are sensor drop-outs.
+var seriesMetricSQL = map[string]string{
+	"pm25":        "NULLIF(pm25, 0)",
+	"pm10":        "NULLIF(pm10, 0)",
+	"pm100":       "NULLIF(pm100, 0)",
+	"aqi":         "NULLIF(aqi, 0)",
+	"av1h":        "NULLIF(av1h, 0)",
+	"av3h":        "NULLIF(av3h, 0)",
+	"av6h":        "NULLIF(av6h, 0)",
+	"av12h":       "NULLIF(av12h, 0)",
+	"av24h":       "NULLIF(av24h, 0)",
+	"temperature": "temperature",
+	"humidity":    "humidity",
+	"pres":        "NULLIF(pres, 0)",
+}
+
+// seriesAggregatorSQL is the raw-reading aggregate of each aggregator; %s is
+// the metric expression.
+var seriesAggregatorSQL = map[string]string{
+	"avg":    "AVG(%s)",
+	"min":    "MIN(%s)",
+	"max":    "MAX(%s)",
+	"median": "percentile_cont(0.5) WITHIN GROUP (ORDER BY %s)",
+	"p90":    "percentile_cont(0.9) WITHIN GROUP (ORDER BY %s)",
+	"count":  "COUNT(%s)",
+}
+
+func truncSQL(unit string) func(string) string {
+	return func(ts string) string { return "date_trunc('" + unit + "', " + ts + ")" }
+}
+
+// seriesBucketSQL truncates a Bangkok wall-clock timestamp expression to its
+// bucket.
+var seriesBucketSQL = map[string]func(ts string) string{
+	"5m": func(ts string) string {
+		return "date_trunc('hour', " + ts + ") + floor(date_part('minute', " + ts + ") / 5) * interval '5 minutes'"
+	},
+	"1h": truncSQL("hour"),
+	"1d": truncSQL("day"),
+	"1w": truncSQL("week"),
+	"1M": truncSQL("month"),
+}
+
+// seriesRollupTable is the rollup table that answers each interval.
+func seriesRollupTable(interval string) string {
+	switch interval {
+	case "1h":
+		return "rollup_hourly"
+	case "1d", "1w", "1M":
+		return "rollup_daily"
+	}
+	return ""
+}
+
+type gormSeriesRepository struct{ db *gorm.DB }
+
+// NewSeriesRepository returns the SeriesRepository backed by db.
+func NewSeriesRepository(db *gorm.DB) SeriesRepository {
+	return &gormSeriesRepository{db: db}
+}
+
+func (r *gormSeriesRepository) Readings(q SeriesSpec) ([]SeriesRow, error) {
+	metric, ok := seriesMetricSQL[q.Metric]
+	agg, aok := seriesAggregatorSQL[q.Aggregator]
+	bucket, bok := seriesBucketSQL[q.Interval]
+	if !ok || !aok || !bok {
+		return nil, fmt.Errorf("cannot aggregate %s of %s at %s", q.Aggregator, q.Metric, q.Interval)
+	}
+
+	key := "'all'"
+	where := []string{database.ReadingWindowSQL("CAST(@from AS timestamptz)", "CAST(@to AS timestamptz)")}
+	switch q.GroupBy {
+	case "province":
+		key = "province_code"
+		where = append(where, "province_code <> ''")
+	case "place":
+		key = "NULLIF(trim(place), '')"
+		where = append(where, key+" IS NOT NULL")
+	case "dvid":
+		key = "dvid"
+	}
+	if q.ExcludeAnomalies {
+		where = append(where, "NOT anomaly")
+	}
+
+	args := windowArgs(q.From, q.To)
+	if len(q.ProvinceCodes) > 0 {
+		where = append(where, "province_code IN @provinces")
+		args["provinces"] = q.ProvinceCodes
+	}
+	if len(q.Places) > 0 {
+		where = append(where, placeMatchSQL("place", q.Places, args))
+	}
+	if len(q.DVIDs) > 0 {
+		where = append(where, "dvid IN @dvids")
+		args["dvids"] = q.DVIDs
+	}
+
+	var rows []SeriesRow
+	err := r.db.Raw(`
+		SELECT `+key+` AS key,
+			`+bucket("(reading_at AT TIME ZONE 'Asia/Bangkok')")+` AS bucket,
+			CAST(`+fmt.Sprintf(agg, metric)+` AS double precision) AS value,
+			COUNT(`+metric+`) AS n
+		FROM sensor_data
+		WHERE `+strings.Join(where, " AND ")+`
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, args).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormSeriesRepository) Rollup(q SeriesSpec, f RollupFilter) ([]SeriesRow, error) {
+	m := q.Metric
+	table := seriesRollupTable(q.Interval)
+	if !rolledUpMetrics[m] || table == "" {
+		return nil, fmt.Errorf("%s at %s is not rolled up", m, q.Interval)
+	}
+	var value string
+	switch q.Aggregator {
+	case "avg":
+		value = rollupAvgSQL(m)
+	case "min":
+		value = "MIN(" + m + "_min)"
+	case "max":
+		value = "MAX(" + m + "_max)"
+	case "count":
+		value = "SUM(" + m + "_count)"
+	default:
+		return nil, fmt.Errorf("rollups cannot answer %s", q.Aggregator)
+	}
+	key := "key"
+	if q.GroupBy == "none" {
+		key = "'all'"
+	}
+
+	args := map[string]interface{}{"from": bucketArg(q.From), "to": bucketArg(q.To)}
+	var rows []SeriesRow
+	err := r.db.Raw(`
+		SELECT `+key+` AS key,
+			`+seriesBucketSQL[q.Interval]("bucket")+` AS bucket,
+			CAST(`+value+` AS double precision) AS value,
+			SUM(`+m+`_count) AS n
+		FROM `+table+`
+		WHERE `+f.where(args)+`
+		  AND bucket >= CAST(@from AS timestamp) AND bucket < CAST(@to AS timestamp)
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, args).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// placeMatchSQL matches col against any of places (substring, any case) and
+// adds the named arguments it uses to args.
+func placeMatchSQL(col string, places []string, args map[string]interface{}) string {
+	conds := make([]string, 0, len(places))
+	for i, place := range places {
+		name := fmt.Sprintf("place%d", i)
+		args[name] = "%" + place + "%"
+		conds = append(conds, col+" ILIKE @"+name)
+	}
+	return "(" + strings.Join(conds, " OR ") + ")"
+}
@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+)
+
+// StationRepository reads the versioned station metadata written at ingest
+// and stores the drift checks run against it.
+type StationRepository interface {
+	// Current returns the station version of dvid that is still valid.
+	Current(dvid string) (models.Station, error)
+	// Places returns the current place of each of dvids that has a station,
+	// trimmed; stations without a place are left out.
+	Places(dvids ...string) (map[string]string, error)
+	// PlaceIndex lists the distinct places (label and address) of the current
+	// stations matching f, the most stations first, at most 1000. The label is
+	// the trimmed place, or the address for stations without one.
+	PlaceIndex(f ReadingFilter) ([]PlaceItem, error)
+	// Located returns the current version of every station with coordinates.
+	Located() ([]models.Station, error)
+	// DailyPM25 returns each station's daily PM2.5 mean from the daily rollup
+	// for the Bangkok days in [from, to), leaving out days with fewer than
+	// minReadings PM2.5 readings.
+	DailyPM25(from, to time.Time, minReadings int) ([]DailyMean, error)
+	// Drift returns the latest neighbour comparison of each of dvids that has
+	// one (see services.DetectDrift).
+	Drift(dvids ...string) (map[string]models.StationDrift, error)
+	// ReplaceDrift replaces every drift result with results.
+	ReplaceDrift(results []models.StationDrift) error
+	// ListDrift returns a page of drift results with their station's place,
+	// flagged stations first and then by the size of their score, with the
+	// total. flaggedOnly leaves out the others.
+	ListDrift(flaggedOnly bool, limit, offset int) ([]models.StationDrift, int64, error)
+}
+
+// DailyMean is the mean PM2.5 of station DVID over the Bangkok day starting
+// at Day, from Readings readings.
+type DailyMean struct {
+	DVID     string
+	Day      time.Time
+	PM25     float64
+	Readings int
+}
+
+// PlaceItem is one place of the place index and how many stations it has.
+type PlaceItem struct {
+	Label     string  `json:"label"`
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Count     int     `json:"count"`
+}
+
+type gormStationRepository struct{ db *gorm.DB }
+
+// NewStationRepository returns the StationRepository backed by db.
+func NewStationRepository(db *gorm.DB) StationRepository {
+	return &gormStationRepository{db: db}
+}
+
+// bucketArg formats t as a rollup bucket, which is Bangkok wall-clock time.
+func bucketArg(t time.Time) string {
+	return t.In(database.Bangkok).Format("2006-01-02 15:04:05")
+}
+
+func (r *gormStationRepository) Current(dvid string) (models.Station, error) {
+	var station models.Station
+	err := r.db.Where("dvid = ? AND valid_to IS NULL", dvid).Take(&station).Error
+	return station, err
+}
+
+func (r *gormStationRepository) Places(dvids ...string) (map[string]string, error) {
+	out := make(map[string]string, len(dvids))
+	if len(dvids) == 0 {
+		return out, nil
+	}
+	var rows []struct{ DVID, Place string }
+	err := r.db.Model(&models.Station{}).Select("dvid", "place").
+		Where("valid_to IS NULL AND dvid IN ?", dvids).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range rows {
+		if place := strings.TrimSpace(s.Place); place != "" {
+			out[s.DVID] = place
+		}
+	}
+	return out, nil
+}
+
+func (r *gormStationRepository) PlaceIndex(f ReadingFilter) ([]PlaceItem, error) {
+	args := map[string]interface{}{}
+	var rows []PlaceItem
+	err := r.db.Raw(`
+		SELECT COALESCE(NULLIF(TRIM(place), ''), address) AS label,
+		       address,
+		       MAX(latitude) AS latitude,
+		       MAX(longitude) AS longitude,
+		       COUNT(*) AS count
+		FROM stations
+		WHERE valid_to IS NULL AND `+f.where(args)+`
+		GROUP BY label, address
+		ORDER BY count DESC, label ASC
+		LIMIT 1000`, args).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormStationRepository) Located() ([]models.Station, error) {
+	var stations []models.Station
+	err := r.db.
+		Where("valid_to IS NULL AND latitude IS NOT NULL AND longitude IS NOT NULL").
+		Where("NOT (latitude = 0 AND longitude = 0)").
+		Order("dvid").
+		Find(&stations).Error
+	if err != nil {
+		return nil, err
+	}
+	return stations, nil
+}
+
+func (r *gormStationRepository) DailyPM25(from, to time.Time, minReadings int) ([]DailyMean, error) {
+	var rows []DailyMean
+	err := r.db.Raw(`
+		SELECT key AS dvid, bucket AS day, pm25_avg AS pm25, pm25_count AS readings
+		FROM rollup_daily
+		WHERE scope = @scope
+		  AND bucket >= CAST(@from AS timestamp) AND bucket < CAST(@to AS timestamp)
+		  AND pm25_count >= @min`,
+		map[string]interface{}{
+			"scope": models.RollupScopeDVID,
+			"from":  bucketArg(from),
+			"to":    bucketArg(to),
+			"min":   minReadings,
+		}).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (r *gormStationRepository) Drift(dvids ...string) (map[string]models.StationDrift, error) {
+	out := make(map[string]models.StationDrift, len(dvids))
+	if len(dvids) == 0 {
+		return out, nil
+	}
+	var rows []models.StationDrift
+	if err := r.db.Where("dvid IN ?", dvids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range rows {
+		out[d.DVID] = d
+	}
+	return out, nil
+}
+
+func (r *gormStationRepository) ReplaceDrift(results []models.StationDrift) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM station_drift`).Error; err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&results, 500).Error
+	})
+}
+
+func (r *gormStationRepository) ListDrift(flaggedOnly bool, limit, offset int) ([]models.StationDrift, int64, error) {
+	q := r.db.Table("station_drift d")
+	if flaggedOnly {
+		q = q.Where("d.flagged")
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var rows []models.StationDrift
+	err := q.Select("d.*, COALESCE(s.place, '') AS place").
+		Joins("LEFT JOIN stations s ON s.dvid = d.dvid AND s.valid_to IS NULL").
+		Order("d.flagged DESC, ABS(d.score) DESC, d.dvid").
+		Limit(limit).Offset(offset).
+		Find(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
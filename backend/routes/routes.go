@@ -1,9 +1,11 @@
 package routes
 
 import (
+	"yakkaw_dashboard/config"
 	"yakkaw_dashboard/controllers"
 	"yakkaw_dashboard/database"
 	middleware "yakkaw_dashboard/middlewares"
+	"yakkaw_dashboard/repository"
 	"yakkaw_dashboard/services"
 
 	"github.com/labstack/echo/v4"
@@ -11,7 +13,22 @@ import (
 
 func Init(e *echo.Echo) {
 
-	ctrl := new(controllers.ColorRangeController)
+	// 🔹 Repositories over the database connection; services and controllers
+	// only see these interfaces
+	stationRepo := repository.NewStationRepository(database.DB)
+	readingRepo := repository.NewReadingRepository(database.DB)
+	rollupRepo := repository.NewRollupRepository(database.DB)
+	seriesRepo := repository.NewSeriesRepository(database.DB)
+	chartDataService := services.NewChartDataService(readingRepo, seriesRepo, rollupRepo)
+	deviceService := services.NewDeviceService(repository.NewDeviceRepository(database.DB), stationRepo)
+	deviceController := controllers.NewDeviceController(deviceService)
+	ctrl := controllers.NewColorRangeController(services.NewColorRangeService(repository.NewColorRangeRepository(database.DB)))
+	authController := controllers.NewAuthController(repository.NewUserRepository(database.DB))
+	sponsorController := controllers.NewSponsorController(repository.NewSponsorRepository(database.DB))
+	notificationController := controllers.NewNotificationController(repository.NewNotificationRepository(database.DB))
+	ingestController := controllers.NewIngestController(deviceService)
+	stationCtl := controllers.NewStationController(services.NewStationService(stationRepo, readingRepo))
+	anomalyCtl := controllers.NewAnomalyController(services.NewAnomalyService(repository.NewAnomalyRepository(database.DB)))
 
 	e.GET("/colorranges", ctrl.GetAll)
 	e.GET("/colorranges/:id", ctrl.GetByID)
@@ -24,17 +41,17 @@ func Init(e *echo.Echo) {
 	// adminGroup.Use(middleware.JWTMiddleware)
 
 	//Devices
-	e.GET("/devices", controllers.GetAllDevices)
-	e.GET("/devices/:dvid", controllers.GetDevice)
+	e.GET("/devices", deviceController.GetAllDevices)
+	e.GET("/devices/:dvid", deviceController.GetDevice)
 
 	// 🔹 Public Authentication Routes
-	e.POST("/login", controllers.Login)
+	e.POST("/login", authController.Login)
 	e.POST("/logout", controllers.Logout)
-	e.POST("/register", controllers.Register)
+	e.POST("/register", authController.Register)
 
 	// 🔹 Instantiate services using the database connection
-	categoryService := services.NewCategoryService(database.DB)
-	newsService := services.NewNewsService(database.DB)
+	categoryService := services.NewCategoryService(repository.NewCategoryRepository(database.DB))
+	newsService := services.NewNewsService(repository.NewNewsRepository(database.DB))
 
 	// 🔹 Create controllers by injecting the corresponding service
 	categoryController := controllers.NewCategoryController(categoryService)
@@ -53,9 +70,14 @@ func Init(e *echo.Echo) {
 	// QR login: admin generates short-lived token
 	adminGroup.POST("/qr/generate", controllers.GenerateQRLogin)
 
-	adminGroup.POST("/devices", controllers.CreateDevice)
-	adminGroup.PUT("/devices/:dvid", controllers.UpdateDevice)
-	adminGroup.DELETE("/devices/:id", controllers.DeleteDevice)
+	adminGroup.POST("/devices", deviceController.CreateDevice)
+	adminGroup.PUT("/devices/:dvid", deviceController.UpdateDevice)
+	adminGroup.DELETE("/devices/:id", deviceController.DeleteDevice)
+
+	// ✅ Admin-only: Push-ingest API keys per device
+	adminGroup.POST("/devices/:dvid/keys", controllers.CreateDeviceKey)
+	adminGroup.GET("/devices/:dvid/keys", controllers.ListDeviceKeys)
+	adminGroup.DELETE("/devices/:dvid/keys/:id", controllers.RevokeDeviceKey)
 
 	adminGroup.POST("/colorranges", ctrl.Create)
 	adminGroup.PUT("/colorranges/:id", ctrl.Update)
@@ -73,30 +95,57 @@ func Init(e *echo.Echo) {
 
 	// ✅ Admin-only: Manage Dashboard & Notifications
 	adminGroup.GET("/dashboard", controllers.AdminDashboard)
-	adminGroup.POST("/notifications", controllers.CreateNotification)
-	adminGroup.PUT("/notifications/:id", controllers.UpdateNotification)
-	adminGroup.DELETE("/notifications/:id", controllers.DeleteNotification)
+	adminGroup.GET("/notifications", notificationController.GetAdminNotifications)
+	adminGroup.POST("/notifications", notificationController.CreateNotification)
+	adminGroup.PUT("/notifications/:id", notificationController.UpdateNotification)
+	adminGroup.DELETE("/notifications/:id", notificationController.DeleteNotification)
+
+	// ✅ Admin-only: Pipeline run history & on-demand refresh jobs
+	adminGroup.GET("/pipeline/runs", controllers.ListPipelineRuns)
+	adminGroup.GET("/pipeline/runs/:id", controllers.GetPipelineRun)
+	adminGroup.POST("/pipeline/refresh", controllers.RefreshPipeline)
+	adminGroup.GET("/pipeline/refresh/:id", controllers.GetRefreshJob)
+	adminGroup.GET("/pipeline/status", controllers.GetPipelineStatus)
+	adminGroup.GET("/pipeline/schema-drift", controllers.GetSchemaDrift)
+
+	// ✅ Admin-only: Readings rejected by ingest validation
+	adminGroup.GET("/quarantine", controllers.ListQuarantine)
+	adminGroup.POST("/quarantine/:id/release", controllers.ReleaseQuarantine)
+	adminGroup.DELETE("/quarantine/:id", controllers.DiscardQuarantine)
+
+	// ✅ Admin-only: Readings flagged as PM2.5 spikes
+	adminGroup.GET("/anomalies", anomalyCtl.ListAnomalies)
+
+	// ✅ Admin-only: Stations drifting away from their neighbours
+	adminGroup.GET("/drift", stationCtl.ListDrift)
+
+	// ✅ Admin-only: Readings whose upsert failed (dead letters)
+	adminGroup.GET("/dead-letters", controllers.ListDeadLetters)
+	adminGroup.GET("/dead-letters/:id", controllers.GetDeadLetter)
+	adminGroup.PUT("/dead-letters/:id", controllers.UpdateDeadLetter)
+	adminGroup.POST("/dead-letters/:id/replay", controllers.ReplayDeadLetter)
+	adminGroup.DELETE("/dead-letters/:id", controllers.DeleteDeadLetter)
 
 	// 🔹 Sponsor Management (Admin Only)
 	sponsorGroup := e.Group("/admin/sponsors")
 	sponsorGroup.Use(middleware.JWTMiddleware)
-	sponsorGroup.POST("", controllers.CreateSponsor)
-	sponsorGroup.PUT("/:id", controllers.UpdateSponsor)
-	sponsorGroup.DELETE("/:id", controllers.DeleteSponsor)
+	sponsorGroup.POST("", sponsorController.CreateSponsor)
+	sponsorGroup.PUT("/:id", sponsorController.UpdateSponsor)
+	sponsorGroup.DELETE("/:id", sponsorController.DeleteSponsor)
 
 	// 🔹 Public Routes for Sponsors and Notifications
-	e.GET("/sponsors", controllers.GetSponsors)
-	e.GET("/notifications", controllers.GetNotifications)
+	e.GET("/sponsors", sponsorController.GetSponsors)
+	e.GET("/notifications", notificationController.GetNotifications)
 	e.GET("/me", controllers.Me)
 
-	// 🔹 Places index (from sensor_data)
-	e.GET("/places", controllers.GetPlaces)
+	// 🔹 Places index (from current stations)
+	e.GET("/places", stationCtl.GetPlaces)
 
-	// 🔹 Pipeline controls (on-demand refresh)
-	e.GET("/pipeline/refresh", controllers.PipelineRefresh)
+	// 🔹 Push ingestion (device API key)
+	e.POST("/ingest/readings", ingestController.IngestReadings, middleware.DeviceKeyMiddleware)
 
 	// 🔹 Air Quality Data Routes
-	airCtl := controllers.NewAirQualityController()
+	airCtl := controllers.NewAirQualityController(services.NewAirQualityService(readingRepo, rollupRepo))
 	e.GET("/api/airquality/one_day", airCtl.GetOneDayDataHandler)
 	e.GET("/api/airquality/one_week", airCtl.GetOneWeekDataHandler)
 	e.GET("/api/airquality/one_month", airCtl.GetOneMonthDataHandler)
@@ -105,23 +154,34 @@ func Init(e *echo.Echo) {
 	e.GET("/api/airquality/province_average", airCtl.GetProvinceAveragePM25Handler)
 	e.GET("/api/airquality/sensor_data/week", airCtl.GetSensorData7DaysHandler)
 	// heat air quality data
-	e.GET("/api/airquality/one_year_series", controllers.GetAirQualityOneYearSeriesByAddress)
+	e.GET("/api/airquality/one_year_series", airCtl.GetAirQualityOneYearSeriesByAddress)
 	// Heatmap by province (province query param optional: if missing => aggregate all)
-	e.GET("/api/airquality/one_year_series_by_province", controllers.GetAirQualityOneYearSeriesByProvince)
+	e.GET("/api/airquality/one_year_series_by_province", airCtl.GetAirQualityOneYearSeriesByProvince)
 
 	// 🔹 Chart Data Route
-	chartDataController := controllers.NewChartDataController()
+	chartDataController := controllers.NewChartDataController(chartDataService)
 	e.GET("/api/chartdata", chartDataController.GetChartDataHandler)
 	e.GET("/api/chartdata/today", chartDataController.GetTodayChartDataHandler)
 	e.GET("/api/chartdata/heatmap_one_year", chartDataController.GetHeatmapOneYearHandler)
 
+	// 🔹 Generic time series: any range, interval, metric, grouping and aggregator
+	seriesCtl := controllers.NewSeriesController(services.NewSeriesService(seriesRepo, stationRepo))
+	e.GET("/api/v2/series", seriesCtl.GetSeries)
+
 	// 🔹 Get Latest Air Quality
-	e.GET("/api/airquality/latest", controllers.GetLatestAirQuality)
+	e.GET("/api/airquality/latest", airCtl.GetLatestAirQuality)
+
+	// 🔹 Compliance with ambient standards (JSON or CSV download)
+	complianceCtl := controllers.NewComplianceController(services.NewComplianceService(config.Get().ComplianceStandards, rollupRepo, stationRepo))
+	e.GET("/api/compliance", complianceCtl.GetCompliance)
+
+	// 🔹 Station profile (current metadata, latest reading, NowCast)
+	e.GET("/api/stations/:dvid", stationCtl.GetStationProfile)
 
 	// Public QR consume endpoint (sets cookie then redirects to frontend)
 	e.GET("/qr/consume", controllers.ConsumeQRLogin)
 
-	chartCtl := controllers.NewChartDataController()
+	chartCtl := controllers.NewChartDataController(chartDataService)
 	// ========== Chart Data ==========
 	// ใช้สำหรับกราฟตามช่วงเวลา เช่น 24 ชั่วโมง / 7 วัน / 30 วัน / 1 ปี
 	e.GET("/chart/data", chartCtl.GetChartDataHandler)
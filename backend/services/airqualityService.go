@@ -1,400 +1,218 @@
 package services
 
 import (
-	"database/sql"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"strings"
 	"time"
-	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/aqi"
 	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
 )
 
-// FetchAndStoreData ดึงข้อมูลจาก API แล้วเก็บลง DB (ด้วย Raw SQL ผ่าน GORM)
-func FetchAndStoreData(apiURL string) {
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		log.Printf("Error fetching API: %v", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response body: %v", err)
-		return
-	}
-
-	var apiResp models.APIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		log.Printf("Error unmarshaling JSON: %v", err)
-		return
-	}
-
-	// วนลูป insert ข้อมูลลงในตาราง sensor_data
-	for _, data := range apiResp.Response {
-
-		// GORM: Exec() จะคืนค่าเป็น *gorm.DB
-		result := database.DB.Exec(`
-            INSERT INTO sensor_data (
-                dvid, deviceid, status, latitude, longitude, place, address, model,
-                deploydate, contactname, contactphone, note, ddate, dtime, timestamp,
-                av24h, av12h, av6h, av3h, av1h, pm25, pm10, pm100, aqi,
-                temperature, humidity, pres, color, trend
-            ) VALUES (
-                ?, ?, ?, ?, ?, ?, ?, ?,
-                ?, ?, ?, ?, ?, ?, ?,
-                ?, ?, ?, ?, ?, ?, ?, ?, ?,
-                ?, ?, ?, ?, ?
-            )
-            ON CONFLICT (dvid, timestamp) DO UPDATE SET
-                deviceid = EXCLUDED.deviceid,
-                status = EXCLUDED.status,
-                latitude = EXCLUDED.latitude,
-                longitude = EXCLUDED.longitude,
-                place = EXCLUDED.place,
-                address = EXCLUDED.address,
-                model = EXCLUDED.model,
-                deploydate = EXCLUDED.deploydate,
-                contactname = EXCLUDED.contactname,
-                contactphone = EXCLUDED.contactphone,
-                note = EXCLUDED.note,
-                ddate = EXCLUDED.ddate,
-                dtime = EXCLUDED.dtime,
-                av24h = EXCLUDED.av24h,
-                av12h = EXCLUDED.av12h,
-                av6h = EXCLUDED.av6h,
-                av3h = EXCLUDED.av3h,
-                av1h = EXCLUDED.av1h,
-                pm25 = EXCLUDED.pm25,
-                pm10 = EXCLUDED.pm10,
-                pm100 = EXCLUDED.pm100,
-                aqi = EXCLUDED.aqi,
-                temperature = EXCLUDED.temperature,
-                humidity = EXCLUDED.humidity,
-                pres = EXCLUDED.pres,
-                color = EXCLUDED.color,
-                trend = EXCLUDED.trend
-        `,
-			data.DVID, data.DeviceID, data.Status, data.Latitude, data.Longitude,
-			data.Place, data.Address, data.Model, data.DeployDate, data.ContactName,
-			data.ContactPhone, data.Note, data.DDate, data.DTime, data.Timestamp,
-			data.Av24h, data.Av12h, data.Av6h, data.Av3h, data.Av1h, data.PM25,
-			data.PM10, data.PM100, data.AQI, data.Temperature, data.Humidity,
-			data.Pres, data.Color, data.Trend,
-		)
-
-		if result.Error != nil {
-			log.Printf("Error inserting data: %v", result.Error)
+// FetchAndStoreData ดึงข้อมูลจาก source ตามรอบเวลา แล้วเก็บลง DB พร้อมบันทึกประวัติใน pipeline_runs
+func FetchAndStoreData(ctx context.Context, src Source) {
+	if _, err := RunPipeline(ctx, src, PipelineTriggerSchedule); err != nil {
+		if errors.Is(err, ErrCircuitOpen) {
+			log.Printf("Skipping source %s: %v", src.Name(), err)
+			return
 		}
+		log.Printf("Error ingesting source %s: %v", src.Name(), err)
 	}
 }
 
-// FetchAndStoreDevices fetches latest device readings and upserts into sensor_data.
-// Returns number of records processed.
-func FetchAndStoreDevices(apiURL string) (int, error) {
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
-	}
-
-	var apiResp models.APIResponse
-	if err := json.Unmarshal(body, &apiResp); err != nil {
-		return 0, err
-	}
+// AirQualityService answers the air quality endpoints: raw readings through
+// Readings, the one-year views through the daily Rollups.
+type AirQualityService struct {
+	Readings repository.ReadingRepository
+	Rollups  repository.RollupRepository
+}
 
-	processed := 0
-	for _, data := range apiResp.Response {
-		result := database.DB.Exec(`
-            INSERT INTO sensor_data (
-                dvid, deviceid, status, latitude, longitude, place, address, model,
-                deploydate, contactname, contactphone, note, ddate, dtime, timestamp,
-                av24h, av12h, av6h, av3h, av1h, pm25, pm10, pm100, aqi,
-                temperature, humidity, pres, color, trend
-            ) VALUES (
-                ?, ?, ?, ?, ?, ?, ?, ?,
-                ?, ?, ?, ?, ?, ?, ?,
-                ?, ?, ?, ?, ?, ?, ?, ?, ?,
-                ?, ?, ?, ?, ?
-            )
-            ON CONFLICT (dvid, timestamp) DO UPDATE SET
-                deviceid = EXCLUDED.deviceid,
-                status = EXCLUDED.status,
-                latitude = EXCLUDED.latitude,
-                longitude = EXCLUDED.longitude,
-                place = EXCLUDED.place,
-                address = EXCLUDED.address,
-                model = EXCLUDED.model,
-                deploydate = EXCLUDED.deploydate,
-                contactname = EXCLUDED.contactname,
-                contactphone = EXCLUDED.contactphone,
-                note = EXCLUDED.note,
-                ddate = EXCLUDED.ddate,
-                dtime = EXCLUDED.dtime,
-                av24h = EXCLUDED.av24h,
-                av12h = EXCLUDED.av12h,
-                av6h = EXCLUDED.av6h,
-                av3h = EXCLUDED.av3h,
-                av1h = EXCLUDED.av1h,
-                pm25 = EXCLUDED.pm25,
-                pm10 = EXCLUDED.pm10,
-                pm100 = EXCLUDED.pm100,
-                aqi = EXCLUDED.aqi,
-                temperature = EXCLUDED.temperature,
-                humidity = EXCLUDED.humidity,
-                pres = EXCLUDED.pres,
-                color = EXCLUDED.color,
-                trend = EXCLUDED.trend
-        `,
-			data.DVID, data.DeviceID, data.Status, data.Latitude, data.Longitude,
-			data.Place, data.Address, data.Model, data.DeployDate, data.ContactName,
-			data.ContactPhone, data.Note, data.DDate, data.DTime, data.Timestamp,
-			data.Av24h, data.Av12h, data.Av6h, data.Av3h, data.Av1h, data.PM25,
-			data.PM10, data.PM100, data.AQI, data.Temperature, data.Humidity,
-			data.Pres, data.Color, data.Trend,
-		)
-		if result.Error != nil {
-			log.Printf("ingest error dvid=%s: %v", data.DVID, result.Error)
-			continue
-		}
-		processed++
-	}
-	return processed, nil
+// NewAirQualityService creates a new AirQualityService instance
+func NewAirQualityService(readings repository.ReadingRepository, rollups repository.RollupRepository) *AirQualityService {
+	return &AirQualityService{Readings: readings, Rollups: rollups}
 }
 
 // GetAirQuality24Hours ค่าเฉลี่ย 24 ชั่วโมง พร้อมระบุช่วงเวลาที่ใช้ดึงข้อมูล
-func GetAirQuality24Hours() (map[string]interface{}, error) {
-	query := `
-        SELECT address, AVG(pm25) AS avg_pm25, AVG(pm10) AS avg_pm10
-        FROM sensor_data
-        WHERE to_timestamp(timestamp/1000) BETWEEN now() - interval '24 hours' AND now()
-        GROUP BY address
-    `
-	data, err := queryAirQuality(query)
-	if err != nil {
-		return nil, err
-	}
-
+func (s *AirQualityService) GetAirQuality24Hours() (map[string]interface{}, error) {
 	current := time.Now()
-	past := current.Add(-24 * time.Hour)
-
-	response := map[string]interface{}{
-		"current_date": current,
-		"past_date":    past,
-		"data":         data,
-	}
+	return s.addressAverages(current.Add(-24*time.Hour), current)
+}
 
-	return response, nil
+// GetAirQualityOneWeek ค่าเฉลี่ย 1 สัปดาห์ พร้อมระบุช่วงเวลาที่ใช้ดึงข้อมูล
+func (s *AirQualityService) GetAirQualityOneWeek() (map[string]interface{}, error) {
+	current := time.Now()
+	return s.addressAverages(current.AddDate(0, 0, -7), current)
 }
 
 // GetAirQualityOneMonth ค่าเฉลี่ย 1 เดือน พร้อมระบุช่วงเวลาที่ใช้ดึงข้อมูล
-func GetAirQualityOneMonth() (map[string]interface{}, error) {
-	query := `
-        SELECT address, AVG(pm25) AS avg_pm25, AVG(pm10) AS avg_pm10
-        FROM sensor_data
-        WHERE to_timestamp(timestamp/1000) BETWEEN now() - interval '1 month' AND now()
-        GROUP BY address
-    `
-	data, err := queryAirQuality(query)
-	if err != nil {
-		return nil, err
-	}
-
+func (s *AirQualityService) GetAirQualityOneMonth() (map[string]interface{}, error) {
 	current := time.Now()
 	// ใช้ AddDate เพื่อหาค่ากลับไป 1 เดือน
-	past := current.AddDate(0, -1, 0)
-
-	response := map[string]interface{}{
-		"current_date": current,
-		"past_date":    past,
-		"data":         data,
-	}
-
-	return response, nil
+	return s.addressAverages(current.AddDate(0, -1, 0), current)
 }
 
 // GetAirQualityThreeMonths ค่าเฉลี่ย 3 เดือน พร้อมระบุช่วงเวลาที่ใช้ดึงข้อมูล
-func GetAirQualityThreeMonths() (map[string]interface{}, error) {
-	query := `
-        SELECT address, AVG(pm25) AS avg_pm25, AVG(pm10) AS avg_pm10
-        FROM sensor_data
-        WHERE to_timestamp(timestamp/1000) BETWEEN now() - interval '3 months' AND now()
-        GROUP BY address
-    `
-	data, err := queryAirQuality(query)
+func (s *AirQualityService) GetAirQualityThreeMonths() (map[string]interface{}, error) {
+	current := time.Now()
+	return s.addressAverages(current.AddDate(0, -3, 0), current)
+}
+
+// addressAverages ค่าเฉลี่ย PM2.5/PM10 ต่อ address ในช่วง [past, current)
+func (s *AirQualityService) addressAverages(past, current time.Time) (map[string]interface{}, error) {
+	rows, err := s.Readings.AddressAverages(past, current)
 	if err != nil {
 		return nil, err
 	}
+	return addressAveragesResponse(rows, past, current), nil
+}
 
-	current := time.Now()
-	past := current.AddDate(0, -3, 0)
+func addressAveragesResponse(rows []repository.AddressAverage, past, current time.Time) map[string]interface{} {
+	data := make([]map[string]interface{}, 0, len(rows))
+	for _, r := range rows {
+		data = append(data, map[string]interface{}{
+			"address":  r.Address,
+			"avg_pm25": r.AvgPM25,
+			"avg_pm10": r.AvgPM10,
+		})
+	}
 
-	response := map[string]interface{}{
+	return map[string]interface{}{
 		"current_date": current,
 		"past_date":    past,
 		"data":         data,
 	}
-
-	return response, nil
 }
 
 // GetAirQualityOneYear ค่าเฉลี่ย 1 ปี พร้อมระบุช่วงเวลาที่ใช้ดึงข้อมูล
-func GetAirQualityOneYear() (map[string]interface{}, error) {
-	query := `
-        SELECT address, AVG(pm25) AS avg_pm25, AVG(pm10) AS avg_pm10
-        FROM sensor_data
-        WHERE to_timestamp(timestamp/1000) BETWEEN now() - interval '1 year' AND now()
-        GROUP BY address
-    `
-	data, err := queryAirQuality(query)
-	if err != nil {
-		return nil, err
-	}
-
+// อ่านจาก rollup รายวันของแต่ละสถานี แล้วรวมตาม address ปัจจุบันของสถานี
+func (s *AirQualityService) GetAirQualityOneYear() (map[string]interface{}, error) {
 	current := time.Now()
 	past := current.AddDate(-1, 0, 0)
-
-	response := map[string]interface{}{
-		"current_date": current,
-		"past_date":    past,
-		"data":         data,
+	rows, err := s.Rollups.AddressAverages(bangkokDay(past), current)
+	if err != nil {
+		return nil, err
 	}
-
-	return response, nil
+	return addressAveragesResponse(rows, past, current), nil
 }
 
-// GetAirQualityOneWeek ค่าเฉลี่ย 1 สัปดาห์ พร้อมระบุช่วงเวลาที่ใช้ดึงข้อมูล
-func GetAirQualityOneWeek() (map[string]interface{}, error) {
-	query := `
-        SELECT address, AVG(pm25) AS avg_pm25, AVG(pm10) AS avg_pm10
-        FROM sensor_data
-        WHERE to_timestamp(timestamp/1000) BETWEEN now() - interval '7 days' AND now()
-        GROUP BY address
-    `
-	data, err := queryAirQuality(query)
+// GetProvinceAveragePM25 คำนวณค่าเฉลี่ย PM2.5 ของแต่ละจังหวัด (24 ชั่วโมงล่าสุด)
+// excludeAnomalies ตัดค่าที่ DetectAnomalies ตั้งธงว่าเป็น spike ออกก่อนเฉลี่ย
+func (s *AirQualityService) GetProvinceAveragePM25(excludeAnomalies bool) ([]map[string]interface{}, error) {
+	now := time.Now()
+	rows, err := s.Readings.ProvinceAveragesPM25(now.Add(-24*time.Hour), now, excludeAnomalies)
 	if err != nil {
 		return nil, err
 	}
 
-	current := time.Now()
-	past := current.AddDate(0, 0, -7)
-
-	response := map[string]interface{}{
-		"current_date": current,
-		"past_date":    past,
-		"data":         data,
+	results := make([]map[string]interface{}, 0, len(rows))
+	for _, r := range rows {
+		results = append(results, map[string]interface{}{
+			"province":      r.Province,
+			"avg_pm25":      r.AvgPM25,
+			"station_count": r.Readings,
+		})
 	}
+	return results, nil
+}
 
-	return response, nil
+// GetSensorData7Days ดึงข้อมูล sensor_data ย้อนหลัง 7 วัน
+func (s *AirQualityService) GetSensorData7Days() ([]models.SensorData, error) {
+	now := time.Now()
+	return s.Readings.Between(now.AddDate(0, 0, -7), now)
+}
+
+// LatestAirQuality is the newest AQI reading of a location, with the NowCast
+// of the station that sent it. With an AQI standard, AQI is computed from the
+// 24-hour PM averages ending at that reading (Index has the sub-indices) and
+// UpstreamAQI keeps the feed's value.
+type LatestAirQuality struct {
+	AQI         int         `json:"aqi"`
+	Timestamp   int64       `json:"timestamp"`
+	Index       *aqi.Result `json:"aqi_index,omitempty"`
+	PM25Avg24h  *float64    `json:"pm25_24h,omitempty"`
+	PM10Avg24h  *float64    `json:"pm10_24h,omitempty"`
+	UpstreamAQI *int        `json:"upstream_aqi,omitempty"`
+	NowCast     *NowCast    `json:"nowcast,omitempty"`
 }
 
-// ฟังก์ชันช่วยสำหรับ Query (Raw SQL) ผ่าน GORM
-func queryAirQuality(query string) ([]map[string]interface{}, error) {
-	rows, err := database.DB.Raw(query).Rows()
+// GetLatestAirQuality returns the newest reading matching the "province"
+// parameter (see locationFilter); empty matches every station. An unknown
+// location returns gorm.ErrRecordNotFound. A nil std reports the upstream AQI
+// (the NowCast AQI then uses aqi.DefaultStandard).
+func (s *AirQualityService) GetLatestAirQuality(province string, std *aqi.Standard) (LatestAirQuality, error) {
+	var f repository.ReadingFilter
+	if province != "" {
+		f = parseLocationFilter(province).readings()
+	}
+	row, err := s.Readings.Latest(f)
 	if err != nil {
-		return nil, err
+		return LatestAirQuality{}, err
 	}
-	defer rows.Close()
-
-	results := []map[string]interface{}{}
+	latest := LatestAirQuality{AQI: row.AQI, Timestamp: row.Timestamp}
 
-	for rows.Next() {
-		var address string
-		var avgPM25 float64
-		var avgPM10 float64
-
-		if err := rows.Scan(&address, &avgPM25, &avgPM10); err != nil {
-			return nil, err
+	nowCastStd := std
+	if nowCastStd == nil {
+		def, err := aqi.Parse("")
+		if err != nil {
+			return LatestAirQuality{}, err
 		}
-
-		data := map[string]interface{}{
-			"address":  address,
-			"avg_pm25": avgPM25,
-			"avg_pm10": avgPM10,
+		nowCastStd = &def
+	}
+	if row.DVID != "" {
+		nc, err := stationNowCast(s.Readings, row.DVID, time.Now(), *nowCastStd)
+		if err != nil {
+			return LatestAirQuality{}, err
 		}
-		results = append(results, data)
+		latest.NowCast = &nc
+	}
+	if std == nil {
+		return latest, nil
 	}
 
-	return results, nil
+	to := time.UnixMilli(row.Timestamp + 1)
+	avg, err := s.Readings.PMAverages(f, to.Add(-24*time.Hour), to)
+	if err != nil {
+		return LatestAirQuality{}, err
+	}
+	index := std.Compute(aqi.PM(avg.PM25, avg.PM10))
+	upstream := row.AQI
+	latest.AQI = index.AQI
+	latest.Index = &index
+	latest.PM25Avg24h, latest.PM10Avg24h = avg.PM25, avg.PM10
+	latest.UpstreamAQI = &upstream
+	return latest, nil
 }
 
-// GetProvinceAveragePM25 คำนวณค่าเฉลี่ย PM2.5 ของแต่ละจังหวัด
-func GetProvinceAveragePM25() ([]map[string]interface{}, error) {
-	query := `
-        WITH province_data AS (
-            SELECT 
-                split_part(address, ' ', array_length(string_to_array(address, ' '), 1)) as province,
-                pm25
-            FROM sensor_data
-            WHERE to_timestamp(timestamp/1000) BETWEEN now() - interval '24 hours' AND now()
-        )
-        SELECT 
-            province,
-            ROUND(AVG(pm25)::numeric, 2) as avg_pm25,
-            COUNT(*) as station_count
-        FROM province_data
-        WHERE province != ''
-        GROUP BY province
-        ORDER BY avg_pm25 DESC
-    `
-
-	rows, err := database.DB.Raw(query).Rows()
+// oneYearSeries: ค่าเฉลี่ยรายวันจาก rollup รายวันของสถานีที่ข้อมูลปัจจุบันตรงกับ f
+// (ถ่วงน้ำหนักด้วยจำนวน reading) ตั้งแต่วันที่ของ from
+func (s *AirQualityService) oneYearSeries(f repository.RollupFilter, from, to time.Time) ([]map[string]interface{}, error) {
+	days, err := s.Rollups.DailyPM(f, bangkokDay(from), to)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
 	results := []map[string]interface{}{}
-
-	for rows.Next() {
-		var province string
-		var avgPM25 float64
-		var stationCount int
-
-		if err := rows.Scan(&province, &avgPM25, &stationCount); err != nil {
-			return nil, err
-		}
-
+	for _, d := range days {
 		data := map[string]interface{}{
-			"province":      province,
-			"avg_pm25":      avgPM25,
-			"station_count": stationCount,
+			"timestamp": d.Day.UnixMilli(),
+			"count":     d.Readings,
+		}
+		if d.PM25 != nil {
+			data["pm25"] = *d.PM25
+		}
+		if d.PM10 != nil {
+			data["pm10"] = *d.PM10
 		}
 		results = append(results, data)
 	}
-
 	return results, nil
 }
 
-// GetSensorData7Days ดึงข้อมูล sensor_data ย้อนหลัง 7 วัน
-func GetSensorData7Days() ([]models.SensorData, error) {
-	var sensorData []models.SensorData
-
-	query := `
-		SELECT *
-		FROM sensor_data
-		WHERE to_timestamp(timestamp/1000) BETWEEN now() - interval '7 days' AND now()
-		ORDER BY timestamp DESC
-	`
-
-	if err := database.DB.Raw(query).Scan(&sensorData).Error; err != nil {
-		return nil, err
-	}
-
-	return sensorData, nil
-}
-
 // GetAirQualityOneYearSeriesByAddress : ข้อมูลรายวัน 1 ปี สำหรับ heatmap (filter ด้วย address)
-func GetAirQualityOneYearSeriesByAddress(address string) (map[string]interface{}, error) {
+func (s *AirQualityService) GetAirQualityOneYearSeriesByAddress(address string) (map[string]interface{}, error) {
 	address = strings.TrimSpace(address)
 	if address == "" {
 		return nil, fmt.Errorf("address is required")
@@ -403,52 +221,10 @@ func GetAirQualityOneYearSeriesByAddress(address string) (map[string]interface{}
 	now := time.Now()
 	from := now.AddDate(-1, 0, 0)
 
-	query := `
-		WITH t AS (
-			SELECT 
-				(to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') AS ts,
-				NULLIF(pm25,0) AS pm25,
-				NULLIF(pm10,0) AS pm10
-			FROM sensor_data
-			WHERE address ILIKE ? AND to_timestamp(timestamp/1000) BETWEEN ? AND ?
-		)
-		SELECT 
-			date_trunc('day', ts) AS bucket,
-			ROUND(AVG(pm25)::numeric, 2) AS pm25_avg,
-			ROUND(AVG(pm10)::numeric, 2) AS pm10_avg,
-			COUNT(*) AS n
-		FROM t
-		GROUP BY bucket
-		ORDER BY bucket ASC;
-	`
-
-	searchAddress := "%" + address + "%"
-	rows, err := database.DB.Raw(query, searchAddress, from, now).Rows()
+	results, err := s.oneYearSeries(repository.RollupFilter{Scope: models.RollupScopeDVID, Address: address}, from, now)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	results := []map[string]interface{}{}
-	for rows.Next() {
-		var bucket time.Time
-		var pm25, pm10 sql.NullFloat64
-		var n int
-		if err := rows.Scan(&bucket, &pm25, &pm10, &n); err != nil {
-			return nil, err
-		}
-		data := map[string]interface{}{
-			"timestamp": bucket.UnixMilli(),
-			"count":     n,
-		}
-		if pm25.Valid {
-			data["pm25"] = pm25.Float64
-		}
-		if pm10.Valid {
-			data["pm10"] = pm10.Float64
-		}
-		results = append(results, data)
-	}
 
 	return map[string]interface{}{
 		"address":      address,
@@ -460,8 +236,8 @@ func GetAirQualityOneYearSeriesByAddress(address string) (map[string]interface{}
 
 }
 
-// GetAirQualityOneYearSeriesByProvince: daily buckets for last 1 year filtered by province (address ILIKE)
-func GetAirQualityOneYearSeriesByProvince(province string) (map[string]interface{}, error) {
+// GetAirQualityOneYearSeriesByProvince: daily buckets for last 1 year filtered by the parsed province (or a place name)
+func (s *AirQualityService) GetAirQualityOneYearSeriesByProvince(province string) (map[string]interface{}, error) {
 	if province == "" {
 		return nil, fmt.Errorf("province is required")
 	}
@@ -469,51 +245,10 @@ func GetAirQualityOneYearSeriesByProvince(province string) (map[string]interface
 	now := time.Now()
 	from := now.AddDate(-1, 0, 0)
 
-	query := `
-        WITH t AS (
-            SELECT 
-                (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') AS ts,
-                NULLIF(pm25,0) AS pm25,
-                NULLIF(pm10,0) AS pm10
-            FROM sensor_data
-            WHERE address ILIKE ? AND to_timestamp(timestamp/1000) BETWEEN ? AND ?
-        )
-        SELECT 
-            date_trunc('day', ts) AS bucket,
-            ROUND(AVG(pm25)::numeric, 2) AS pm25_avg,
-            ROUND(AVG(pm10)::numeric, 2) AS pm10_avg,
-            COUNT(*) AS n
-        FROM t
-        GROUP BY bucket
-        ORDER BY bucket ASC;
-    `
-
-	rows, err := database.DB.Raw(query, "%"+province+"%", from, now).Rows()
+	results, err := s.oneYearSeries(parseLocationFilter(province).stations(), from, now)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	results := []map[string]interface{}{}
-	for rows.Next() {
-		var bucket time.Time
-		var pm25, pm10 sql.NullFloat64
-		var n int
-		if err := rows.Scan(&bucket, &pm25, &pm10, &n); err != nil {
-			return nil, err
-		}
-		data := map[string]interface{}{
-			"timestamp": bucket.UnixMilli(),
-			"count":     n,
-		}
-		if pm25.Valid {
-			data["pm25"] = pm25.Float64
-		}
-		if pm10.Valid {
-			data["pm10"] = pm10.Float64
-		}
-		results = append(results, data)
-	}
 
 	return map[string]interface{}{
 		"province":     province,
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+func TestAirQualityOneYear(t *testing.T) {
+	now := time.Now()
+	day, old := wallDay(now.AddDate(0, 0, -3)), wallDay(now.AddDate(-2, 0, 0))
+	avg := func(v float64) *float64 { return &v }
+	rollups := repository.NewMemoryRollupRepository()
+	rollups.AddStations(
+		models.Station{DVID: "a", Address: "239 ถ.ห้วยแก้ว จ.เชียงใหม่", Place: "CMU", ProvinceCode: "TH-50"},
+		models.Station{DVID: "b", Address: "239 ถ.ห้วยแก้ว จ.เชียงใหม่", Place: "CMU", ProvinceCode: "TH-50"},
+		models.Station{DVID: "c", Address: "จ.ลำปาง", Place: "Lampang", ProvinceCode: "TH-52"},
+	)
+	rollups.AddDaily(
+		models.RollupBucket{Scope: models.RollupScopeDVID, Key: "a", Bucket: day, Readings: 10, PM25Avg: avg(10), PM25Count: 10},
+		models.RollupBucket{Scope: models.RollupScopeDVID, Key: "b", Bucket: day, Readings: 30, PM25Avg: avg(30), PM25Count: 30, PM10Avg: avg(50), PM10Count: 30},
+		models.RollupBucket{Scope: models.RollupScopeDVID, Key: "c", Bucket: day, Readings: 5, PM25Avg: avg(80), PM25Count: 5},
+		models.RollupBucket{Scope: models.RollupScopeDVID, Key: "a", Bucket: old, Readings: 5, PM25Avg: avg(500), PM25Count: 5},
+	)
+	s := NewAirQualityService(repository.NewMemoryReadingRepository(), rollups)
+
+	// Both stations at the address, weighted by their readings.
+	res, err := s.GetAirQualityOneYearSeriesByAddress("ห้วยแก้ว")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := res["data"].([]map[string]interface{})
+	if len(data) != 1 || data[0]["pm25"] != 25.0 || data[0]["pm10"] != 50.0 || data[0]["count"] != 40 ||
+		data[0]["timestamp"] != day.UnixMilli() {
+		t.Errorf("by address = %+v, want one day of 25/50 over 40 readings", data)
+	}
+
+	res, err = s.GetAirQualityOneYearSeriesByProvince("ลำปาง")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data = res["data"].([]map[string]interface{}); len(data) != 1 || data[0]["pm25"] != 80.0 || data[0]["pm10"] != nil {
+		t.Errorf("by province = %+v, want c's day without PM10", data)
+	}
+	if _, err := s.GetAirQualityOneYearSeriesByAddress(" "); err == nil {
+		t.Error("empty address: want an error")
+	}
+
+	res, err = s.GetAirQualityOneYear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data = res["data"].([]map[string]interface{}); len(data) != 2 || data[0]["avg_pm25"] != 25.0 || data[1]["avg_pm10"] != 0.0 {
+		t.Errorf("one year = %+v, want two addresses", data)
+	}
+}
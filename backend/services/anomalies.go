@@ -0,0 +1,180 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"yakkaw_dashboard/config"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+// madScale turns a median absolute deviation into a standard deviation
+// estimate for normally distributed values.
+const madScale = 1.4826
+
+// AnomalyOptions tune the PM2.5 spike detector (see config.Config).
+type AnomalyOptions struct {
+	Window     time.Duration
+	MinSamples int
+	Threshold  float64
+	MinDelta   float64
+	Recheck    time.Duration
+}
+
+// AnomalyOptionsFromConfig reads the detector settings of cfg.
+func AnomalyOptionsFromConfig(cfg *config.Config) AnomalyOptions {
+	return AnomalyOptions{
+		Window:     cfg.AnomalyWindow,
+		MinSamples: cfg.AnomalyMinSamples,
+		Threshold:  cfg.AnomalyThreshold,
+		MinDelta:   cfg.AnomalyMinDelta,
+		Recheck:    cfg.AnomalyRecheck,
+	}
+}
+
+// AnomalyReport counts the readings a detection pass looked at, and those it
+// newly flagged or unflagged.
+type AnomalyReport struct {
+	Checked int `json:"checked"`
+	Flagged int `json:"flagged"`
+	Cleared int `json:"cleared"`
+}
+
+// DetectAnomalies flags PM2.5 spikes among the readings from since up to now,
+// per dvid. Each reading is compared with the median and MAD of the station's
+// unflagged readings in the opts.Window before it; it is a spike when it is
+// above the median by more than opts.Threshold scaled MADs and by at least
+// opts.MinDelta µg/m³. Readings with fewer than opts.MinSamples baseline
+// values, and zero values, are never flagged. Flags that no longer hold (e.g.
+// after late readings filled the baseline) are cleared. The report counts
+// only readings whose flag changed.
+func DetectAnomalies(anomalies repository.AnomalyRepository, opts AnomalyOptions, since time.Time) (AnomalyReport, error) {
+	var report AnomalyReport
+	rows, err := anomalies.Readings(since.Add(-opts.Window), time.Now().Add(time.Minute))
+	if err != nil {
+		return report, err
+	}
+
+	var flagged []models.ReadingAnomaly
+	var cleared []repository.AnomalyReading
+	for start := 0; start < len(rows); {
+		end := start
+		for end < len(rows) && rows[end].DVID == rows[start].DVID {
+			end++
+		}
+		f, c, n := detectStationAnomalies(rows[start:end], opts, since.UnixMilli())
+		flagged = append(flagged, f...)
+		cleared = append(cleared, c...)
+		report.Checked += n
+		start = end
+	}
+
+	report.Flagged, report.Cleared, err = anomalies.Apply(flagged, cleared)
+	return report, err
+}
+
+// detectStationAnomalies runs the detector over one station's readings in
+// timestamp order. Readings before since only serve as baseline. It returns
+// the new or still valid flags, the flags to clear and how many readings were
+// checked.
+func detectStationAnomalies(rows []repository.AnomalyReading, opts AnomalyOptions, since int64) ([]models.ReadingAnomaly, []repository.AnomalyReading, int) {
+	var flagged []models.ReadingAnomaly
+	var cleared []repository.AnomalyReading
+	checked := 0
+	window := opts.Window.Milliseconds()
+	spike := make([]bool, len(rows))
+	lo := 0
+	for i, r := range rows {
+		// Readings before since keep their stored flag as baseline input.
+		if r.Timestamp < since {
+			spike[i] = r.Anomaly
+			continue
+		}
+		checked++
+		for lo < i && rows[lo].Timestamp <= r.Timestamp-window {
+			lo++
+		}
+		var baseline []float64
+		for j := lo; j < i; j++ {
+			if !spike[j] && rows[j].PM25 > 0 {
+				baseline = append(baseline, float64(rows[j].PM25))
+			}
+		}
+
+		if r.PM25 > 0 && len(baseline) >= opts.MinSamples {
+			median, mad := medianMAD(baseline)
+			delta := float64(r.PM25) - median
+			score := delta / math.Max(madScale*mad, 1)
+			if delta >= opts.MinDelta && score > opts.Threshold {
+				spike[i] = true
+				flagged = append(flagged, models.ReadingAnomaly{
+					DVID:       r.DVID,
+					Timestamp:  r.Timestamp,
+					PM25:       r.PM25,
+					Median:     median,
+					MAD:        mad,
+					Score:      math.Round(score*100) / 100,
+					Samples:    len(baseline),
+					DetectedAt: time.Now(),
+				})
+			}
+		}
+		if r.Anomaly && !spike[i] {
+			cleared = append(cleared, r)
+		}
+	}
+	return flagged, cleared, checked
+}
+
+// medianMAD returns the median of values and their median absolute deviation
+// from it. values is reordered.
+func medianMAD(values []float64) (float64, float64) {
+	median := medianOf(values)
+	dev := make([]float64, len(values))
+	for i, v := range values {
+		dev[i] = math.Abs(v - median)
+	}
+	return median, medianOf(dev)
+}
+
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// AnomalyFilter selects flagged readings for the admin report.
+type AnomalyFilter struct {
+	DVID   string
+	Since  time.Time
+	Limit  int
+	Offset int
+}
+
+type AnomalyService struct {
+	Anomalies repository.AnomalyRepository
+}
+
+// NewAnomalyService creates a new AnomalyService instance
+func NewAnomalyService(anomalies repository.AnomalyRepository) *AnomalyService {
+	return &AnomalyService{Anomalies: anomalies}
+}
+
+// ListAnomalies returns the flagged readings since f.Since newest first with
+// their total, and a per-device summary ordered by number of flags.
+func (s *AnomalyService) ListAnomalies(f AnomalyFilter) ([]models.ReadingAnomaly, int64, []repository.AnomalyDevice, error) {
+	rows, total, err := s.Anomalies.List(f.DVID, f.Since, f.Limit, f.Offset)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	devices, err := s.Anomalies.Devices(f.DVID, f.Since)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return rows, total, devices, nil
+}
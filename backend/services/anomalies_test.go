@@ -0,0 +1,78 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/repository"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-5 * time.Hour)
+	at := func(i int) int64 { return start.Add(time.Duration(i) * 10 * time.Minute).UnixMilli() }
+
+	var readings []repository.AnomalyReading
+	for i := 0; i < 30; i++ {
+		r := repository.AnomalyReading{DVID: "a", Timestamp: at(i), PM25: 20 + i%3}
+		switch i {
+		case 20:
+			r.PM25 = 200 // a new spike
+		case 22:
+			r.Anomaly = true // flagged earlier, no longer a spike
+		case 25:
+			r.PM25, r.Anomaly = 180, true // still a spike, already flagged
+		}
+		readings = append(readings, r)
+	}
+	// Too few baseline readings to judge b's jump.
+	readings = append(readings,
+		repository.AnomalyReading{DVID: "b", Timestamp: at(20), PM25: 20},
+		repository.AnomalyReading{DVID: "b", Timestamp: at(21), PM25: 300},
+	)
+	repo := repository.NewMemoryAnomalyRepository(readings...)
+
+	opts := AnomalyOptions{Window: 3 * time.Hour, MinSamples: 6, Threshold: 5, MinDelta: 30}
+	since := now.Add(-2 * time.Hour)
+	rep, err := DetectAnomalies(repo, opts, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a is checked from reading 18 on, b in full.
+	if rep != (AnomalyReport{Checked: 14, Flagged: 1, Cleared: 1}) {
+		t.Errorf("first pass = %+v, want 14 checked, 1 flagged, 1 cleared", rep)
+	}
+
+	// A second pass changes nothing, so it counts nothing.
+	rep, err = DetectAnomalies(repo, opts, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep != (AnomalyReport{Checked: 14}) {
+		t.Errorf("second pass = %+v, want only 14 checked", rep)
+	}
+
+	rows, total, devices, err := NewAnomalyService(repo).ListAnomalies(AnomalyFilter{Since: since, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(rows) != 2 || rows[0].Timestamp != at(25) || rows[1].PM25 != 200 {
+		t.Errorf("anomalies = %+v (total %d), want readings 25 and 20", rows, total)
+	}
+	if rows[1].Samples < opts.MinSamples || rows[1].Median != 21 {
+		t.Errorf("reason = %+v, want the median of a full baseline", rows[1])
+	}
+	if len(devices) != 1 || devices[0].DVID != "a" || devices[0].Anomalies != 2 || devices[0].MaxPM25 != 200 {
+		t.Errorf("devices = %+v, want a with 2 flags", devices)
+	}
+}
+
+func TestMedianMAD(t *testing.T) {
+	median, mad := medianMAD([]float64{1, 1, 2, 2, 4, 6, 9})
+	if median != 2 || mad != 1 {
+		t.Errorf("medianMAD = %v, %v; want 2, 1", median, mad)
+	}
+	if m := medianOf([]float64{4, 1, 3, 2}); m != 2.5 {
+		t.Errorf("medianOf even = %v, want 2.5", m)
+	}
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+)
+
+// BackfillOptions controls BackfillFile.
+type BackfillOptions struct {
+	// Format is "csv", "json" or "ndjson"; empty picks it from the extension.
+	Format string
+	// DryRun parses and validates without writing anything.
+	DryRun bool
+	// Resume skips records already committed by an earlier run of the same file.
+	Resume    bool
+	BatchSize int
+	// Source labels quarantined rows; defaults to "backfill".
+	Source string
+	// Progress, when set, is called after every committed batch.
+	Progress func(BackfillStats)
+}
+
+// BackfillStats is the running and final summary of one file.
+type BackfillStats struct {
+	File    string `json:"file"`
+	Records int64  `json:"records"`
+	// Committed is the record count covered by the last saved checkpoint.
+	Committed   int64         `json:"committed"`
+	ResumedFrom int64         `json:"resumed_from"`
+	Inserted    int64         `json:"inserted"`
+	Updated     int64         `json:"updated"`
+	Skipped     int64         `json:"skipped"`
+	Quarantined int64         `json:"quarantined"`
+	DryRun      bool          `json:"dry_run"`
+	Elapsed     time.Duration `json:"elapsed"`
+}
+
+func (s *BackfillStats) add(r IngestResult) {
+	s.Inserted += int64(r.Inserted)
+	s.Updated += int64(r.Updated)
+	s.Skipped += int64(r.Skipped)
+	s.Quarantined += int64(r.Quarantined)
+}
+
+// BackfillFile streams an archive of readings into sensor_data through the
+// normal ingest path. Each batch commits together with its checkpoint, so a
+// resumed run continues exactly after the last committed record.
+func BackfillFile(ctx context.Context, path string, opts BackfillOptions) (BackfillStats, error) {
+	started := time.Now()
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return BackfillStats{}, err
+	}
+	stats := BackfillStats{File: abs, DryRun: opts.DryRun}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.Source == "" {
+		opts.Source = "backfill"
+	}
+
+	f, err := os.Open(abs)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return stats, err
+	}
+
+	checkpoint := models.BackfillCheckpoint{File: abs, Size: info.Size(), ModTime: info.ModTime().UTC()}
+	if opts.Resume {
+		prev, err := loadCheckpoint(abs)
+		if err != nil {
+			return stats, err
+		}
+		if prev != nil && prev.Size == checkpoint.Size && prev.ModTime.Equal(checkpoint.ModTime) {
+			if prev.Done {
+				stats.ResumedFrom = prev.Records
+				stats.Records = prev.Records
+				stats.Committed = prev.Records
+				stats.Elapsed = time.Since(started)
+				return stats, nil
+			}
+			checkpoint.Records = prev.Records
+		}
+	}
+	stats.ResumedFrom = checkpoint.Records
+	stats.Committed = checkpoint.Records
+
+	reader, err := newRecordReader(f, opts.Format, abs)
+	if err != nil {
+		return stats, err
+	}
+
+	// Fast-forward past records committed by a previous run.
+	for stats.Records < checkpoint.Records {
+		if _, err := reader.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return stats, fmt.Errorf("file has only %d records but checkpoint is at %d", stats.Records, checkpoint.Records)
+			}
+			return stats, fmt.Errorf("record %d: %w", stats.Records+1, err)
+		}
+		stats.Records++
+	}
+
+	batch := make([]models.SensorData, 0, opts.BatchSize)
+	flush := func(done bool) error {
+		if len(batch) == 0 && !done {
+			return nil
+		}
+		checkpoint.Records = stats.Records
+		checkpoint.Done = done
+
+		if opts.DryRun {
+			if err := fillFromStations(database.DB.WithContext(ctx), batch); err != nil {
+				return err
+			}
+			_, rejected := NewValidator().Split(batch)
+			stats.Quarantined += int64(len(rejected))
+		} else {
+			err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				result, err := IngestRowsTx(tx, opts.Source, batch)
+				if err != nil {
+					return err
+				}
+				stats.add(result)
+				return tx.Save(&checkpoint).Error
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		batch = batch[:0]
+		stats.Committed = stats.Records
+		stats.Elapsed = time.Since(started)
+		if opts.Progress != nil {
+			opts.Progress(stats)
+		}
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("record %d: %w", stats.Records+1, err)
+		}
+
+		batch = append(batch, row)
+		stats.Records++
+		if len(batch) >= opts.BatchSize {
+			if err := flush(false); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err := flush(true); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+func loadCheckpoint(file string) (*models.BackfillCheckpoint, error) {
+	var cp models.BackfillCheckpoint
+	err := database.DB.Where("file = ?", file).First(&cp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// recordReader streams readings one at a time and returns io.EOF at the end.
+type recordReader interface {
+	Next() (models.SensorData, error)
+}
+
+func newRecordReader(r io.Reader, format, path string) (recordReader, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		default:
+			format = "json"
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case "csv":
+		return newCSVRecordReader(r)
+	case "ndjson":
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		return &ndjsonRecordReader{scanner: scanner}, nil
+	case "json":
+		return newJSONRecordReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported backfill format %q", format)
+	}
+}
+
+// csvRecordReader maps columns by header name onto the sensor_data columns
+// (the same names as models.SensorData's JSON tags).
+type csvRecordReader struct {
+	r       *csv.Reader
+	columns []int // struct field index per CSV column, -1 when unknown
+	names   []string
+}
+
+func newCSVRecordReader(r io.Reader) (*csvRecordReader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+
+	reader := &csvRecordReader{r: cr, columns: make([]int, len(header)), names: make([]string, len(header))}
+	known := 0
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		reader.names[i] = name
+		reader.columns[i] = -1
+		if idx, ok := sensorDataFields[name]; ok {
+			reader.columns[i] = idx
+			known++
+		}
+	}
+	if known == 0 {
+		return nil, fmt.Errorf("csv header has no sensor_data columns")
+	}
+	return reader, nil
+}
+
+func (c *csvRecordReader) Next() (models.SensorData, error) {
+	var row models.SensorData
+	record, err := c.r.Read()
+	if err != nil {
+		return row, err
+	}
+
+	rv := reflect.ValueOf(&row).Elem()
+	for i, cell := range record {
+		if i >= len(c.columns) || c.columns[i] < 0 {
+			continue
+		}
+		cell = strings.TrimSpace(cell)
+		if cell == "" {
+			continue
+		}
+		if err := assignField(rv.Field(c.columns[i]), c.names[i], cell); err != nil {
+			return row, fmt.Errorf("column %s: %w", c.names[i], err)
+		}
+	}
+	return row, nil
+}
+
+type ndjsonRecordReader struct {
+	scanner *bufio.Scanner
+}
+
+func (n *ndjsonRecordReader) Next() (models.SensorData, error) {
+	var row models.SensorData
+	for n.scanner.Scan() {
+		line := bytes.TrimSpace(n.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		err := json.Unmarshal(line, &row)
+		return row, err
+	}
+	if err := n.scanner.Err(); err != nil {
+		return row, err
+	}
+	return row, io.EOF
+}
+
+// jsonRecordReader streams either a bare array of readings or the "response"
+// array of a models.APIResponse envelope without loading the whole file.
+type jsonRecordReader struct {
+	dec *json.Decoder
+}
+
+func newJSONRecordReader(r io.Reader) (*jsonRecordReader, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('['):
+		return &jsonRecordReader{dec: dec}, nil
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			if key == "response" {
+				if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+					return nil, fmt.Errorf(`"response" is not an array`)
+				}
+				return &jsonRecordReader{dec: dec}, nil
+			}
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+		}
+		return nil, fmt.Errorf(`json object has no "response" array`)
+	default:
+		return nil, fmt.Errorf("json must be an array or an API response envelope")
+	}
+}
+
+func (j *jsonRecordReader) Next() (models.SensorData, error) {
+	var row models.SensorData
+	if !j.dec.More() {
+		return row, io.EOF
+	}
+	err := j.dec.Decode(&row)
+	return row, err
+}
@@ -3,22 +3,23 @@ package services
 import (
 	"errors"
 	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
 
 	"gorm.io/gorm"
 )
 
 type CategoryService struct {
-    DB *gorm.DB
+    Categories repository.CategoryRepository
 }
 
 // NewCategoryService creates a new CategoryService instance
-func NewCategoryService(db *gorm.DB) *CategoryService {
-    return &CategoryService{DB: db}
+func NewCategoryService(categories repository.CategoryRepository) *CategoryService {
+    return &CategoryService{Categories: categories}
 }
 
 // CreateCategory creates a new category
 func (s *CategoryService) CreateCategory(category models.Category) (models.Category, error) {
-    if err := s.DB.Create(&category).Error; err != nil {
+    if err := s.Categories.Create(&category); err != nil {
         return models.Category{}, err
     }
     return category, nil
@@ -26,40 +27,29 @@ func (s *CategoryService) CreateCategory(category models.Category) (models.Categ
 
 // GetAllCategories returns all categories, optionally with News
 func (s *CategoryService) GetAllCategories() ([]models.Category, error) {
-    var categories []models.Category
-
     // ✅ โหลด Category พร้อม News แต่ไม่ preload category ของ news
-    if err := s.DB.Preload("News").Find(&categories).Error; err != nil {
-        return nil, err
-    }
-
-    return categories, nil
+    return s.Categories.List()
 }
 
 
 // GetCategoryByID fetches a single category by ID
 func (s *CategoryService) GetCategoryByID(id uint) (models.Category, error) {
-    var category models.Category
-    if err := s.DB.First(&category, id).Error; err != nil {
-        return models.Category{}, err
-    }
-    return category, nil
+    return s.Categories.FindByID(id)
 }
 
 func (s *CategoryService) DeleteCategory(id uint) error {
-    result := s.DB.Delete(&models.Category{}, id)
-    if result.RowsAffected == 0 {
+    err := s.Categories.Delete(id)
+    if errors.Is(err, gorm.ErrRecordNotFound) {
         return errors.New("category not found")
     }
-    return nil
+    return err
 }
 
 // UpdateCategory updates an existing category entry
 func (s *CategoryService) UpdateCategory(id uint, categoryUpdate models.Category) (models.Category, error) {
-    var category models.Category
-
     // ค้นหาหมวดหมู่ที่ต้องการอัปเดต
-    if err := s.DB.First(&category, id).Error; err != nil {
+    category, err := s.Categories.FindByID(id)
+    if err != nil {
         return models.Category{}, errors.New("category not found")
     }
 
@@ -67,7 +57,7 @@ func (s *CategoryService) UpdateCategory(id uint, categoryUpdate models.Category
     category.Name = categoryUpdate.Name
 
     // บันทึกการเปลี่ยนแปลง
-    if err := s.DB.Save(&category).Error; err != nil {
+    if err := s.Categories.Save(&category); err != nil {
         return models.Category{}, err
     }
 
@@ -1,209 +1,133 @@
 package services
 
 import (
-    "sort"
-    "time"
+	"sort"
+	"time"
 
-    "yakkaw_dashboard/database"
-    "yakkaw_dashboard/models"
+	"yakkaw_dashboard/aqi"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
 )
 
-// GetChartData ดึงข้อมูลและ aggregate ค่า pm25 ตามช่วงเวลาที่ระบุ
-// หาก query parameter "province" ถูกส่งมา จะทำการ filter โดยใช้ address ILIKE
-// แต่ถ้าไม่ส่ง จะดึงข้อมูลของทุกจังหวัดโดย extract จังหวัดจาก address (โดยใช้ split_part)
-func GetChartData(rangeType string, province string, metric string) (models.ChartData, error) {
-    var chartData models.ChartData
-    var baseQuery string
+// ChartDataService answers the chart and ranking endpoints: the hourly and
+// daily rollups through Series and Rollups, raw readings through Readings.
+type ChartDataService struct {
+	Readings repository.ReadingRepository
+	Series   repository.SeriesRepository
+	Rollups  repository.RollupRepository
+}
 
-    // sanitize metric
-    col := "pm25"
-    switch metric {
-    case "pm25", "pm10", "aqi":
-        col = metric
-    default:
-        col = "pm25"
-    }
+// NewChartDataService creates a new ChartDataService instance
+func NewChartDataService(readings repository.ReadingRepository, series repository.SeriesRepository, rollups repository.RollupRepository) *ChartDataService {
+	return &ChartDataService{Readings: readings, Series: series, Rollups: rollups}
+}
 
-	// กำหนดช่วงเวลาและฟังก์ชัน date_trunc ที่จะใช้
-	switch rangeType {
-	case "Today":
-        if province != "" {
-            baseQuery = `
-                WITH hourly_data AS (
-                    SELECT 
-                        split_part(address, 'จ.', 2) as province,
-                        date_trunc('hour', (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok')) as time_label,
-                        ` + col + ` as value,
-                        ROW_NUMBER() OVER (
-                            PARTITION BY split_part(address, 'จ.', 2), 
-                            date_trunc('hour', to_timestamp(timestamp/1000))
-                            ORDER BY timestamp DESC
-                        ) as rn
-                    FROM sensor_data
-                    WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') >= date_trunc('day', (now() AT TIME ZONE 'Asia/Bangkok'))
-                      AND (address ILIKE ? OR place ILIKE ?)
-                )
-                SELECT 
-                    province,
-                    time_label,
-                    value as avg_pm25
-                FROM hourly_data
-                WHERE rn = 1
-                ORDER BY time_label
-            `
-        } else {
-            baseQuery = `
-                WITH hourly_data AS (
-                    SELECT 
-                        split_part(address, 'จ.', 2) as province,
-                        date_trunc('hour', (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok')) as time_label,
-                        ` + col + ` as value,
-                        ROW_NUMBER() OVER (
-                            PARTITION BY split_part(address, 'จ.', 2), 
-                            date_trunc('hour', to_timestamp(timestamp/1000))
-                            ORDER BY timestamp DESC
-                        ) as rn
-                    FROM sensor_data
-                    WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') >= date_trunc('day', (now() AT TIME ZONE 'Asia/Bangkok'))
-                )
-                SELECT 
-                    province,
-                    time_label,
-                    value as avg_pm25
-                FROM hourly_data
-                WHERE rn = 1
-                ORDER BY province, time_label
-            `
-        }
-    case "24 Hour":
-        baseQuery = `
-            SELECT split_part(address, 'จ.', 2) as province,
-                   date_trunc('hour', (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok')) as time_label,
-                   AVG(` + col + `) as avg_pm25
-            FROM sensor_data
-            WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') BETWEEN (now() AT TIME ZONE 'Asia/Bangkok') - interval '24 hours' AND (now() AT TIME ZONE 'Asia/Bangkok')
-        `
-        if province != "" {
-            baseQuery += ` AND (address ILIKE ? OR place ILIKE ?)`
-        }
-        baseQuery += ` GROUP BY province, time_label`
-        if province != "" {
-			baseQuery += ` ORDER BY time_label`
-		} else {
-			baseQuery += ` ORDER BY province, time_label`
-		}
-    case "1 Week":
-        baseQuery = `
-            SELECT split_part(address, 'จ.', 2) as province,
-                   date_trunc('day', (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok')) as time_label,
-                   AVG(` + col + `) as avg_pm25
-            FROM sensor_data
-            WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') BETWEEN (now() AT TIME ZONE 'Asia/Bangkok') - interval '7 days' AND (now() AT TIME ZONE 'Asia/Bangkok')
-        `
-        if province != "" {
-            baseQuery += ` AND (address ILIKE ? OR place ILIKE ?)`
-        }
-        baseQuery += ` GROUP BY province, time_label`
-        if province != "" {
-			baseQuery += ` ORDER BY time_label`
-		} else {
-			baseQuery += ` ORDER BY province, time_label`
-		}
-    case "1 Month":
-        baseQuery = `
-            SELECT split_part(address, 'จ.', 2) as province,
-                   date_trunc('week', (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok')) as time_label,
-                   AVG(` + col + `) as avg_pm25
-            FROM sensor_data
-            WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') BETWEEN (now() AT TIME ZONE 'Asia/Bangkok') - interval '1 month' AND (now() AT TIME ZONE 'Asia/Bangkok')
-        `
-        if province != "" {
-            baseQuery += ` AND (address ILIKE ? OR place ILIKE ?)`
-        }
-        baseQuery += ` GROUP BY province, time_label`
-        if province != "" {
-			baseQuery += ` ORDER BY time_label`
-		} else {
-			baseQuery += ` ORDER BY province, time_label`
+// GetChartData ดึงข้อมูลและ aggregate ค่า pm25 ตามช่วงเวลาที่ระบุ
+// หาก query parameter "province" ถูกส่งมา จะ filter ด้วยจังหวัดที่ parse ไว้ (province_code) หรือชื่อ place
+// แต่ถ้าไม่ส่ง จะดึงข้อมูลของทุกจังหวัดโดยจัดกลุ่มตามคอลัมน์ province
+// metric=aqi ไม่เฉลี่ยค่า aqi ของ upstream แต่คำนวณจากค่าเฉลี่ย PM ตามมาตรฐาน aqi.DefaultStandard (ดู GetChartAQI)
+func (s *ChartDataService) GetChartData(rangeType string, province string, metric string) (models.ChartData, error) {
+	// sanitize metric
+	col := "pm25"
+	switch metric {
+	case "pm25", "pm10":
+		col = metric
+	case "aqi":
+		std, err := aqi.Parse("")
+		if err != nil {
+			return models.ChartData{}, err
 		}
-    case "3 Month":
-        baseQuery = `
-            SELECT split_part(address, 'จ.', 2) as province,
-                   date_trunc('month', (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok')) as time_label,
-                   AVG(` + col + `) as avg_pm25
-            FROM sensor_data
-            WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') BETWEEN (now() AT TIME ZONE 'Asia/Bangkok') - interval '3 months' AND (now() AT TIME ZONE 'Asia/Bangkok')
-        `
-        if province != "" {
-            baseQuery += ` AND (address ILIKE ? OR place ILIKE ?)`
-        }
-        baseQuery += ` GROUP BY province, time_label`
-        if province != "" {
-			baseQuery += ` ORDER BY time_label`
-		} else {
-			baseQuery += ` ORDER BY province, time_label`
+		return s.GetChartAQI(rangeType, province, std)
+	default:
+		col = "pm25"
+	}
+	return s.chartSeries(rangeType, province, col)
+}
+
+// GetChartAQI returns the GetChartData chart of the AQI under std, computed
+// per point from that point's PM2.5 and PM10 averages. Each dataset also
+// carries the dominant pollutant and the sub-indices of every point.
+func (s *ChartDataService) GetChartAQI(rangeType string, province string, std aqi.Standard) (models.ChartData, error) {
+	pm25, err := s.chartSeries(rangeType, province, "pm25")
+	if err != nil {
+		return models.ChartData{}, err
+	}
+	pm10, err := s.chartSeries(rangeType, province, "pm10")
+	if err != nil {
+		return models.ChartData{}, err
+	}
+
+	// PM10 ถูกจับคู่กับ PM2.5 ด้วยชื่อ dataset และ label; จุดที่ไม่มีค่าจะเป็น 0 และถูกข้ามในการคำนวณ
+	pm10Values := make(map[string]map[string]float64, len(pm10.Datasets))
+	for _, ds := range pm10.Datasets {
+		values := make(map[string]float64, len(ds.Data))
+		for i, v := range ds.Data {
+			if i < len(pm10.Labels) {
+				values[pm10.Labels[i]] = v
+			}
 		}
-    case "1 Year":
-        baseQuery = `
-            SELECT split_part(address, 'จ.', 2) as province,
-                   date_trunc('month', (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok')) as time_label,
-                   AVG(` + col + `) as avg_pm25
-            FROM sensor_data
-            WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') BETWEEN (now() AT TIME ZONE 'Asia/Bangkok') - interval '1 year' AND (now() AT TIME ZONE 'Asia/Bangkok')
-        `
-        if province != "" {
-            baseQuery += ` AND (address ILIKE ? OR place ILIKE ?)`
-        }
-        baseQuery += ` GROUP BY province, time_label`
-        if province != "" {
-			baseQuery += ` ORDER BY time_label`
-		} else {
-			baseQuery += ` ORDER BY province, time_label`
+		pm10Values[ds.Label] = values
+	}
+
+	chartData := models.ChartData{Labels: pm25.Labels, AQIStandard: std.Code}
+	for _, ds := range pm25.Datasets {
+		out := models.DatasetChart{
+			Label:      ds.Label,
+			Data:       make([]float64, len(ds.Data)),
+			Dominant:   make([]string, len(ds.Data)),
+			SubIndices: map[string][]float64{},
 		}
-	default:
-		baseQuery = `
-			SELECT split_part(address, 'จ.', 2) as province,
-			       date_trunc('hour', to_timestamp(timestamp/1000)) as time_label,
-			       AVG(pm25) as avg_pm25
-			FROM sensor_data
-			WHERE to_timestamp(timestamp/1000) BETWEEN now() - interval '24 hours' AND now()
-		`
-		if province != "" {
-			baseQuery += ` AND address ILIKE ?`
+		for _, p := range aqi.Pollutants {
+			out.SubIndices[string(p)] = make([]float64, len(ds.Data))
 		}
-		baseQuery += ` GROUP BY province, time_label`
-		if province != "" {
-			baseQuery += ` ORDER BY time_label`
-		} else {
-			baseQuery += ` ORDER BY province, time_label`
+		for i, v := range ds.Data {
+			pm25Avg := v
+			pm10Avg := pm10Values[ds.Label][pm25.Labels[i]]
+			index := std.Compute(aqi.PM(&pm25Avg, &pm10Avg))
+			out.Data[i] = float64(index.AQI)
+			out.Dominant[i] = string(index.Dominant)
+			for p, sub := range index.SubIndices {
+				out.SubIndices[string(p)][i] = float64(sub)
+			}
 		}
+		chartData.Datasets = append(chartData.Datasets, out)
 	}
+	return chartData, nil
+}
 
-	// โครงสร้างผลลัพธ์จาก query
-	type resultRow struct {
-		Province  string
-		TimeLabel time.Time
-		AvgPM25   float64
+// chartSeries builds the GetChartData chart of column col (pm25 or pm10).
+func (s *ChartDataService) chartSeries(rangeType string, province string, col string) (models.ChartData, error) {
+	var chartData models.ChartData
+	var f repository.ReadingFilter
+	if province != "" {
+		f = parseLocationFilter(province).readings()
 	}
-	var results []resultRow
 
-    if province != "" {
-        if err := database.DB.Raw(baseQuery, "%"+province+"%", "%"+province+"%").Scan(&results).Error; err != nil {
-            return chartData, err
-        }
-    } else {
-        if err := database.DB.Raw(baseQuery).Scan(&results).Error; err != nil {
-            return chartData, err
-        }
-    }
+	// กำหนดช่วงเวลาและแหล่งข้อมูลที่จะใช้
+	now := time.Now()
+	var results []repository.ProvinceHour
+	var err error
+	switch rangeType {
+	case "Today":
+		// ค่าล่าสุดของแต่ละชั่วโมงตั้งแต่เที่ยงคืน (Asia/Bangkok)
+		results, err = s.Readings.HourlyLatest(f, col, bangkokDay(now), now)
+	case "24 Hour", "1 Week", "1 Month", "3 Month", "1 Year":
+		// ช่วงเวลาเหล่านี้อ่านจาก rollup รายชั่วโมง/รายวัน แทนการเฉลี่ยจาก raw ทุกครั้ง
+		results, err = s.chartRollup(rangeType, province, col, now)
+	default:
+		results, err = s.Readings.HourlyAverages(f, col, now.Add(-24*time.Hour), now)
+	}
+	if err != nil {
+		return chartData, err
+	}
 
 	// กรณีมีการส่ง province filter (เฉพาะจังหวัดเดียว)
 	if province != "" {
 		var labels []string
 		var dataValues []float64
 		for _, row := range results {
-			labels = append(labels, formatLabel(rangeType, row.TimeLabel))
-			dataValues = append(dataValues, row.AvgPM25)
+			labels = append(labels, formatLabel(rangeType, row.Hour))
+			dataValues = append(dataValues, row.Value)
 		}
 		chartData.Labels = labels
 		chartData.Datasets = []models.DatasetChart{
@@ -216,13 +140,13 @@ func GetChartData(rangeType string, province string, metric string) (models.Char
 		timeMap := make(map[string]time.Time)
 
 		for _, row := range results {
-			lbl := formatLabel(rangeType, row.TimeLabel)
+			lbl := formatLabel(rangeType, row.Hour)
 			if _, ok := provinceMap[row.Province]; !ok {
 				provinceMap[row.Province] = make(map[string]float64)
 			}
-			provinceMap[row.Province][lbl] = row.AvgPM25
+			provinceMap[row.Province][lbl] = row.Value
 			if _, exists := timeMap[lbl]; !exists {
-				timeMap[lbl] = row.TimeLabel
+				timeMap[lbl] = row.Hour
 			}
 		}
 
@@ -258,6 +182,52 @@ func GetChartData(rangeType string, province string, metric string) (models.Char
 	return chartData, nil
 }
 
+// chartRollupRanges maps a chart range to the series interval of its labels
+// (1h reads the hourly rollup, longer ones the daily rollup) and how far back
+// it goes.
+var chartRollupRanges = map[string]struct {
+	interval string
+	since    func(t time.Time) time.Time
+}{
+	"24 Hour": {"1h", func(t time.Time) time.Time { return t.Add(-24 * time.Hour) }},
+	"1 Week":  {"1d", func(t time.Time) time.Time { return t.AddDate(0, 0, -7) }},
+	"1 Month": {"1w", func(t time.Time) time.Time { return t.AddDate(0, -1, 0) }},
+	"3 Month": {"1M", func(t time.Time) time.Time { return t.AddDate(0, -3, 0) }},
+	"1 Year":  {"1M", func(t time.Time) time.Time { return t.AddDate(-1, 0, 0) }},
+}
+
+// chartRollup reads the GetChartData rows of rangeType from the province (or,
+// for a place filter, place) rollups, from the start of the hour or day the
+// range begins in. Averages are weighted by reading count so they equal the
+// average over the raw readings.
+func (s *ChartDataService) chartRollup(rangeType, province, col string, now time.Time) ([]repository.ProvinceHour, error) {
+	r := chartRollupRanges[rangeType]
+	from := bangkokDay(r.since(now))
+	if r.interval == "1h" {
+		from = seriesIntervals["1h"].start(r.since(now))
+	}
+	q := repository.SeriesSpec{From: from, To: now, Interval: r.interval, Metric: col, Aggregator: "avg", GroupBy: SeriesGroupProvince}
+	f := repository.RollupFilter{Scope: models.RollupScopeProvince}
+	if province != "" {
+		q.GroupBy = SeriesGroupNone
+		f = parseLocationFilter(province).rollup()
+	}
+	rows, err := s.Series.Rollup(q, f)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]repository.ProvinceHour, 0, len(rows))
+	for _, row := range rows {
+		if row.Value != nil {
+			out = append(out, repository.ProvinceHour{Province: row.Key, Hour: row.Bucket, Value: *row.Value})
+		}
+	}
+	if province != "" {
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Hour.Before(out[j].Hour) })
+	}
+	return out, nil
+}
+
 // Helper function สำหรับฟอร์แมต label ตามช่วงเวลา
 func formatLabel(rangeType string, t time.Time) string {
 	switch rangeType {
@@ -276,54 +246,45 @@ func formatLabel(rangeType string, t time.Time) string {
 
 // GetHeatmapOneYearDaily returns daily PM2.5 averages for the past year for a given province.
 // It returns a ChartData with ISO date labels (YYYY-MM-DD) and a single dataset labelled by province.
-func GetHeatmapOneYearDaily(province string, metric string) (models.ChartData, error) {
-    var chartData models.ChartData
-    if province == "" {
-        return chartData, nil
-    }
-
-    col := "pm25"
-    switch metric {
-    case "pm25", "pm10", "aqi":
-        col = metric
-    default:
-        col = "pm25"
-    }
-
-    // Daily buckets for the past 1 year filtered by province/place (address or place ILIKE)
-    baseQuery := `
-        SELECT 
-            date_trunc('day', (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok')) as time_label,
-            AVG(` + col + `) as avg_pm25
-        FROM sensor_data
-        WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') BETWEEN (now() AT TIME ZONE 'Asia/Bangkok') - interval '1 year' AND (now() AT TIME ZONE 'Asia/Bangkok')
-          AND (address ILIKE ? OR place ILIKE ?)
-        GROUP BY time_label
-        ORDER BY time_label ASC
-    `
+func (s *ChartDataService) GetHeatmapOneYearDaily(province string, metric string) (models.ChartData, error) {
+	var chartData models.ChartData
+	if province == "" {
+		return chartData, nil
+	}
 
-    type resultRow struct {
-        TimeLabel time.Time
-        AvgPM25   float64
-    }
-    var results []resultRow
+	col := "pm25"
+	switch metric {
+	case "pm25", "pm10", "aqi":
+		col = metric
+	default:
+		col = "pm25"
+	}
 
-    if err := database.DB.Raw(baseQuery, "%"+province+"%", "%"+province+"%").Scan(&results).Error; err != nil {
-        return chartData, err
-    }
+	// Daily buckets for the past 1 year from the daily rollup of the matching province or place
+	now := time.Now()
+	rows, err := s.Series.Rollup(repository.SeriesSpec{
+		From: bangkokDay(now.AddDate(-1, 0, 0)), To: now,
+		Interval: "1d", Metric: col, Aggregator: "avg", GroupBy: SeriesGroupNone,
+	}, parseLocationFilter(province).rollup())
+	if err != nil {
+		return chartData, err
+	}
 
-    labels := make([]string, 0, len(results))
-    values := make([]float64, 0, len(results))
-    for _, r := range results {
-        labels = append(labels, r.TimeLabel.Format("2006-01-02"))
-        values = append(values, r.AvgPM25)
-    }
+	labels := make([]string, 0, len(rows))
+	values := make([]float64, 0, len(rows))
+	for _, r := range rows {
+		if r.Value == nil {
+			continue
+		}
+		labels = append(labels, r.Bucket.Format("2006-01-02"))
+		values = append(values, *r.Value)
+	}
 
-    chartData.Labels = labels
-    chartData.Datasets = []models.DatasetChart{{
-        Label: province,
-        Data:  values,
-    }}
+	chartData.Labels = labels
+	chartData.Datasets = []models.DatasetChart{{
+		Label: province,
+		Data:  values,
+	}}
 
-    return chartData, nil
+	return chartData, nil
 }
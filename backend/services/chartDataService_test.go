@@ -0,0 +1,82 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+// wallDay is the daily rollup bucket of t: its Bangkok date at midnight,
+// without a zone.
+func wallDay(t time.Time) time.Time {
+	t = t.In(database.Bangkok)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func TestChartData(t *testing.T) {
+	now := time.Now()
+	midnight := bangkokDay(now)
+	reading := func(address, place string, at time.Time, pm25 int) models.SensorData {
+		return models.SensorData{Address: address, Place: place, Timestamp: at.UnixMilli(), PM25: pm25, PM10: pm25 * 2}
+	}
+	readings := repository.NewMemoryReadingRepository(
+		reading("จ.เชียงใหม่", "CMU", midnight, 20),
+		reading("จ.เชียงใหม่", "CMU", midnight.Add(time.Millisecond), 25), // the hour's newest
+		reading("จ.ลำปาง", "Lampang", midnight, 60),
+		reading("", "Nowhere", midnight, 99),                          // no province
+		reading("จ.เชียงใหม่", "CMU", midnight.Add(-time.Minute), 80), // yesterday
+	)
+
+	avg := func(v float64) *float64 { return &v }
+	series := repository.NewMemorySeriesRepository()
+	yesterday, weekAgo := wallDay(now.AddDate(0, 0, -1)), wallDay(now.AddDate(0, 0, -10))
+	series.Rollups.AddDaily(
+		models.RollupBucket{Scope: models.RollupScopeProvince, Key: "เชียงใหม่", Bucket: yesterday, PM25Avg: avg(30), PM25Count: 100},
+		models.RollupBucket{Scope: models.RollupScopeProvince, Key: "ลำปาง", Bucket: yesterday, PM25Avg: avg(50), PM25Count: 100},
+		models.RollupBucket{Scope: models.RollupScopeProvince, Key: "ลำปาง", Bucket: weekAgo, PM25Avg: avg(70), PM25Count: 100},
+		models.RollupBucket{Scope: models.RollupScopePlace, Key: "CMU Gate", Bucket: yesterday, PM25Avg: avg(35), PM25Count: 100},
+		models.RollupBucket{Scope: models.RollupScopePlace, Key: "CMU Gate", Bucket: weekAgo, PM25Avg: avg(45), PM25Count: 100},
+		models.RollupBucket{Scope: models.RollupScopePlace, Key: "CMU Gate", Bucket: wallDay(now.AddDate(0, 0, -2))},
+	)
+	s := NewChartDataService(readings, series, repository.NewMemoryRollupRepository())
+
+	// Today: each province's newest value of the hour since midnight.
+	chart, err := s.GetChartData("Today", "", "pm25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chart.Labels) != 1 || chart.Labels[0] != "00:00" || len(chart.Datasets) != 2 {
+		t.Fatalf("today = %+v, want one hour of two provinces", chart)
+	}
+	for _, ds := range chart.Datasets {
+		if want := map[string]float64{"เชียงใหม่": 25, "ลำปาง": 60}[ds.Label]; ds.Data[0] != want {
+			t.Errorf("today %s = %v, want %v", ds.Label, ds.Data, want)
+		}
+	}
+	if chart, _ = s.GetChartData("Today", "TH-52", "pm10"); len(chart.Datasets) != 1 || chart.Datasets[0].Data[0] != 120 {
+		t.Errorf("today in TH-52 = %+v, want PM10 120", chart)
+	}
+
+	// A week per day from the province rollups.
+	chart, err = s.GetChartData("1 Week", "", "pm25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chart.Labels) != 1 || chart.Labels[0] != yesterday.Format("Mon") || len(chart.Datasets) != 2 {
+		t.Errorf("week = %+v, want yesterday of two provinces", chart)
+	}
+
+	// The heatmap of a place filter reads the place rollups, leaving out days
+	// without data.
+	chart, err = s.GetHeatmapOneYearDaily("CMU", "pm25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chart.Labels) != 2 || chart.Labels[1] != yesterday.Format("2006-01-02") ||
+		chart.Datasets[0].Label != "CMU" || chart.Datasets[0].Data[0] != 45 {
+		t.Errorf("heatmap = %+v, want two CMU days", chart)
+	}
+}
@@ -1,48 +1,49 @@
 package services
 
 import (
-	"yakkaw_dashboard/database"
 	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
 )
 
-func CreateColorRange(ColorRange models.ColorRange) (models.ColorRange, error) {
-	if err := database.DB.Create(&ColorRange).Error; err != nil {
-		return models.ColorRange{}, err
-	}
-	return ColorRange, nil
+type ColorRangeService struct {
+	ColorRanges repository.ColorRangeRepository
 }
 
-func GetAllColorRanges() ([]models.ColorRange, error) {
-	var colorRanges []models.ColorRange
-	if err := database.DB.Find(&colorRanges).Error; err != nil {
-		return nil, err
-	}
-	return colorRanges, nil
+// NewColorRangeService creates a new ColorRangeService instance
+func NewColorRangeService(colorRanges repository.ColorRangeRepository) *ColorRangeService {
+	return &ColorRangeService{ColorRanges: colorRanges}
 }
 
-func GetColorRange(id string) (models.ColorRange, error) {
-	var ColorRange models.ColorRange
-	if err := database.DB.First(&ColorRange, id).Error; err != nil {
+func (s *ColorRangeService) CreateColorRange(colorRange models.ColorRange) (models.ColorRange, error) {
+	if err := s.ColorRanges.Create(&colorRange); err != nil {
 		return models.ColorRange{}, err
 	}
-	return ColorRange, nil
+	return colorRange, nil
+}
+
+func (s *ColorRangeService) GetAllColorRanges() ([]models.ColorRange, error) {
+	return s.ColorRanges.List()
+}
+
+func (s *ColorRangeService) GetColorRange(id uint) (models.ColorRange, error) {
+	return s.ColorRanges.FindByID(id)
 }
 
-func UpdateColorRange(id string, input models.ColorRange) (models.ColorRange, error) {
-	var ColorRange models.ColorRange
-	if err := database.DB.First(&ColorRange, id).Error; err != nil {
+func (s *ColorRangeService) UpdateColorRange(id uint, input models.ColorRange) (models.ColorRange, error) {
+	colorRange, err := s.ColorRanges.FindByID(id)
+	if err != nil {
 		return models.ColorRange{}, err
 	}
-	ColorRange.Min = input.Min
-	ColorRange.Max = input.Max
-	ColorRange.Color = input.Color
+	colorRange.Min = input.Min
+	colorRange.Max = input.Max
+	colorRange.Color = input.Color
 
-	if err := database.DB.Save(&ColorRange).Error; err != nil {
+	if err := s.ColorRanges.Save(&colorRange); err != nil {
 		return models.ColorRange{}, err
 	}
-	return ColorRange, nil
+	return colorRange, nil
 }
 
-func DeleteColorRange(id string) error {
-	return database.DB.Delete(&models.ColorRange{}, id).Error
+func (s *ColorRangeService) DeleteColorRange(id uint) error {
+	return s.ColorRanges.Delete(id)
 }
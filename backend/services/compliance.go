@@ -0,0 +1,360 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"yakkaw_dashboard/config"
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+	"yakkaw_dashboard/thaiaddress"
+)
+
+// ErrInvalidComplianceQuery wraps every validation error of GetComplianceReport.
+var ErrInvalidComplianceQuery = errors.New("invalid compliance query")
+
+// maxComplianceRange bounds a report; hourly counts scan rollup_hourly.
+const maxComplianceRange = 366 * 24 * time.Hour
+
+// complianceMinDayHours is how many of a day's 24 hourly means must have data
+// for its daily mean to be valid: 75%, the completeness rule of the US EPA and
+// the Thai PCD. A daily mean of a mostly offline day would stand for a few
+// hours only, so it counts towards neither the 24h exceedances nor the annual
+// mean.
+const complianceMinDayHours = 18
+
+// Compliance report groupings.
+const (
+	ComplianceGroupStation  = "station"
+	ComplianceGroupProvince = "province"
+	ComplianceGroupMonth    = "month"
+)
+
+// ComplianceQuery selects a compliance report. From and To are Asia/Bangkok
+// midnights; To is exclusive. Location is the free-text "province" parameter
+// (see locationFilter). A month grouping needs a Location or DVID and reports
+// that location month by month.
+type ComplianceQuery struct {
+	From      time.Time
+	To        time.Time
+	GroupBy   string
+	Location  string
+	DVID      string
+	Standards []string
+}
+
+// ComplianceReport counts exceedances of every standard per group.
+type ComplianceReport struct {
+	From      string                      `json:"from"`
+	To        string                      `json:"to"`
+	GroupBy   string                      `json:"group_by"`
+	Standards []config.ComplianceStandard `json:"standards"`
+	Rows      []ComplianceRow             `json:"rows"`
+}
+
+// ComplianceRow is one station (dvid), province (ISO code) or month
+// (YYYY-MM) with a result per standard, in the order of Standards.
+type ComplianceRow struct {
+	Key     string             `json:"key"`
+	Label   string             `json:"label"`
+	Results []ComplianceResult `json:"results"`
+}
+
+// ComplianceResult is one group against one standard. A daily mean is the
+// mean of the day's hourly means; Days counts the valid ones (see
+// complianceMinDayHours) and IncompleteDays the days with too few hours of
+// data. Hours counts the hourly means that had data. Mean is the mean of the
+// valid daily means and MaxDailyMean the highest of them. For a 24h standard
+// ExceedanceDays counts valid daily means above the limit (ExceedanceHours,
+// hourly means above it, is indicative); for a 1h standard ExceedanceHours
+// counts hourly means above the limit and ExceedanceDays the days with at
+// least one. An annual standard is exceeded when Mean is above the limit.
+type ComplianceResult struct {
+	Standard        string   `json:"standard"`
+	Days            int      `json:"days"`
+	IncompleteDays  int      `json:"incomplete_days"`
+	ExceedanceDays  int      `json:"exceedance_days"`
+	Hours           int      `json:"hours"`
+	ExceedanceHours int      `json:"exceedance_hours"`
+	Mean            *float64 `json:"mean"`
+	MaxDailyMean    *float64 `json:"max_daily_mean"`
+	Exceeds         bool     `json:"exceeds"`
+}
+
+type ComplianceService struct {
+	Standards []config.ComplianceStandard
+	Rollups   repository.RollupRepository
+	Stations  repository.StationRepository
+}
+
+// NewComplianceService creates a new ComplianceService instance
+func NewComplianceService(standards []config.ComplianceStandard, rollups repository.RollupRepository, stations repository.StationRepository) *ComplianceService {
+	return &ComplianceService{Standards: standards, Rollups: rollups, Stations: stations}
+}
+
+func invalidCompliance(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidComplianceQuery, fmt.Sprintf(format, args...))
+}
+
+// GetComplianceReport counts exceedances from the hourly rollup (station or
+// province scope; a place Location reads the place scope).
+func (s *ComplianceService) GetComplianceReport(q ComplianceQuery) (ComplianceReport, error) {
+	standards, err := s.selectStandards(q.Standards)
+	if err != nil {
+		return ComplianceReport{}, err
+	}
+	if !q.To.After(q.From) {
+		return ComplianceReport{}, invalidCompliance("to must be after from")
+	}
+	if q.To.Sub(q.From) > maxComplianceRange {
+		return ComplianceReport{}, invalidCompliance("range is limited to 366 days")
+	}
+	filter, err := complianceScope(q)
+	if err != nil {
+		return ComplianceReport{}, err
+	}
+
+	rows := map[string][]ComplianceResult{}
+	sums := map[string][]float64{}
+	row := func(key string) []ComplianceResult {
+		r, ok := rows[key]
+		if !ok {
+			r = make([]ComplianceResult, len(standards))
+			for i, st := range standards {
+				r[i].Standard = st.Code
+			}
+			rows[key] = r
+			sums[key] = make([]float64, len(standards))
+		}
+		return r
+	}
+
+	// One pass per pollutant over its daily summaries of hourly means, with
+	// the limits of all its standards.
+	byPollutant := map[string][]int{}
+	var pollutants []string
+	for i, st := range standards {
+		if _, ok := byPollutant[st.Pollutant]; !ok {
+			pollutants = append(pollutants, st.Pollutant)
+		}
+		byPollutant[st.Pollutant] = append(byPollutant[st.Pollutant], i)
+	}
+	for _, p := range pollutants {
+		idx := byPollutant[p]
+		limits := make([]float64, len(idx))
+		for j, i := range idx {
+			limits[j] = standards[i].Limit
+		}
+		days, err := s.Rollups.DailyFromHourly(filter, p, limits, q.From, q.To)
+		if err != nil {
+			return ComplianceReport{}, err
+		}
+		for _, d := range days {
+			key := d.Key
+			if q.GroupBy == ComplianceGroupMonth {
+				key = d.Day.Format("2006-01")
+			}
+			r := row(key)
+			for j, i := range idx {
+				addComplianceDay(&r[i], &sums[key][i], standards[i], d, d.Above[j])
+			}
+		}
+	}
+
+	report := ComplianceReport{
+		From:      q.From.In(database.Bangkok).Format("2006-01-02"),
+		To:        q.To.In(database.Bangkok).Format("2006-01-02"),
+		GroupBy:   q.GroupBy,
+		Standards: standards,
+		Rows:      make([]ComplianceRow, 0, len(rows)),
+	}
+	for key, results := range rows {
+		for i, st := range standards {
+			res := &results[i]
+			if res.Days > 0 {
+				mean := sums[key][i] / float64(res.Days)
+				res.Mean = &mean
+			}
+			switch st.Period {
+			case "1h", "24h":
+				res.Exceeds = res.ExceedanceDays > 0
+			case "annual":
+				res.Exceeds = res.Mean != nil && *res.Mean > st.Limit
+			}
+		}
+		report.Rows = append(report.Rows, ComplianceRow{Key: key, Label: key, Results: results})
+	}
+	sort.Slice(report.Rows, func(i, j int) bool { return report.Rows[i].Key < report.Rows[j].Key })
+	if err := s.labelComplianceRows(q.GroupBy, report.Rows); err != nil {
+		return ComplianceReport{}, err
+	}
+	return report, nil
+}
+
+// addComplianceDay counts one day of hourly means into res; sum collects the
+// valid daily means and above is how many hourly means exceeded st.Limit.
+func addComplianceDay(res *ComplianceResult, sum *float64, st config.ComplianceStandard, d repository.RollupDay, above int) {
+	res.Hours += d.Hours
+	if st.Period != "annual" {
+		res.ExceedanceHours += above
+	}
+	if st.Period == "1h" && above > 0 {
+		res.ExceedanceDays++
+	}
+
+	if d.Hours < complianceMinDayHours || d.Mean == nil {
+		res.IncompleteDays++
+		return
+	}
+	res.Days++
+	*sum += *d.Mean
+	if res.MaxDailyMean == nil || *d.Mean > *res.MaxDailyMean {
+		max := *d.Mean
+		res.MaxDailyMean = &max
+	}
+	if st.Period == "24h" && *d.Mean > st.Limit {
+		res.ExceedanceDays++
+	}
+}
+
+// selectStandards returns the configured standards named by codes, all of
+// them for none.
+func (s *ComplianceService) selectStandards(codes []string) ([]config.ComplianceStandard, error) {
+	if len(codes) == 0 {
+		return s.Standards, nil
+	}
+	var out []config.ComplianceStandard
+	for _, code := range codes {
+		found := false
+		for _, st := range s.Standards {
+			if st.Code == code {
+				out = append(out, st)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, invalidCompliance("unknown standard %q", code)
+		}
+	}
+	return out, nil
+}
+
+// complianceScope returns the rollup rows that answer q.
+func complianceScope(q ComplianceQuery) (repository.RollupFilter, error) {
+	var f repository.RollupFilter
+	var loc *locationFilter
+	if q.Location != "" {
+		l := parseLocationFilter(q.Location)
+		loc = &l
+	}
+	if q.DVID != "" && loc != nil {
+		return f, invalidCompliance("filter by either province or dvid")
+	}
+
+	switch q.GroupBy {
+	case ComplianceGroupStation:
+		f.Scope = models.RollupScopeDVID
+		switch {
+		case q.DVID != "":
+			f.Keys = []string{q.DVID}
+		case loc != nil && loc.isProvince():
+			f.ProvinceCode = loc.province.Code
+		case loc != nil:
+			f.Place = loc.place
+		}
+	case ComplianceGroupProvince:
+		f.Scope = models.RollupScopeProvince
+		switch {
+		case q.DVID != "":
+			return f, invalidCompliance("dvid cannot be grouped by province")
+		case loc != nil && !loc.isProvince():
+			return f, invalidCompliance("%q is not a province", q.Location)
+		case loc != nil:
+			f.Keys = []string{loc.province.Name}
+		}
+	case ComplianceGroupMonth:
+		switch {
+		case q.DVID != "":
+			f.Scope, f.Keys = models.RollupScopeDVID, []string{q.DVID}
+		case loc != nil && loc.isProvince():
+			f.Scope, f.Keys = models.RollupScopeProvince, []string{loc.province.Name}
+		case loc != nil:
+			f.Scope, f.KeyLike = models.RollupScopePlace, []string{loc.place}
+		default:
+			return f, invalidCompliance("group_by=month needs a province or dvid")
+		}
+	default:
+		return f, invalidCompliance("group_by must be station, province or month")
+	}
+	return f, nil
+}
+
+// labelComplianceRows keys provinces by ISO code and labels stations with
+// their current place.
+func (s *ComplianceService) labelComplianceRows(groupBy string, rows []ComplianceRow) error {
+	switch groupBy {
+	case ComplianceGroupProvince:
+		for i := range rows {
+			if p, ok := thaiaddress.LookupProvince(rows[i].Key); ok {
+				rows[i].Key = p.Code
+			}
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	case ComplianceGroupStation:
+		if len(rows) == 0 {
+			return nil
+		}
+		dvids := make([]string, len(rows))
+		for i, r := range rows {
+			dvids[i] = r.Key
+		}
+		places, err := s.Stations.Places(dvids...)
+		if err != nil {
+			return err
+		}
+		for i := range rows {
+			if place := places[rows[i].Key]; place != "" {
+				rows[i].Label = place
+			}
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes the report with one line per group and standard.
+func (r ComplianceReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"from", "to", "group_by", "key", "label", "standard", "pollutant", "period", "limit",
+		"days", "incomplete_days", "exceedance_days", "hours", "exceedance_hours", "mean", "max_daily_mean", "exceeds"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	optional := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', 2, 64)
+	}
+	for _, row := range r.Rows {
+		for i, res := range row.Results {
+			st := r.Standards[i]
+			err := cw.Write([]string{r.From, r.To, r.GroupBy, row.Key, row.Label, st.Code, st.Pollutant, st.Period,
+				strconv.FormatFloat(st.Limit, 'f', -1, 64),
+				strconv.Itoa(res.Days), strconv.Itoa(res.IncompleteDays), strconv.Itoa(res.ExceedanceDays),
+				strconv.Itoa(res.Hours), strconv.Itoa(res.ExceedanceHours),
+				optional(res.Mean), optional(res.MaxDailyMean), strconv.FormatBool(res.Exceeds)})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/config"
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+// hourlyPM25 returns hours rollup rows of key starting at Bangkok wall-clock
+// hour start of day, all with the same PM2.5 mean.
+func hourlyPM25(scope, key string, day, start, hours int, v float64) []models.RollupBucket {
+	rows := make([]models.RollupBucket, hours)
+	for i := range rows {
+		avg := v
+		rows[i] = models.RollupBucket{
+			Scope: scope, Key: key,
+			Bucket:  time.Date(2025, time.January, day, start+i, 0, 0, 0, time.UTC),
+			PM25Avg: &avg, PM25Count: 12,
+		}
+	}
+	return rows
+}
+
+func TestComplianceReport(t *testing.T) {
+	rollups := repository.NewMemoryRollupRepository()
+	// A full day above 37.5, a valid day at 10 and a mostly offline day.
+	rollups.AddHourly(hourlyPM25(models.RollupScopeDVID, "a", 1, 0, 24, 40)...)
+	rollups.AddHourly(hourlyPM25(models.RollupScopeDVID, "a", 2, 0, 20, 10)...)
+	rollups.AddHourly(hourlyPM25(models.RollupScopeDVID, "a", 3, 8, 5, 100)...)
+	// Another province, and an hour outside the window.
+	rollups.AddHourly(hourlyPM25(models.RollupScopeDVID, "b", 1, 0, 24, 80)...)
+	rollups.AddHourly(hourlyPM25(models.RollupScopeDVID, "a", 31, 23, 2, 500)...)
+	stationList := []models.Station{
+		{DVID: "a", Place: "CMU", ProvinceCode: "TH-50"},
+		{DVID: "b", Place: "Lampang", ProvinceCode: "TH-52"},
+	}
+	rollups.AddStations(stationList...)
+
+	standards := []config.ComplianceStandard{
+		{Code: "th_pm25_24h", Pollutant: "pm25", Period: "24h", Limit: 37.5},
+		{Code: "th_pm25_annual", Pollutant: "pm25", Period: "annual", Limit: 15},
+		{Code: "x_pm25_1h", Pollutant: "pm25", Period: "1h", Limit: 50},
+		{Code: "th_pm10_24h", Pollutant: "pm10", Period: "24h", Limit: 120},
+	}
+	s := NewComplianceService(standards, rollups, repository.NewMemoryStationRepository(stationList...))
+
+	from := time.Date(2025, time.January, 1, 0, 0, 0, 0, database.Bangkok)
+	report, err := s.GetComplianceReport(ComplianceQuery{
+		From: from, To: from.AddDate(0, 0, 30),
+		GroupBy: ComplianceGroupStation, Location: "เชียงใหม่",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].Key != "a" || report.Rows[0].Label != "CMU" {
+		t.Fatalf("rows = %+v, want station a labelled CMU", report.Rows)
+	}
+	res := report.Rows[0].Results
+
+	daily := res[0]
+	if daily.Days != 2 || daily.IncompleteDays != 1 || daily.Hours != 49 ||
+		daily.ExceedanceDays != 1 || daily.ExceedanceHours != 29 || !daily.Exceeds {
+		t.Errorf("24h = %+v, want 2 valid days, 1 incomplete, 1 exceedance day", daily)
+	}
+	if daily.MaxDailyMean == nil || *daily.MaxDailyMean != 40 {
+		t.Errorf("max daily mean = %v, want 40 (the incomplete day is left out)", daily.MaxDailyMean)
+	}
+
+	// The mean of the valid daily means, not of the readings: (40 + 10) / 2.
+	annual := res[1]
+	if annual.Mean == nil || *annual.Mean != 25 || !annual.Exceeds || annual.ExceedanceHours != 0 {
+		t.Errorf("annual = %+v, want mean 25 exceeding 15", annual)
+	}
+
+	// Hourly exceedances count on every day, complete or not.
+	hourly := res[2]
+	if hourly.ExceedanceHours != 5 || hourly.ExceedanceDays != 1 || !hourly.Exceeds {
+		t.Errorf("1h = %+v, want 5 hours on 1 day", hourly)
+	}
+
+	if pm10 := res[3]; pm10.Days != 0 || pm10.Hours != 0 || pm10.Mean != nil || pm10.Exceeds {
+		t.Errorf("pm10 = %+v, want no data", pm10)
+	}
+
+	// The same station month by month.
+	report, err = s.GetComplianceReport(ComplianceQuery{
+		From: from, To: from.AddDate(0, 1, 0),
+		GroupBy: ComplianceGroupMonth, DVID: "a", Standards: []string{"th_pm25_24h"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].Key != "2025-01" || report.Rows[0].Results[0].IncompleteDays != 2 {
+		t.Errorf("month rows = %+v, want 2025-01 with the Jan 31 hours incomplete too", report.Rows)
+	}
+}
+
+func TestComplianceQueryErrors(t *testing.T) {
+	s := NewComplianceService(config.DefaultComplianceStandards, repository.NewMemoryRollupRepository(), repository.NewMemoryStationRepository())
+	from := time.Date(2025, time.January, 1, 0, 0, 0, 0, database.Bangkok)
+	tests := []ComplianceQuery{
+		{From: from, To: from, GroupBy: ComplianceGroupProvince},
+		{From: from, To: from.AddDate(2, 0, 0), GroupBy: ComplianceGroupProvince},
+		{From: from, To: from.AddDate(0, 1, 0), GroupBy: "week"},
+		{From: from, To: from.AddDate(0, 1, 0), GroupBy: ComplianceGroupMonth},
+		{From: from, To: from.AddDate(0, 1, 0), GroupBy: ComplianceGroupProvince, DVID: "a"},
+		{From: from, To: from.AddDate(0, 1, 0), GroupBy: ComplianceGroupProvince, Location: "CMU gate"},
+		{From: from, To: from.AddDate(0, 1, 0), GroupBy: ComplianceGroupProvince, Standards: []string{"nope"}},
+	}
+	for _, q := range tests {
+		if _, err := s.GetComplianceReport(q); !errors.Is(err, ErrInvalidComplianceQuery) {
+			t.Errorf("%+v: err = %v, want ErrInvalidComplianceQuery", q, err)
+		}
+	}
+}
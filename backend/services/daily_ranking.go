@@ -2,10 +2,11 @@
 package services
 
 import (
-	"database/sql"
 	"fmt"
+	"sort"
 	"time"
 
+	"yakkaw_dashboard/aqi"
 	"yakkaw_dashboard/database"
 )
 
@@ -17,17 +18,28 @@ type DailyRankRow struct {
 	Date   string  `json:"date"`
 	Metric string  `json:"metric"`
 	Group  string  `json:"group"`
+	// AQI rankings only: Avg is the AQI of the day's PM averages under this index
+	Index *aqi.Result `json:"aqi_index,omitempty"`
 }
 
 // GetDailyRankingGrouped จัดอันดับเฉลี่ยรายวันโดย group: address | place | province
 // dateStr: YYYY-MM-DD (ใช้ TZ Asia/Bangkok)
-func GetDailyRankingGrouped(dateStr, metric, group string, limit int) ([]DailyRankRow, error) {
+// metric=aqi จัดอันดับด้วย AQI ที่คำนวณจากค่าเฉลี่ย PM ตาม aqi.DefaultStandard (ดู GetDailyAQIRanking)
+// excludeAnomalies ตัดค่าที่ DetectAnomalies ตั้งธงไว้ออก (อ่านจาก sensor_data เสมอ เพราะ rollup ยังรวมค่าเหล่านั้นอยู่)
+func (s *ChartDataService) GetDailyRankingGrouped(dateStr, metric, group string, limit int, excludeAnomalies bool) ([]DailyRankRow, error) {
+	if metric == "aqi" {
+		std, err := aqi.Parse("")
+		if err != nil {
+			return nil, err
+		}
+		return s.GetDailyAQIRanking(dateStr, group, limit, std, excludeAnomalies)
+	}
+
 	// whitelist metric -> column
 	metricCol, ok := map[string]string{
 		"pm25":        "pm25",
 		"pm10":        "pm10",
 		"pm100":       "pm100",
-		"aqi":         "aqi",
 		"temp":        "temperature",
 		"temperature": "temperature",
 		"humidity":    "humidity",
@@ -37,85 +49,133 @@ func GetDailyRankingGrouped(dateStr, metric, group string, limit int) ([]DailyRa
 		return nil, fmt.Errorf("invalid metric")
 	}
 
-	// whitelist group -> column
-	groupCol, ok := map[string]string{
-		"address":  "address",
-		"place":    "place",
-		"province": "province", // province ถ้าไม่มีคอลัมน์ตรง แนะนำทำวิว/คอลัมน์คำนวณเอง
-	}[group]
-	if !ok {
+	// whitelist group
+	if group != "address" && group != "place" && group != "province" {
 		return nil, fmt.Errorf("invalid group")
 	}
 
-	// ถ้าในตารางไม่มีคอลัมน์ province แต่คุณต้อง derive จาก address:
-	if groupCol == "province" {
-		// สลับไปใช้ expression ที่เหมาะกับข้อมูลจริงของคุณ
-		// ตัวอย่าง derive คร่าวๆ: ชื่อจังหวัดคือคำสุดท้ายใน address
-		groupCol = "regexp_replace(trim(regexp_replace(address, '^\\s+|\\s+$', '', 'g')), '^.*\\s+', '')"
-	}
-
 	// สร้างช่วงเวลาใน TZ Bangkok
-	loc, _ := time.LoadLocation("Asia/Bangkok")
-	t, err := time.ParseInLocation("2006-01-02", dateStr, loc)
+	t, err := time.ParseInLocation("2006-01-02", dateStr, database.Bangkok)
 	if err != nil {
 		return nil, fmt.Errorf("invalid date (expect YYYY-MM-DD)")
 	}
-	start := t
-	end := t.Add(24 * time.Hour)
 
-	// SQL: เฉลี่ยรายวัน ช่วง [start, end)
-	// NOTE: metricCol/groupCol มาจาก whitelist ด้านบนเท่านั้น (safe)
-	query := fmt.Sprintf(`
-        WITH d AS (
-            SELECT
-                %s AS key,
-                AVG(NULLIF(%s,0)) AS avg_val,
-                COUNT(*)          AS cnt
-            FROM sensor_data
-            WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') >= ?
-              AND (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') <  ?
-              AND %s IS NOT NULL
-              AND %s <> ''
-            GROUP BY %s
-        )
-        SELECT key, avg_val, cnt,
-               RANK() OVER (ORDER BY avg_val DESC) AS rk
-        FROM d
-        ORDER BY rk
-        LIMIT ?;
-    `, groupCol, metricCol, groupCol, groupCol, groupCol)
+	var res []DailyRankRow
+	row := func(key string, avg float64, cnt int) DailyRankRow {
+		return DailyRankRow{Key: key, Avg: avg, Count: cnt, Date: dateStr, Metric: metric, Group: group}
+	}
+	if group != "address" && hasRollupMetric(metricCol) && !excludeAnomalies {
+		// place/province อ่านจาก rollup รายวันได้โดยตรง (ยกเว้น metric ที่ไม่ได้ rollup เช่น pm100)
+		buckets, err := s.Rollups.Day(group, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range buckets {
+			if avg, _, _, cnt, _ := b.Metric(metricCol); avg != nil && cnt > 0 {
+				res = append(res, row(b.Key, *avg, int(cnt)))
+			}
+		}
+	} else {
+		// เฉลี่ยรายวันจาก sensor_data ช่วง [t, t+24h) โดยไม่นับค่า 0
+		averages, err := s.Readings.GroupAverages(group, metricCol, t, t.Add(24*time.Hour), excludeAnomalies)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range averages {
+			r := row(a.Key, 0, a.Readings)
+			if a.Avg != nil {
+				r.Avg = *a.Avg
+			}
+			res = append(res, r)
+		}
+	}
+	return rankDaily(res, limit), nil
+}
 
-	rows, err := database.DB.Raw(query, start, end, limit).Rows()
+// rankDaily orders rows by Avg, highest first, and ranks them like RANK()
+// (ties share a rank, ties broken by key), keeping the first limit.
+func rankDaily(res []DailyRankRow, limit int) []DailyRankRow {
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Avg != res[j].Avg {
+			return res[i].Avg > res[j].Avg
+		}
+		return res[i].Key < res[j].Key
+	})
+	for i := range res {
+		res[i].Rank = i + 1
+		if i > 0 && res[i].Avg == res[i-1].Avg {
+			res[i].Rank = res[i-1].Rank
+		}
+	}
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// GetDailyAQIRanking จัดอันดับรายวันด้วย AQI ตามมาตรฐาน std ซึ่งคำนวณจากค่าเฉลี่ย PM2.5/PM10 ของวันนั้นในแต่ละ group
+// (ไม่ใช่ค่าเฉลี่ยของ aqi ที่ upstream ส่งมา) อันดับเท่ากันเมื่อ AQI เท่ากันแบบเดียวกับ RANK()
+// excludeAnomalies มีความหมายเดียวกับใน GetDailyRankingGrouped
+func (s *ChartDataService) GetDailyAQIRanking(dateStr, group string, limit int, std aqi.Standard, excludeAnomalies bool) ([]DailyRankRow, error) {
+	if group != "address" && group != "place" && group != "province" {
+		return nil, fmt.Errorf("invalid group")
+	}
+	t, err := time.ParseInLocation("2006-01-02", dateStr, database.Bangkok)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid date (expect YYYY-MM-DD)")
 	}
-	defer rows.Close()
 
-	res := make([]DailyRankRow, 0, limit)
-	for rows.Next() {
-		var key sql.NullString
-		var avg sql.NullFloat64
-		var cnt int
-		var rk int
-		if err := rows.Scan(&key, &avg, &cnt, &rk); err != nil {
+	type dayRow struct {
+		Key  string
+		PM25 *float64
+		PM10 *float64
+		Cnt  int
+	}
+	var rows []dayRow
+	if group != "address" && !excludeAnomalies {
+		buckets, err := s.Rollups.Day(group, t)
+		if err != nil {
 			return nil, err
 		}
-		row := DailyRankRow{
-			Key:    "",
-			Avg:    0,
-			Rank:   rk,
-			Count:  cnt,
-			Date:   dateStr,
-			Metric: metric,
-			Group:  group,
+		for _, b := range buckets {
+			if b.PM25Count+b.PM10Count > 0 {
+				rows = append(rows, dayRow{Key: b.Key, PM25: b.PM25Avg, PM10: b.PM10Avg, Cnt: int(b.Readings)})
+			}
 		}
-		if key.Valid {
-			row.Key = key.String
+	} else {
+		from, to := t, t.Add(24*time.Hour)
+		pm25, err := s.Readings.GroupAverages(group, "pm25", from, to, excludeAnomalies)
+		if err != nil {
+			return nil, err
+		}
+		pm10, err := s.Readings.GroupAverages(group, "pm10", from, to, excludeAnomalies)
+		if err != nil {
+			return nil, err
 		}
-		if avg.Valid {
-			row.Avg = avg.Float64
+		pm10Avg := make(map[string]*float64, len(pm10))
+		for _, a := range pm10 {
+			pm10Avg[a.Key] = a.Avg
 		}
-		res = append(res, row)
+		for _, a := range pm25 {
+			rows = append(rows, dayRow{Key: a.Key, PM25: a.Avg, PM10: pm10Avg[a.Key], Cnt: a.Readings})
+		}
+	}
+
+	res := make([]DailyRankRow, 0, len(rows))
+	for _, r := range rows {
+		index := std.Compute(aqi.PM(r.PM25, r.PM10))
+		if index.Dominant == "" {
+			continue
+		}
+		res = append(res, DailyRankRow{
+			Key:    r.Key,
+			Avg:    float64(index.AQI),
+			Count:  r.Cnt,
+			Date:   dateStr,
+			Metric: "aqi",
+			Group:  group,
+			Index:  &index,
+		})
 	}
-	return res, nil
+	return rankDaily(res, limit), nil
 }
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/aqi"
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+func TestDailyRanking(t *testing.T) {
+	day := time.Date(2025, time.January, 15, 0, 0, 0, 0, database.Bangkok)
+	avg := func(v float64) *float64 { return &v }
+	rollups := repository.NewMemoryRollupRepository()
+	rollups.AddDaily(
+		models.RollupBucket{Scope: models.RollupScopeProvince, Key: "เชียงใหม่", Bucket: time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC),
+			Readings: 300, PM25Avg: avg(40), PM25Count: 288, PM10Avg: avg(60), PM10Count: 288},
+		models.RollupBucket{Scope: models.RollupScopeProvince, Key: "ลำปาง", Bucket: time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC),
+			Readings: 200, PM25Avg: avg(55), PM25Count: 150},
+		models.RollupBucket{Scope: models.RollupScopeProvince, Key: "เชียงราย", Bucket: time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC),
+			Readings: 10},
+		// Another day.
+		models.RollupBucket{Scope: models.RollupScopeProvince, Key: "น่าน", Bucket: time.Date(2025, time.January, 16, 0, 0, 0, 0, time.UTC),
+			Readings: 10, PM25Avg: avg(90), PM25Count: 10},
+	)
+	reading := func(address string, minutes, pm25 int, anomaly bool) models.SensorData {
+		return models.SensorData{Address: address, Timestamp: day.Add(time.Duration(minutes) * time.Minute).UnixMilli(), PM25: pm25, Anomaly: anomaly}
+	}
+	readings := repository.NewMemoryReadingRepository(
+		reading("a", 10, 30, false),
+		reading("a", 20, 0, false), // a drop-out, counted but not averaged
+		reading("b", 30, 30, false),
+		reading("b", 40, 300, true),
+		reading("c", 50, 10, false),
+		reading("c", 24*60+10, 500, false), // the next day
+	)
+	s := NewChartDataService(readings, repository.NewMemorySeriesRepository(), rollups)
+
+	// Provinces are ranked from the daily rollup; a province without PM2.5 is left out.
+	rows, err := s.GetDailyRankingGrouped("2025-01-15", "pm25", "province", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Key != "ลำปาง" || rows[0].Rank != 1 || rows[0].Count != 150 || rows[1].Avg != 40 {
+		t.Errorf("provinces = %+v, want ลำปาง (55) then เชียงใหม่ (40)", rows)
+	}
+
+	// Addresses are ranked from raw readings; a and b tie without b's spike.
+	rows, err = s.GetDailyRankingGrouped("2025-01-15", "pm25", "address", 10, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Key != "a" || rows[0].Count != 2 || rows[1].Key != "b" || rows[1].Rank != 1 ||
+		rows[2].Key != "c" || rows[2].Rank != 3 || rows[2].Avg != 10 {
+		t.Errorf("addresses = %+v, want a and b tied at 30, then c", rows)
+	}
+	if rows, _ = s.GetDailyRankingGrouped("2025-01-15", "pm25", "address", 1, false); len(rows) != 1 || rows[0].Key != "b" {
+		t.Errorf("top address = %+v, want b with its spike", rows)
+	}
+
+	// AQI from the day's PM averages.
+	std, err := aqi.Parse("th")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err = s.GetDailyAQIRanking("2025-01-15", "province", 10, std, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Key != "ลำปาง" || rows[0].Index == nil || rows[1].Count != 300 {
+		t.Errorf("AQI ranking = %+v, want ลำปาง first", rows)
+	}
+
+	for _, bad := range [][3]string{{"2025-01-15", "co2", "place"}, {"2025-01-15", "pm25", "district"}, {"15/01/2025", "pm25", "place"}} {
+		if _, err := s.GetDailyRankingGrouped(bad[0], bad[1], bad[2], 10, false); err == nil {
+			t.Errorf("%v: want an error", bad)
+		}
+	}
+}
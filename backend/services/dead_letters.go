@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeadLetterFilter narrows ListDeadLetters.
+type DeadLetterFilter struct {
+	DVID   string
+	Source string
+	Limit  int
+	Offset int
+}
+
+// ListDeadLetters returns dead-lettered readings newest first with the total count.
+func ListDeadLetters(f DeadLetterFilter) ([]models.DeadLetter, int64, error) {
+	q := database.DB.Model(&models.DeadLetter{})
+	if f.DVID != "" {
+		q = q.Where("dvid = ?", f.DVID)
+	}
+	if f.Source != "" {
+		q = q.Where("source = ?", f.Source)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []models.DeadLetter
+	if err := q.Order("id DESC").Limit(f.Limit).Offset(f.Offset).Find(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+// GetDeadLetter fetches a single dead letter by ID.
+func GetDeadLetter(id uint) (models.DeadLetter, error) {
+	var row models.DeadLetter
+	err := database.DB.First(&row, id).Error
+	return row, err
+}
+
+// UpdateDeadLetter replaces the stored payload, e.g. to fix the value that
+// made the upsert fail before replaying it.
+func UpdateDeadLetter(id uint, payload models.SensorData) (models.DeadLetter, error) {
+	row, err := GetDeadLetter(id)
+	if err != nil {
+		return row, err
+	}
+	row.Payload = payload
+	row.DVID = payload.DVID
+	row.Timestamp = payload.Timestamp
+	err = database.DB.Save(&row).Error
+	return row, err
+}
+
+// ReplayDeadLetter re-submits a dead letter through the normal ingest path
+// (validation, quarantine, upsert) and deletes it on success. On failure the
+// row stays with its attempt count and error updated.
+func ReplayDeadLetter(ctx context.Context, id uint) (IngestResult, error) {
+	row, err := GetDeadLetter(id)
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	var result IngestResult
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = ingestRowsTx(tx, row.Source, []models.SensorData{row.Payload}, false)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&models.DeadLetter{}, row.ID).Error
+	})
+	if err != nil {
+		database.DB.Model(&row).Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_attempt_at": time.Now(),
+			"error":           err.Error(),
+		})
+		return result, err
+	}
+	return result, nil
+}
+
+// DeleteDeadLetter permanently deletes a dead letter.
+func DeleteDeadLetter(id uint) error {
+	result := database.DB.Delete(&models.DeadLetter{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// deadLetterRows stores rows the database refused. A reading that is already
+// a dead letter (it fails again on the next poll) counts another attempt and
+// keeps the latest error instead of adding a row.
+func deadLetterRows(tx *gorm.DB, source string, failed []FailedRow) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	type key struct {
+		dvid      string
+		timestamp int64
+	}
+	now := time.Now()
+	seen := make(map[key]int, len(failed))
+	rows := make([]models.DeadLetter, 0, len(failed))
+	for _, f := range failed {
+		// One statement cannot upsert the same row twice; the last copy wins.
+		k := key{f.Row.DVID, f.Row.Timestamp}
+		if i, ok := seen[k]; ok {
+			rows[i].Error, rows[i].Payload = f.Err.Error(), f.Row
+			continue
+		}
+		seen[k] = len(rows)
+		rows = append(rows, models.DeadLetter{
+			Source:        source,
+			DVID:          f.Row.DVID,
+			Timestamp:     f.Row.Timestamp,
+			Error:         f.Err.Error(),
+			Payload:       f.Row,
+			Attempts:      1,
+			LastAttemptAt: now,
+		})
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "source"}, {Name: "dvid"}, {Name: "timestamp"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"attempts":        gorm.Expr("dead_letters.attempts + 1"),
+			"last_attempt_at": gorm.Expr("EXCLUDED.last_attempt_at"),
+			"error":           gorm.Expr("EXCLUDED.error"),
+			"updated_at":      gorm.Expr("EXCLUDED.updated_at"),
+		}),
+	}).CreateInBatches(&rows, 500).Error
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+
+	"gorm.io/gorm"
+)
+
+const deviceKeyPrefix = "ykw_"
+
+// ErrInvalidDeviceKey is returned for unknown or revoked device API keys.
+var ErrInvalidDeviceKey = errors.New("invalid device api key")
+
+// CreateDeviceAPIKey issues a new key for an existing device. The plaintext
+// key is only returned here; it cannot be recovered later.
+func CreateDeviceAPIKey(dvid, label string) (string, models.DeviceAPIKey, error) {
+	if _, err := repository.NewDeviceRepository(database.DB).FindByDVID(dvid); err != nil {
+		return "", models.DeviceAPIKey{}, err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", models.DeviceAPIKey{}, err
+	}
+	plain := deviceKeyPrefix + hex.EncodeToString(b)
+
+	key := models.DeviceAPIKey{
+		DVID:    dvid,
+		Label:   label,
+		Prefix:  plain[:len(deviceKeyPrefix)+8],
+		KeyHash: hashDeviceKey(plain),
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		return "", models.DeviceAPIKey{}, err
+	}
+	return plain, key, nil
+}
+
+// ListDeviceAPIKeys returns all keys (including revoked ones) for a device.
+func ListDeviceAPIKeys(dvid string) ([]models.DeviceAPIKey, error) {
+	var keys []models.DeviceAPIKey
+	err := database.DB.Where("dvid = ?", dvid).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeDeviceAPIKey disables a key; revoked keys stay listed for audit.
+func RevokeDeviceAPIKey(dvid string, id uint) error {
+	now := time.Now()
+	result := database.DB.Model(&models.DeviceAPIKey{}).
+		Where("id = ? AND dvid = ? AND revoked_at IS NULL", id, dvid).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AuthenticateDeviceKey resolves a plaintext key to its active record.
+func AuthenticateDeviceKey(plain string) (models.DeviceAPIKey, error) {
+	var key models.DeviceAPIKey
+	err := database.DB.Where("key_hash = ? AND revoked_at IS NULL", hashDeviceKey(plain)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return key, ErrInvalidDeviceKey
+	}
+	if err != nil {
+		return key, err
+	}
+
+	// Record usage at most once a minute to avoid a write per request.
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		database.DB.Model(&key).Update("last_used_at", now)
+	}
+	return key, nil
+}
+
+func hashDeviceKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// FillFromDevice copies registered station metadata onto pushed readings that
+// omit it, so a lean gateway payload does not blank out place/address.
+func FillFromDevice(rows []models.SensorData, device models.Device) {
+	for i := range rows {
+		r := &rows[i]
+		if r.Place == "" {
+			r.Place = device.Place
+		}
+		if r.Address == "" {
+			r.Address = device.Address
+		}
+		if r.Latitude == 0 && r.Longitude == 0 {
+			r.Latitude, r.Longitude = device.Latitude, device.Longitude
+		}
+		if r.Model == "" {
+			r.Model = device.Models
+		}
+		if r.ContactName == "" {
+			r.ContactName = device.ContactName
+		}
+		if r.ContactPhone == "" {
+			r.ContactPhone = device.ContactPhone
+		}
+		if r.DeployDate == "" && !device.DeployDate.IsZero() {
+			r.DeployDate = device.DeployDate.Format("2006-01-02")
+		}
+	}
+}
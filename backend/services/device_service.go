@@ -1,52 +1,68 @@
 package services
 
 import (
+	"log"
 	"time"
-	"yakkaw_dashboard/database"
 	"yakkaw_dashboard/models"
-	"gorm.io/gorm"
+	"yakkaw_dashboard/repository"
 )
 
-func CreateDevice(device models.Device) (models.Device, error) {
+type DeviceService struct {
+	Devices  repository.DeviceRepository
+	Stations repository.StationRepository
+}
+
+// NewDeviceService creates a new DeviceService instance
+func NewDeviceService(devices repository.DeviceRepository, stations repository.StationRepository) *DeviceService {
+	return &DeviceService{Devices: devices, Stations: stations}
+}
+
+func (s *DeviceService) CreateDevice(device models.Device) (models.Device, error) {
 	// ตั้งค่า deploy_date เป็นเวลาปัจจุบันถ้าไม่มีการตั้งค่า
 	if device.DeployDate.IsZero() {
 		device.DeployDate = time.Now()
 	}
 
 	// สร้าง device ในฐานข้อมูล
-	if err := database.DB.Create(&device).Error; err != nil {
+	if err := s.Devices.Create(&device); err != nil {
 		return models.Device{}, err
 	}
 	return device, nil
 }
 
-func GetDeviceByDVID(dvid string) (models.Device, error) {
-    var device models.Device
-    if err := database.DB.Where("dv_id = ?", dvid).First(&device).Error; err != nil {
-        if err == gorm.ErrRecordNotFound {
-            return device, gorm.ErrRecordNotFound
-        }
-        return device, err
-    }
-    return device, nil
+// GetDeviceByDVID returns gorm.ErrRecordNotFound for an unknown (or soft
+// deleted) device.
+func (s *DeviceService) GetDeviceByDVID(dvid string) (models.Device, error) {
+	return s.Devices.FindByDVID(dvid)
 }
 
-func GetAllDevices() ([]models.Device, error) {
-	var devices []models.Device
-	if err := database.DB.Find(&devices).Error; err != nil {
-		return nil, err
-	}
-	return devices, nil
+func (s *DeviceService) GetAllDevices() ([]models.Device, error) {
+	return s.Devices.List()
 }
 
-func UpdateDevice(dvid string, device models.Device) (models.Device, error) {
-	var existingDevice models.Device
-	// ค้นหาข้อมูล device ที่มี DVID ตรงกัน (รวม soft deleted ถ้าต้องการ)
-	err := database.DB.Where("dv_id = ?", dvid).First(&existingDevice).Error
+// AttachDrift sets each device's latest drift result for the device read
+// handlers. Devices are left without it when the lookup fails.
+func (s *DeviceService) AttachDrift(devices []models.Device) {
+	dvids := make([]string, 0, len(devices))
+	for _, d := range devices {
+		dvids = append(dvids, d.DVID)
+	}
+	drifts, err := s.Stations.Drift(dvids...)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return models.Device{}, gorm.ErrRecordNotFound // แจ้งชัดเจนว่าไม่พบ record (อาจถูกลบแบบ soft delete)
+		log.Printf("devices: drift lookup failed: %v", err)
+		return
+	}
+	for i := range devices {
+		if d, ok := drifts[devices[i].DVID]; ok {
+			devices[i].Drift = &d
 		}
+	}
+}
+
+func (s *DeviceService) UpdateDevice(dvid string, device models.Device) (models.Device, error) {
+	// ค้นหาข้อมูล device ที่มี DVID ตรงกัน; gorm.ErrRecordNotFound แจ้งชัดเจนว่าไม่พบ record (อาจถูกลบแบบ soft delete)
+	existingDevice, err := s.Devices.FindByDVID(dvid)
+	if err != nil {
 		return models.Device{}, err
 	}
 
@@ -67,16 +83,13 @@ func UpdateDevice(dvid string, device models.Device) (models.Device, error) {
 	}
 
 	// บันทึกการอัปเดตข้อมูล
-	if err := database.DB.Save(&existingDevice).Error; err != nil {
+	if err := s.Devices.Save(&existingDevice); err != nil {
 		return models.Device{}, err
 	}
 
 	return existingDevice, nil
 }
 
-func DeleteDevice(id uint) error {
-	if err := database.DB.Delete(&models.Device{}, id).Error; err != nil {
-		return err
-	}
-	return nil
+func (s *DeviceService) DeleteDevice(id uint) error {
+	return s.Devices.Delete(id)
 }
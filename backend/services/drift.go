@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"yakkaw_dashboard/cache"
+	"yakkaw_dashboard/config"
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+const (
+	// driftMinDayReadings is how many PM2.5 readings a station-day needs to
+	// count, so days the station was mostly offline are left out.
+	driftMinDayReadings = 24
+	// driftMinReference skips days whose neighbourhood median is below this
+	// (µg/m³), where ratios are dominated by noise.
+	driftMinReference = 5.0
+	earthRadiusKM     = 6371.0
+)
+
+// DriftOptions tune the neighbour comparison (see config.Config).
+type DriftOptions struct {
+	RadiusKM      float64
+	WindowDays    int
+	MinNeighbours int
+	MinDays       int
+	Threshold     float64
+}
+
+// DriftOptionsFromConfig reads the drift settings of cfg.
+func DriftOptionsFromConfig(cfg *config.Config) DriftOptions {
+	return DriftOptions{
+		RadiusKM:      cfg.DriftRadiusKM,
+		WindowDays:    cfg.DriftWindowDays,
+		MinNeighbours: cfg.DriftMinNeighbours,
+		MinDays:       cfg.DriftMinDays,
+		Threshold:     cfg.DriftThreshold,
+	}
+}
+
+// DriftReport counts the stations a drift check looked at, those with enough
+// overlapping days to be scored, and those flagged.
+type DriftReport struct {
+	Stations int `json:"stations"`
+	Scored   int `json:"scored"`
+	Flagged  int `json:"flagged"`
+}
+
+// DetectDrift compares each station's daily PM2.5 means over the opts.WindowDays
+// days before until with the median of the other stations within
+// opts.RadiusKM on the same day, and replaces the stored drift results.
+// Only days where at least opts.MinNeighbours neighbours have a mean count,
+// and a station needs opts.MinDays of them to be scored. A station is flagged
+// when its median ratio to its neighbours is off by more than opts.Threshold
+// ("bias"), or would be after another 30 days of its trend ("trend").
+func DetectDrift(stations repository.StationRepository, opts DriftOptions, until time.Time) (DriftReport, error) {
+	var report DriftReport
+	located, err := stations.Located()
+	if err != nil {
+		return report, err
+	}
+	report.Stations = len(located)
+
+	to := bangkokDay(until)
+	from := to.AddDate(0, 0, -opts.WindowDays)
+	days, err := stations.DailyPM25(from, to, driftMinDayReadings)
+	if err != nil {
+		return report, err
+	}
+
+	means := make(map[string]map[string]float64)
+	for _, d := range days {
+		if means[d.DVID] == nil {
+			means[d.DVID] = make(map[string]float64)
+		}
+		means[d.DVID][d.Day.Format("2006-01-02")] = d.PM25
+	}
+
+	now := time.Now()
+	var results []models.StationDrift
+	for _, s := range located {
+		var neighbours []models.Station
+		for _, n := range located {
+			if n.DVID != s.DVID && haversineKM(s.Latitude, s.Longitude, n.Latitude, n.Longitude) <= opts.RadiusKM {
+				neighbours = append(neighbours, n)
+			}
+		}
+		r, ok := stationDrift(s.DVID, means, neighbours, from, opts)
+		if !ok {
+			continue
+		}
+		r.WindowFrom, r.WindowTo, r.ComputedAt = from, to, now
+		results = append(results, r)
+		if r.Flagged {
+			report.Flagged++
+		}
+	}
+	report.Scored = len(results)
+
+	return report, stations.ReplaceDrift(results)
+}
+
+// stationDrift scores station dvid against neighbours from the daily means;
+// it is false when fewer than opts.MinDays days could be compared.
+func stationDrift(dvid string, means map[string]map[string]float64, neighbours []models.Station, from time.Time, opts DriftOptions) (models.StationDrift, bool) {
+	type point struct {
+		day   float64 // days since from
+		ratio float64
+		diff  float64
+	}
+	var points []point
+	contributed := make(map[string]bool)
+	for day, v := range means[dvid] {
+		var ref []float64
+		var refs []string
+		for _, n := range neighbours {
+			if nv, ok := means[n.DVID][day]; ok {
+				ref = append(ref, nv)
+				refs = append(refs, n.DVID)
+			}
+		}
+		if len(ref) < opts.MinNeighbours {
+			continue
+		}
+		median := medianOf(ref)
+		if median < driftMinReference {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", day, database.Bangkok)
+		if err != nil {
+			continue
+		}
+		points = append(points, point{
+			day:   t.Sub(from).Hours() / 24,
+			ratio: v / median,
+			diff:  v - median,
+		})
+		for _, n := range refs {
+			contributed[n] = true
+		}
+	}
+	if len(points) < opts.MinDays {
+		return models.StationDrift{}, false
+	}
+
+	ratios := make([]float64, len(points))
+	var sumDiff, sumX, sumY float64
+	for i, p := range points {
+		ratios[i] = p.ratio
+		sumDiff += p.diff
+		sumX += p.day
+		sumY += p.ratio
+	}
+	n := float64(len(points))
+	// Least-squares slope of the daily ratio.
+	meanX, meanY := sumX/n, sumY/n
+	var sxy, sxx float64
+	for _, p := range points {
+		sxy += (p.day - meanX) * (p.ratio - meanY)
+		sxx += (p.day - meanX) * (p.day - meanX)
+	}
+	slope := 0.0
+	if sxx > 0 {
+		slope = sxy / sxx
+	}
+
+	ratio := medianOf(ratios)
+	r := models.StationDrift{
+		DVID:       dvid,
+		Days:       len(points),
+		Neighbours: len(contributed),
+		Ratio:      round3(ratio),
+		Score:      round3(ratio - 1),
+		MeanDiff:   round3(sumDiff / n),
+		Trend:      round3(slope * 30),
+	}
+	switch {
+	case math.Abs(r.Score) > opts.Threshold:
+		r.Flagged, r.Reason = true, "bias"
+	case math.Abs(r.Score+r.Trend) > opts.Threshold:
+		r.Flagged, r.Reason = true, "trend"
+	}
+	return r, true
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// haversineKM is the great-circle distance between two points in km.
+func haversineKM(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKM * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// RunDriftDetection runs DetectDrift with the configured options up to now.
+func RunDriftDetection(ctx context.Context, cfg *config.Config) {
+	stations := repository.NewStationRepository(database.DB.WithContext(ctx))
+	rep, err := DetectDrift(stations, DriftOptionsFromConfig(cfg), time.Now())
+	if err != nil {
+		log.Printf("drift: detection failed: %v", err)
+		return
+	}
+	log.Printf("drift: scored %d of %d stations, %d flagged for recalibration", rep.Scored, rep.Stations, rep.Flagged)
+}
+
+// NewDriftScheduler runs RunDriftDetection on the leader replica.
+func NewDriftScheduler(cfg *config.Config) *Scheduler {
+	return &Scheduler{
+		Name:     "drift",
+		Interval: cfg.DriftInterval,
+		Lock:     cache.NewLock("drift:leader", 2*cfg.DriftInterval),
+		Job: func(ctx context.Context) {
+			RunDriftDetection(ctx, cfg)
+		},
+	}
+}
+
+// DriftFilter selects stations for the admin drift report.
+type DriftFilter struct {
+	FlaggedOnly bool
+	Limit       int
+	Offset      int
+}
+
+// ListDrift returns the latest drift results, flagged stations first and then
+// by the size of their score, with their total.
+func (s *StationService) ListDrift(f DriftFilter) ([]models.StationDrift, int64, error) {
+	return s.Stations.ListDrift(f.FlaggedOnly, f.Limit, f.Offset)
+}
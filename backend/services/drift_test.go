@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+func TestDetectDrift(t *testing.T) {
+	until := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	stations := repository.NewMemoryStationRepository(
+		models.Station{DVID: "a", Latitude: 18.79, Longitude: 98.95, Place: "A"},
+		models.Station{DVID: "b", Latitude: 18.80, Longitude: 98.96, Place: "B"},
+		models.Station{DVID: "c", Latitude: 18.78, Longitude: 98.94, Place: "C"},
+		models.Station{DVID: "d", Latitude: 18.81, Longitude: 98.97, Place: "D"},
+		// Bangkok has no neighbours within the radius.
+		models.Station{DVID: "e", Latitude: 13.75, Longitude: 100.50, Place: "E"},
+		// No coordinates: not a candidate.
+		models.Station{DVID: "f", Place: "F"},
+	)
+	today := bangkokDay(until)
+	for i := 1; i <= 20; i++ {
+		day := today.AddDate(0, 0, -i)
+		base := 20 + float64(i%7)
+		stations.AddDaily(
+			repository.DailyMean{DVID: "a", Day: day, PM25: base, Readings: 24},
+			repository.DailyMean{DVID: "b", Day: day, PM25: base * 1.05, Readings: 24},
+			repository.DailyMean{DVID: "c", Day: day, PM25: base * 0.95, Readings: 24},
+			// d reads half again as high as its neighbours.
+			repository.DailyMean{DVID: "d", Day: day, PM25: base * 1.5, Readings: 24},
+			repository.DailyMean{DVID: "e", Day: day, PM25: base, Readings: 24},
+		)
+	}
+	// A mostly offline day is left out even though it would skew d.
+	stations.AddDaily(repository.DailyMean{DVID: "d", Day: today.AddDate(0, 0, -21), PM25: 500, Readings: 3})
+
+	opts := DriftOptions{RadiusKM: 15, WindowDays: 30, MinNeighbours: 2, MinDays: 14, Threshold: 0.3}
+	rep, err := DetectDrift(stations, opts, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep != (DriftReport{Stations: 5, Scored: 4, Flagged: 1}) {
+		t.Errorf("report = %+v, want 5 stations, 4 scored, 1 flagged", rep)
+	}
+
+	drifts, _ := stations.Drift("a", "d", "e")
+	d, ok := drifts["d"]
+	if !ok || !d.Flagged || d.Reason != "bias" || d.Days != 20 || d.Neighbours != 3 {
+		t.Errorf("d = %+v, want flagged for bias over 20 days and 3 neighbours", d)
+	}
+	if d.Ratio < 1.4 || d.Ratio > 1.6 || d.Trend != 0 {
+		t.Errorf("d ratio = %v, trend = %v; want about 1.5 and no trend", d.Ratio, d.Trend)
+	}
+	// a's neighbour median is b's, which reads 5% higher.
+	if a := drifts["a"]; a.Flagged || a.Ratio != 0.952 {
+		t.Errorf("a = %+v, want ratio 0.952 and not flagged", a)
+	}
+	if _, ok := drifts["e"]; ok {
+		t.Error("e was scored without neighbours")
+	}
+
+	// The admin report lists flagged stations first, with their place.
+	rows, total, err := NewStationService(stations, nil).ListDrift(DriftFilter{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 4 || len(rows) != 2 || rows[0].DVID != "d" || rows[0].Place != "D" {
+		t.Errorf("ListDrift = %+v (total %d), want d first of 4", rows, total)
+	}
+	rows, total, _ = NewStationService(stations, nil).ListDrift(DriftFilter{FlaggedOnly: true, Limit: 10})
+	if total != 1 || len(rows) != 1 {
+		t.Errorf("flagged only = %+v (total %d), want just d", rows, total)
+	}
+}
+
+func TestAttachDrift(t *testing.T) {
+	stations := repository.NewMemoryStationRepository()
+	stations.SetDrift(models.StationDrift{DVID: "a", Flagged: true, Reason: "trend"})
+	s := NewDeviceService(repository.NewMemoryDeviceRepository(), stations)
+
+	devices := []models.Device{{DVID: "a"}, {DVID: "b"}}
+	s.AttachDrift(devices)
+	if devices[0].Drift == nil || devices[0].Drift.Reason != "trend" {
+		t.Errorf("a drift = %+v, want the stored result", devices[0].Drift)
+	}
+	if devices[1].Drift != nil {
+		t.Errorf("b drift = %+v, want none", devices[1].Drift)
+	}
+}
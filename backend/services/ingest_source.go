@@ -0,0 +1,465 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/config"
+	"yakkaw_dashboard/models"
+)
+
+// Source is anything the ingest pipeline can pull sensor readings from.
+type Source interface {
+	// Name identifies the source in logs and pipeline history.
+	Name() string
+	// Fetch performs one round-trip to the upstream and decodes its readings.
+	Fetch(ctx context.Context) (FetchResult, error)
+}
+
+// FetchResult is the outcome of a single Source.Fetch.
+type FetchResult struct {
+	Rows []models.SensorData
+	// StatusCode is the upstream HTTP status (0 for non-HTTP sources).
+	StatusCode int
+	// Attempts is the number of HTTP requests made, including retries.
+	Attempts int
+	// Raw is the last response body as received, kept for the payload
+	// archive; nil for non-HTTP sources.
+	Raw *RawResponse
+}
+
+// RawResponse is an upstream body with the metadata needed to archive it.
+type RawResponse struct {
+	URL         string
+	Body        []byte
+	ContentType string
+	FetchedAt   time.Time
+}
+
+// PayloadDecoder is implemented by sources whose archived raw payloads can be
+// decoded again, e.g. by the reprocess command after a parsing fix.
+type PayloadDecoder interface {
+	Decode(body []byte) ([]models.SensorData, error)
+}
+
+func rawResponse(url string, res FetchResponse) *RawResponse {
+	if res.Body == nil {
+		return nil
+	}
+	return &RawResponse{URL: url, Body: res.Body, ContentType: res.ContentType, FetchedAt: res.FetchedAt}
+}
+
+const defaultSourceTimeout = 30 * time.Second
+
+// SourcesFromConfig builds the built-in Yakkaw source plus every source
+// declared in cfg.IngestSources.
+func SourcesFromConfig(cfg *config.Config) ([]Source, error) {
+	opts := UpstreamOptionsFromConfig(cfg)
+	sources := []Source{NewYakkawSource("yakkaw", cfg.DevicesAPIURL, opts)}
+	seen := map[string]bool{"yakkaw": true}
+
+	for _, sc := range cfg.IngestSources {
+		if sc.Name == "" {
+			return nil, fmt.Errorf("ingest source without a name")
+		}
+		if seen[sc.Name] {
+			return nil, fmt.Errorf("duplicate ingest source %q", sc.Name)
+		}
+		seen[sc.Name] = true
+
+		src, err := NewSource(sc, opts)
+		if err != nil {
+			return nil, fmt.Errorf("ingest source %q: %w", sc.Name, err)
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// NewSource builds a single Source from its configuration. A per-source
+// timeout overrides opts.Timeout.
+func NewSource(sc config.IngestSourceConfig, opts UpstreamOptions) (Source, error) {
+	if sc.Timeout > 0 {
+		opts.Timeout = sc.Timeout
+	}
+	switch strings.ToLower(sc.Type) {
+	case "yakkaw":
+		if sc.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		src := NewYakkawSource(sc.Name, sc.URL, opts)
+		src.headers = sc.Headers
+		return src, nil
+	case "http":
+		if sc.URL == "" {
+			return nil, fmt.Errorf("url is required")
+		}
+		return NewHTTPSource(sc, opts), nil
+	case "file":
+		if sc.Path == "" {
+			return nil, fmt.Errorf("path is required")
+		}
+		return NewFileSource(sc.Name, sc.Path, sc.Format), nil
+	default:
+		return nil, fmt.Errorf("unknown source type %q", sc.Type)
+	}
+}
+
+// ---------- Yakkaw devices API ----------
+
+// YakkawSource reads the native Yakkaw devices endpoint (models.APIResponse).
+type YakkawSource struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *UpstreamClient
+}
+
+func NewYakkawSource(name, apiURL string, opts UpstreamOptions) *YakkawSource {
+	return &YakkawSource{name: name, url: apiURL, client: NewUpstreamClient(name, opts)}
+}
+
+func (s *YakkawSource) Name() string { return s.name }
+
+func (s *YakkawSource) Fetch(ctx context.Context) (FetchResult, error) {
+	var rows []models.SensorData
+	res, err := s.client.Fetch(ctx, s.url, s.headers, func(body []byte) error {
+		var err error
+		rows, err = s.Decode(body)
+		return err
+	})
+	return FetchResult{Rows: rows, StatusCode: res.StatusCode, Attempts: res.Attempts, Raw: rawResponse(s.url, res)}, err
+}
+
+func (s *YakkawSource) Decode(body []byte) ([]models.SensorData, error) {
+	return decodeAPIResponse(body)
+}
+
+// decodeAPIResponse unwraps a models.APIResponse envelope. An envelope with
+// a status other than 200 or a non-empty error is reported as an
+// UpstreamEnvelopeError rather than silently yielding zero rows.
+func decodeAPIResponse(body []byte) ([]models.SensorData, error) {
+	var apiResp models.APIResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, fmt.Errorf("decode upstream response: %w", err)
+	}
+	msg := envelopeErrorMessage(apiResp.Error)
+	if (apiResp.Status != 0 && apiResp.Status != http.StatusOK) || msg != "" {
+		if msg == "" {
+			msg = http.StatusText(apiResp.Status)
+		}
+		return nil, &UpstreamEnvelopeError{Status: apiResp.Status, Message: msg}
+	}
+	return apiResp.Response, nil
+}
+
+// envelopeErrorMessage normalises APIResponse.Error, which upstreams send as
+// null, false, "", a string or an object.
+func envelopeErrorMessage(v interface{}) string {
+	switch e := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		if e {
+			return "error"
+		}
+		return ""
+	case string:
+		return strings.TrimSpace(e)
+	default:
+		b, _ := json.Marshal(e)
+		if s := string(b); s != "{}" && s != "[]" {
+			return s
+		}
+		return ""
+	}
+}
+
+// ---------- Generic HTTP upstream ----------
+
+// HTTPSource reads an arbitrary JSON upstream and maps its records onto
+// models.SensorData using the configured field map.
+type HTTPSource struct {
+	name        string
+	url         string
+	headers     map[string]string
+	client      *UpstreamClient
+	recordsPath string
+	fieldMap    map[string]string
+}
+
+func NewHTTPSource(sc config.IngestSourceConfig, opts UpstreamOptions) *HTTPSource {
+	return &HTTPSource{
+		name:        sc.Name,
+		url:         sc.URL,
+		headers:     sc.Headers,
+		client:      NewUpstreamClient(sc.Name, opts),
+		recordsPath: sc.RecordsPath,
+		fieldMap:    sc.FieldMap,
+	}
+}
+
+func (s *HTTPSource) Name() string { return s.name }
+
+func (s *HTTPSource) Fetch(ctx context.Context) (FetchResult, error) {
+	var rows []models.SensorData
+	res, err := s.client.Fetch(ctx, s.url, s.headers, func(body []byte) error {
+		var err error
+		rows, err = s.Decode(body)
+		return err
+	})
+	return FetchResult{Rows: rows, StatusCode: res.StatusCode, Attempts: res.Attempts, Raw: rawResponse(s.url, res)}, err
+}
+
+func (s *HTTPSource) Decode(body []byte) ([]models.SensorData, error) {
+	return decodeMappedRecords(body, s.recordsPath, s.fieldMap)
+}
+
+// ---------- Local file replay ----------
+
+// FileSource replays a recorded payload from disk. JSON files may hold either
+// a models.APIResponse envelope or a bare array of readings; NDJSON files hold
+// one reading per line.
+type FileSource struct {
+	name   string
+	path   string
+	format string
+}
+
+func NewFileSource(name, path, format string) *FileSource {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ndjson", ".jsonl":
+			format = "ndjson"
+		default:
+			format = "json"
+		}
+	}
+	return &FileSource{name: name, path: path, format: strings.ToLower(format)}
+}
+
+func (s *FileSource) Name() string { return s.name }
+
+func (s *FileSource) Fetch(ctx context.Context) (FetchResult, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return FetchResult{}, err
+	}
+	defer f.Close()
+
+	var rows []models.SensorData
+	switch s.format {
+	case "ndjson":
+		rows, err = decodeNDJSON(ctx, f)
+	case "json":
+		rows, err = decodeJSONReadings(f)
+	default:
+		err = fmt.Errorf("unsupported file format %q", s.format)
+	}
+	if err != nil {
+		return FetchResult{}, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return FetchResult{Rows: rows}, nil
+}
+
+func decodeJSONReadings(r io.Reader) ([]models.SensorData, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var rows []models.SensorData
+		err := json.Unmarshal(body, &rows)
+		return rows, err
+	}
+
+	var apiResp models.APIResponse
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return nil, err
+	}
+	return apiResp.Response, nil
+}
+
+func decodeNDJSON(ctx context.Context, r io.Reader) ([]models.SensorData, error) {
+	var rows []models.SensorData
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if line%10000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var row models.SensorData
+		if err := json.Unmarshal(text, &row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// ---------- helpers ----------
+
+// decodeMappedRecords walks to recordsPath inside body and converts every
+// record into a SensorData via fieldMap.
+func decodeMappedRecords(body []byte, recordsPath string, fieldMap map[string]string) ([]models.SensorData, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var root interface{}
+	if err := dec.Decode(&root); err != nil {
+		return nil, err
+	}
+
+	node, ok := lookupPath(root, recordsPath)
+	if !ok {
+		return nil, fmt.Errorf("records path %q not found", recordsPath)
+	}
+	records, ok := node.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("records path %q is not an array", recordsPath)
+	}
+
+	rows := make([]models.SensorData, 0, len(records))
+	for i, rec := range records {
+		row, err := mapRecord(rec, fieldMap)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// lookupPath resolves a dotted path ("a.b.0.c") inside decoded JSON.
+func lookupPath(node interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return node, true
+	}
+	for _, part := range strings.Split(path, ".") {
+		switch v := node.(type) {
+		case map[string]interface{}:
+			next, ok := v[part]
+			if !ok {
+				return nil, false
+			}
+			node = next
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, false
+			}
+			node = v[idx]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// sensorDataFields lists the JSON name and struct index of every mappable
+// SensorData field.
+var sensorDataFields = func() map[string]int {
+	t := reflect.TypeOf(models.SensorData{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = i
+	}
+	return fields
+}()
+
+func mapRecord(rec interface{}, fieldMap map[string]string) (models.SensorData, error) {
+	var row models.SensorData
+	rv := reflect.ValueOf(&row).Elem()
+
+	for name, idx := range sensorDataFields {
+		path := name
+		if mapped, ok := fieldMap[name]; ok {
+			path = mapped
+		}
+		val, ok := lookupPath(rec, path)
+		if !ok || val == nil {
+			continue
+		}
+		if err := assignField(rv.Field(idx), name, val); err != nil {
+			return row, fmt.Errorf("field %s (%s): %w", name, path, err)
+		}
+	}
+	return row, nil
+}
+
+func assignField(field reflect.Value, name string, val interface{}) error {
+	switch field.Kind() {
+	case reflect.String:
+		switch v := val.(type) {
+		case string:
+			field.SetString(v)
+		case json.Number:
+			field.SetString(v.String())
+		case bool:
+			field.SetString(strconv.FormatBool(v))
+		default:
+			return fmt.Errorf("cannot use %T as string", val)
+		}
+	case reflect.Float64:
+		f, err := toFloat(val)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Int, reflect.Int64:
+		if s, ok := val.(string); ok && name == "timestamp" {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				field.SetInt(t.UnixMilli())
+				return nil
+			}
+		}
+		f, err := toFloat(val)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(math.Round(f)))
+	default:
+		return fmt.Errorf("unsupported field kind %s", field.Kind())
+	}
+	return nil
+}
+
+func toFloat(val interface{}) (float64, error) {
+	switch v := val.(type) {
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("cannot use %T as number", val)
+	}
+}
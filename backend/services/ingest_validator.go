@@ -0,0 +1,96 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"yakkaw_dashboard/models"
+)
+
+// maxClockSkew tolerates upstream clocks running slightly ahead of ours.
+const maxClockSkew = 5 * time.Minute
+
+// ValidationRule rejects a reading when Check returns a non-empty reason.
+type ValidationRule struct {
+	Name  string
+	Check func(d models.SensorData, now time.Time) string
+}
+
+// DefaultValidationRules are applied to every reading on the ingest path.
+var DefaultValidationRules = []ValidationRule{
+	{Name: "missing_key", Check: func(d models.SensorData, _ time.Time) string {
+		if d.DVID == "" || d.Timestamp <= 0 {
+			return "dvid and timestamp are required"
+		}
+		return ""
+	}},
+	{Name: "pm25_negative", Check: func(d models.SensorData, _ time.Time) string {
+		if d.PM25 < 0 {
+			return fmt.Sprintf("pm25 %d is negative", d.PM25)
+		}
+		return ""
+	}},
+	{Name: "pm25_out_of_range", Check: func(d models.SensorData, _ time.Time) string {
+		if d.PM25 > 1000 {
+			return fmt.Sprintf("pm25 %d exceeds 1000", d.PM25)
+		}
+		return ""
+	}},
+	{Name: "humidity_out_of_range", Check: func(d models.SensorData, _ time.Time) string {
+		if d.Humidity < 0 || d.Humidity > 100 {
+			return fmt.Sprintf("humidity %d is outside 0..100", d.Humidity)
+		}
+		return ""
+	}},
+	{Name: "timestamp_in_future", Check: func(d models.SensorData, now time.Time) string {
+		if t := time.UnixMilli(d.Timestamp); t.After(now.Add(maxClockSkew)) {
+			return fmt.Sprintf("timestamp %s is in the future", t.UTC().Format(time.RFC3339))
+		}
+		return ""
+	}},
+	// Readings without coordinates have already been filled from their
+	// station (see fillFromStations), so this only catches unknown stations.
+	{Name: "zero_coordinates", Check: func(d models.SensorData, _ time.Time) string {
+		if d.Latitude == 0 || d.Longitude == 0 {
+			return fmt.Sprintf("coordinates (%g, %g) are not set", d.Latitude, d.Longitude)
+		}
+		return ""
+	}},
+}
+
+// Rejection is a reading that failed the first matching rule.
+type Rejection struct {
+	Row    models.SensorData
+	Rule   string
+	Reason string
+}
+
+// Validator splits readings into accepted rows and rejections.
+type Validator struct {
+	Rules []ValidationRule
+	Now   func() time.Time
+}
+
+// NewValidator returns a Validator with the default rules.
+func NewValidator() *Validator {
+	return &Validator{Rules: DefaultValidationRules, Now: time.Now}
+}
+
+// Split checks every row against the rules in order.
+func (v *Validator) Split(rows []models.SensorData) ([]models.SensorData, []Rejection) {
+	now := v.Now()
+	valid := make([]models.SensorData, 0, len(rows))
+	var rejected []Rejection
+
+rows:
+	for _, row := range rows {
+		for _, rule := range v.Rules {
+			if reason := rule.Check(row, now); reason != "" {
+				rejected = append(rejected, Rejection{Row: row, Rule: rule.Name, Reason: reason})
+				continue rows
+			}
+		}
+		valid = append(valid, row)
+	}
+	return valid, rejected
+}
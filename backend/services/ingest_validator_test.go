@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/models"
+)
+
+func TestValidatorSplit(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	v := &Validator{Rules: DefaultValidationRules, Now: func() time.Time { return now }}
+	ts := now.Add(-time.Hour).UnixMilli()
+	row := func(mod func(*models.SensorData)) models.SensorData {
+		d := models.SensorData{DVID: "a", Timestamp: ts, Latitude: 18.79, Longitude: 98.95, PM25: 20, Humidity: 60}
+		if mod != nil {
+			mod(&d)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name string
+		row  models.SensorData
+		rule string
+	}{
+		{"valid", row(nil), ""},
+		{"missing dvid", row(func(d *models.SensorData) { d.DVID = "" }), "missing_key"},
+		{"negative pm25", row(func(d *models.SensorData) { d.PM25 = -1 }), "pm25_negative"},
+		{"pm25 above 1000", row(func(d *models.SensorData) { d.PM25 = 1001 }), "pm25_out_of_range"},
+		{"humidity above 100", row(func(d *models.SensorData) { d.Humidity = 101 }), "humidity_out_of_range"},
+		{"clock skew tolerated", row(func(d *models.SensorData) { d.Timestamp = now.Add(maxClockSkew).UnixMilli() }), ""},
+		{"future timestamp", row(func(d *models.SensorData) { d.Timestamp = now.Add(time.Hour).UnixMilli() }), "timestamp_in_future"},
+		{"no coordinates", row(func(d *models.SensorData) { d.Latitude, d.Longitude = 0, 0 }), "zero_coordinates"},
+		{"half coordinates", row(func(d *models.SensorData) { d.Longitude = 0 }), "zero_coordinates"},
+	}
+	for _, tt := range tests {
+		valid, rejected := v.Split([]models.SensorData{tt.row})
+		switch {
+		case tt.rule == "" && (len(valid) != 1 || len(rejected) != 0):
+			t.Errorf("%s: rejected %+v, want accepted", tt.name, rejected)
+		case tt.rule != "" && (len(rejected) != 1 || rejected[0].Rule != tt.rule):
+			t.Errorf("%s: rejected %+v, want rule %s", tt.name, rejected, tt.rule)
+		}
+	}
+}
+
+func TestFillFromStation(t *testing.T) {
+	station := models.Station{
+		DVID: "a", DeviceID: "dev-1", Latitude: 18.79, Longitude: 98.95,
+		Place: "CMU", Address: "ต.สุเทพ อ.เมือง จ.เชียงใหม่", Model: "m1",
+	}
+
+	// A measurement-only reading takes the station's metadata and passes
+	// validation without starting a new station version.
+	r := models.SensorData{DVID: "a", Timestamp: 1, PM25: 20}
+	fillFromStation(&r, station)
+	if r.Latitude != 18.79 || r.Longitude != 98.95 || r.Place != "CMU" || r.DeviceID != "dev-1" {
+		t.Errorf("filled reading = %+v", r)
+	}
+	if !sameStation(station, stationFromReading(r)) {
+		t.Error("filled reading differs from its station")
+	}
+	if _, rejected := NewValidator().Split([]models.SensorData{r}); len(rejected) != 0 {
+		t.Errorf("filled reading rejected: %+v", rejected)
+	}
+
+	// Metadata the reading carries is kept.
+	r = models.SensorData{DVID: "a", Place: "CMU gate"}
+	fillFromStation(&r, station)
+	if r.Place != "CMU gate" || r.Latitude != 18.79 {
+		t.Errorf("filled reading = %+v, want its own place and the station's coordinates", r)
+	}
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+)
+
+const defaultIngestBatchSize = 500
+
+// Postgres caps a statement at 65535 bind parameters.
+var maxIngestBatchSize = 65535 / len(readingColumns)
+
+// readingColumns is the column order used by every readings upsert.
+var readingColumns = []string{
+	"dvid", "timestamp", "status", "ddate", "dtime",
+	"av24h", "av12h", "av6h", "av3h", "av1h", "pm25", "pm10", "pm100", "aqi",
+	"temperature", "humidity", "pres", "color", "trend",
+}
+
+func readingValues(d models.SensorData) []interface{} {
+	return []interface{}{
+		d.DVID, d.Timestamp, d.Status, d.DDate, d.DTime,
+		d.Av24h, d.Av12h, d.Av6h, d.Av3h, d.Av1h, d.PM25, d.PM10, d.PM100, d.AQI,
+		d.Temperature, d.Humidity, d.Pres, d.Color, d.Trend,
+	}
+}
+
+// BatchReport describes the outcome of one multi-row upsert statement.
+// Skipped counts rows that were duplicated within the batch or whose stored
+// values were already identical. StationVersions counts stations whose
+// metadata changed.
+type BatchReport struct {
+	Batch           int `json:"batch"`
+	Rows            int `json:"rows"`
+	Inserted        int `json:"inserted"`
+	Updated         int `json:"updated"`
+	Skipped         int `json:"skipped"`
+	StationVersions int `json:"station_versions"`
+	Failed          int `json:"failed"`
+}
+
+// IngestReport aggregates the batch reports of one write.
+type IngestReport struct {
+	Batches         []BatchReport `json:"batches"`
+	Inserted        int           `json:"inserted"`
+	Updated         int           `json:"updated"`
+	Skipped         int           `json:"skipped"`
+	StationVersions int           `json:"station_versions"`
+	// Failed holds rows isolated from a failing batch when dead-lettering is
+	// enabled; the caller decides where they go.
+	Failed []FailedRow `json:"-"`
+}
+
+// FailedRow is a reading whose upsert failed on its own.
+type FailedRow struct {
+	Row models.SensorData
+	Err error
+}
+
+func (r *IngestReport) add(b BatchReport) {
+	r.Batches = append(r.Batches, b)
+	r.Inserted += b.Inserted
+	r.Updated += b.Updated
+	r.Skipped += b.Skipped
+	r.StationVersions += b.StationVersions
+}
+
+// IngestWriter is the single write path into readings and stations.
+type IngestWriter struct {
+	DB        *gorm.DB
+	BatchSize int
+	// IsolateFailures retries a failing batch row by row (each behind a
+	// savepoint) and reports the rows that still fail in IngestReport.Failed
+	// instead of aborting the whole write.
+	IsolateFailures bool
+}
+
+// NewIngestWriter creates an IngestWriter with the default batch size.
+func NewIngestWriter(db *gorm.DB) *IngestWriter {
+	return &IngestWriter{DB: db, BatchSize: defaultIngestBatchSize}
+}
+
+// Write upserts rows in batches inside a single transaction; either every
+// batch is committed or none is.
+func (w *IngestWriter) Write(ctx context.Context, rows []models.SensorData) (IngestReport, error) {
+	var report IngestReport
+	err := w.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		report, err = w.WriteTx(tx, rows)
+		return err
+	})
+	if err != nil {
+		return IngestReport{}, err
+	}
+	return report, nil
+}
+
+// WriteTx upserts rows using an existing transaction, so callers can commit
+// other bookkeeping atomically with the data.
+func (w *IngestWriter) WriteTx(tx *gorm.DB, rows []models.SensorData) (IngestReport, error) {
+	var report IngestReport
+	size := w.batchSize()
+
+	for start, n := 0, 1; start < len(rows); start, n = start+size, n+1 {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var batch BatchReport
+		var failed []FailedRow
+		var err error
+		if w.IsolateFailures {
+			batch, failed, err = upsertBatchIsolated(tx, rows[start:end])
+		} else {
+			batch, err = upsertBatch(tx, rows[start:end])
+		}
+		if err != nil {
+			return report, fmt.Errorf("batch %d: %w", n, err)
+		}
+		batch.Batch = n
+		report.add(batch)
+		report.Failed = append(report.Failed, failed...)
+	}
+	return report, nil
+}
+
+// upsertBatchIsolated runs upsertBatch behind a savepoint. If the batch
+// fails, it is rolled back and every row is retried alone so one bad row
+// does not sink its neighbours. Context cancellation is still fatal.
+func upsertBatchIsolated(tx *gorm.DB, rows []models.SensorData) (BatchReport, []FailedRow, error) {
+	if err := tx.SavePoint("ingest_batch").Error; err != nil {
+		return BatchReport{}, nil, err
+	}
+	report, err := upsertBatch(tx, rows)
+	if err == nil {
+		return report, nil, tx.Exec("RELEASE SAVEPOINT ingest_batch").Error
+	}
+	if ctxErr := tx.Statement.Context.Err(); ctxErr != nil {
+		return report, nil, ctxErr
+	}
+	if err := tx.RollbackTo("ingest_batch").Error; err != nil {
+		return report, nil, err
+	}
+
+	unique := dedupeReadings(rows)
+	report = BatchReport{Rows: len(rows), Skipped: len(rows) - len(unique)}
+	var failed []FailedRow
+	for _, row := range unique {
+		if err := tx.SavePoint("ingest_row").Error; err != nil {
+			return report, failed, err
+		}
+		one, err := upsertBatch(tx, []models.SensorData{row})
+		if err != nil {
+			if ctxErr := tx.Statement.Context.Err(); ctxErr != nil {
+				return report, failed, ctxErr
+			}
+			if err := tx.RollbackTo("ingest_row").Error; err != nil {
+				return report, failed, err
+			}
+			failed = append(failed, FailedRow{Row: row, Err: err})
+			report.Failed++
+			continue
+		}
+		if err := tx.Exec("RELEASE SAVEPOINT ingest_row").Error; err != nil {
+			return report, failed, err
+		}
+		report.Inserted += one.Inserted
+		report.Updated += one.Updated
+		report.Skipped += one.Skipped
+		report.StationVersions += one.StationVersions
+	}
+	return report, failed, nil
+}
+
+func (w *IngestWriter) batchSize() int {
+	switch {
+	case w.BatchSize <= 0:
+		return defaultIngestBatchSize
+	case w.BatchSize > maxIngestBatchSize:
+		return maxIngestBatchSize
+	default:
+		return w.BatchSize
+	}
+}
+
+// upsertBatch writes one batch with a single INSERT ... ON CONFLICT statement.
+// Rows whose values are unchanged are not rewritten, and RETURNING xmax tells
+// fresh inserts apart from updates.
+func upsertBatch(tx *gorm.DB, rows []models.SensorData) (BatchReport, error) {
+	report := BatchReport{Rows: len(rows)}
+
+	// ON CONFLICT cannot touch the same row twice in one statement, so keep
+	// only the last reading per (dvid, timestamp).
+	unique := dedupeReadings(rows)
+	report.Skipped = len(rows) - len(unique)
+	if len(unique) == 0 {
+		return report, nil
+	}
+
+	var returned []upsertResult
+	err := tx.Raw(upsertSQL(len(unique)), upsertArgs(unique)...).Scan(&returned).Error
+	if err != nil {
+		return report, err
+	}
+
+	for _, r := range returned {
+		if r.Inserted {
+			report.Inserted++
+		} else {
+			report.Updated++
+		}
+	}
+	report.Skipped += len(unique) - len(returned)
+
+	report.StationVersions, err = syncStations(tx, unique)
+	return report, err
+}
+
+type upsertResult struct {
+	Inserted bool
+}
+
+func dedupeReadings(rows []models.SensorData) []models.SensorData {
+	type key struct {
+		dvid string
+		ts   int64
+	}
+	last := make(map[key]int, len(rows))
+	for i, r := range rows {
+		last[key{r.DVID, r.Timestamp}] = i
+	}
+	if len(last) == len(rows) {
+		return rows
+	}
+
+	unique := make([]models.SensorData, 0, len(last))
+	for i, r := range rows {
+		if last[key{r.DVID, r.Timestamp}] == i {
+			unique = append(unique, r)
+		}
+	}
+	return unique
+}
+
+func upsertArgs(rows []models.SensorData) []interface{} {
+	args := make([]interface{}, 0, len(rows)*len(readingColumns))
+	for _, r := range rows {
+		args = append(args, readingValues(r)...)
+	}
+	return args
+}
+
+func upsertSQL(n int) string {
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(readingColumns)), ", ") + ")"
+
+	var set, current, excluded []string
+	for _, col := range readingColumns {
+		if col == "dvid" || col == "timestamp" {
+			continue
+		}
+		set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+		current = append(current, "readings."+col)
+		excluded = append(excluded, "EXCLUDED."+col)
+	}
+
+	var b strings.Builder
+	b.WriteString("INSERT INTO readings (")
+	b.WriteString(strings.Join(readingColumns, ", "))
+	b.WriteString(") VALUES ")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(tuple)
+	}
+	b.WriteString(" ON CONFLICT (dvid, timestamp) DO UPDATE SET ")
+	b.WriteString(strings.Join(set, ", "))
+	b.WriteString(" WHERE (")
+	b.WriteString(strings.Join(current, ", "))
+	b.WriteString(") IS DISTINCT FROM (")
+	b.WriteString(strings.Join(excluded, ", "))
+	b.WriteString(") RETURNING (xmax = 0) AS inserted")
+	return b.String()
+}
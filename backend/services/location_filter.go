@@ -0,0 +1,47 @@
+package services
+
+import (
+	"strings"
+
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+	"yakkaw_dashboard/thaiaddress"
+)
+
+// locationFilter is the free-text "province" parameter of the chart, place
+// and latest endpoints. It used to be matched with address ILIKE, which also
+// hit other provinces' addresses that merely contained the text. A province
+// (any spelling, English name or ISO code) now matches the parsed province
+// columns exactly; any other text is taken as part of a place name.
+type locationFilter struct {
+	province thaiaddress.Province
+	place    string
+}
+
+func parseLocationFilter(s string) locationFilter {
+	s = strings.TrimSpace(s)
+	if p, ok := thaiaddress.LookupProvince(s); ok {
+		return locationFilter{province: p}
+	}
+	return locationFilter{place: s}
+}
+
+func (f locationFilter) isProvince() bool { return f.province.Code != "" }
+
+// rollup returns the filter on the province or place rollups.
+func (f locationFilter) rollup() repository.RollupFilter {
+	if f.isProvince() {
+		return repository.RollupFilter{Scope: models.RollupScopeProvince, Keys: []string{f.province.Name}}
+	}
+	return repository.RollupFilter{Scope: models.RollupScopePlace, KeyLike: []string{f.place}}
+}
+
+// stations returns the filter on the rollups of the stations it matches.
+func (f locationFilter) stations() repository.RollupFilter {
+	return repository.RollupFilter{Scope: models.RollupScopeDVID, ProvinceCode: f.province.Code, Place: f.place}
+}
+
+// readings returns the filter as a ReadingRepository filter.
+func (f locationFilter) readings() repository.ReadingFilter {
+	return repository.ReadingFilter{ProvinceCode: f.province.Code, Place: f.place}
+}
@@ -4,17 +4,18 @@ import (
 	"errors"
 	"time"
 	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
 
 	"gorm.io/gorm"
 )
 
 type NewsService struct {
-    DB *gorm.DB
+    News repository.NewsRepository
 }
 
 // NewNewsService creates a new NewsService instance
-func NewNewsService(db *gorm.DB) *NewsService {
-    return &NewsService{DB: db}
+func NewNewsService(news repository.NewsRepository) *NewsService {
+    return &NewsService{News: news}
 }
 
 // CreateNews creates a new news entry
@@ -24,12 +25,12 @@ func (s *NewsService) CreateNews(news models.News) (models.News, error) {
         news.Date = time.Now()
     }
 
-    if err := s.DB.Create(&news).Error; err != nil {
+    if err := s.News.Create(&news); err != nil {
         return models.News{}, err
     }
 
     // โหลดข้อมูล Category ของข่าวที่สร้างใหม่
-    s.DB.Preload("Category").First(&news, news.ID)
+    s.News.LoadCategory(&news)
 
     return news, nil
 }
@@ -37,41 +38,30 @@ func (s *NewsService) CreateNews(news models.News) (models.News, error) {
 
 // GetAllNews returns all news, optionally with Category
 func (s *NewsService) GetAllNews() ([]models.News, error) {
-    var news []models.News
-
     // ✅ โหลด News พร้อม Category (แต่ไม่ให้ preload news อีก)
-    if err := s.DB.Preload("Category").Find(&news).Error; err != nil {
-        return nil, err
-    }
-
-    return news, nil
+    return s.News.List()
 }
 
 // GetNewsByID fetches a single news record by ID
 func (s *NewsService) GetNewsByID(id uint) (models.News, error) {
-    var news models.News
-    if err := s.DB.First(&news, id).Error; err != nil {
-        return models.News{}, err
-    }
-    return news, nil
+    return s.News.FindByID(id)
 }
 
 
 
 func (s *NewsService) DeleteNews(id uint) error {
-    result := s.DB.Delete(&models.News{}, id)
-    if result.RowsAffected == 0 {
+    err := s.News.Delete(id)
+    if errors.Is(err, gorm.ErrRecordNotFound) {
         return errors.New("news not found")
     }
-    return nil
+    return err
 }
 
 // UpdateNews updates an existing news entry
 func (s *NewsService) UpdateNews(id uint, newsUpdate models.News) (models.News, error) {
-    var news models.News
-
     // ค้นหาข่าวที่ต้องการอัปเดต
-    if err := s.DB.First(&news, id).Error; err != nil {
+    news, err := s.News.FindByID(id)
+    if err != nil {
         return models.News{}, errors.New("news not found")
     }
 
@@ -90,12 +80,12 @@ func (s *NewsService) UpdateNews(id uint, newsUpdate models.News) (models.News,
     }
 
     // บันทึกการเปลี่ยนแปลง
-    if err := s.DB.Save(&news).Error; err != nil {
+    if err := s.News.Save(&news); err != nil {
         return models.News{}, err
     }
 
     // โหลดข้อมูลหมวดหมู่ที่อัปเดต
-    s.DB.Preload("Category").First(&news, id)
+    s.News.LoadCategory(&news)
 
     return news, nil
 }
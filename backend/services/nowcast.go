@@ -0,0 +1,55 @@
+package services
+
+import (
+	"time"
+
+	"yakkaw_dashboard/aqi"
+	"yakkaw_dashboard/repository"
+)
+
+// NowCast is a station's NowCast for the clock hour starting at Hour (epoch
+// ms), from the hourly averages of that hour and the 11 before it. A
+// concentration is nil when the station lacks two of the three most recent
+// hours; Index is then computed from the other one, or left out.
+type NowCast struct {
+	DVID  string      `json:"dvid"`
+	Hour  int64       `json:"hour"`
+	PM25  *float64    `json:"pm25"`
+	PM10  *float64    `json:"pm10"`
+	Hours int         `json:"hours"`
+	Index *aqi.Result `json:"aqi_index,omitempty"`
+}
+
+// stationNowCast computes the NowCast of dvid at now, with the AQI under std.
+func stationNowCast(readings repository.ReadingRepository, dvid string, now time.Time, std aqi.Standard) (NowCast, error) {
+	hour := now.Truncate(time.Hour)
+	from := hour.Add(-(aqi.NowCastHours - 1) * time.Hour)
+	rows, err := readings.HourlyPM(dvid, from, hour.Add(time.Hour))
+	if err != nil {
+		return NowCast{}, err
+	}
+
+	// ช่อง i คือชั่วโมงที่ย้อนหลังไป i ชั่วโมงจากชั่วโมงปัจจุบัน; ชั่วโมงที่ไม่มีข้อมูลเป็น nil
+	pm25 := make([]*float64, aqi.NowCastHours)
+	pm10 := make([]*float64, aqi.NowCastHours)
+	nc := NowCast{DVID: dvid, Hour: hour.UnixMilli()}
+	for _, r := range rows {
+		i := int(hour.Sub(r.Hour) / time.Hour)
+		if i < 0 || i >= aqi.NowCastHours {
+			continue
+		}
+		pm25[i], pm10[i] = r.PM25, r.PM10
+		nc.Hours++
+	}
+	if v, ok := aqi.NowCast(aqi.PM25, pm25); ok {
+		nc.PM25 = &v
+	}
+	if v, ok := aqi.NowCast(aqi.PM10, pm10); ok {
+		nc.PM10 = &v
+	}
+	if nc.PM25 != nil || nc.PM10 != nil {
+		index := std.Compute(aqi.PM(nc.PM25, nc.PM10))
+		nc.Index = &index
+	}
+	return nc, nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/aqi"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+func TestStationNowCast(t *testing.T) {
+	std, err := aqi.Parse("us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 3, 1, 10, 40, 0, 0, time.UTC)
+	hour := now.Truncate(time.Hour)
+	at := func(hoursAgo int, minute int) int64 {
+		return hour.Add(-time.Duration(hoursAgo)*time.Hour + time.Duration(minute)*time.Minute).UnixMilli()
+	}
+	readings := repository.NewMemoryReadingRepository(
+		// Current hour averages to 21, the hour before to 30; two hours ago
+		// has no reading and the zero PM10 values count as missing.
+		models.SensorData{DVID: "a", Timestamp: at(0, 5), PM25: 20, PM10: 40},
+		models.SensorData{DVID: "a", Timestamp: at(0, 35), PM25: 22, PM10: 0},
+		models.SensorData{DVID: "a", Timestamp: at(1, 10), PM25: 30, PM10: 50},
+		models.SensorData{DVID: "a", Timestamp: at(3, 10), PM25: 25, PM10: 45},
+		// Outside the 12 hours and another station: both ignored.
+		models.SensorData{DVID: "a", Timestamp: at(12, 0), PM25: 500, PM10: 500},
+		models.SensorData{DVID: "b", Timestamp: at(0, 5), PM25: 300, PM10: 300},
+	)
+
+	nc, err := stationNowCast(readings, "a", now, std)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPM25, _ := aqi.NowCast(aqi.PM25, []*float64{floatPtr(21), floatPtr(30), nil, floatPtr(25)})
+	wantPM10, _ := aqi.NowCast(aqi.PM10, []*float64{floatPtr(40), floatPtr(50), nil, floatPtr(45)})
+	if nc.Hours != 3 || nc.Hour != hour.UnixMilli() {
+		t.Errorf("hours = %d, hour = %d; want 3, %d", nc.Hours, nc.Hour, hour.UnixMilli())
+	}
+	if nc.PM25 == nil || *nc.PM25 != wantPM25 {
+		t.Errorf("pm25 = %v, want %v", nc.PM25, wantPM25)
+	}
+	if nc.PM10 == nil || *nc.PM10 != wantPM10 {
+		t.Errorf("pm10 = %v, want %v", nc.PM10, wantPM10)
+	}
+	if nc.Index == nil || nc.Index.Standard != "us" || nc.Index.Dominant == "" {
+		t.Errorf("index = %+v, want a us index", nc.Index)
+	}
+
+	// Only the current hour: not enough for a NowCast.
+	nc, err = stationNowCast(repository.NewMemoryReadingRepository(
+		models.SensorData{DVID: "c", Timestamp: at(0, 5), PM25: 20, PM10: 40},
+	), "c", now, std)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nc.PM25 != nil || nc.PM10 != nil || nc.Index != nil {
+		t.Errorf("single hour gave %+v, want no values", nc)
+	}
+}
+
+func floatPtr(v float64) *float64 { return &v }
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"yakkaw_dashboard/config"
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+
+	"gorm.io/gorm"
+)
+
+// Pipeline run triggers.
+const (
+	PipelineTriggerSchedule = "schedule"
+	PipelineTriggerManual   = "manual"
+)
+
+// Pipeline run statuses.
+const (
+	// PipelineRunQueued marks an on-demand refresh waiting for the worker.
+	PipelineRunQueued    = "queued"
+	PipelineRunRunning   = "running"
+	PipelineRunSucceeded = "succeeded"
+	PipelineRunFailed    = "failed"
+	// PipelineRunSkipped marks a run that did not contact the upstream
+	// because its circuit breaker was open.
+	PipelineRunSkipped = "skipped"
+)
+
+// RunPipeline fetches src once, upserts its rows and records the run in
+// pipeline_runs. The returned run is populated even when err != nil.
+func RunPipeline(ctx context.Context, src Source, trigger string) (models.PipelineRun, error) {
+	run := models.PipelineRun{
+		Source:    src.Name(),
+		Trigger:   trigger,
+		Status:    PipelineRunRunning,
+		StartedAt: time.Now(),
+	}
+	if err := database.DB.Create(&run).Error; err != nil {
+		log.Printf("pipeline: could not record run for %s: %v", src.Name(), err)
+	}
+
+	err := executePipelineRun(ctx, src, &run)
+	return run, err
+}
+
+// executePipelineRun runs src against an already recorded run and saves the
+// outcome.
+func executePipelineRun(ctx context.Context, src Source, run *models.PipelineRun) error {
+	err := ingestSource(ctx, src, run)
+	finishPipelineRun(run, err)
+	// Also picks up hours dirtied by device pushes since the last run.
+	if n, rerr := RefreshRollups(ctx); rerr != nil {
+		log.Printf("pipeline: rollup refresh failed: %v", rerr)
+	} else if n > 0 {
+		log.Printf("pipeline: refreshed rollups for %d hours", n)
+	}
+	opts := AnomalyOptionsFromConfig(config.Get())
+	if rep, aerr := DetectAnomalies(repository.NewAnomalyRepository(database.DB.WithContext(ctx)), opts, time.Now().Add(-opts.Recheck)); aerr != nil {
+		log.Printf("pipeline: anomaly detection failed: %v", aerr)
+	} else if rep.Flagged > 0 || rep.Cleared > 0 {
+		log.Printf("pipeline: flagged %d anomalous readings, cleared %d", rep.Flagged, rep.Cleared)
+	}
+	return err
+}
+
+func ingestSource(ctx context.Context, src Source, run *models.PipelineRun) error {
+	setPipelineStage(run, "fetching")
+	res, err := src.Fetch(ctx)
+	run.HTTPStatus = res.StatusCode
+	run.Attempts = res.Attempts
+	run.RowsReceived = len(res.Rows)
+	if res.Raw != nil {
+		if err := archiveRawPayload(src.Name(), run.ID, res.StatusCode, res.Raw); err != nil {
+			log.Printf("pipeline: could not archive payload of %s: %v", src.Name(), err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if checker, ok := src.(SchemaChecker); ok && res.Raw != nil {
+		checkSchemaDrift(src.Name(), checker, res.Raw.Body)
+	}
+	setPipelineStage(run, "writing")
+
+	result, err := IngestRows(ctx, src.Name(), res.Rows)
+	if err != nil {
+		// The write is a single transaction, so nothing from this fetch landed.
+		run.RowsFailed = len(res.Rows)
+		return err
+	}
+	run.RowsInserted = result.Inserted
+	run.RowsUpdated = result.Updated
+	run.RowsSkipped = result.Skipped
+	run.RowsQuarantined = result.Quarantined
+	run.RowsDeadLettered = result.DeadLettered
+	return nil
+}
+
+// IngestResult summarises one pass through the ingest path.
+type IngestResult struct {
+	IngestReport
+	Received     int `json:"received"`
+	Quarantined  int `json:"quarantined"`
+	DeadLettered int `json:"dead_lettered"`
+}
+
+// IngestRows is the shared ingest path: rows are validated, rejects go to
+// sensor_data_quarantine, rows the database refuses go to dead_letters and
+// the rest are upserted, all in one transaction.
+func IngestRows(ctx context.Context, source string, rows []models.SensorData) (IngestResult, error) {
+	var result IngestResult
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = IngestRowsTx(tx, source, rows)
+		return err
+	})
+	if err != nil {
+		return IngestResult{Received: len(rows)}, err
+	}
+	return result, nil
+}
+
+// IngestRowsTx runs the ingest path inside an existing transaction.
+func IngestRowsTx(tx *gorm.DB, source string, rows []models.SensorData) (IngestResult, error) {
+	return ingestRowsTx(tx, source, rows, true)
+}
+
+// ingestRowsTx optionally skips dead-lettering so a replay that fails again
+// surfaces its error instead of producing a new dead letter.
+func ingestRowsTx(tx *gorm.DB, source string, rows []models.SensorData, deadLetter bool) (IngestResult, error) {
+	result := IngestResult{Received: len(rows)}
+	if err := fillFromStations(tx, rows); err != nil {
+		return result, err
+	}
+	valid, rejected := NewValidator().Split(rows)
+
+	if err := quarantineRows(tx, source, rejected); err != nil {
+		return result, err
+	}
+	writer := NewIngestWriter(tx)
+	writer.IsolateFailures = deadLetter
+	report, err := writer.WriteTx(tx, valid)
+	if err != nil {
+		return result, err
+	}
+	if err := deadLetterRows(tx, source, report.Failed); err != nil {
+		return result, err
+	}
+	if err := markRollupsDirty(tx, valid); err != nil {
+		return result, err
+	}
+	result.IngestReport = report
+	result.Quarantined = len(rejected)
+	result.DeadLettered = len(report.Failed)
+	return result, nil
+}
+
+// setPipelineStage persists progress so job polling can follow a run.
+func setPipelineStage(run *models.PipelineRun, stage string) {
+	run.Stage = stage
+	if run.ID == 0 {
+		return
+	}
+	err := database.DB.Model(run).Updates(map[string]interface{}{
+		"stage":         run.Stage,
+		"http_status":   run.HTTPStatus,
+		"attempts":      run.Attempts,
+		"rows_received": run.RowsReceived,
+	}).Error
+	if err != nil {
+		log.Printf("pipeline: could not update run %d: %v", run.ID, err)
+	}
+}
+
+func finishPipelineRun(run *models.PipelineRun, err error) {
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Stage = ""
+	run.Status = PipelineRunSucceeded
+	if err != nil {
+		run.Status = PipelineRunFailed
+		if errors.Is(err, ErrCircuitOpen) {
+			run.Status = PipelineRunSkipped
+		}
+		run.Error = err.Error()
+	}
+
+	if run.ID == 0 {
+		return
+	}
+	if err := database.DB.Save(run).Error; err != nil {
+		log.Printf("pipeline: could not update run %d: %v", run.ID, err)
+	}
+}
+
+// PipelineRunFilter narrows ListPipelineRuns.
+type PipelineRunFilter struct {
+	Source string
+	Status string
+	Limit  int
+	Offset int
+}
+
+// ListPipelineRuns returns runs newest first together with the total count
+// matching the filter.
+func ListPipelineRuns(f PipelineRunFilter) ([]models.PipelineRun, int64, error) {
+	q := database.DB.Model(&models.PipelineRun{})
+	if f.Source != "" {
+		q = q.Where("source = ?", f.Source)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var runs []models.PipelineRun
+	if err := q.Order("started_at DESC").Limit(f.Limit).Offset(f.Offset).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// GetPipelineRun fetches a single run by ID.
+func GetPipelineRun(id uint) (models.PipelineRun, error) {
+	var run models.PipelineRun
+	err := database.DB.First(&run, id).Error
+	return run, err
+}
+
+// PipelineSourceStatus is the latest run and backlog of one source.
+type PipelineSourceStatus struct {
+	Source      string              `json:"source"`
+	LastRun     *models.PipelineRun `json:"last_run"`
+	DeadLetters int64               `json:"dead_letters"`
+	Quarantined int64               `json:"quarantined"`
+}
+
+// PipelineStatus summarises ingestion health for the admin dashboard.
+type PipelineStatus struct {
+	Sources     []PipelineSourceStatus `json:"sources"`
+	DeadLetters int64                  `json:"dead_letters"`
+	Quarantined int64                  `json:"quarantined"`
+}
+
+// GetPipelineStatus reports, per source seen in runs, dead letters or
+// quarantine, the latest run and the outstanding dead-letter and quarantine
+// counts, plus overall totals.
+func GetPipelineStatus() (PipelineStatus, error) {
+	var status PipelineStatus
+
+	type sourceCount struct {
+		Source string
+		Count  int64
+	}
+	var deadCounts, quarantineCounts []sourceCount
+	if err := database.DB.Model(&models.DeadLetter{}).
+		Select("source, COUNT(*) AS count").Group("source").Scan(&deadCounts).Error; err != nil {
+		return status, err
+	}
+	if err := database.DB.Model(&models.SensorDataQuarantine{}).
+		Select("source, COUNT(*) AS count").Group("source").Scan(&quarantineCounts).Error; err != nil {
+		return status, err
+	}
+
+	var lastRuns []models.PipelineRun
+	err := database.DB.Raw(`
+		SELECT DISTINCT ON (source) *
+		FROM pipeline_runs
+		ORDER BY source, started_at DESC`).Scan(&lastRuns).Error
+	if err != nil {
+		return status, err
+	}
+
+	bySource := map[string]*PipelineSourceStatus{}
+	entry := func(source string) *PipelineSourceStatus {
+		if s, ok := bySource[source]; ok {
+			return s
+		}
+		s := &PipelineSourceStatus{Source: source}
+		bySource[source] = s
+		return s
+	}
+	for i := range lastRuns {
+		entry(lastRuns[i].Source).LastRun = &lastRuns[i]
+	}
+	for _, c := range deadCounts {
+		entry(c.Source).DeadLetters = c.Count
+		status.DeadLetters += c.Count
+	}
+	for _, c := range quarantineCounts {
+		entry(c.Source).Quarantined = c.Count
+		status.Quarantined += c.Count
+	}
+
+	status.Sources = make([]PipelineSourceStatus, 0, len(bySource))
+	for _, s := range bySource {
+		status.Sources = append(status.Sources, *s)
+	}
+	sort.Slice(status.Sources, func(i, j int) bool {
+		return status.Sources[i].Source < status.Sources[j].Source
+	})
+	return status, nil
+}
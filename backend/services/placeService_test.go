@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+func TestGetDistinctPlaces(t *testing.T) {
+	retired := int64(1)
+	stations := repository.NewMemoryStationRepository(
+		models.Station{DVID: "a", Place: " CMU ", Address: "ต.สุเทพ", ProvinceCode: "TH-50", Latitude: 18.80},
+		models.Station{DVID: "b", Place: "CMU", Address: "ต.สุเทพ", ProvinceCode: "TH-50", Latitude: 18.81},
+		models.Station{DVID: "c", Address: "ต.ช้างเผือก", ProvinceCode: "TH-50"},
+		models.Station{DVID: "d", Place: "Lampang", Address: "จ.ลำปาง", ProvinceCode: "TH-52"},
+		models.Station{DVID: "e", Place: "Old", Address: "ต.สุเทพ", ProvinceCode: "TH-50", ValidTo: &retired},
+	)
+	s := NewStationService(stations, nil)
+
+	places, err := s.GetDistinctPlaces("เชียงใหม่")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(places) != 2 || places[0].Label != "CMU" || places[0].Count != 2 || places[0].Latitude != 18.81 ||
+		places[1].Label != "ต.ช้างเผือก" {
+		t.Errorf("places = %+v, want CMU with 2 stations, then a place named by its address", places)
+	}
+
+	if places, _ = s.GetDistinctPlaces("lamp"); len(places) != 1 || places[0].Label != "Lampang" {
+		t.Errorf("place filter = %+v, want Lampang", places)
+	}
+	if places, _ = s.GetDistinctPlaces(""); len(places) != 3 {
+		t.Errorf("all places = %+v, want 3", places)
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QuarantineFilter narrows ListQuarantine.
+type QuarantineFilter struct {
+	DVID   string
+	Rule   string
+	Source string
+	Limit  int
+	Offset int
+}
+
+// ListQuarantine returns quarantined readings newest first with the total count.
+func ListQuarantine(f QuarantineFilter) ([]models.SensorDataQuarantine, int64, error) {
+	q := database.DB.Model(&models.SensorDataQuarantine{})
+	if f.DVID != "" {
+		q = q.Where("dvid = ?", f.DVID)
+	}
+	if f.Rule != "" {
+		q = q.Where("rule = ?", f.Rule)
+	}
+	if f.Source != "" {
+		q = q.Where("source = ?", f.Source)
+	}
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []models.SensorDataQuarantine
+	if err := q.Order("id DESC").Limit(f.Limit).Offset(f.Offset).Find(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+// ReleaseQuarantined upserts a quarantined reading into sensor_data as-is,
+// overriding the rule that rejected it, and removes it from quarantine.
+func ReleaseQuarantined(ctx context.Context, id uint) (IngestReport, error) {
+	var report IngestReport
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var row models.SensorDataQuarantine
+		if err := tx.First(&row, id).Error; err != nil {
+			return err
+		}
+
+		var err error
+		report, err = NewIngestWriter(tx).WriteTx(tx, []models.SensorData{row.Payload})
+		if err != nil {
+			return err
+		}
+		if err := markRollupsDirty(tx, []models.SensorData{row.Payload}); err != nil {
+			return err
+		}
+		return tx.Delete(&row).Error
+	})
+	return report, err
+}
+
+// DiscardQuarantined permanently deletes a quarantined reading.
+func DiscardQuarantined(id uint) error {
+	result := database.DB.Delete(&models.SensorDataQuarantine{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// quarantineRows stores rejected readings. A reading already quarantined under
+// the same rule (a device stuck on a bad value is polled again every few
+// minutes) gets the latest reason and payload instead of another row.
+func quarantineRows(tx *gorm.DB, source string, rejected []Rejection) error {
+	if len(rejected) == 0 {
+		return nil
+	}
+	type key struct {
+		dvid      string
+		timestamp int64
+		rule      string
+	}
+	seen := make(map[key]int, len(rejected))
+	rows := make([]models.SensorDataQuarantine, 0, len(rejected))
+	for _, r := range rejected {
+		// One statement cannot upsert the same row twice; the last copy wins.
+		k := key{r.Row.DVID, r.Row.Timestamp, r.Rule}
+		if i, ok := seen[k]; ok {
+			rows[i].Reason, rows[i].Payload = r.Reason, r.Row
+			continue
+		}
+		seen[k] = len(rows)
+		rows = append(rows, models.SensorDataQuarantine{
+			Source:    source,
+			DVID:      r.Row.DVID,
+			Timestamp: r.Row.Timestamp,
+			Rule:      r.Rule,
+			Reason:    r.Reason,
+			Payload:   r.Row,
+		})
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "source"}, {Name: "dvid"}, {Name: "timestamp"}, {Name: "rule"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "payload"}),
+	}).CreateInBatches(&rows, 500).Error
+}
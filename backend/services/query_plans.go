@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/database"
+
+	"gorm.io/gorm"
+)
+
+// QueryPlan is the EXPLAIN output of one dashboard query in the form it had
+// before reading_at existed (Before: the reading time is computed from
+// timestamp inside WHERE) and in its current form (After), and of the current
+// form again without the indexes of migration 0003 (Unindexed).
+type QueryPlan struct {
+	Name      string
+	Before    []string
+	After     []string
+	Unindexed []string
+}
+
+// queryPlanIndexes are the indexes added by migration 0003_reading_at. They
+// are dropped for the Unindexed plan inside the transaction that is rolled
+// back, so they come back untouched.
+var queryPlanIndexes = []string{"idx_readings_reading_at", "idx_readings_dvid_reading_at", "idx_stations_province_dvid"}
+
+type queryPlanCase struct {
+	name          string
+	before, after string
+}
+
+// queryPlanCases are representative raw-reading queries of the air quality,
+// chart and ranking services.
+func queryPlanCases(now time.Time) []queryPlanCase {
+	day := now.In(database.Bangkok).AddDate(0, 0, -1)
+	dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, database.Bangkok)
+	from := "'" + dayStart.Format(time.RFC3339) + "'::timestamptz"
+	to := "'" + dayStart.AddDate(0, 0, 1).Format(time.RFC3339) + "'::timestamptz"
+
+	return []queryPlanCase{
+		{
+			name: "24 hour average per address (GetAirQuality24Hours)",
+			before: `SELECT address, AVG(pm25), AVG(pm10) FROM sensor_data
+				WHERE to_timestamp(timestamp/1000) BETWEEN now() - interval '24 hours' AND now()
+				GROUP BY address`,
+			after: `SELECT address, AVG(pm25), AVG(pm10) FROM sensor_data
+				WHERE ` + database.ReadingsSinceSQL("24 hours") + `
+				GROUP BY address`,
+		},
+		{
+			name: "today by province and hour (GetChartData Today)",
+			before: `SELECT province, date_trunc('hour', to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok') AS h, AVG(pm25)
+				FROM sensor_data
+				WHERE to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok' >= date_trunc('day', now() AT TIME ZONE 'Asia/Bangkok')
+				GROUP BY 1, 2`,
+			after: `SELECT province, date_trunc('hour', reading_at AT TIME ZONE 'Asia/Bangkok') AS h, AVG(pm25)
+				FROM sensor_data
+				WHERE ` + database.ReadingWindowSQL(database.BangkokTodaySQL, "now()") + `
+				GROUP BY 1, 2`,
+		},
+		{
+			name: "daily ranking by address (GetDailyRankingGrouped)",
+			before: fmt.Sprintf(`SELECT address, AVG(NULLIF(pm25, 0)) FROM sensor_data
+				WHERE (to_timestamp(timestamp/1000) AT TIME ZONE 'Asia/Bangkok')::date = '%s'
+				GROUP BY address`, dayStart.Format("2006-01-02")),
+			after: `SELECT address, AVG(NULLIF(pm25, 0)) FROM sensor_data
+				WHERE ` + database.ReadingWindowSQL(from, to) + `
+				GROUP BY address`,
+		},
+		{
+			name: "one station, last 7 days",
+			before: `SELECT * FROM sensor_data
+				WHERE dvid = (SELECT dvid FROM stations WHERE valid_to IS NULL ORDER BY dvid LIMIT 1)
+				  AND to_timestamp(timestamp/1000) >= now() - interval '7 days'
+				ORDER BY timestamp DESC`,
+			after: `SELECT * FROM sensor_data
+				WHERE dvid = (SELECT dvid FROM stations WHERE valid_to IS NULL ORDER BY dvid LIMIT 1)
+				  AND ` + database.ReadingsSinceSQL("7 days") + `
+				ORDER BY reading_at DESC`,
+		},
+	}
+}
+
+// ExplainQueryPlans returns the plans of the before and after form of each
+// representative query, and of the after form without queryPlanIndexes. With
+// analyze the queries are executed (EXPLAIN ANALYZE, BUFFERS) inside a
+// transaction that is rolled back. Dropping the indexes locks readings and
+// stations until that rollback, so writes wait for each Unindexed plan.
+func ExplainQueryPlans(ctx context.Context, analyze bool) ([]QueryPlan, error) {
+	explain := "EXPLAIN "
+	if analyze {
+		explain = "EXPLAIN (ANALYZE, BUFFERS) "
+	}
+
+	var plans []QueryPlan
+	for _, c := range queryPlanCases(time.Now()) {
+		p := QueryPlan{Name: c.name}
+		var err error
+		if p.Before, err = explainQuery(ctx, explain+c.before, nil); err != nil {
+			return plans, fmt.Errorf("%s (before): %w", c.name, err)
+		}
+		if p.After, err = explainQuery(ctx, explain+c.after, nil); err != nil {
+			return plans, fmt.Errorf("%s (after): %w", c.name, err)
+		}
+		if p.Unindexed, err = explainQuery(ctx, explain+c.after, queryPlanIndexes); err != nil {
+			return plans, fmt.Errorf("%s (without indexes): %w", c.name, err)
+		}
+		plans = append(plans, p)
+	}
+	return plans, nil
+}
+
+// WriteQueryPlans writes plans as the explain command prints them.
+func WriteQueryPlans(w io.Writer, plans []QueryPlan) {
+	for _, p := range plans {
+		fmt.Fprintf(w, "=== %s\n", p.Name)
+		for _, section := range []struct {
+			name  string
+			lines []string
+		}{{"before", p.Before}, {"after", p.After}, {"after, without the reading_at indexes", p.Unindexed}} {
+			fmt.Fprintf(w, "--- %s\n", section.name)
+			for _, l := range section.lines {
+				fmt.Fprintln(w, l)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// explainQuery runs the EXPLAIN query in a transaction that is rolled back,
+// after dropping the indexes drop. Without any to drop the transaction is
+// read-only.
+func explainQuery(ctx context.Context, query string, drop []string) ([]string, error) {
+	var lines []string
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		setup := `SET TRANSACTION READ ONLY`
+		if len(drop) > 0 {
+			setup = `DROP INDEX IF EXISTS ` + strings.Join(drop, ", ")
+		}
+		if err := tx.Exec(setup).Error; err != nil {
+			return err
+		}
+		rows, err := tx.Raw(query).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				return err
+			}
+			lines = append(lines, line)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		// Nothing to keep; rolling back also discards anything ANALYZE did
+		// and restores dropped indexes.
+		return errRollback
+	})
+	if err == errRollback {
+		err = nil
+	}
+	return lines, err
+}
+
+var errRollback = errors.New("rollback")
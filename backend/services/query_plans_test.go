@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/database"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestQueryPlans plans the representative queries with and without the
+// reading_at indexes on the migrated database TEST_DATABASE_DSN and logs both
+// plans, also writing them to QUERY_PLANS_OUT when set. QUERY_PLANS_ANALYZE
+// executes them (EXPLAIN ANALYZE).
+func TestQueryPlans(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = saved })
+
+	indexed := func(index string) bool {
+		var n int64
+		if err := db.Raw(`SELECT count(*) FROM pg_indexes WHERE indexname = ?`, index).Scan(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n > 0
+	}
+	for _, index := range queryPlanIndexes {
+		if !indexed(index) {
+			t.Fatalf("index %s missing: migrate the test database first", index)
+		}
+	}
+
+	plans, err := ExplainQueryPlans(context.Background(), os.Getenv("QUERY_PLANS_ANALYZE") != "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plans) != len(queryPlanCases(time.Now())) {
+		t.Fatalf("got %d plans, want one per case", len(plans))
+	}
+	for _, p := range plans {
+		if len(p.After) == 0 || len(p.Unindexed) == 0 {
+			t.Errorf("%s: empty plan", p.Name)
+		}
+		// The plan without the indexes must not have used them.
+		unindexed := strings.Join(p.Unindexed, "\n")
+		for _, index := range queryPlanIndexes {
+			if strings.Contains(unindexed, index) {
+				t.Errorf("%s: plan without indexes uses %s", p.Name, index)
+			}
+		}
+	}
+	for _, index := range queryPlanIndexes {
+		if !indexed(index) {
+			t.Errorf("index %s not restored after the plans", index)
+		}
+	}
+
+	var out bytes.Buffer
+	WriteQueryPlans(&out, plans)
+	t.Log("\n" + out.String())
+	if path := os.Getenv("QUERY_PLANS_OUT"); path != "" {
+		if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
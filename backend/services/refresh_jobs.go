@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/config"
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+)
+
+var (
+	// ErrRefreshQueueFull is returned when too many refreshes are pending.
+	ErrRefreshQueueFull = errors.New("refresh queue is full")
+	// ErrUnknownSource is returned for a source name that is not configured.
+	ErrUnknownSource = errors.New("unknown source")
+	// ErrURLNotAllowed is returned for an api_url outside the allow-list.
+	ErrURLNotAllowed = errors.New("api_url is not in PIPELINE_REFRESH_ALLOWED_URLS")
+)
+
+// refreshStaleAfter bounds how long a queued/running refresh blocks new
+// requests for the same source, in case its process died mid-job.
+const refreshStaleAfter = 30 * time.Minute
+
+type refreshJob struct {
+	runID uint
+	src   Source
+}
+
+var refreshJobs = make(chan refreshJob, 16)
+
+// ResolveRefreshSource picks the source for an on-demand refresh: a
+// configured source by name, an allow-listed api_url, or the default Yakkaw
+// devices API. Arbitrary URLs are rejected so the endpoint cannot be used to
+// make the server fetch internal addresses.
+func ResolveRefreshSource(cfg *config.Config, sourceName, apiURL string) (Source, error) {
+	opts := UpstreamOptionsFromConfig(cfg)
+
+	switch {
+	case sourceName != "":
+		sources, err := SourcesFromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range sources {
+			if s.Name() == sourceName {
+				return s, nil
+			}
+		}
+		return nil, ErrUnknownSource
+	case apiURL != "":
+		if sameURL(apiURL, cfg.DevicesAPIURL) {
+			return NewYakkawSource("yakkaw", cfg.DevicesAPIURL, opts), nil
+		}
+		for _, allowed := range cfg.RefreshAllowedURLs {
+			if sameURL(apiURL, allowed) {
+				return NewYakkawSource(adhocSourceName(allowed), allowed, opts), nil
+			}
+		}
+		return nil, ErrURLNotAllowed
+	default:
+		return NewYakkawSource("yakkaw", cfg.DevicesAPIURL, opts), nil
+	}
+}
+
+// adhocSourceName names an allow-listed URL by host so its runs and circuit
+// breaker are kept apart from other ad-hoc upstreams.
+func adhocSourceName(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		return "adhoc:" + normalizeHost(u)
+	}
+	return "adhoc"
+}
+
+// sameURL compares two absolute http(s) URLs after parsing, so trivial
+// differences such as host case do not matter.
+func sameURL(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || (ua.Scheme != "http" && ua.Scheme != "https") || ua.Host == "" {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	ua.Host, ub.Host = normalizeHost(ua), normalizeHost(ub)
+	return ua.String() == ub.String()
+}
+
+func normalizeHost(u *url.URL) string {
+	host := u.Hostname()
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	return strings.ToLower(host)
+}
+
+// EnqueueRefresh records a queued manual run for src and hands it to the
+// refresh worker. The run ID doubles as the job ID. If a refresh of the same
+// source is already pending, that run is returned with existing=true.
+func EnqueueRefresh(src Source) (run models.PipelineRun, existing bool, err error) {
+	err = database.DB.
+		Where("source = ? AND trigger = ? AND status IN ? AND started_at > ?",
+			src.Name(), PipelineTriggerManual,
+			[]string{PipelineRunQueued, PipelineRunRunning},
+			time.Now().Add(-refreshStaleAfter)).
+		Order("id DESC").
+		Limit(1).
+		Find(&run).Error
+	if err != nil {
+		return run, false, err
+	}
+	if run.ID != 0 {
+		return run, true, nil
+	}
+
+	run = models.PipelineRun{
+		Source:    src.Name(),
+		Trigger:   PipelineTriggerManual,
+		Status:    PipelineRunQueued,
+		StartedAt: time.Now(),
+	}
+	if err := database.DB.Create(&run).Error; err != nil {
+		return run, false, err
+	}
+
+	select {
+	case refreshJobs <- refreshJob{runID: run.ID, src: src}:
+		return run, false, nil
+	default:
+		finishPipelineRun(&run, ErrRefreshQueueFull)
+		return run, false, ErrRefreshQueueFull
+	}
+}
+
+// RunRefreshWorker executes queued refreshes one at a time until ctx is
+// cancelled. Jobs still queued at shutdown are marked failed.
+func RunRefreshWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case job := <-refreshJobs:
+					abandonRefresh(job)
+				default:
+					return
+				}
+			}
+		case job := <-refreshJobs:
+			runRefreshJob(ctx, job)
+		}
+	}
+}
+
+func runRefreshJob(ctx context.Context, job refreshJob) {
+	run, err := GetPipelineRun(job.runID)
+	if err != nil {
+		log.Printf("refresh: could not load job %d: %v", job.runID, err)
+		return
+	}
+
+	run.Status = PipelineRunRunning
+	run.StartedAt = time.Now()
+	if err := database.DB.Save(&run).Error; err != nil {
+		log.Printf("refresh: could not start job %d: %v", run.ID, err)
+	}
+
+	if err := executePipelineRun(ctx, job.src, &run); err != nil {
+		log.Printf("refresh job %d (%s) failed: %v", run.ID, job.src.Name(), err)
+	}
+}
+
+func abandonRefresh(job refreshJob) {
+	run, err := GetPipelineRun(job.runID)
+	if err != nil {
+		return
+	}
+	finishPipelineRun(&run, errors.New("server shut down before the refresh started"))
+}
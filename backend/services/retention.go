@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"yakkaw_dashboard/cache"
+	"yakkaw_dashboard/config"
+	"yakkaw_dashboard/database"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// RetentionDetach detaches old partitions; the tables stay in the
+	// database, outside readings, until an operator archives and drops them.
+	RetentionDetach = "detach"
+	// RetentionDrop drops old partitions.
+	RetentionDrop = "drop"
+)
+
+// RetentionOptions configures ApplyRetention.
+type RetentionOptions struct {
+	// KeepMonths whole months before the current one stay in readings.
+	KeepMonths int
+	Mode       string
+	// DryRun only reports the partitions that would be retired.
+	DryRun bool
+}
+
+// RetiredPartition reports one partition handled by ApplyRetention.
+type RetiredPartition struct {
+	Name     string    `json:"name"`
+	Month    time.Time `json:"month"`
+	Readings int64     `json:"readings"`
+	Stations int64     `json:"stations"`
+	Mode     string    `json:"mode"`
+}
+
+// rollupPartitionSQL summarises one raw partition into readings_monthly.
+// %s is a generated partition name.
+const rollupPartitionSQL = `
+INSERT INTO readings_monthly (dvid, month, readings,
+	pm25_avg, pm25_min, pm25_max, pm10_avg, pm10_min, pm10_max,
+	aqi_avg, aqi_max, temperature_avg, humidity_avg, rolled_up_at)
+SELECT dvid, ?::date, COUNT(*),
+	AVG(NULLIF(pm25, 0)), MIN(NULLIF(pm25, 0)), MAX(NULLIF(pm25, 0)),
+	AVG(NULLIF(pm10, 0)), MIN(NULLIF(pm10, 0)), MAX(NULLIF(pm10, 0)),
+	AVG(NULLIF(aqi, 0)), MAX(NULLIF(aqi, 0)),
+	AVG(temperature), AVG(humidity), NOW()
+FROM %s
+GROUP BY dvid
+ON CONFLICT (dvid, month) DO UPDATE SET
+	readings = EXCLUDED.readings,
+	pm25_avg = EXCLUDED.pm25_avg, pm25_min = EXCLUDED.pm25_min, pm25_max = EXCLUDED.pm25_max,
+	pm10_avg = EXCLUDED.pm10_avg, pm10_min = EXCLUDED.pm10_min, pm10_max = EXCLUDED.pm10_max,
+	aqi_avg = EXCLUDED.aqi_avg, aqi_max = EXCLUDED.aqi_max,
+	temperature_avg = EXCLUDED.temperature_avg, humidity_avg = EXCLUDED.humidity_avg,
+	rolled_up_at = EXCLUDED.rolled_up_at`
+
+// ApplyRetention retires every monthly partition that ends before the
+// current month minus KeepMonths. A partition is only retired once the hourly
+// and daily rollups cover all of its readings (missing hours are rebuilt
+// first); it is then summarised into readings_monthly and detached or dropped
+// in one transaction, with writes to it blocked while the coverage is checked.
+func ApplyRetention(ctx context.Context, now time.Time, opts RetentionOptions) ([]RetiredPartition, error) {
+	if opts.KeepMonths <= 0 {
+		return nil, fmt.Errorf("retention needs at least one month to keep")
+	}
+	if opts.Mode != RetentionDetach && opts.Mode != RetentionDrop {
+		return nil, fmt.Errorf("unknown retention mode %q", opts.Mode)
+	}
+
+	db := database.DB.WithContext(ctx)
+	parts, err := database.ReadingsPartitions(db)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := database.MonthStart(now).AddDate(0, -opts.KeepMonths, 0)
+
+	var retired []RetiredPartition
+	for _, p := range parts {
+		if !p.Month.Before(cutoff) {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return retired, err
+		}
+
+		r := RetiredPartition{Name: p.Name, Month: p.Month, Mode: opts.Mode}
+		if err := countPartition(db, p, &r); err != nil {
+			return retired, fmt.Errorf("%s: %w", p.Name, err)
+		}
+		if !opts.DryRun {
+			if err := ensureRollupCoverage(ctx, p, r.Readings); err != nil {
+				return retired, fmt.Errorf("%s: %w", p.Name, err)
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return retirePartition(tx, p, opts.Mode, &r)
+			})
+			if err != nil {
+				return retired, fmt.Errorf("%s: %w", p.Name, err)
+			}
+		}
+		retired = append(retired, r)
+	}
+	return retired, nil
+}
+
+func countPartition(db *gorm.DB, p database.ReadingsPartition, r *RetiredPartition) error {
+	return db.Raw(`SELECT COUNT(*), COUNT(DISTINCT dvid) FROM `+p.Name).
+		Row().Scan(&r.Readings, &r.Stations)
+}
+
+// ensureRollupCoverage rebuilds the partition's month of rollups when the
+// hourly rollups do not account for every reading in it.
+func ensureRollupCoverage(ctx context.Context, p database.ReadingsPartition, readings int64) error {
+	from, to := p.Month, p.Month.AddDate(0, 1, 0)
+	covered, err := rollupCoverage(database.DB.WithContext(ctx), from, to)
+	if err != nil || covered == readings {
+		return err
+	}
+	log.Printf("retention: rollups cover %d of %d readings in %s; rebuilding", covered, readings, p.Name)
+	_, err = RebuildRollups(ctx, from, to)
+	return err
+}
+
+func retirePartition(tx *gorm.DB, p database.ReadingsPartition, mode string, r *RetiredPartition) error {
+	// Late readings (e.g. a backfill) must not slip in between the check and
+	// the detach.
+	if err := tx.Exec(`LOCK TABLE ` + p.Name + ` IN SHARE MODE`).Error; err != nil {
+		return err
+	}
+	if err := countPartition(tx, p, r); err != nil {
+		return err
+	}
+	covered, err := rollupCoverage(tx, p.Month, p.Month.AddDate(0, 1, 0))
+	if err != nil {
+		return err
+	}
+	if covered != r.Readings {
+		return fmt.Errorf("rollups cover %d of %d readings; partition kept", covered, r.Readings)
+	}
+
+	month := p.Month.Format("2006-01-02")
+	if err := tx.Exec(fmt.Sprintf(rollupPartitionSQL, p.Name), month).Error; err != nil {
+		return fmt.Errorf("monthly roll-up: %w", err)
+	}
+
+	if mode == RetentionDrop {
+		return tx.Exec(`DROP TABLE ` + p.Name).Error
+	}
+	return tx.Exec(`ALTER TABLE readings DETACH PARTITION ` + p.Name).Error
+}
+
+// RunPartitionMaintenance creates the upcoming monthly partitions and, when
+// RETENTION_RAW_MONTHS is set, retires partitions past the retention window.
+func RunPartitionMaintenance(ctx context.Context, cfg *config.Config) {
+	now := time.Now()
+	if err := database.EnsureReadingsPartitions(database.DB.WithContext(ctx), now, cfg.PartitionAheadMonths); err != nil {
+		log.Printf("partitions: ensure upcoming partitions failed: %v", err)
+	}
+	if cfg.RetentionRawMonths == 0 {
+		return
+	}
+
+	retired, err := ApplyRetention(ctx, now, RetentionOptions{
+		KeepMonths: cfg.RetentionRawMonths,
+		Mode:       cfg.RetentionMode,
+	})
+	for _, r := range retired {
+		log.Printf("retention: %s %s (%d readings from %d stations rolled up)", r.Mode, r.Name, r.Readings, r.Stations)
+	}
+	if err != nil {
+		log.Printf("retention failed: %v", err)
+	}
+}
+
+// NewPartitionScheduler runs RunPartitionMaintenance on the leader replica.
+func NewPartitionScheduler(cfg *config.Config) *Scheduler {
+	return &Scheduler{
+		Name:     "partitions",
+		Interval: cfg.PartitionMaintenanceInterval,
+		Lock:     cache.NewLock("partitions:leader", 2*cfg.PartitionMaintenanceInterval),
+		Job: func(ctx context.Context) {
+			RunPartitionMaintenance(ctx, cfg)
+		},
+	}
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rollupMetrics are the summarised metrics and how a raw value is read. Zero
+// PM/AQI values are sensor drop-outs, not clean air.
+var rollupMetrics = []struct{ Name, Raw string }{
+	{"pm25", "NULLIF(pm25, 0)"},
+	{"pm10", "NULLIF(pm10, 0)"},
+	{"aqi", "NULLIF(aqi, 0)"},
+	{"temperature", "temperature"},
+	{"humidity", "humidity"},
+}
+
+// rollupProvinceSQL is a reading's province: the canonical name parsed from
+// its station's address (see thaiaddress).
+const rollupProvinceSQL = `NULLIF(province, '')`
+
+// rollupBatchHours dirty hours are refreshed per transaction.
+const rollupBatchHours = 24
+
+// rollupLockKey serialises rollup refreshes across replicas
+// (pg_advisory_xact_lock).
+const rollupLockKey = 7146001
+
+const hourMillis = int64(time.Hour / time.Millisecond)
+
+var rollupHourSQL, rollupDaySQL = buildRollupSQL()
+
+// buildRollupSQL renders the hourly rebuild (raw readings of one hour,
+// grouped per dvid, province and place in one scan) and the daily rebuild
+// (the day's hourly rows combined; averages weighted by count).
+func buildRollupSQL() (string, string) {
+	var cols, raw, hourAggs, dayAggs []string
+	for _, m := range rollupMetrics {
+		cols = append(cols, fmt.Sprintf("%[1]s_avg, %[1]s_min, %[1]s_max, %[1]s_count", m.Name))
+		raw = append(raw, fmt.Sprintf("%s AS %s", m.Raw, m.Name))
+		hourAggs = append(hourAggs, fmt.Sprintf("AVG(%[1]s), MIN(%[1]s), MAX(%[1]s), COUNT(%[1]s)", m.Name))
+		dayAggs = append(dayAggs, fmt.Sprintf(
+			"SUM(%[1]s_avg * %[1]s_count) / NULLIF(SUM(%[1]s_count), 0), MIN(%[1]s_min), MAX(%[1]s_max), SUM(%[1]s_count)", m.Name))
+	}
+	columns := "scope, key, bucket, readings, " + strings.Join(cols, ", ") + ", updated_at"
+
+	hour := `
+INSERT INTO rollup_hourly (` + columns + `)
+SELECT
+	CASE WHEN GROUPING(dvid) = 0 THEN 'dvid' WHEN GROUPING(province) = 0 THEN 'province' ELSE 'place' END,
+	COALESCE(dvid, province, place), CAST(@bucket AS timestamp), COUNT(*),
+	` + strings.Join(hourAggs, ",\n\t") + `,
+	NOW()
+FROM (
+	SELECT dvid, ` + rollupProvinceSQL + ` AS province, NULLIF(trim(place), '') AS place,
+		` + strings.Join(raw, ", ") + `
+	FROM sensor_data
+	WHERE timestamp >= @from AND timestamp < @to
+) s
+GROUP BY GROUPING SETS ((dvid), (province), (place))
+HAVING COALESCE(dvid, province, place) IS NOT NULL`
+
+	day := `
+INSERT INTO rollup_daily (` + columns + `)
+SELECT scope, key, CAST(@day AS timestamp), SUM(readings),
+	` + strings.Join(dayAggs, ",\n\t") + `,
+	NOW()
+FROM rollup_hourly
+WHERE bucket >= CAST(@day AS timestamp) AND bucket < CAST(@day AS timestamp) + interval '1 day'
+GROUP BY scope, key`
+
+	return hour, day
+}
+
+// markRollupsDirty queues the hours touched by rows for RefreshRollups. It
+// runs inside the ingest transaction.
+func markRollupsDirty(tx *gorm.DB, rows []models.SensorData) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	now := time.Now()
+	seen := map[int64]bool{}
+	var dirty []models.RollupDirtyHour
+	for _, r := range rows {
+		h := r.Timestamp - r.Timestamp%hourMillis
+		if !seen[h] {
+			seen[h] = true
+			dirty = append(dirty, models.RollupDirtyHour{Hour: h, MarkedAt: now})
+		}
+	}
+	// Updating (not ignoring) a queued hour waits for a refresh that is
+	// processing it, so the hour is queued again after that refresh commits.
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hour"}},
+		DoUpdates: clause.AssignmentColumns([]string{"marked_at"}),
+	}).Create(&dirty).Error
+}
+
+// RefreshRollups recomputes the hourly and daily rollups of every queued
+// hour and returns how many hours it processed. Refreshes are serialised
+// with an advisory lock; an hour with no raw readings left (e.g. retired by
+// retention) keeps its rollups.
+func RefreshRollups(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n := 0
+		err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(`SELECT pg_advisory_xact_lock(?)`, rollupLockKey).Error; err != nil {
+				return err
+			}
+			var dirty []models.RollupDirtyHour
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Order("hour").Limit(rollupBatchHours).Find(&dirty).Error; err != nil {
+				return err
+			}
+
+			days := map[string]bool{}
+			hours := make([]int64, 0, len(dirty))
+			for _, d := range dirty {
+				day, err := refreshRollupHour(tx, d.Hour)
+				if err != nil {
+					return fmt.Errorf("hour %d: %w", d.Hour, err)
+				}
+				days[day] = true
+				hours = append(hours, d.Hour)
+			}
+			for day := range days {
+				if err := refreshRollupDay(tx, day); err != nil {
+					return fmt.Errorf("day %s: %w", day, err)
+				}
+			}
+			n = len(hours)
+			if n == 0 {
+				return nil
+			}
+			return tx.Where("hour IN ?", hours).Delete(&models.RollupDirtyHour{}).Error
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < rollupBatchHours {
+			return total, nil
+		}
+	}
+}
+
+// refreshRollupHour rebuilds the hourly rows of the hour starting at hour
+// (epoch ms) and returns the Bangkok day it belongs to.
+func refreshRollupHour(tx *gorm.DB, hour int64) (string, error) {
+	start := time.UnixMilli(hour).In(database.Bangkok)
+	bucket := rollupBucket(start)
+	day := start.Format("2006-01-02")
+
+	var raw int64
+	if err := tx.Raw(`SELECT COUNT(*) FROM readings WHERE timestamp >= ? AND timestamp < ?`,
+		hour, hour+hourMillis).Scan(&raw).Error; err != nil {
+		return day, err
+	}
+	if raw == 0 {
+		return day, nil
+	}
+
+	if err := tx.Exec(`DELETE FROM rollup_hourly WHERE bucket = ?::timestamp`, bucket).Error; err != nil {
+		return day, err
+	}
+	return day, tx.Exec(rollupHourSQL, map[string]interface{}{
+		"bucket": bucket,
+		"from":   hour,
+		"to":     hour + hourMillis,
+	}).Error
+}
+
+func refreshRollupDay(tx *gorm.DB, day string) error {
+	if err := tx.Exec(`DELETE FROM rollup_daily WHERE bucket = ?::timestamp`, day).Error; err != nil {
+		return err
+	}
+	return tx.Exec(rollupDaySQL, map[string]interface{}{"day": day}).Error
+}
+
+// RebuildRollups queues every hour with readings in [from, to) and refreshes
+// the queue, e.g. after the rollup definition changed or for history that
+// predates the rollup tables.
+func RebuildRollups(ctx context.Context, from, to time.Time) (int, error) {
+	err := database.DB.WithContext(ctx).Exec(`
+		INSERT INTO rollup_dirty_hours (hour, marked_at)
+		SELECT DISTINCT timestamp - timestamp % ?, NOW()
+		FROM readings
+		WHERE timestamp >= ? AND timestamp < ?
+		ON CONFLICT (hour) DO NOTHING`,
+		hourMillis, from.UnixMilli(), to.UnixMilli()).Error
+	if err != nil {
+		return 0, err
+	}
+	return RefreshRollups(ctx)
+}
+
+// QueueInitialRollups queues every hour with readings when the rollups have
+// never been built, so an upgraded database gets its history rolled up by
+// the next pipeline runs instead of serving empty charts.
+func QueueInitialRollups() error {
+	var built bool
+	err := database.DB.Raw(`SELECT EXISTS (SELECT 1 FROM rollup_hourly) OR EXISTS (SELECT 1 FROM rollup_dirty_hours)`).
+		Scan(&built).Error
+	if err != nil || built {
+		return err
+	}
+	res := database.DB.Exec(`
+		INSERT INTO rollup_dirty_hours (hour, marked_at)
+		SELECT DISTINCT timestamp - timestamp % ?, NOW() FROM readings
+		ON CONFLICT (hour) DO NOTHING`, hourMillis)
+	if res.RowsAffected > 0 {
+		log.Printf("rollups: queued %d hours of existing readings", res.RowsAffected)
+	}
+	return res.Error
+}
+
+// rollupCoverage returns how many readings in [from, to) the dvid-scope
+// hourly rollups account for.
+func rollupCoverage(tx *gorm.DB, from, to time.Time) (int64, error) {
+	var covered int64
+	err := tx.Raw(`
+		SELECT COALESCE(SUM(readings), 0) FROM rollup_hourly
+		WHERE scope = 'dvid' AND bucket >= ?::timestamp AND bucket < ?::timestamp`,
+		rollupBucket(from), rollupBucket(to)).Scan(&covered).Error
+	return covered, err
+}
+
+// ---------- querying rollups ----------
+
+// hasRollupMetric reports whether metric (a sensor_data column) is rolled up.
+func hasRollupMetric(metric string) bool {
+	for _, m := range rollupMetrics {
+		if m.Name == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// rollupBucket formats t as a Bangkok wall-clock bucket value.
+func rollupBucket(t time.Time) string {
+	return t.In(database.Bangkok).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"yakkaw_dashboard/cache"
+)
+
+// Scheduler runs Job every Interval plus a random delay of up to Jitter.
+// When Lock is set, the job only runs on the replica holding the lock, and the
+// lease is renewed while the job is running; the job's context is cancelled
+// once the lease is lost.
+type Scheduler struct {
+	Name     string
+	Interval time.Duration
+	Jitter   time.Duration
+	Lock     *cache.Lock
+	Job      func(ctx context.Context)
+}
+
+// Run blocks until ctx is cancelled, then releases the leader lock.
+func (s *Scheduler) Run(ctx context.Context) {
+	defer s.release()
+
+	for {
+		if s.lead(ctx) {
+			s.runJob(ctx)
+		}
+
+		timer := time.NewTimer(s.nextDelay())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Scheduler) nextDelay() time.Duration {
+	if s.Jitter <= 0 {
+		return s.Interval
+	}
+	return s.Interval + time.Duration(rand.Int64N(int64(s.Jitter)))
+}
+
+func (s *Scheduler) lead(ctx context.Context) bool {
+	if s.Lock == nil {
+		return true
+	}
+	ok, err := s.Lock.Acquire(ctx)
+	if err != nil {
+		log.Printf("scheduler %s: leader lock: %v", s.Name, err)
+		return false
+	}
+	return ok
+}
+
+func (s *Scheduler) runJob(ctx context.Context) {
+	if s.Lock == nil {
+		s.Job(ctx)
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go s.renew(jobCtx, cancel, done)
+	defer close(done)
+	s.Job(jobCtx)
+}
+
+// renew keeps the lease alive for jobs that outlast a third of its TTL. When
+// another replica holds the lock, or renewing has failed for a whole TTL (so
+// the lease may have expired and been taken), it cancels the job so two
+// replicas never run it at once.
+func (s *Scheduler) renew(ctx context.Context, cancel context.CancelFunc, done <-chan struct{}) {
+	ticker := time.NewTicker(s.Lock.TTL() / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := s.Lock.Acquire(ctx)
+			switch {
+			case err == nil && ok:
+				renewed = time.Now()
+			case err == nil:
+				log.Printf("scheduler %s: lost leader lock during run; stopping the job", s.Name)
+				cancel()
+				return
+			case time.Since(renewed) >= s.Lock.TTL():
+				log.Printf("scheduler %s: leader lock not renewed for %s (err=%v); stopping the job", s.Name, s.Lock.TTL(), err)
+				cancel()
+				return
+			default:
+				log.Printf("scheduler %s: renew leader lock: %v", s.Name, err)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) release() {
+	if s.Lock == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Lock.Release(ctx); err != nil {
+		log.Printf("scheduler %s: release leader lock: %v", s.Name, err)
+	}
+}
+
+// NewPipelineScheduler builds the ingest scheduler that runs every source in
+// turn on the leader replica.
+func NewPipelineScheduler(interval, jitter time.Duration, sources []Source) *Scheduler {
+	// The lease outlives a full cycle so the current leader keeps it between
+	// runs; another replica only takes over once the leader stops renewing.
+	ttl := 2 * (interval + jitter)
+	return &Scheduler{
+		Name:     "pipeline",
+		Interval: interval,
+		Jitter:   jitter,
+		Lock:     cache.NewLock("pipeline:leader", ttl),
+		Job: func(ctx context.Context) {
+			for _, src := range sources {
+				if ctx.Err() != nil {
+					return
+				}
+				FetchAndStoreData(ctx, src)
+			}
+		},
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/cache"
+)
+
+func TestSchedulerStopsJobWithoutLease(t *testing.T) {
+	// Without Redis every renewal fails, so the lease is lost after one TTL.
+	saved := cache.Rdb
+	cache.Rdb = nil
+	t.Cleanup(func() { cache.Rdb = saved })
+
+	stopped := make(chan error, 1)
+	s := &Scheduler{
+		Name: "test",
+		Lock: cache.NewLock("test:leader", 30*time.Millisecond),
+		Job: func(ctx context.Context) {
+			select {
+			case <-ctx.Done():
+				stopped <- ctx.Err()
+			case <-time.After(time.Second):
+				stopped <- nil
+			}
+		},
+	}
+
+	start := time.Now()
+	s.runJob(context.Background())
+	if err := <-stopped; err == nil {
+		t.Fatal("job ran on without the lease")
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("job stopped after %s, before the lease could expire", d)
+	}
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+
+	"gorm.io/gorm"
+)
+
+// NotificationCategorySystem marks notifications raised by the backend for
+// admins; they are hidden from the public notification feed.
+const NotificationCategorySystem = "system"
+
+// SchemaDiff is the difference between a payload's records and the
+// expected record schema.
+type SchemaDiff struct {
+	Added       []string                 `json:"added"`
+	Removed     []string                 `json:"removed"`
+	TypeChanged []models.FieldTypeChange `json:"type_changed"`
+	Records     int                      `json:"records"`
+}
+
+// Empty reports whether the payload matched the expected schema.
+func (d SchemaDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.TypeChanged) == 0
+}
+
+// Fingerprint identifies a diff independent of how many records showed it.
+func (d SchemaDiff) Fingerprint() string {
+	var b strings.Builder
+	b.WriteString("+" + strings.Join(d.Added, ",") + "\n")
+	b.WriteString("-" + strings.Join(d.Removed, ",") + "\n")
+	for _, c := range d.TypeChanged {
+		fmt.Fprintf(&b, "~%s:%s>%s\n", c.Field, c.Expected, strings.Join(c.Observed, "|"))
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Summary renders the diff for a notification message.
+func (d SchemaDiff) Summary() string {
+	var parts []string
+	if len(d.Added) > 0 {
+		parts = append(parts, "added: "+strings.Join(d.Added, ", "))
+	}
+	if len(d.Removed) > 0 {
+		parts = append(parts, "removed: "+strings.Join(d.Removed, ", "))
+	}
+	if len(d.TypeChanged) > 0 {
+		changes := make([]string, 0, len(d.TypeChanged))
+		for _, c := range d.TypeChanged {
+			changes = append(changes, fmt.Sprintf("%s %s→%s", c.Field, c.Expected, strings.Join(c.Observed, "/")))
+		}
+		parts = append(parts, "type changed: "+strings.Join(changes, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// SchemaChecker is implemented by sources whose payloads can be compared
+// against the schema the decoder expects.
+type SchemaChecker interface {
+	CheckSchema(body []byte) (SchemaDiff, error)
+}
+
+// sensorDataSchema maps every models.SensorData JSON field to its expected
+// JSON type ("string" or "number").
+var sensorDataSchema = func() map[string]string {
+	t := reflect.TypeOf(models.SensorData{})
+	schema := make(map[string]string, len(sensorDataFields))
+	for name, idx := range sensorDataFields {
+		switch t.Field(idx).Type.Kind() {
+		case reflect.String:
+			schema[name] = "string"
+		default:
+			schema[name] = "number"
+		}
+	}
+	return schema
+}()
+
+// CheckSchema compares the records of a Yakkaw envelope with models.SensorData.
+func (s *YakkawSource) CheckSchema(body []byte) (SchemaDiff, error) {
+	var envelope struct {
+		Response []map[string]json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return SchemaDiff{}, err
+	}
+	return diffRecords(envelope.Response, sensorDataSchema), nil
+}
+
+// diffRecords reports fields no record is expected to carry, expected fields
+// absent from every record, and fields seen with a JSON type other than the
+// expected one. Nulls are ignored.
+func diffRecords(records []map[string]json.RawMessage, schema map[string]string) SchemaDiff {
+	diff := SchemaDiff{Records: len(records)}
+	if len(records) == 0 {
+		return diff
+	}
+
+	seen := map[string]bool{}
+	observed := map[string]map[string]bool{}
+	for _, rec := range records {
+		for field, raw := range rec {
+			seen[field] = true
+			typ := jsonType(raw)
+			if typ == "null" {
+				continue
+			}
+			if observed[field] == nil {
+				observed[field] = map[string]bool{}
+			}
+			observed[field][typ] = true
+		}
+	}
+
+	for field := range seen {
+		if _, ok := schema[field]; !ok {
+			diff.Added = append(diff.Added, field)
+		}
+	}
+	for field, expected := range schema {
+		if !seen[field] {
+			diff.Removed = append(diff.Removed, field)
+			continue
+		}
+		var others []string
+		for typ := range observed[field] {
+			if typ != expected {
+				others = append(others, typ)
+			}
+		}
+		if len(others) > 0 {
+			sort.Strings(others)
+			diff.TypeChanged = append(diff.TypeChanged, models.FieldTypeChange{
+				Field: field, Expected: expected, Observed: others,
+			})
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.TypeChanged, func(i, j int) bool {
+		return diff.TypeChanged[i].Field < diff.TypeChanged[j].Field
+	})
+	return diff
+}
+
+func jsonType(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "null"
+	}
+	switch raw[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+// checkSchemaDrift compares a fetched payload with the expected schema and
+// records the result. Drift detection never fails the ingest.
+func checkSchemaDrift(source string, checker SchemaChecker, body []byte) {
+	diff, err := checker.CheckSchema(body)
+	if err == nil {
+		err = recordSchemaDrift(source, diff)
+	}
+	if err != nil {
+		log.Printf("pipeline: schema drift check for %s failed: %v", source, err)
+		return
+	}
+	if !diff.Empty() {
+		log.Printf("pipeline: schema drift on %s: %s", source, diff.Summary())
+	}
+}
+
+// recordSchemaDrift stores diff for source. A diff identical to the source's
+// latest open drift only bumps its counters; a new diff is stored and raises
+// a system notification. A clean payload resolves the open drift.
+func recordSchemaDrift(source string, diff SchemaDiff) error {
+	now := time.Now()
+	var open models.SchemaDrift
+	err := database.DB.Where("source = ? AND resolved_at IS NULL", source).
+		Order("last_seen_at DESC").First(&open).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	hasOpen := err == nil
+
+	if diff.Empty() {
+		if !hasOpen {
+			return nil
+		}
+		return database.DB.Model(&models.SchemaDrift{}).
+			Where("source = ? AND resolved_at IS NULL", source).
+			Update("resolved_at", now).Error
+	}
+
+	fingerprint := diff.Fingerprint()
+	if hasOpen && open.Fingerprint == fingerprint {
+		return database.DB.Model(&open).Updates(map[string]interface{}{
+			"occurrences":  gorm.Expr("occurrences + 1"),
+			"last_seen_at": now,
+			"records":      diff.Records,
+		}).Error
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if hasOpen {
+			if err := tx.Model(&open).Update("resolved_at", now).Error; err != nil {
+				return err
+			}
+		}
+		notification := models.Notification{
+			Title:    "Upstream schema drift: " + source,
+			Message:  diff.Summary(),
+			Category: NotificationCategorySystem,
+		}
+		if err := tx.Create(&notification).Error; err != nil {
+			return err
+		}
+		drift := models.SchemaDrift{
+			Source:         source,
+			Fingerprint:    fingerprint,
+			Added:          diff.Added,
+			Removed:        diff.Removed,
+			TypeChanged:    diff.TypeChanged,
+			Records:        diff.Records,
+			Occurrences:    1,
+			FirstSeenAt:    now,
+			LastSeenAt:     now,
+			NotificationID: &notification.ID,
+		}
+		return tx.Create(&drift).Error
+	})
+}
+
+// LatestSchemaDrifts returns the most recent drift per source, or only for
+// source when given.
+func LatestSchemaDrifts(source string) ([]models.SchemaDrift, error) {
+	latest := database.DB.Raw(`
+		SELECT DISTINCT ON (source) id
+		FROM schema_drifts
+		ORDER BY source, last_seen_at DESC`)
+	q := database.DB.Where("id IN (?)", latest)
+	if source != "" {
+		q = q.Where("source = ?", source)
+	}
+
+	var drifts []models.SchemaDrift
+	err := q.Order("source").Find(&drifts).Error
+	return drifts, err
+}
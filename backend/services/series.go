@@ -0,0 +1,403 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+	"yakkaw_dashboard/thaiaddress"
+)
+
+// ErrInvalidSeriesQuery wraps every validation error of GetSeries.
+var ErrInvalidSeriesQuery = errors.New("invalid series query")
+
+const (
+	// maxSeriesBuckets caps the buckets per series ((to - from) / interval).
+	maxSeriesBuckets = 2000
+	// maxSeriesPoints caps buckets × series of one response.
+	maxSeriesPoints = 200000
+	// maxRawSeriesRange caps windows answered from raw readings (medians,
+	// percentiles, 5 minute buckets, metrics that are not rolled up).
+	maxRawSeriesRange = 366 * 24 * time.Hour
+)
+
+// Series group keys.
+const (
+	SeriesGroupProvince = "province"
+	SeriesGroupPlace    = "place"
+	SeriesGroupDVID     = "dvid"
+	SeriesGroupNone     = "none"
+)
+
+// seriesMetrics are the sensor_data columns a series can aggregate.
+var seriesMetrics = map[string]bool{
+	"pm25": true, "pm10": true, "pm100": true, "aqi": true,
+	"av1h": true, "av3h": true, "av6h": true, "av12h": true, "av24h": true,
+	"temperature": true, "humidity": true, "pres": true,
+}
+
+// seriesAggregators are the aggregates a series can take; medians and
+// percentiles need raw readings.
+var seriesAggregators = map[string]bool{
+	"avg": true, "min": true, "max": true, "median": true, "p90": true, "count": true,
+}
+
+// seriesInterval is a bucket width. Buckets are Asia/Bangkok wall-clock
+// periods; weeks start on Monday.
+type seriesInterval struct {
+	start func(t time.Time) time.Time
+	next  func(t time.Time) time.Time
+	// rollup is the rollup table that can answer the interval ("" for none).
+	rollup string
+}
+
+var seriesIntervals = map[string]seriesInterval{
+	"5m": {
+		start: func(t time.Time) time.Time {
+			t = t.In(database.Bangkok)
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()/5*5, 0, 0, database.Bangkok)
+		},
+		next: func(t time.Time) time.Time { return t.Add(5 * time.Minute) },
+	},
+	"1h": {
+		start: func(t time.Time) time.Time {
+			t = t.In(database.Bangkok)
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, database.Bangkok)
+		},
+		next:   func(t time.Time) time.Time { return t.Add(time.Hour) },
+		rollup: "rollup_hourly",
+	},
+	"1d": {
+		start:  bangkokDay,
+		next:   func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+		rollup: "rollup_daily",
+	},
+	"1w": {
+		start: func(t time.Time) time.Time {
+			d := bangkokDay(t)
+			return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+		},
+		next:   func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+		rollup: "rollup_daily",
+	},
+	"1M": {
+		start: func(t time.Time) time.Time {
+			t = t.In(database.Bangkok)
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, database.Bangkok)
+		},
+		next:   func(t time.Time) time.Time { return t.AddDate(0, 1, 0) },
+		rollup: "rollup_daily",
+	},
+}
+
+func bangkokDay(t time.Time) time.Time {
+	t = t.In(database.Bangkok)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, database.Bangkok)
+}
+
+// SeriesQuery selects one metric of the readings in [From, To), aggregated
+// per Interval bucket and per GroupBy key. Filters of the same kind are ORed,
+// different kinds ANDed; Places match case-insensitive substrings of the
+// place name and Provinces any spelling LookupProvince understands.
+// ExcludeAnomalies leaves out readings flagged by DetectAnomalies, which
+// rollups still contain, so such queries always read raw readings.
+type SeriesQuery struct {
+	From       time.Time
+	To         time.Time
+	Interval   string
+	Metric     string
+	GroupBy    string
+	Aggregator string
+	Provinces  []string
+	Places     []string
+	DVIDs      []string
+
+	ExcludeAnomalies bool
+}
+
+// SeriesResult is the answer to a SeriesQuery. From is aligned down to the
+// start of its bucket; every series has a point for every bucket, with a nil
+// Value where no reading had the metric.
+type SeriesResult struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Interval   string    `json:"interval"`
+	Metric     string    `json:"metric"`
+	Aggregator string    `json:"aggregator"`
+	GroupBy    string    `json:"group_by"`
+	// Source is the table the values were computed from: rollup_hourly,
+	// rollup_daily or readings.
+	Source string   `json:"source"`
+	Series []Series `json:"series"`
+}
+
+// Series is the points of one group. Key identifies the group (ISO province
+// code, place name, dvid, or "all" without grouping); Label is its display
+// name.
+type Series struct {
+	Key    string        `json:"key"`
+	Label  string        `json:"label"`
+	Points []SeriesPoint `json:"points"`
+}
+
+// SeriesPoint is one bucket: its Asia/Bangkok start, the aggregate and the
+// number of readings that had the metric.
+type SeriesPoint struct {
+	Time      time.Time `json:"time"`
+	Timestamp int64     `json:"timestamp"`
+	Value     *float64  `json:"value"`
+	Count     int64     `json:"count"`
+}
+
+// seriesPlan is a validated SeriesQuery.
+type seriesPlan struct {
+	q         SeriesQuery
+	interval  seriesInterval
+	buckets   []time.Time
+	provinces []thaiaddress.Province
+}
+
+func invalidSeries(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSeriesQuery, fmt.Sprintf(format, args...))
+}
+
+func planSeries(q SeriesQuery) (seriesPlan, error) {
+	p := seriesPlan{q: q}
+	var ok bool
+	if p.interval, ok = seriesIntervals[q.Interval]; !ok {
+		return p, invalidSeries("interval must be one of 5m, 1h, 1d, 1w, 1M")
+	}
+	if !seriesMetrics[q.Metric] {
+		return p, invalidSeries("unknown metric %q", q.Metric)
+	}
+	if !seriesAggregators[q.Aggregator] {
+		return p, invalidSeries("aggregator must be one of avg, min, max, median, p90, count")
+	}
+	switch q.GroupBy {
+	case SeriesGroupProvince, SeriesGroupPlace, SeriesGroupDVID, SeriesGroupNone:
+	default:
+		return p, invalidSeries("group_by must be one of province, place, dvid, none")
+	}
+	if !q.To.After(q.From) {
+		return p, invalidSeries("to must be after from")
+	}
+	for _, s := range q.Provinces {
+		prov, ok := thaiaddress.LookupProvince(s)
+		if !ok {
+			return p, invalidSeries("unknown province %q", s)
+		}
+		p.provinces = append(p.provinces, prov)
+	}
+
+	for b := p.interval.start(q.From); b.Before(q.To); b = p.interval.next(b) {
+		if len(p.buckets) == maxSeriesBuckets {
+			return p, invalidSeries("more than %d buckets; shorten the range or use a longer interval", maxSeriesBuckets)
+		}
+		p.buckets = append(p.buckets, b)
+	}
+	p.q.From = p.buckets[0]
+	return p, nil
+}
+
+// rollupScope returns the rollup scope that answers the plan exactly, or ""
+// when it has to read raw readings. Rollups carry avg/min/max/count per
+// station, province and place, so a query can use them when the grouping and
+// the filters are all on the same one of those.
+func (p seriesPlan) rollupScope() string {
+	switch p.q.Aggregator {
+	case "avg", "min", "max", "count":
+	default:
+		return ""
+	}
+	if p.interval.rollup == "" || !hasRollupMetric(p.q.Metric) || p.q.ExcludeAnomalies {
+		return ""
+	}
+
+	var filtered []string
+	if len(p.provinces) > 0 {
+		filtered = append(filtered, models.RollupScopeProvince)
+	}
+	if len(p.q.Places) > 0 {
+		filtered = append(filtered, models.RollupScopePlace)
+	}
+	if len(p.q.DVIDs) > 0 {
+		filtered = append(filtered, models.RollupScopeDVID)
+	}
+
+	scope := p.q.GroupBy
+	if scope == SeriesGroupNone {
+		scope = models.RollupScopeDVID
+		if len(filtered) == 1 {
+			scope = filtered[0]
+		}
+	}
+	for _, f := range filtered {
+		if f != scope {
+			return ""
+		}
+	}
+	return scope
+}
+
+type SeriesService struct {
+	Series   repository.SeriesRepository
+	Stations repository.StationRepository
+}
+
+// NewSeriesService creates a new SeriesService instance
+func NewSeriesService(series repository.SeriesRepository, stations repository.StationRepository) *SeriesService {
+	return &SeriesService{Series: series, Stations: stations}
+}
+
+// GetSeries answers a SeriesQuery from the rollups when they hold the
+// aggregate, otherwise from raw readings.
+func (s *SeriesService) GetSeries(q SeriesQuery) (SeriesResult, error) {
+	p, err := planSeries(q)
+	if err != nil {
+		return SeriesResult{}, err
+	}
+
+	var rows []repository.SeriesRow
+	source := p.interval.rollup
+	if scope := p.rollupScope(); scope != "" {
+		rows, err = s.Series.Rollup(p.spec(), p.rollupFilter(scope))
+	} else {
+		if p.q.To.Sub(p.q.From) > maxRawSeriesRange {
+			return SeriesResult{}, invalidSeries("%s of %s at %s reads raw readings and is limited to 366 days",
+				p.q.Aggregator, p.q.Metric, p.q.Interval)
+		}
+		source = "readings"
+		rows, err = s.Series.Readings(p.spec())
+	}
+	if err != nil {
+		return SeriesResult{}, err
+	}
+
+	series, err := s.assemble(p, rows)
+	if err != nil {
+		return SeriesResult{}, err
+	}
+	return SeriesResult{
+		From:       p.q.From,
+		To:         p.q.To.In(database.Bangkok),
+		Interval:   p.q.Interval,
+		Metric:     p.q.Metric,
+		Aggregator: p.q.Aggregator,
+		GroupBy:    p.q.GroupBy,
+		Source:     source,
+		Series:     series,
+	}, nil
+}
+
+// spec is the plan as a repository query, provinces as ISO codes.
+func (p seriesPlan) spec() repository.SeriesSpec {
+	codes := make([]string, 0, len(p.provinces))
+	for _, prov := range p.provinces {
+		codes = append(codes, prov.Code)
+	}
+	return repository.SeriesSpec{
+		From:             p.q.From,
+		To:               p.q.To,
+		Interval:         p.q.Interval,
+		Metric:           p.q.Metric,
+		Aggregator:       p.q.Aggregator,
+		GroupBy:          p.q.GroupBy,
+		ProvinceCodes:    codes,
+		Places:           p.q.Places,
+		DVIDs:            p.q.DVIDs,
+		ExcludeAnomalies: p.q.ExcludeAnomalies,
+	}
+}
+
+// rollupFilter selects the rollup rows of scope the plan's filters match;
+// province rollups are keyed by name.
+func (p seriesPlan) rollupFilter(scope string) repository.RollupFilter {
+	f := repository.RollupFilter{Scope: scope}
+	switch {
+	case len(p.provinces) > 0:
+		for _, prov := range p.provinces {
+			f.Keys = append(f.Keys, prov.Name)
+		}
+	case len(p.q.Places) > 0:
+		f.KeyLike = p.q.Places
+	case len(p.q.DVIDs) > 0:
+		f.Keys = p.q.DVIDs
+	}
+	return f
+}
+
+// assemble turns the query rows into one series per key with a point per
+// bucket, keyed and labelled consistently whichever table answered.
+func (s *SeriesService) assemble(p seriesPlan, rows []repository.SeriesRow) ([]Series, error) {
+	type group struct {
+		label  string
+		points map[int64]repository.SeriesRow
+	}
+	groups := map[string]*group{}
+	for _, r := range rows {
+		key, label := r.Key, r.Key
+		switch p.q.GroupBy {
+		case SeriesGroupProvince:
+			// Raw rows carry the ISO code, rollup rows the province name.
+			if prov, ok := thaiaddress.LookupProvince(r.Key); ok {
+				key, label = prov.Code, prov.Name
+			}
+		case SeriesGroupNone:
+			label = "All stations"
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{label: label, points: map[int64]repository.SeriesRow{}}
+			groups[key] = g
+		}
+		// Buckets come back as Bangkok wall-clock timestamps.
+		b := r.Bucket
+		bucket := time.Date(b.Year(), b.Month(), b.Day(), b.Hour(), b.Minute(), 0, 0, database.Bangkok)
+		g.points[bucket.UnixMilli()] = r
+	}
+
+	if len(groups)*len(p.buckets) > maxSeriesPoints {
+		return nil, invalidSeries("%d series of %d buckets exceed %d points; add filters or use a longer interval",
+			len(groups), len(p.buckets), maxSeriesPoints)
+	}
+
+	if p.q.GroupBy == SeriesGroupDVID && len(groups) > 0 {
+		dvids := make([]string, 0, len(groups))
+		for dvid := range groups {
+			dvids = append(dvids, dvid)
+		}
+		places, err := s.Stations.Places(dvids...)
+		if err != nil {
+			return nil, err
+		}
+		for dvid, place := range places {
+			if g := groups[dvid]; g != nil {
+				g.label = place
+			}
+		}
+	}
+
+	series := make([]Series, 0, len(groups))
+	for key, g := range groups {
+		sr := Series{Key: key, Label: g.label, Points: make([]SeriesPoint, 0, len(p.buckets))}
+		for _, b := range p.buckets {
+			pt := SeriesPoint{Time: b, Timestamp: b.UnixMilli()}
+			if r, ok := g.points[b.UnixMilli()]; ok {
+				pt.Value, pt.Count = r.Value, r.N
+			}
+			sr.Points = append(sr.Points, pt)
+		}
+		series = append(series, sr)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].Label != series[j].Label {
+			return series[i].Label < series[j].Label
+		}
+		return series[i].Key < series[j].Key
+	})
+	return series, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"yakkaw_dashboard/database"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+)
+
+func TestPlanSeriesErrors(t *testing.T) {
+	from := time.Date(2025, time.January, 1, 0, 0, 0, 0, database.Bangkok)
+	ok := SeriesQuery{From: from, To: from.AddDate(0, 0, 1), Interval: "1h", Metric: "pm25", GroupBy: SeriesGroupNone, Aggregator: "avg"}
+	tests := []func(q *SeriesQuery){
+		func(q *SeriesQuery) { q.Interval = "2h" },
+		func(q *SeriesQuery) { q.Metric = "co2" },
+		func(q *SeriesQuery) { q.Aggregator = "sum" },
+		func(q *SeriesQuery) { q.GroupBy = "district" },
+		func(q *SeriesQuery) { q.To = q.From },
+		func(q *SeriesQuery) { q.Provinces = []string{"Atlantis"} },
+		func(q *SeriesQuery) { q.Interval, q.To = "5m", from.AddDate(0, 0, 7) },
+	}
+	if _, err := planSeries(ok); err != nil {
+		t.Fatalf("valid query: %v", err)
+	}
+	for i, edit := range tests {
+		q := ok
+		edit(&q)
+		if _, err := planSeries(q); !errors.Is(err, ErrInvalidSeriesQuery) {
+			t.Errorf("case %d: err = %v, want ErrInvalidSeriesQuery", i, err)
+		}
+	}
+}
+
+func TestRollupScope(t *testing.T) {
+	from := time.Date(2025, time.January, 1, 0, 0, 0, 0, database.Bangkok)
+	base := SeriesQuery{From: from, To: from.AddDate(0, 1, 0), Interval: "1d", Metric: "pm25", GroupBy: SeriesGroupProvince, Aggregator: "avg"}
+	tests := []struct {
+		name string
+		edit func(q *SeriesQuery)
+		want string
+	}{
+		{"province groups", func(q *SeriesQuery) {}, models.RollupScopeProvince},
+		{"province filter", func(q *SeriesQuery) { q.Provinces = []string{"เชียงใหม่"} }, models.RollupScopeProvince},
+		{"hourly max per station", func(q *SeriesQuery) { q.Interval, q.GroupBy, q.Aggregator = "1h", SeriesGroupDVID, "max" }, models.RollupScopeDVID},
+		{"one place, no grouping", func(q *SeriesQuery) { q.GroupBy, q.Places = SeriesGroupNone, []string{"CMU"} }, models.RollupScopePlace},
+		{"no filter, no grouping", func(q *SeriesQuery) { q.GroupBy = SeriesGroupNone }, models.RollupScopeDVID},
+		{"median", func(q *SeriesQuery) { q.Aggregator = "median" }, ""},
+		{"5 minute buckets", func(q *SeriesQuery) { q.Interval, q.To = "5m", from.AddDate(0, 0, 1) }, ""},
+		{"not rolled up", func(q *SeriesQuery) { q.Metric = "pres" }, ""},
+		{"anomalies left out", func(q *SeriesQuery) { q.ExcludeAnomalies = true }, ""},
+		{"filter on another scope", func(q *SeriesQuery) { q.DVIDs = []string{"a"} }, ""},
+		{"mixed filters", func(q *SeriesQuery) {
+			q.GroupBy, q.Places, q.DVIDs = SeriesGroupNone, []string{"CMU"}, []string{"a"}
+		}, ""},
+	}
+	for _, tt := range tests {
+		q := base
+		tt.edit(&q)
+		p, err := planSeries(q)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := p.rollupScope(); got != tt.want {
+			t.Errorf("%s: scope = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetSeries(t *testing.T) {
+	from := time.Date(2025, time.January, 1, 0, 0, 0, 0, database.Bangkok)
+	reading := func(dvid string, at time.Time, pm25 int) models.SensorData {
+		return models.SensorData{DVID: dvid, Timestamp: at.UnixMilli(), PM25: pm25, Address: "ต.สุเทพ อ.เมือง จ.เชียงใหม่"}
+	}
+	repo := repository.NewMemorySeriesRepository(
+		reading("a", from.Add(time.Hour), 10),
+		reading("a", from.Add(2*time.Hour), 30),
+		reading("a", from.Add(3*time.Hour), 0), // a drop-out
+		reading("b", from.AddDate(0, 0, 2), 50),
+	)
+	avg := 99.0
+	repo.Rollups.AddDaily(models.RollupBucket{
+		Scope: models.RollupScopeProvince, Key: "เชียงใหม่",
+		Bucket:  time.Date(2025, time.January, 2, 0, 0, 0, 0, time.UTC),
+		PM25Avg: &avg, PM25Count: 288,
+	})
+	s := NewSeriesService(repo, repository.NewMemoryStationRepository(models.Station{DVID: "a", Place: "CMU"}))
+
+	// Daily province averages come from the daily rollup, keyed by ISO code.
+	res, err := s.GetSeries(SeriesQuery{From: from, To: from.AddDate(0, 0, 3), Interval: "1d", Metric: "pm25",
+		GroupBy: SeriesGroupProvince, Aggregator: "avg", Provinces: []string{"TH-50"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != "rollup_daily" || len(res.Series) != 1 || res.Series[0].Key != "TH-50" || res.Series[0].Label != "เชียงใหม่" {
+		t.Fatalf("result = %+v, want one TH-50 series from rollup_daily", res)
+	}
+	pts := res.Series[0].Points
+	if len(pts) != 3 || pts[0].Value != nil || pts[1].Value == nil || *pts[1].Value != 99 || pts[1].Count != 288 {
+		t.Errorf("points = %+v, want only Jan 2 filled with 99", pts)
+	}
+
+	// Medians per station need the raw readings.
+	res, err = s.GetSeries(SeriesQuery{From: from, To: from.AddDate(0, 0, 3), Interval: "1d", Metric: "pm25",
+		GroupBy: SeriesGroupDVID, Aggregator: "median"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != "readings" || len(res.Series) != 2 {
+		t.Fatalf("result = %+v, want two series from readings", res)
+	}
+	a, b := res.Series[0], res.Series[1]
+	if a.Key != "a" || a.Label != "CMU" || b.Key != "b" || b.Label != "b" {
+		t.Fatalf("series = %+v, want a labelled CMU and b by dvid", res.Series)
+	}
+	if v := a.Points[0].Value; v == nil || *v != 20 || a.Points[0].Count != 2 {
+		t.Errorf("a on Jan 1 = %+v, want the median 20 of 2 readings", a.Points[0])
+	}
+	if b.Points[0].Value != nil || b.Points[2].Value == nil || *b.Points[2].Value != 50 {
+		t.Errorf("b = %+v, want only Jan 3 filled", b.Points)
+	}
+
+	// Raw windows are capped.
+	_, err = s.GetSeries(SeriesQuery{From: from, To: from.AddDate(2, 0, 0), Interval: "1M", Metric: "pm25",
+		GroupBy: SeriesGroupNone, Aggregator: "p90"})
+	if !errors.Is(err, ErrInvalidSeriesQuery) {
+		t.Errorf("two years of p90: err = %v, want ErrInvalidSeriesQuery", err)
+	}
+}
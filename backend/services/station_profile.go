@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"yakkaw_dashboard/aqi"
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/repository"
+
+	"gorm.io/gorm"
+)
+
+// StationProfile is a station's current metadata with its latest reading
+// (nil before the first one), NowCast and latest drift check (nil until the
+// station could be compared with its neighbours).
+type StationProfile struct {
+	Station models.Station       `json:"station"`
+	Latest  *models.SensorData   `json:"latest"`
+	NowCast NowCast              `json:"nowcast"`
+	Drift   *models.StationDrift `json:"drift"`
+}
+
+type StationService struct {
+	Stations repository.StationRepository
+	Readings repository.ReadingRepository
+}
+
+// NewStationService creates a new StationService instance
+func NewStationService(stations repository.StationRepository, readings repository.ReadingRepository) *StationService {
+	return &StationService{Stations: stations, Readings: readings}
+}
+
+// GetStationProfile returns the profile of dvid with its NowCast AQI under
+// std. An unknown station returns gorm.ErrRecordNotFound.
+func (s *StationService) GetStationProfile(dvid string, std aqi.Standard) (StationProfile, error) {
+	station, err := s.Stations.Current(dvid)
+	if err != nil {
+		return StationProfile{}, err
+	}
+	profile := StationProfile{Station: station}
+
+	latest, err := s.Readings.Latest(repository.ReadingFilter{DVID: dvid})
+	switch {
+	case err == nil:
+		profile.Latest = &latest
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return StationProfile{}, err
+	}
+
+	if profile.NowCast, err = stationNowCast(s.Readings, dvid, time.Now(), std); err != nil {
+		return StationProfile{}, err
+	}
+
+	drifts, err := s.Stations.Drift(dvid)
+	if err != nil {
+		return StationProfile{}, err
+	}
+	if d, ok := drifts[dvid]; ok {
+		profile.Drift = &d
+	}
+	return profile, nil
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"sort"
+
+	"yakkaw_dashboard/models"
+	"yakkaw_dashboard/thaiaddress"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// stationColumns are the metadata columns compared and copied between
+// station versions.
+var stationColumns = []string{
+	"deviceid", "latitude", "longitude", "place", "address", "model",
+	"deploydate", "contactname", "contactphone", "note",
+	"province", "province_code", "district", "subdistrict",
+}
+
+func stationFromReading(d models.SensorData) models.Station {
+	addr := thaiaddress.Parse(d.Address)
+	return models.Station{
+		DVID:         d.DVID,
+		DeviceID:     d.DeviceID,
+		Latitude:     d.Latitude,
+		Longitude:    d.Longitude,
+		Place:        d.Place,
+		Address:      d.Address,
+		Model:        d.Model,
+		DeployDate:   d.DeployDate,
+		ContactName:  d.ContactName,
+		ContactPhone: d.ContactPhone,
+		Note:         d.Note,
+		Province:     addr.Province,
+		ProvinceCode: addr.ProvinceCode,
+		District:     addr.District,
+		Subdistrict:  addr.Subdistrict,
+	}
+}
+
+func sameStation(a, b models.Station) bool {
+	return a.DeviceID == b.DeviceID && a.Latitude == b.Latitude && a.Longitude == b.Longitude &&
+		a.Place == b.Place && a.Address == b.Address && a.Model == b.Model &&
+		a.DeployDate == b.DeployDate && a.ContactName == b.ContactName &&
+		a.ContactPhone == b.ContactPhone && a.Note == b.Note
+}
+
+// hasStationMeta reports whether a reading carries any station metadata.
+// Sources that only send measurements must not blank out the station.
+func hasStationMeta(d models.SensorData) bool {
+	return d.Place != "" || d.Address != "" || d.Latitude != 0 || d.Longitude != 0
+}
+
+// fillFromStations copies the current station version onto readings that
+// arrive without coordinates, as sources that only send measurements do, so
+// they pass validation and do not blank out the station. Fields the reading
+// does carry are kept.
+func fillFromStations(db *gorm.DB, rows []models.SensorData) error {
+	seen := make(map[string]bool)
+	var dvids []string
+	for _, r := range rows {
+		if r.Latitude == 0 && r.Longitude == 0 && r.DVID != "" && !seen[r.DVID] {
+			seen[r.DVID] = true
+			dvids = append(dvids, r.DVID)
+		}
+	}
+	if len(dvids) == 0 {
+		return nil
+	}
+
+	var current []models.Station
+	if err := db.Where("dvid IN ? AND valid_to IS NULL", dvids).Find(&current).Error; err != nil {
+		return err
+	}
+	byDVID := make(map[string]models.Station, len(current))
+	for _, s := range current {
+		byDVID[s.DVID] = s
+	}
+	for i := range rows {
+		if s, ok := byDVID[rows[i].DVID]; ok && rows[i].Latitude == 0 && rows[i].Longitude == 0 {
+			fillFromStation(&rows[i], s)
+		}
+	}
+	return nil
+}
+
+func fillFromStation(r *models.SensorData, s models.Station) {
+	r.Latitude, r.Longitude = s.Latitude, s.Longitude
+	if r.DeviceID == "" {
+		r.DeviceID = s.DeviceID
+	}
+	if r.Place == "" {
+		r.Place = s.Place
+	}
+	if r.Address == "" {
+		r.Address = s.Address
+	}
+	if r.Model == "" {
+		r.Model = s.Model
+	}
+	if r.DeployDate == "" {
+		r.DeployDate = s.DeployDate
+	}
+	if r.ContactName == "" {
+		r.ContactName = s.ContactName
+	}
+	if r.ContactPhone == "" {
+		r.ContactPhone = s.ContactPhone
+	}
+	if r.Note == "" {
+		r.Note = s.Note
+	}
+}
+
+// syncStations brings each station's current version in line with the newest
+// reading of the batch. A change starts a new version at that reading's
+// timestamp; readings older than the current version never rewrite history.
+// It returns the number of stations created or changed.
+func syncStations(tx *gorm.DB, rows []models.SensorData) (int, error) {
+	latest := make(map[string]models.SensorData)
+	for _, r := range rows {
+		if !hasStationMeta(r) {
+			continue
+		}
+		if cur, ok := latest[r.DVID]; !ok || r.Timestamp >= cur.Timestamp {
+			latest[r.DVID] = r
+		}
+	}
+	if len(latest) == 0 {
+		return 0, nil
+	}
+
+	// Lock in a stable order so concurrent writers cannot deadlock.
+	dvids := make([]string, 0, len(latest))
+	for dvid := range latest {
+		dvids = append(dvids, dvid)
+	}
+	sort.Strings(dvids)
+
+	var current []models.Station
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("dvid IN ? AND valid_to IS NULL", dvids).
+		Order("dvid").
+		Find(&current).Error
+	if err != nil {
+		return 0, err
+	}
+	byDVID := make(map[string]models.Station, len(current))
+	for _, s := range current {
+		byDVID[s.DVID] = s
+	}
+
+	changed := 0
+	for _, dvid := range dvids {
+		r := latest[dvid]
+		next := stationFromReading(r)
+		cur, ok := byDVID[dvid]
+
+		switch {
+		case !ok:
+			next.Version = 1
+			next.ValidFrom = 0
+			err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&next).Error
+		case sameStation(cur, next) || r.Timestamp < cur.ValidFrom:
+			continue
+		case r.Timestamp == cur.ValidFrom:
+			err = tx.Model(&models.Station{}).Where("id = ?", cur.ID).
+				Select(stationColumns).Updates(&next).Error
+		default:
+			err = tx.Model(&models.Station{}).Where("id = ?", cur.ID).
+				Update("valid_to", r.Timestamp).Error
+			if err == nil {
+				next.Version = cur.Version + 1
+				next.ValidFrom = r.Timestamp
+				err = tx.Create(&next).Error
+			}
+		}
+		if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"yakkaw_dashboard/config"
+)
+
+// ErrCircuitOpen is returned without contacting the upstream while a
+// source's circuit breaker is open.
+var ErrCircuitOpen = errors.New("upstream circuit open")
+
+// maxUpstreamBody guards against an upstream streaming an unbounded payload.
+const maxUpstreamBody = 64 << 20
+
+// UpstreamStatusError is a non-2xx HTTP response.
+type UpstreamStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *UpstreamStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("upstream returned HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("upstream returned HTTP %d: %s", e.StatusCode, e.Body)
+}
+
+// UpstreamEnvelopeError is an HTTP 200 whose payload reports a failure, e.g.
+// a models.APIResponse with status != 200 or a non-empty error.
+type UpstreamEnvelopeError struct {
+	Status  int
+	Message string
+}
+
+func (e *UpstreamEnvelopeError) Error() string {
+	return fmt.Sprintf("upstream envelope status %d: %s", e.Status, e.Message)
+}
+
+// UpstreamOptions tunes timeouts, retries and the circuit breaker.
+type UpstreamOptions struct {
+	Timeout     time.Duration
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// BreakerThreshold consecutive failed fetches open the breaker for
+	// BreakerCooldown; 0 disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// UpstreamOptionsFromConfig reads the UPSTREAM_* settings.
+func UpstreamOptionsFromConfig(cfg *config.Config) UpstreamOptions {
+	return UpstreamOptions{
+		Timeout:          cfg.UpstreamTimeout,
+		MaxRetries:       cfg.UpstreamMaxRetries,
+		BaseBackoff:      cfg.UpstreamRetryBackoff,
+		MaxBackoff:       cfg.UpstreamMaxBackoff,
+		BreakerThreshold: cfg.UpstreamBreakerThreshold,
+		BreakerCooldown:  cfg.UpstreamBreakerCooldown,
+	}
+}
+
+// UpstreamClient performs GETs against one upstream with a request timeout,
+// exponential-backoff retries on network errors, 429 and 5xx, and a circuit
+// breaker shared by every client of the same source name.
+type UpstreamClient struct {
+	http    *http.Client
+	opts    UpstreamOptions
+	breaker *CircuitBreaker
+}
+
+// NewUpstreamClient creates a client for the source called name.
+func NewUpstreamClient(name string, opts UpstreamOptions) *UpstreamClient {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultSourceTimeout
+	}
+	return &UpstreamClient{
+		http:    &http.Client{Timeout: opts.Timeout},
+		opts:    opts,
+		breaker: breakerFor(name, opts),
+	}
+}
+
+// FetchResponse is the outcome of UpstreamClient.Fetch.
+type FetchResponse struct {
+	Body        []byte
+	StatusCode  int
+	ContentType string
+	Attempts    int
+	FetchedAt   time.Time
+}
+
+// Fetch GETs url and hands the body to decode. A decode error wrapping an
+// UpstreamEnvelopeError with a 5xx status is retried like an HTTP 5xx; any
+// other decode error fails immediately. The final outcome feeds the breaker.
+func (c *UpstreamClient) Fetch(ctx context.Context, url string, headers map[string]string, decode func([]byte) error) (FetchResponse, error) {
+	var res FetchResponse
+	if err := c.breaker.Allow(); err != nil {
+		return res, err
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		res.Attempts = attempt + 1
+		var retryAfter time.Duration
+		res.FetchedAt = time.Now()
+		res.Body, res.StatusCode, res.ContentType, retryAfter, err = c.get(ctx, url, headers)
+		if err == nil && decode != nil {
+			err = decode(res.Body)
+		}
+		if err == nil || !retryable(ctx, err) || attempt >= c.opts.MaxRetries {
+			break
+		}
+
+		wait := c.backoff(attempt)
+		if retryAfter > wait && retryAfter <= c.opts.MaxBackoff {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(wait):
+			continue
+		}
+		break
+	}
+
+	// A shutdown is not the upstream's fault, but a trial it cut short must
+	// not keep the breaker half-open for good.
+	switch {
+	case err == nil:
+		c.breaker.Success()
+	case ctx.Err() == nil:
+		c.breaker.Failure()
+	default:
+		c.breaker.Release()
+	}
+	return res, err
+}
+
+func (c *UpstreamClient) get(ctx context.Context, url string, headers map[string]string) ([]byte, int, string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, "", 0, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, "", 0, &upstreamNetError{err}
+	}
+	defer resp.Body.Close()
+	contentType := resp.Header.Get("Content-Type")
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamBody))
+	if err != nil {
+		return nil, resp.StatusCode, contentType, 0, &upstreamNetError{err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet := string(body)
+		if len(snippet) > 200 {
+			snippet = snippet[:200]
+		}
+		return body, resp.StatusCode, contentType, parseRetryAfter(resp.Header.Get("Retry-After")),
+			&UpstreamStatusError{StatusCode: resp.StatusCode, Body: snippet}
+	}
+	return body, resp.StatusCode, contentType, 0, nil
+}
+
+// backoff returns BaseBackoff * 2^attempt capped at MaxBackoff, with up to
+// 50% jitter so replicas do not retry in lockstep.
+func (c *UpstreamClient) backoff(attempt int) time.Duration {
+	base := c.opts.BaseBackoff
+	if base <= 0 {
+		base = time.Second
+	}
+	d := base << attempt
+	if d <= 0 || (c.opts.MaxBackoff > 0 && d > c.opts.MaxBackoff) {
+		d = c.opts.MaxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+type upstreamNetError struct{ err error }
+
+func (e *upstreamNetError) Error() string { return e.err.Error() }
+func (e *upstreamNetError) Unwrap() error { return e.err }
+
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var netErr *upstreamNetError
+	var statusErr *UpstreamStatusError
+	var envErr *UpstreamEnvelopeError
+	switch {
+	case errors.As(err, &netErr):
+		return true
+	case errors.As(err, &statusErr):
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	case errors.As(err, &envErr):
+		return envErr.Status >= 500
+	default:
+		return false
+	}
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// ---------- circuit breaker ----------
+
+// CircuitBreaker opens after Threshold consecutive failures and rejects calls
+// until Cooldown has passed. It then lets a single trial call through
+// (half-open): success closes it, failure opens it for another Cooldown.
+// A nil *CircuitBreaker always allows.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow reports ErrCircuitOpen while the breaker is open or a half-open
+// trial is already in flight.
+func (b *CircuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return fmt.Errorf("%w until %s", ErrCircuitOpen, b.openUntil.Format(time.RFC3339))
+	}
+	b.trial = true
+	return nil
+}
+
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *CircuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// Release ends a half-open trial without an outcome (the call was cancelled),
+// so the next Allow may try again.
+func (b *CircuitBreaker) Release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*CircuitBreaker{}
+)
+
+// breakerFor returns the process-wide breaker for a source, so scheduled and
+// on-demand fetches of the same source share state.
+func breakerFor(name string, opts UpstreamOptions) *CircuitBreaker {
+	if opts.BreakerThreshold <= 0 {
+		return nil
+	}
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = NewCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown)
+		breakers[name] = b
+	}
+	return b
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerCancelledTrial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	b := NewCircuitBreaker(1, 10*time.Millisecond)
+	c := &UpstreamClient{http: srv.Client(), opts: UpstreamOptions{}, breaker: b}
+
+	b.Failure()
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker: Allow = %v, want ErrCircuitOpen", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// The half-open trial is cancelled before it gets an answer.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Fetch(ctx, srv.URL, nil, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled trial: err = %v, want context.Canceled", err)
+	}
+
+	// The next call is a new trial, and its success closes the breaker.
+	if _, err := c.Fetch(context.Background(), srv.URL, nil, nil); err != nil {
+		t.Fatalf("after a cancelled trial: err = %v, want a new trial", err)
+	}
+	if b.failures != 0 || b.trial {
+		t.Errorf("breaker = %d failures, trial %v; want closed", b.failures, b.trial)
+	}
+}
@@ -0,0 +1,153 @@
+package thaiaddress
+
+import "strings"
+
+// Province is one of Thailand's 77 provinces (Bangkok included). Code is its
+// ISO 3166-2:TH code.
+type Province struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	NameEN string `json:"name_en"`
+}
+
+// BangkokCode is the ISO 3166-2:TH code of Bangkok, whose districts are เขต
+// and subdistricts แขวง.
+const BangkokCode = "TH-10"
+
+var provinces = []Province{
+	{"TH-10", "กรุงเทพมหานคร", "Bangkok"},
+	{"TH-11", "สมุทรปราการ", "Samut Prakan"},
+	{"TH-12", "นนทบุรี", "Nonthaburi"},
+	{"TH-13", "ปทุมธานี", "Pathum Thani"},
+	{"TH-14", "พระนครศรีอยุธยา", "Phra Nakhon Si Ayutthaya"},
+	{"TH-15", "อ่างทอง", "Ang Thong"},
+	{"TH-16", "ลพบุรี", "Lop Buri"},
+	{"TH-17", "สิงห์บุรี", "Sing Buri"},
+	{"TH-18", "ชัยนาท", "Chai Nat"},
+	{"TH-19", "สระบุรี", "Saraburi"},
+	{"TH-20", "ชลบุรี", "Chon Buri"},
+	{"TH-21", "ระยอง", "Rayong"},
+	{"TH-22", "จันทบุรี", "Chanthaburi"},
+	{"TH-23", "ตราด", "Trat"},
+	{"TH-24", "ฉะเชิงเทรา", "Chachoengsao"},
+	{"TH-25", "ปราจีนบุรี", "Prachin Buri"},
+	{"TH-26", "นครนายก", "Nakhon Nayok"},
+	{"TH-27", "สระแก้ว", "Sa Kaeo"},
+	{"TH-30", "นครราชสีมา", "Nakhon Ratchasima"},
+	{"TH-31", "บุรีรัมย์", "Buri Ram"},
+	{"TH-32", "สุรินทร์", "Surin"},
+	{"TH-33", "ศรีสะเกษ", "Si Sa Ket"},
+	{"TH-34", "อุบลราชธานี", "Ubon Ratchathani"},
+	{"TH-35", "ยโสธร", "Yasothon"},
+	{"TH-36", "ชัยภูมิ", "Chaiyaphum"},
+	{"TH-37", "อำนาจเจริญ", "Amnat Charoen"},
+	{"TH-38", "บึงกาฬ", "Bueng Kan"},
+	{"TH-39", "หนองบัวลำภู", "Nong Bua Lam Phu"},
+	{"TH-40", "ขอนแก่น", "Khon Kaen"},
+	{"TH-41", "อุดรธานี", "Udon Thani"},
+	{"TH-42", "เลย", "Loei"},
+	{"TH-43", "หนองคาย", "Nong Khai"},
+	{"TH-44", "มหาสารคาม", "Maha Sarakham"},
+	{"TH-45", "ร้อยเอ็ด", "Roi Et"},
+	{"TH-46", "กาฬสินธุ์", "Kalasin"},
+	{"TH-47", "สกลนคร", "Sakon Nakhon"},
+	{"TH-48", "นครพนม", "Nakhon Phanom"},
+	{"TH-49", "มุกดาหาร", "Mukdahan"},
+	{"TH-50", "เชียงใหม่", "Chiang Mai"},
+	{"TH-51", "ลำพูน", "Lamphun"},
+	{"TH-52", "ลำปาง", "Lampang"},
+	{"TH-53", "อุตรดิตถ์", "Uttaradit"},
+	{"TH-54", "แพร่", "Phrae"},
+	{"TH-55", "น่าน", "Nan"},
+	{"TH-56", "พะเยา", "Phayao"},
+	{"TH-57", "เชียงราย", "Chiang Rai"},
+	{"TH-58", "แม่ฮ่องสอน", "Mae Hong Son"},
+	{"TH-60", "นครสวรรค์", "Nakhon Sawan"},
+	{"TH-61", "อุทัยธานี", "Uthai Thani"},
+	{"TH-62", "กำแพงเพชร", "Kamphaeng Phet"},
+	{"TH-63", "ตาก", "Tak"},
+	{"TH-64", "สุโขทัย", "Sukhothai"},
+	{"TH-65", "พิษณุโลก", "Phitsanulok"},
+	{"TH-66", "พิจิตร", "Phichit"},
+	{"TH-67", "เพชรบูรณ์", "Phetchabun"},
+	{"TH-70", "ราชบุรี", "Ratchaburi"},
+	{"TH-71", "กาญจนบุรี", "Kanchanaburi"},
+	{"TH-72", "สุพรรณบุรี", "Suphan Buri"},
+	{"TH-73", "นครปฐม", "Nakhon Pathom"},
+	{"TH-74", "สมุทรสาคร", "Samut Sakhon"},
+	{"TH-75", "สมุทรสงคราม", "Samut Songkhram"},
+	{"TH-76", "เพชรบุรี", "Phetchaburi"},
+	{"TH-77", "ประจวบคีรีขันธ์", "Prachuap Khiri Khan"},
+	{"TH-80", "นครศรีธรรมราช", "Nakhon Si Thammarat"},
+	{"TH-81", "กระบี่", "Krabi"},
+	{"TH-82", "พังงา", "Phangnga"},
+	{"TH-83", "ภูเก็ต", "Phuket"},
+	{"TH-84", "สุราษฎร์ธานี", "Surat Thani"},
+	{"TH-85", "ระนอง", "Ranong"},
+	{"TH-86", "ชุมพร", "Chumphon"},
+	{"TH-90", "สงขลา", "Songkhla"},
+	{"TH-91", "สตูล", "Satun"},
+	{"TH-92", "ตรัง", "Trang"},
+	{"TH-93", "พัทลุง", "Phatthalung"},
+	{"TH-94", "ปัตตานี", "Pattani"},
+	{"TH-95", "ยะลา", "Yala"},
+	{"TH-96", "นราธิวาส", "Narathiwat"},
+}
+
+// aliases are other Thai spellings of province names seen in station
+// addresses. English names are matched case- and space-insensitively.
+var aliases = map[string]string{
+	"กรุงเทพ":  "TH-10",
+	"กรุงเทพฯ": "TH-10",
+	"กทม":      "TH-10",
+	"กทม.":     "TH-10",
+	"อยุธยา":   "TH-14",
+	"โคราช":    "TH-30",
+}
+
+var (
+	byCode = map[string]Province{}
+	byKey  = map[string]Province{}
+	// thaiNames are every Thai name and alias, for finding a province in an
+	// address without a จ./จังหวัด marker.
+	thaiNames []string
+)
+
+func init() {
+	for _, p := range provinces {
+		byCode[p.Code] = p
+		byKey[lookupKey(p.Name)] = p
+		byKey[lookupKey(p.NameEN)] = p
+		thaiNames = append(thaiNames, p.Name)
+	}
+	for alias, code := range aliases {
+		byKey[lookupKey(alias)] = byCode[code]
+		thaiNames = append(thaiNames, alias)
+	}
+}
+
+// Provinces returns every province ordered by code.
+func Provinces() []Province {
+	out := make([]Province, len(provinces))
+	copy(out, provinces)
+	return out
+}
+
+// LookupProvince resolves a province name (Thai or English, any common
+// spelling) or ISO code, e.g. "จ.เชียงใหม่", "Chiang Mai" or "TH-50".
+func LookupProvince(s string) (Province, bool) {
+	s = strings.TrimSpace(s)
+	if p, ok := byCode[strings.ToUpper(s)]; ok {
+		return p, true
+	}
+	s = strings.TrimPrefix(s, "จังหวัด")
+	s = strings.TrimPrefix(s, "จ.")
+	p, ok := byKey[lookupKey(s)]
+	return p, ok
+}
+
+// lookupKey folds case and spacing so "Chiang Mai", "chiangmai" and
+// "เชียง ใหม่" share a key.
+func lookupKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), ""))
+}
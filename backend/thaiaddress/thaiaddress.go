@@ -0,0 +1,150 @@
+// Package thaiaddress splits free-text Thai station addresses into province,
+// district and subdistrict.
+//
+// Addresses come from the upstream feed in many shapes: "ต.สุเทพ อ.เมือง
+// จ.เชียงใหม่ 50200", "ตำบลสุเทพ อำเภอเมืองเชียงใหม่ จังหวัดเชียงใหม่",
+// "แขวงลุมพินี เขตปทุมวัน กรุงเทพฯ 10330". Parse recognises the short and long
+// markers, Bangkok's เขต/แขวง, and a province named without a marker.
+package thaiaddress
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Address is the parsed form of a station address. Fields the address does
+// not carry are empty; Province and ProvinceCode are only set for a known
+// province.
+type Address struct {
+	Province     string `json:"province"`
+	ProvinceCode string `json:"province_code"`
+	District     string `json:"district"`
+	Subdistrict  string `json:"subdistrict"`
+}
+
+// Markers must start a word, so "เขต" in "ในเขตเทศบาล" is not a district.
+const wordStart = `(?:^|[\s,(])`
+
+// value is the text after a marker, up to the next space or separator.
+const value = `\s*([^\s,()]+)`
+
+var (
+	provinceRe    = regexp.MustCompile(wordStart + `(?:จังหวัด|จ\.)` + value)
+	districtRe    = regexp.MustCompile(wordStart + `(?:กิ่งอำเภอ|กิ่งอ\.|อำเภอ|อ\.)` + value)
+	subdistrictRe = regexp.MustCompile(wordStart + `(?:ตำบล|ต\.)` + value)
+	khetRe        = regexp.MustCompile(wordStart + `เขต` + value)
+	khwaengRe     = regexp.MustCompile(wordStart + `แขวง` + value)
+)
+
+// glued are markers that may follow a value without a space
+// ("อ.เมืองจ.เชียงใหม่"); a value is cut where one starts.
+var glued = []string{"จังหวัด", "จ.", "อำเภอ", "อ.", "ตำบล", "ต.", "เขต", "แขวง"}
+
+// Parse extracts the province, district and subdistrict of a Thai address.
+// The district "เมือง" is expanded to its official name ("เมืองเชียงใหม่").
+func Parse(s string) Address {
+	s = strings.Join(strings.Fields(s), " ")
+	var a Address
+	if s == "" {
+		return a
+	}
+
+	p, ok := markedProvince(s)
+	if !ok {
+		p, ok = namedProvince(s)
+	}
+	khwaeng := lastValue(khwaengRe, s)
+	if !ok && khwaeng != "" {
+		// แขวง only exists in Bangkok.
+		p, ok = byCode[BangkokCode], true
+	}
+	if ok {
+		a.Province, a.ProvinceCode = p.Name, p.Code
+	}
+
+	if a.ProvinceCode == BangkokCode {
+		a.District = lastValue(khetRe, s)
+		a.Subdistrict = khwaeng
+	}
+	if a.District == "" {
+		a.District = lastValue(districtRe, s)
+	}
+	if a.Subdistrict == "" {
+		a.Subdistrict = lastValue(subdistrictRe, s)
+	}
+	if a.District == "เมือง" && a.Province != "" && a.ProvinceCode != BangkokCode {
+		a.District += a.Province
+	}
+	return a
+}
+
+// markedProvince resolves the value of the last จ./จังหวัด marker.
+func markedProvince(s string) (Province, bool) {
+	v := lastValue(provinceRe, s)
+	if v == "" {
+		return Province{}, false
+	}
+	return LookupProvince(v)
+}
+
+// namedProvince finds the province named last in s as a whole word, preferring
+// the longer name where two end at the same place ("กรุงเทพฯ" over
+// "กรุงเทพ").
+func namedProvince(s string) (Province, bool) {
+	best, bestEnd := "", -1
+	for _, name := range thaiNames {
+		for from := 0; ; {
+			i := strings.Index(s[from:], name)
+			if i < 0 {
+				break
+			}
+			start := from + i
+			end := start + len(name)
+			from = end
+			if !boundary(s, start, end) {
+				continue
+			}
+			if end > bestEnd || (end == bestEnd && len(name) > len(best)) {
+				best, bestEnd = name, end
+			}
+		}
+	}
+	if best == "" {
+		return Province{}, false
+	}
+	return byKey[lookupKey(best)], true
+}
+
+// boundary reports whether s[start:end] is not part of a longer word.
+func boundary(s string, start, end int) bool {
+	if r, _ := utf8.DecodeLastRuneInString(s[:start]); start > 0 && isWordRune(r) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(s[end:])
+	return end == len(s) || !isWordRune(r)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r)
+}
+
+func lastValue(re *regexp.Regexp, s string) string {
+	m := re.FindAllStringSubmatch(s, -1)
+	if len(m) == 0 {
+		return ""
+	}
+	return cleanValue(m[len(m)-1][1])
+}
+
+// cleanValue cuts a captured value at a glued marker and drops trailing
+// postcodes and punctuation.
+func cleanValue(v string) string {
+	for _, g := range glued {
+		if i := strings.Index(v, g); i > 0 {
+			v = v[:i]
+		}
+	}
+	return strings.TrimRightFunc(v, func(r rune) bool { return !isWordRune(r) })
+}
@@ -0,0 +1,89 @@
+package thaiaddress
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Address
+	}{
+		// Short markers, with postcode.
+		{"239 ถ.ห้วยแก้ว ต.สุเทพ อ.เมือง จ.เชียงใหม่ 50200",
+			Address{"เชียงใหม่", "TH-50", "เมืองเชียงใหม่", "สุเทพ"}},
+		// Long markers; the district is already the full name.
+		{"ตำบลสุเทพ อำเภอเมืองเชียงใหม่ จังหวัดเชียงใหม่",
+			Address{"เชียงใหม่", "TH-50", "เมืองเชียงใหม่", "สุเทพ"}},
+		// Markers glued to the previous value.
+		{"ต.เวียง อ.เมืองจ.เชียงราย",
+			Address{"เชียงราย", "TH-57", "เมืองเชียงราย", "เวียง"}},
+		{"ม.5 ต.แม่เหียะ อ.เมือง จ.เชียงใหม่",
+			Address{"เชียงใหม่", "TH-50", "เมืองเชียงใหม่", "แม่เหียะ"}},
+		{"โรงเรียนบ้านปง ต.บ้านปง อ.หางดง จ.เชียงใหม่ 50230",
+			Address{"เชียงใหม่", "TH-50", "หางดง", "บ้านปง"}},
+		{"ต.ปงยางคก อ.ห้างฉัตร จ.ลำปาง",
+			Address{"ลำปาง", "TH-52", "ห้างฉัตร", "ปงยางคก"}},
+		{"กิ่งอ.ดอยหล่อ จ.เชียงใหม่",
+			Address{"เชียงใหม่", "TH-50", "ดอยหล่อ", ""}},
+		// Bangkok: เขต/แขวง, with and without the province named.
+		{"แขวงลุมพินี เขตปทุมวัน กรุงเทพฯ 10330",
+			Address{"กรุงเทพมหานคร", "TH-10", "ปทุมวัน", "ลุมพินี"}},
+		{"แขวงจตุจักร เขตจตุจักร",
+			Address{"กรุงเทพมหานคร", "TH-10", "จตุจักร", "จตุจักร"}},
+		{"เขตบางรัก กรุงเทพมหานคร",
+			Address{"กรุงเทพมหานคร", "TH-10", "บางรัก", ""}},
+		{"ถนนพระราม 4 กทม.",
+			Address{"กรุงเทพมหานคร", "TH-10", "", ""}},
+		// อ.เมือง is not expanded in Bangkok.
+		{"เขตบางกอกน้อย จังหวัดกรุงเทพมหานคร",
+			Address{"กรุงเทพมหานคร", "TH-10", "บางกอกน้อย", ""}},
+		// A province named without a marker.
+		{"หน้าศาลากลาง ลำพูน 51000",
+			Address{"ลำพูน", "TH-51", "", ""}},
+		{"อ.แม่สาย เชียงราย",
+			Address{"เชียงราย", "TH-57", "แม่สาย", ""}},
+		// "เขต" inside a word is not a district.
+		{"ในเขตเทศบาลนครเชียงใหม่",
+			Address{}},
+		// Extra whitespace is folded.
+		{"  ต.ช้างเผือก   อ.เมือง\tจ.เชียงใหม่ ",
+			Address{"เชียงใหม่", "TH-50", "เมืองเชียงใหม่", "ช้างเผือก"}},
+		// Nothing to find: empty, romanised, or no province at all.
+		{"", Address{}},
+		{"Chiang Mai", Address{}},
+		{"123 Moo 5, Suthep, Mueang Chiang Mai, Chiang Mai 50200", Address{}},
+		{"อาคารสำนักงาน ชั้น 2", Address{}},
+		// An unknown province after the marker is not guessed.
+		{"ต.หนึ่ง อ.สอง จ.ไม่มีจริง",
+			Address{"", "", "สอง", "หนึ่ง"}},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.in); got != tt.want {
+			t.Errorf("Parse(%q)\n got %+v\nwant %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLookupProvince(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantCode string
+		ok       bool
+	}{
+		{"เชียงใหม่", "TH-50", true},
+		{"จ.เชียงใหม่", "TH-50", true},
+		{"จังหวัดเชียงใหม่", "TH-50", true},
+		{"Chiang Mai", "TH-50", true},
+		{"chiangmai", "TH-50", true},
+		{"th-50", "TH-50", true},
+		{"กรุงเทพฯ", "TH-10", true},
+		{"Bangkok", "TH-10", true},
+		{"Atlantis", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		p, ok := LookupProvince(tt.in)
+		if ok != tt.ok || p.Code != tt.wantCode {
+			t.Errorf("LookupProvince(%q) = %s, %v; want %s, %v", tt.in, p.Code, ok, tt.wantCode, tt.ok)
+		}
+	}
+}
@@ -79,15 +79,32 @@ function TrackingPageContent() {
     try {
       setSyncing(true);
       setSyncMessage(null);
-      const res = await api.get("/pipeline/refresh");
-      const json = res.data || {};
-      if (res.status >= 200 && res.status < 300) {
-        const processed = typeof json?.processed === 'number' ? json.processed : undefined;
-        setSyncMessage(typeof processed === 'number' ? `Synced ${processed} records` : 'Sync complete');
-        setLastSyncAt(Date.now());
-      } else {
-        setSyncMessage(`Sync failed${json?.error ? `: ${json.error}` : ''}`);
+      // Refresh is an admin-only background job: enqueue it, then poll until it finishes.
+      const { data: job } = await api.post("/admin/pipeline/refresh");
+      const jobId = job?.job_id;
+      if (typeof jobId !== "number") {
+        setSyncMessage("Sync failed: no job id returned");
+        return;
       }
+      setSyncMessage("Sync queued…");
+      const deadline = Date.now() + 5 * 60_000;
+      while (Date.now() < deadline) {
+        await new Promise((resolve) => setTimeout(resolve, 2000));
+        const { data: status } = await api.get(`/admin/pipeline/refresh/${jobId}`);
+        if (!status?.done) {
+          setSyncMessage(status?.stage ? `Syncing (${status.stage})…` : "Sync queued…");
+          continue;
+        }
+        if (status.status === "succeeded") {
+          setSyncMessage(`Synced ${status.processed ?? 0} records`);
+          setLastSyncAt(Date.now());
+        } else {
+          const reason = status?.run?.error;
+          setSyncMessage(`Sync ${status.status}${reason ? `: ${reason}` : ""}`);
+        }
+        return;
+      }
+      setSyncMessage("Sync still running; check again later");
     } catch (e: unknown) {
       setSyncMessage(`Sync error: ${getErrorMessage(e, "unknown error")}`);
     } finally {
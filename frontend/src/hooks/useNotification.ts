@@ -32,7 +32,7 @@ export const useNotifications = () => {
   const fetchNotifications = async () => {
     try {
       setIsLoading(true);
-      const response = await api.get<Notification[]>("/notifications");
+      const response = await api.get<Notification[]>("/admin/notifications");
       setNotifications(response.data || []);
     } catch (err) {
       setError((err as Error).message);